@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/logging"
+	"github.com/djheidihoe/1brc/internal/output"
+	"github.com/djheidihoe/1brc/pkg/brc"
+	"github.com/djheidihoe/1brc/pkg/strategy"
+)
+
+// benchReport is the JSON report of a bench run.
+type benchReport struct {
+	Time        time.Time `json:"time"`
+	Environment benchEnv  `json:"environment"`
+	Iterations  int       `json:"iterations"`
+	Warmup      int       `json:"warmup"`
+	// DropCaches reports whether the input was evicted from the page cache
+	// before every run, for cold cache numbers.
+	DropCaches bool `json:"drop_caches,omitempty"`
+	// Storage is the simulated storage of every run, if any.
+	Storage *simulatedStorage `json:"simulated_storage,omitempty"`
+	Results []benchResult     `json:"results"`
+}
+
+// benchEnv describes the machine and input of a bench run.
+type benchEnv struct {
+	CPUModel   string `json:"cpu_model"`
+	CPUs       int    `json:"cpus"`
+	GOOS       string `json:"goos"`
+	GOARCH     string `json:"goarch"`
+	GoVersion  string `json:"go_version"`
+	BuildMode  string `json:"build_mode"`
+	Hostname   string `json:"hostname"`
+	Input      string `json:"input"`
+	InputBytes int64  `json:"input_bytes"`
+	// PageCacheResident is the fraction of the input in the page cache
+	// before the first iteration, -1 where it cannot be determined.
+	PageCacheResident float64 `json:"page_cache_resident"`
+}
+
+// benchResult holds the timings of one strategy.
+type benchResult struct {
+	Strategy  string          `json:"strategy"`
+	Durations []time.Duration `json:"durations_ns"`
+	Min       time.Duration   `json:"min_ns"`
+	Median    time.Duration   `json:"median_ns"`
+	Mean      time.Duration   `json:"mean_ns"`
+	Usage     benchUsage      `json:"usage"`
+}
+
+// benchUsage is the resource usage of the timed runs of a strategy, the
+// faults and switches per run on average. The peak RSS of the strategies
+// run in process is that of the bench process so far, which only grows,
+// that of -binaries is their own.
+type benchUsage struct {
+	MaxRSS              int64 `json:"max_rss_bytes"`
+	MajorFaults         int64 `json:"major_faults"`
+	MinorFaults         int64 `json:"minor_faults"`
+	VoluntarySwitches   int64 `json:"voluntary_switches"`
+	InvoluntarySwitches int64 `json:"involuntary_switches"`
+}
+
+func benchCmd(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	names := fs.String("strategies", "mmap,stream", "comma separated `list` of strategies to compare, empty for only -binaries: "+strings.Join(strategy.Names(), ", "))
+	iterations := fs.Int("iterations", 5, "timed runs per strategy")
+	warmup := fs.Int("warmup", 1, "untimed runs per strategy before the timed ones")
+	workers := fs.Int("workers", 0, "number of parallel parsers (default the CPUs, or the CPU quota of the cgroup)")
+	binaries := fs.String("binaries", "", "comma separated `list` of name=path onebrc binaries to time as well, each running onebrc run in a process of its own, e.g. pgo=./onebrc-pgo,nopgo=./onebrc-nopgo")
+	jsonPath := fs.String("json", "-", "write the JSON report to `path` (- for stdout)")
+	baselinePath := fs.String("baseline", "", "compare the medians against the JSON report at `path` of an earlier run")
+	drop := fs.Bool("drop-caches", false, "evict the input from the page cache before every run, warmup included, to time cold cache runs: posix_fadvise on Linux, falling back to the root-only /proc/sys/vm/drop_caches for the pages it cannot drop, and the purge command on macOS")
+	mlock := fs.Bool("mlock", false, "lock the mapped input into memory before the parse of every run, binaries included, see onebrc run -mlock")
+	simulate := storageFlags(fs)
+	maxRegression := fs.String("max-regression", "5%", "exit with status 5 if a strategy's median is more than `percent` slower than in -baseline")
+	applyGC := gcFlags(fs)
+	newLogger := logging.Flags(fs)
+	parseFlags(fs, args)
+	log := setupLogger(newLogger)
+	if err := applyGC(log); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	if *iterations < 1 || *warmup < 0 {
+		fatal("invalid arguments", usageError(errors.New("need at least one iteration and no negative warmup")))
+	}
+	limit, err := parsePercent(*maxRegression)
+	if err != nil {
+		fatal("invalid arguments", usageError(fmt.Errorf("invalid -max-regression: %w", err)))
+	}
+	storage, err := simulate()
+	if err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	var baseline *benchReport
+	if *baselinePath != "" {
+		if baseline, err = readBenchReport(*baselinePath); err != nil {
+			fatal("failed to read baseline", inputError(err), "path", *baselinePath)
+		}
+	}
+
+	path := defaultMeasurementsPath
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+	var selected []string
+	if *names != "" {
+		selected = strings.Split(*names, ",")
+	}
+	for _, name := range selected {
+		if _, ok := strategy.Lookup(name); !ok {
+			fatal("invalid arguments", usageError(fmt.Errorf("unknown strategy %q", name)))
+		}
+	}
+	bins, err := parseBinaries(*binaries)
+	if err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	if len(selected) == 0 && len(bins) == 0 {
+		fatal("invalid arguments", usageError(errors.New("no strategies or binaries to time")))
+	}
+
+	env, err := captureEnv(path)
+	if err != nil {
+		fatal("failed to inspect input", inputError(err), "input", path)
+	}
+	report := benchReport{Time: time.Now().UTC(), Environment: env, Iterations: *iterations, Warmup: *warmup, DropCaches: *drop}
+	if storage != (simulatedStorage{}) {
+		report.Storage = &storage
+	}
+	var prepare func() error
+	if *drop {
+		prepare = func() error { return dropCaches(path) }
+		if err := prepare(); err != nil {
+			fatal("failed to drop the page cache", err, "input", path)
+		}
+	}
+	for _, name := range selected {
+		cfg := brc.Config{Workers: *workers, Mlock: *mlock, Logger: log}
+		s, _ := strategy.Lookup(name)
+		s.Configure(&cfg)
+		storage.apply(&cfg)
+		res := timeRuns(log, name, *warmup, *iterations, prepare, func() (brc.Rusage, error) {
+			var summary brc.Summary
+			cfg.Summary = &summary
+			_, err := s.ProcessFile(context.Background(), path, cfg)
+			return summary.Usage, err
+		})
+		report.Results = append(report.Results, res)
+	}
+	for _, b := range bins {
+		args := []string{"run", "-workers", strconv.Itoa(*workers), path}
+		if *mlock {
+			args = slices.Insert(args, 1, "-mlock")
+		}
+		args = slices.Insert(args, 1, storage.args()...)
+		res := timeRuns(log, b.name, *warmup, *iterations, prepare, func() (brc.Rusage, error) {
+			cmd := exec.Command(b.path, args...)
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				return brc.Rusage{}, err
+			}
+			return brc.RusageOf(cmd.ProcessState), nil
+		})
+		report.Results = append(report.Results, res)
+	}
+
+	report.writeTable(os.Stderr)
+	if err := output.WriteFile(*jsonPath, report.writeJSON); err != nil {
+		fatal("failed to write report", err, "path", *jsonPath)
+	}
+	if baseline != nil {
+		if regressed := report.compare(os.Stderr, log, baseline, limit); len(regressed) > 0 {
+			err := fmt.Errorf("%s slower than the baseline by more than %v%%", strings.Join(regressed, ", "), limit)
+			fatal("performance regression", &exitError{exitRegression, err}, "baseline", *baselinePath)
+		}
+	}
+}
+
+// timeRuns times iterations calls of run after warmup untimed ones,
+// calling prepare, if set, untimed before each. run returns the resource
+// usage of the run.
+func timeRuns(log *slog.Logger, name string, warmup, iterations int, prepare func() error, run func() (brc.Rusage, error)) benchResult {
+	res := benchResult{Strategy: name}
+	for i := range warmup + iterations {
+		if prepare != nil {
+			if err := prepare(); err != nil {
+				fatal("failed to drop the page cache", err, "strategy", name)
+			}
+		}
+		start := time.Now()
+		u, err := run()
+		if err != nil {
+			fatal("failed to process input", inputError(err), "strategy", name)
+		}
+		if d := time.Since(start); i >= warmup {
+			res.Durations = append(res.Durations, d)
+			res.Usage.add(u)
+			log.Info("iteration finished", "strategy", name, "iteration", i-warmup, "duration", d, "major_faults", u.MajorFaults, "minor_faults", u.MinorFaults)
+		}
+	}
+	res.summarize()
+	return res
+}
+
+// benchBinary is an onebrc binary timed by bench -binaries.
+type benchBinary struct {
+	name, path string
+}
+
+// parseBinaries parses a -binaries list "name=path,...". A path without a
+// name is named after its file.
+func parseBinaries(s string) ([]benchBinary, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var bins []benchBinary
+	for _, item := range strings.Split(s, ",") {
+		name, path, ok := strings.Cut(item, "=")
+		if !ok {
+			name, path = filepath.Base(item), item
+		}
+		if name == "" || path == "" {
+			return nil, fmt.Errorf("invalid binary %q, expected name=path", item)
+		}
+		if _, ok := strategy.Lookup(name); ok {
+			return nil, fmt.Errorf("binary name %q is a strategy", name)
+		}
+		bins = append(bins, benchBinary{name, path})
+	}
+	return bins, nil
+}
+
+// summarize fills the statistics of the durations of r.
+func (r *benchResult) summarize() {
+	sorted := slices.Clone(r.Durations)
+	slices.Sort(sorted)
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	r.Min = sorted[0]
+	r.Median = sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		r.Median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+	r.Mean = sum / time.Duration(len(sorted))
+	n := int64(len(sorted))
+	r.Usage.MajorFaults /= n
+	r.Usage.MinorFaults /= n
+	r.Usage.VoluntarySwitches /= n
+	r.Usage.InvoluntarySwitches /= n
+}
+
+// add adds the usage of a run to the totals of u.
+func (u *benchUsage) add(run brc.Rusage) {
+	u.MaxRSS = max(u.MaxRSS, run.MaxRSS)
+	u.MajorFaults += run.MajorFaults
+	u.MinorFaults += run.MinorFaults
+	u.VoluntarySwitches += run.VoluntarySwitches
+	u.InvoluntarySwitches += run.InvoluntarySwitches
+}
+
+// storage returns the simulated storage of r, the zero value if none.
+func (r *benchReport) storage() simulatedStorage {
+	if r.Storage == nil {
+		return simulatedStorage{}
+	}
+	return *r.Storage
+}
+
+func (r *benchReport) writeTable(w io.Writer) {
+	cache := "warm"
+	if r.DropCaches {
+		cache = "cold"
+	}
+	fmt.Fprintf(w, "%s build, %s %s/%s, %s page cache", r.Environment.BuildMode, r.Environment.GoVersion, r.Environment.GOOS, r.Environment.GOARCH, cache)
+	if r.Storage != nil {
+		fmt.Fprintf(w, ", simulated storage of %v", *r.Storage)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "strategy\tmin\tmedian\tmean\titerations\tmax rss\tmajor faults\tminor faults\n")
+	for _, res := range r.Results {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t%d\t%s\t%d\t%d\n", res.Strategy, res.Min.Round(time.Microsecond), res.Median.Round(time.Microsecond), res.Mean.Round(time.Microsecond), len(res.Durations),
+			formatBytes(res.Usage.MaxRSS), res.Usage.MajorFaults, res.Usage.MinorFaults)
+	}
+	tw.Flush()
+}
+
+func (r *benchReport) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// captureEnv describes the machine and the input at path.
+func captureEnv(path string) (benchEnv, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return benchEnv{}, err
+	}
+	host, _ := os.Hostname()
+	resident, err := pageCacheResident(path)
+	if err != nil {
+		resident = -1
+	}
+	return benchEnv{
+		CPUModel:          cpuModel(),
+		CPUs:              runtime.NumCPU(),
+		GOOS:              runtime.GOOS,
+		GOARCH:            runtime.GOARCH,
+		GoVersion:         runtime.Version(),
+		BuildMode:         brc.BuildMode,
+		Hostname:          host,
+		Input:             path,
+		InputBytes:        fi.Size(),
+		PageCacheResident: resident,
+	}, nil
+}
+
+func readBenchReport(path string) (*benchReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r benchReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// compare writes the change of each strategy's median against baseline to w
+// and returns the strategies that are more than limit percent slower.
+// Strategies missing from baseline are reported but never regress.
+func (r *benchReport) compare(w io.Writer, log *slog.Logger, baseline *benchReport, limit float64) (regressed []string) {
+	if r.Environment.CPUModel != baseline.Environment.CPUModel || r.Environment.InputBytes != baseline.Environment.InputBytes {
+		log.Warn("baseline was measured on another machine or input",
+			"baseline_cpu", baseline.Environment.CPUModel, "baseline_input_bytes", baseline.Environment.InputBytes)
+	}
+	if r.DropCaches != baseline.DropCaches {
+		log.Warn("baseline was measured with another page cache state, compare cold with cold and warm with warm runs",
+			"drop_caches", r.DropCaches, "baseline_drop_caches", baseline.DropCaches)
+	}
+	if r.storage() != baseline.storage() {
+		log.Warn("baseline was measured on other simulated storage",
+			"storage", r.storage(), "baseline_storage", baseline.storage())
+	}
+	old := map[string]time.Duration{}
+	for _, res := range baseline.Results {
+		old[res.Strategy] = res.Median
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "strategy\tbaseline\tmedian\tchange\tverdict\n")
+	for _, res := range r.Results {
+		base, ok := old[res.Strategy]
+		if !ok || base <= 0 {
+			fmt.Fprintf(tw, "%s\t-\t%v\t-\tnot in baseline\n", res.Strategy, res.Median.Round(time.Microsecond))
+			continue
+		}
+		change := 100 * (float64(res.Median) - float64(base)) / float64(base)
+		verdict := "ok"
+		if change > limit {
+			verdict = "REGRESSION"
+			regressed = append(regressed, res.Strategy)
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%+.1f%%\t%s\n", res.Strategy, base.Round(time.Microsecond), res.Median.Round(time.Microsecond), change, verdict)
+	}
+	tw.Flush()
+	return regressed
+}
+
+// parsePercent parses a percentage such as 5% or 2.5, the % sign being
+// optional.
+func parsePercent(s string) (float64, error) {
+	p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 {
+		return 0, fmt.Errorf("negative percentage %q", s)
+	}
+	if math.IsNaN(p) {
+		// no change would exceed it
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+	return p, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpuModel returns the CPU brand, e.g. "Apple M2".
+func cpuModel() string {
+	s, err := unix.Sysctl("machdep.cpu.brand_string")
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// pageCacheResident is unknown, macOS has no mincore in x/sys/unix.
+func pageCacheResident(string) (float64, error) {
+	return 0, errors.New("page cache residency unavailable")
+}
+
+// dropCaches purges the disk cache of the whole host with purge(8), macOS
+// having no way to evict the pages of a single file. Recent releases need
+// it run as root.
+func dropCaches(string) error {
+	if out, err := exec.Command("purge").CombinedOutput(); err != nil {
+		return fmt.Errorf("purge: %w: %s", err, out)
+	}
+	return nil
+}
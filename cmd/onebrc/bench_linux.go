@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpuModel returns the model name of the first CPU in /proc/cpuinfo.
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		// x86 reports a model name, arm64 only a CPU part
+		switch strings.TrimSpace(key) {
+		case "model name", "Model", "Hardware":
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// pageCacheResident returns the fraction of the pages of the file at path
+// that are in the page cache, which tells cold from warm runs apart.
+func pageCacheResident(path string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fi.Size() == 0 {
+		return 1, nil
+	}
+	data, err := unix.Mmap(int(f.Fd()), 0, int(fi.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return 0, err
+	}
+	defer unix.Munmap(data)
+
+	page := os.Getpagesize()
+	vec := make([]byte, (len(data)+page-1)/page)
+	_, _, errno := unix.Syscall(unix.SYS_MINCORE, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&vec[0])))
+	if errno != 0 {
+		return 0, errno
+	}
+	resident := 0
+	for _, v := range vec {
+		resident += int(v & 1)
+	}
+	return float64(resident) / float64(len(vec)), nil
+}
+
+// dropCachesSysctl is the knob that drops the clean page cache of the whole
+// host, see Documentation/admin-guide/sysctl/vm.rst. Writing it needs root.
+const dropCachesSysctl = "/proc/sys/vm/drop_caches"
+
+// dropCaches evicts the pages of the file at path from the page cache with
+// posix_fadvise(POSIX_FADV_DONTNEED). The kernel keeps the pages that other
+// processes map or that are dirty, in which case the page cache of the whole
+// host is dropped with the drop_caches sysctl, as root.
+func dropCaches(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("fadvise: %w", err)
+	}
+	if resident, err := pageCacheResident(path); err != nil || resident < 0.01 {
+		return nil
+	}
+	unix.Sync()
+	if err := os.WriteFile(dropCachesSysctl, []byte("1"), 0); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("pages of %s stay cached, mapped by another process, and dropping the host's page cache with %s needs root", path, dropCachesSysctl)
+		}
+		return err
+	}
+	return nil
+}
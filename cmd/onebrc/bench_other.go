@@ -0,0 +1,22 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// cpuModel is unknown on other systems.
+func cpuModel() string {
+	return ""
+}
+
+// pageCacheResident is unknown on other systems.
+func pageCacheResident(string) (float64, error) {
+	return 0, errors.New("page cache residency unavailable")
+}
+
+// dropCaches fails on other systems, where bench has no way to evict the
+// page cache on, so that -drop-caches stops instead of reporting warm runs
+// as cold.
+func dropCaches(string) error {
+	return errors.New("dropping the page cache is only supported on Linux and macOS")
+}
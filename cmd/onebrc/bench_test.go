@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestParsePercent(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"5%", 5, true},
+		{" 2.5 ", 2.5, true},
+		{"0", 0, true},
+		{"-1%", 0, false},
+		{"NaN", 0, false},
+		{"nan%", 0, false},
+		{"five", 0, false},
+		{"", 0, false},
+	} {
+		got, err := parsePercent(tt.in)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("parsePercent(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// chartWidth is the width of the longest bar of -chart.
+const chartWidth = 40
+
+// writeCharts draws horizontal bar charts of the n hottest stations of res
+// by mean and of the n stations with the most readings to w, for a quick
+// look in the terminal.
+func writeCharts(w io.Writer, res *brc.Result, n int) error {
+	type station struct {
+		name  string
+		stats brc.Stats
+	}
+	stations := make([]station, 0, res.Len())
+	for name, s := range res.Sorted() {
+		stations = append(stations, station{name, s})
+	}
+	top := func(by func(brc.Stats) float64) (names []string, values []float64) {
+		slices.SortStableFunc(stations, func(a, b station) int { return cmp.Compare(by(b.stats), by(a.stats)) })
+		for _, s := range stations[:min(n, len(stations))] {
+			names, values = append(names, s.name), append(values, by(s.stats))
+		}
+		return names, values
+	}
+
+	var b strings.Builder
+	names, values := top(brc.Stats.Mean)
+	fmt.Fprintf(&b, "mean temperature, %d hottest stations\n", len(names))
+	drawBars(&b, names, values, 1)
+	names, values = top(func(s brc.Stats) float64 { return float64(s.Count) })
+	fmt.Fprintf(&b, "\nreadings, %d stations with the most\n", len(names))
+	drawBars(&b, names, values, 0)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// drawBars writes a bar per name for its value, with prec decimals. With
+// negative values the bars extend left and right of a zero axis.
+func drawBars(b *strings.Builder, names []string, values []float64, prec int) {
+	width, extent, negative := 0, 0.0, false
+	for i, name := range names {
+		width = max(width, min(len([]rune(name)), 24))
+		extent = max(extent, math.Abs(values[i]))
+		negative = negative || values[i] < 0
+	}
+	half := chartWidth
+	if negative {
+		half = chartWidth / 2
+	}
+	for i, name := range names {
+		n := 0
+		if extent > 0 {
+			n = int(math.Round(math.Abs(values[i]) / extent * float64(half)))
+		}
+		fmt.Fprintf(b, "%-*.*s ", width, width, name)
+		switch {
+		case !negative:
+			b.WriteString(strings.Repeat("#", n))
+		case values[i] < 0:
+			b.WriteString(strings.Repeat(" ", half-n) + strings.Repeat("#", n) + "|" + strings.Repeat(" ", half))
+		default:
+			b.WriteString(strings.Repeat(" ", half) + "|" + strings.Repeat("#", n) + strings.Repeat(" ", half-n))
+		}
+		fmt.Fprintf(b, " %s\n", strconv.FormatFloat(values[i], 'f', prec, 64))
+	}
+}
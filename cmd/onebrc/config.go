@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loadConfigFile sets the flags of fs that are not given on the command line
+// from the config file at path, and returns its input path, if any. The file
+// holds one setting per line, named like the flags with - or _, in YAML
+//
+//	input: measurements.txt
+//	workers: 8
+//	io: stream
+//	cache_dir: /var/cache/onebrc
+//
+// or, for .toml files, in TOML ("workers = 8"). Comments, a YAML document
+// marker and TOML table headers are ignored, nesting is not supported.
+func loadConfigFile(fs *flag.FlagSet, path string) (input string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sep := ":"
+	if filepath.Ext(path) == ".toml" {
+		sep = "="
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line == "---" || line[0] == '#' || line[0] == '[' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			return "", fmt.Errorf("%s:%d: expected key%s value", path, n, sep)
+		}
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		if value, err = configValue(strings.TrimSpace(value)); err != nil {
+			return "", fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+
+		if key == "input" {
+			input = value
+			continue
+		}
+		if fs.Lookup(key) == nil {
+			return "", fmt.Errorf("%s:%d: unknown setting %q", path, n, key)
+		}
+		if set[key] {
+			continue // the command line wins
+		}
+		if err := fs.Set(key, value); err != nil {
+			return "", fmt.Errorf("%s:%d: %s: %v", path, n, key, err)
+		}
+	}
+	return input, sc.Err()
+}
+
+// envPrefix starts the environment variables read by loadEnv.
+const envPrefix = "ONEBRC_"
+
+// loadEnv sets the flags of fs that are not given on the command line from
+// environment variables named like them, e.g. ONEBRC_WORKERS for -workers
+// and ONEBRC_OUTPUT_FORMAT for -output-format, and returns ONEBRC_INPUT. It
+// runs before loadConfigFile, so the environment overrides a config file
+// (which ONEBRC_CONFIG may name) and the command line overrides both.
+func loadEnv(fs *flag.FlagSet) (input string, err error) {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		value, ok := os.LookupEnv(name)
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if serr := fs.Set(f.Name, value); serr != nil {
+			err = fmt.Errorf("%s: %v", name, serr)
+		}
+	})
+	return os.Getenv(envPrefix + "INPUT"), err
+}
+
+// configValue unquotes a config file value or drops its trailing comment.
+func configValue(v string) (string, error) {
+	if len(v) > 0 && (v[0] == '"' || v[0] == '\'') {
+		end := strings.LastIndexByte(v, v[0])
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", v)
+		}
+		if v[0] == '\'' {
+			return v[1:end], nil
+		}
+		return strconv.Unquote(v[:end+1])
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFlags returns a flag set with some of the flags of run, parsed from
+// args.
+func testFlags(t *testing.T, args ...string) (*flag.FlagSet, *int, *string, *string) {
+	t.Helper()
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	workers := fs.Int("workers", 0, "")
+	io := fs.String("io", "", "")
+	cacheDir := fs.String("cache-dir", "", "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs, workers, io, cacheDir
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name, file               string
+		args                     []string
+		input, io, cacheDir, err string
+		workers                  int
+	}{
+		{name: "config.yaml", file: "---\n# run settings\ninput: measurements.txt\nworkers: 8\nio: stream # the default\ncache_dir: '/var/cache/onebrc'\n", input: "measurements.txt", workers: 8, io: "stream", cacheDir: "/var/cache/onebrc"},
+		{name: "config.toml", file: "[run]\nworkers = 4\nio = \"pipeline\"\n", workers: 4, io: "pipeline"},
+		{name: "flags.yaml", file: "workers: 8\nio: stream\n", args: []string{"-workers", "2"}, workers: 2, io: "stream"},
+		{name: "unknown.yaml", file: "threads: 8\n", err: `unknown.yaml:1: unknown setting "threads"`},
+		{name: "separator.toml", file: "workers: 8\n", err: "separator.toml:1: expected key= value"},
+		{name: "value.yaml", file: "\nworkers: eight\n", err: "value.yaml:2: workers:"},
+		{name: "quote.yaml", file: "io: \"stream\n", err: "quote.yaml:1: unterminated string"},
+	} {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fs, workers, io, cacheDir := testFlags(t, tt.args...)
+		input, err := loadConfigFile(fs, path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, expected %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || input != tt.input || *workers != tt.workers || *io != tt.io || *cacheDir != tt.cacheDir {
+			t.Errorf("%s: input %q, workers %d, io %q, cache-dir %q, %v", tt.name, input, *workers, *io, *cacheDir, err)
+		}
+	}
+	if _, err := loadConfigFile(flag.NewFlagSet("run", flag.ContinueOnError), filepath.Join(dir, "missing.yaml")); !os.IsNotExist(err) {
+		t.Errorf("missing config file: %v", err)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("ONEBRC_INPUT", "measurements.txt")
+	t.Setenv("ONEBRC_WORKERS", "8")
+	t.Setenv("ONEBRC_IO", "stream")
+	t.Setenv("ONEBRC_CACHE_DIR", "/tmp/cache")
+	fs, workers, io, cacheDir := testFlags(t, "-io", "mmap")
+	input, err := loadEnv(fs)
+	if err != nil || input != "measurements.txt" || *workers != 8 || *io != "mmap" || *cacheDir != "/tmp/cache" {
+		t.Errorf("loadEnv: input %q, workers %d, io %q, cache-dir %q, %v", input, *workers, *io, *cacheDir, err)
+	}
+
+	t.Setenv("ONEBRC_WORKERS", "eight")
+	fs, _, _, _ = testFlags(t)
+	if _, err := loadEnv(fs); err == nil || !strings.HasPrefix(err.Error(), "ONEBRC_WORKERS:") {
+		t.Errorf("loadEnv with ONEBRC_WORKERS=eight: %v", err)
+	}
+}
+
+func TestConfigValue(t *testing.T) {
+	for _, tt := range []struct{ in, want, err string }{
+		{in: "stream", want: "stream"},
+		{in: "stream # comment", want: "stream"},
+		{in: "a#b", want: "a#b"},
+		{in: `"a # b"`, want: "a # b"},
+		{in: `"tab\t"`, want: "tab\t"},
+		{in: `'raw\t' # comment`, want: `raw\t`},
+		{in: `"open`, err: "unterminated string"},
+		{in: `'`, err: "unterminated string"},
+		{in: "", want: ""},
+	} {
+		got, err := configValue(tt.in)
+		if got != tt.want || (err == nil) != (tt.err == "") || (err != nil && !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("configValue(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/djheidihoe/1brc/internal/output"
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// loadDictionary reads the -dict station dictionary at path, an empty one
+// if there is no file yet.
+func loadDictionary(path string) (*brc.Dictionary, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return brc.NewDictionary(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return brc.ReadDictionary(f)
+}
+
+// saveDictionary writes d back to path unless the run added no stations to
+// the loaded stations, in its CSV form for a .csv path.
+func saveDictionary(path string, d *brc.Dictionary, loaded int) error {
+	if d.Len() == loaded {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return output.WriteFile(path, d.WriteCSV)
+	}
+	return output.WriteFile(path, d.Write)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// Exit statuses of onebrc, so that wrappers and the bench harness can tell
+// failures apart.
+const (
+	exitOK        = 0
+	exitUsage     = 1 // invalid flags, environment or config file
+	exitInput     = 2 // missing, unreadable or invalid input
+	exitMalformed = 3 // malformed lines with -strict
+	exitInternal  = 4 // anything else, such as a failed write
+	// exitRegression is bench's status for a regression against -baseline.
+	exitRegression = 5
+	// exitAlert is run's status when rules of -alerts hold.
+	exitAlert = 6
+)
+
+// exitError is an error that ends onebrc with a given status.
+type exitError struct {
+	status int
+	err    error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func usageError(err error) error { return &exitError{exitUsage, err} }
+func inputError(err error) error { return &exitError{exitInput, err} }
+
+// exitStatus returns the status err ends onebrc with: exitMalformed for
+// brc.ErrMalformed, exitInternal for brc.ErrAudit, that of a failed onebrc
+// binary run by bench, that of the outermost exitError, and exitInternal
+// otherwise.
+func exitStatus(err error) int {
+	var ee *exitError
+	var xe *exec.ExitError
+	switch {
+	case errors.Is(err, brc.ErrMalformed):
+		return exitMalformed
+	case errors.Is(err, brc.ErrAudit):
+		return exitInternal
+	case errors.As(err, &xe) && xe.ExitCode() > 0:
+		return xe.ExitCode()
+	case errors.As(err, &ee):
+		return ee.status
+	}
+	return exitInternal
+}
+
+// parseFlags parses args into fs, which must be flag.ContinueOnError. fs
+// reports invalid flags itself, and parseFlags exits with exitUsage after
+// them or exitOK after -h.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	switch err := fs.Parse(args); {
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(exitOK)
+	case err != nil:
+		os.Exit(exitUsage)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/djheidihoe/1brc/internal/output"
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// extra is an optional per-station report, written to its own path next to
+// the results.
+type extra struct {
+	flag, usage, what string
+	enable            func(*brc.Config)
+	write             func(*brc.Result, io.Writer) error
+	path              string
+}
+
+func extraFlags(fs *flag.FlagSet) []*extra {
+	sigmas := fs.Float64("anomaly-sigmas", 4, "with -anomalies, flag stations whose min or max is more than `k` standard deviations from their mean")
+	extras := []*extra{
+		{
+			flag:   "extremes",
+			usage:  "record where each station's min and max were read and write their line numbers and byte offsets to `path` (- for stdout)",
+			what:   "extremes",
+			enable: func(c *brc.Config) { c.Provenance = true },
+			write:  (*brc.Result).WriteExtremes,
+		},
+		{
+			flag:   "distinct",
+			usage:  "count the distinct readings of each station and write them to `path` (- for stdout)",
+			what:   "distinct counts",
+			enable: func(c *brc.Config) { c.Distinct = true },
+			write:  (*brc.Result).WriteDistinct,
+		},
+		{
+			flag:   "anomalies",
+			usage:  "write the stations whose min or max lies implausibly far from their mean, see -anomaly-sigmas, with their standard deviation to `path` (- for stdout)",
+			what:   "anomalies",
+			enable: func(c *brc.Config) { c.Moments = true },
+			write:  func(r *brc.Result, w io.Writer) error { return r.WriteAnomalies(w, *sigmas) },
+		},
+		{
+			flag:   "percentiles",
+			usage:  "write each station's p50, p90 and p99 to `path` (- for stdout), estimated with t-digests or exact with -frequencies",
+			what:   "percentiles",
+			enable: func(c *brc.Config) { c.Percentiles = true },
+			write:  (*brc.Result).WritePercentiles,
+		},
+		{
+			flag:   "frequencies",
+			usage:  "count each station's readings per value (8KB per station and worker) and write the table to `path` (- for stdout)",
+			what:   "frequencies",
+			enable: func(c *brc.Config) { c.Frequencies = true },
+			write:  (*brc.Result).WriteFrequencies,
+		},
+	}
+	for _, e := range extras {
+		fs.StringVar(&e.path, e.flag, "", e.usage)
+	}
+	return extras
+}
+
+// enableExtras sets up cfg for the requested reports. They need the final
+// result, so streamed windows cannot have them.
+func enableExtras(extras []*extra, cfg *brc.Config) error {
+	for _, e := range extras {
+		if e.path == "" {
+			continue
+		}
+		if cfg.Window.Emit != nil {
+			return fmt.Errorf("-%s cannot be combined with streamed -window output", e.flag)
+		}
+		e.enable(cfg)
+	}
+	return nil
+}
+
+func writeExtras(extras []*extra, res *brc.Result) {
+	for _, e := range extras {
+		if e.path == "" {
+			continue
+		}
+		if err := output.WriteFile(e.path, func(w io.Writer) error { return e.write(res, w) }); err != nil {
+			fatal("failed to write "+e.what, err, "path", e.path)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/djheidihoe/1brc/internal/cgroup"
+)
+
+// defaultGOGC trades memory for fewer collections: the heap is dominated by
+// short-lived per-worker maps and read buffers (none at all with mmap), so
+// collecting at the usual 100% growth only burns CPU on garbage the run
+// drops as a whole anyway.
+const defaultGOGC = 400
+
+// memoryLimitFraction of physical memory is the default soft limit, which
+// keeps the raised GOGC (or a disabled collector) from running into swap.
+const memoryLimitFraction = 0.75
+
+// gcFlags registers the GC tuning flags on fs. The returned function applies
+// them once fs is parsed. GOGC and GOMEMLIMIT from the environment take
+// precedence over the defaults, but not over explicitly set flags.
+func gcFlags(fs *flag.FlagSet) func(log *slog.Logger) error {
+	gogc := fs.Int("gogc", defaultGOGC, "garbage collection target `percent`, negative turns the collector off")
+	limit := fs.String("memory-limit", "auto", "soft memory `limit` such as 8GiB, auto (75% of physical memory or of the cgroup limit) or off")
+	return func(log *slog.Logger) error {
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+		if set["gogc"] || os.Getenv("GOGC") == "" {
+			debug.SetGCPercent(*gogc)
+		}
+		if set["memory-limit"] || os.Getenv("GOMEMLIMIT") == "" {
+			n, err := parseMemoryLimit(*limit)
+			if err != nil {
+				return err
+			}
+			debug.SetMemoryLimit(n)
+		}
+		log.Debug("gc configured", "gogc", gcPercentString(), "memory_limit", debug.SetMemoryLimit(-1))
+		return nil
+	}
+}
+
+// parseMemoryLimit parses a -memory-limit value into bytes, math.MaxInt64
+// meaning no limit.
+func parseMemoryLimit(s string) (int64, error) {
+	switch s {
+	case "off", "none":
+		return math.MaxInt64, nil
+	case "auto":
+		total := memoryBudget()
+		if total == 0 {
+			return math.MaxInt64, nil
+		}
+		return int64(float64(total) * memoryLimitFraction), nil
+	}
+	n, err := parseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit %q: %w", s, err)
+	}
+	return n, nil
+}
+
+// parseBytes parses a byte count with an optional B, KB..TB (powers of 1000)
+// or KiB..TiB (powers of 1024) suffix.
+func parseBytes(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"B", 1},
+	}
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSuffix(s, u.suffix), u.mult
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	if f < 0 || f*float64(mult) >= math.MaxInt64 {
+		return 0, fmt.Errorf("out of range")
+	}
+	return int64(f * float64(mult)), nil
+}
+
+// memoryBudget returns the memory the process may use, the physical memory
+// or the lower limit of its cgroup, 0 if neither is known.
+func memoryBudget() int64 {
+	limit := cgroup.Read().Memory
+	total, err := physicalMemory()
+	if err != nil || total == 0 || limit > 0 && limit < int64(total) {
+		return limit
+	}
+	return int64(total)
+}
+
+// physicalMemory returns the total memory of the machine from /proc/meminfo,
+// so it is only known on Linux.
+func physicalMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			return kb << 10, err
+		}
+	}
+	return 0, sc.Err()
+}
+
+func gcPercentString() string {
+	p := debug.SetGCPercent(100)
+	debug.SetGCPercent(p)
+	if p < 0 {
+		return "off"
+	}
+	return strconv.Itoa(p)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/logging"
+	"github.com/djheidihoe/1brc/internal/output"
+	"github.com/djheidihoe/1brc/internal/testdata"
+)
+
+// generateCmd writes a random measurements file, or shards of one, so that
+// inputs of any size can be made without the Java generator.
+func generateCmd(args []string) {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	lines := fs.Int64("lines", 1_000_000_000, "number of lines to write, or to add with -append")
+	stations := fs.Int("stations", 413, "number of distinct stations, e.g. 10000 for the 10K key set")
+	maxName := fs.Int("max-name", 24, "longest station name in bytes, at most 100")
+	names := fs.String("names", string(testdata.RandomNames), "station names: random, long, all -max-name bytes of multi-byte UTF-8, or fnv-collide, sharing the low 16 bits of their FNV-1a hash to stress hash tables")
+	zipf := fs.Float64("zipf", 0, "draw stations with Zipfian frequencies of exponent `s` above 1, the first station being the most frequent, instead of uniformly")
+	distribution := fs.String("distribution", string(testdata.Normal), "readings: uniform, normal around a mean of each station, java, normal like the official Java generator, σ 10 around the mean and rounded half up, or extremes, the bounds, zero and their neighbours (default java with -weather-stations)")
+	weatherStations := fs.String("weather-stations", "", "draw the stations and their means from the name;mean lines at `path`, such as the official data/weather_stations.csv, all of them unless -stations is set")
+	seed := fs.Uint64("seed", 1, "random seed, the same seed and shape giving the same lines")
+	shards := fs.Int("out-shards", 1, "split the lines over `n` files written in parallel, measurements-00.txt and so on for measurements.txt, which concatenate to the single file")
+	appendLines := fs.Bool("append", false, "add -lines lines to the existing file, continuing the lines of the same -seed and shape as if it had been generated longer")
+	injectErrors := fs.Float64("inject-errors", 0, "replace the `fraction` of lines by malformed ones, without a semicolon, without a reading, of binary garbage or overlong, counted in a manifest next to each file, path.manifest.json")
+	newLogger := logging.Flags(fs)
+	parseFlags(fs, args)
+	log := setupLogger(newLogger)
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if fs.NArg() > 1 {
+		fatal("invalid arguments", usageError(errors.New("more than one measurements file")))
+	}
+	path := defaultMeasurementsPath
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+	shape := testdata.Shape{
+		Lines:        int(*lines),
+		Stations:     *stations,
+		MaxName:      *maxName,
+		Distribution: testdata.Distribution(*distribution),
+		Names:        testdata.NameSet(*names),
+		Zipf:         *zipf,
+		Errors:       *injectErrors,
+	}
+	switch {
+	case *zipf != 0 && *zipf <= 1:
+		fatal("invalid arguments", usageError(fmt.Errorf("invalid -zipf %g, the exponent must be above 1", *zipf)))
+	case shape.Distribution != testdata.Uniform && shape.Distribution != testdata.Normal && shape.Distribution != testdata.Java && shape.Distribution != testdata.Extremes:
+		fatal("invalid arguments", usageError(fmt.Errorf("unknown distribution %q", *distribution)))
+	case shape.Names != testdata.RandomNames && shape.Names != testdata.LongNames && shape.Names != testdata.CollidingNames:
+		fatal("invalid arguments", usageError(fmt.Errorf("unknown names %q", *names)))
+	case *injectErrors < 0 || *injectErrors > 1:
+		fatal("invalid arguments", usageError(fmt.Errorf("invalid -inject-errors %g, the fraction must be from 0 to 1", *injectErrors)))
+	case *shards < 1:
+		fatal("invalid arguments", usageError(fmt.Errorf("invalid -out-shards %d", *shards)))
+	case *appendLines && *shards > 1:
+		fatal("invalid arguments", usageError(errors.New("-append cannot be combined with -out-shards")))
+	case (*appendLines || *shards > 1) && path == output.Stdout:
+		fatal("invalid arguments", usageError(errors.New("-append and -out-shards need a file")))
+	case *weatherStations != "" && (set["names"] || set["max-name"]):
+		fatal("invalid arguments", usageError(errors.New("-weather-stations cannot be combined with -names or -max-name")))
+	}
+	if err := shape.Validate(); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+
+	start := time.Now()
+	g := testdata.NewGenerator(*seed, shape)
+	if *weatherStations != "" {
+		stations, err := readWeatherStations(*weatherStations)
+		if err != nil {
+			fatal("failed to read weather stations", inputError(err), "path", *weatherStations)
+		}
+		if !set["stations"] {
+			shape.Stations = len(stations)
+		}
+		if !set["distribution"] {
+			shape.Distribution = testdata.Java
+		}
+		g = testdata.NewStationsGenerator(*seed, shape, stations)
+	}
+	if *appendLines {
+		from, err := countLines(path)
+		if err != nil {
+			fatal("failed to append to measurements file", inputError(err), "path", path)
+		}
+		var injected testdata.Injected
+		err = appendTo(path, func(w io.Writer) (err error) {
+			injected, err = g.WriteLines(w, from, from+*lines)
+			return err
+		})
+		if err != nil {
+			fatal("failed to append to measurements file", err, "path", path)
+		}
+		if *injectErrors > 0 {
+			// the manifest of the lines before, if they had any malformed
+			m, err := readManifest(path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				fatal("failed to read manifest", inputError(err), "path", path+manifestSuffix)
+			}
+			m.Seed, m.Rate, m.Lines = *seed, *injectErrors, from+*lines
+			m.Kinds.Add(injected)
+			m.Malformed = m.Kinds.Total()
+			if err := writeManifest(path, m); err != nil {
+				fatal("failed to write manifest", err, "path", path+manifestSuffix)
+			}
+		}
+		log.Info("appended measurements", "path", path, "from", from, "lines", *lines, "malformed", injected.Total(), "duration", time.Since(start))
+		return
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, *shards)
+	injected := make([]testdata.Injected, *shards)
+	limit := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i := range *shards {
+		from, to := *lines*int64(i)/int64(*shards), *lines*int64(i+1)/int64(*shards)
+		wg.Go(func() {
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			p := shardPath(path, i, *shards)
+			errs[i] = output.WriteFile(p, func(w io.Writer) (err error) {
+				injected[i], err = g.WriteLines(w, from, to)
+				return err
+			})
+			if errs[i] == nil && *injectErrors > 0 && path != output.Stdout {
+				errs[i] = writeManifest(p, manifest{*seed, *injectErrors, to - from, injected[i].Total(), injected[i]})
+			}
+		})
+	}
+	wg.Wait()
+	var malformed int64
+	for i, err := range errs {
+		if err != nil {
+			fatal("failed to write measurements file", err, "path", shardPath(path, i, *shards))
+		}
+		malformed += injected[i].Total()
+	}
+	log.Info("generated measurements", "path", path, "shards", *shards, "lines", *lines, "malformed", malformed, "duration", time.Since(start))
+}
+
+// manifestSuffix is the suffix of the manifest of a measurements file
+// generated with -inject-errors.
+const manifestSuffix = ".manifest.json"
+
+// manifest describes the malformed lines -inject-errors put into a file, to
+// check the malformed line counts of run and -strict against.
+type manifest struct {
+	Seed uint64  `json:"seed"`
+	Rate float64 `json:"rate"`
+	// Lines counts all lines, the malformed ones included.
+	Lines     int64             `json:"lines"`
+	Malformed int64             `json:"malformed"`
+	Kinds     testdata.Injected `json:"kinds"`
+}
+
+// readManifest reads the manifest of the measurements file at path.
+func readManifest(path string) (manifest, error) {
+	var m manifest
+	data, err := os.ReadFile(path + manifestSuffix)
+	if err != nil {
+		return m, err
+	}
+	return m, json.Unmarshal(data, &m)
+}
+
+// writeManifest writes m as the manifest of the measurements file at path.
+func writeManifest(path string, m manifest) error {
+	return output.WriteFile(path+manifestSuffix, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+}
+
+// shardPath returns the path of shard i of n of the file at path, path
+// itself for a single shard.
+func shardPath(path string, i, n int) string {
+	if n == 1 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%0*d%s", strings.TrimSuffix(path, ext), len(fmt.Sprint(n-1)), i, ext)
+}
+
+// countLines returns the number of lines of the file at path, which must end
+// with a newline for lines to be appended.
+func countLines(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var n int64
+	last := byte('\n')
+	buf := make([]byte, 1<<20)
+	for {
+		k, err := f.Read(buf)
+		if k > 0 {
+			n += int64(bytes.Count(buf[:k], []byte{'\n'}))
+			last = buf[k-1]
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if last != '\n' {
+		return 0, errors.New("last line does not end with a newline")
+	}
+	return n, nil
+}
+
+// appendTo adds what write writes to the end of the file at path.
+func appendTo(path string, write func(io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readWeatherStations reads the -weather-stations file at path.
+func readWeatherStations(path string) ([]testdata.Station, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return testdata.ReadWeatherStations(f)
+}
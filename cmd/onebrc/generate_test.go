@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/djheidihoe/1brc/internal/testdata"
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+func TestGenerateShards(t *testing.T) {
+	dir := t.TempDir()
+	single, sharded := filepath.Join(dir, "single.txt"), filepath.Join(dir, "measurements.txt")
+	shape := []string{"-lines", "150000", "-stations", "20", "-seed", "3"}
+	generateCmd(append(shape, single))
+	generateCmd(append(shape, "-out-shards", "3", sharded))
+
+	want, err := os.ReadFile(single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for i, name := range []string{"measurements-0.txt", "measurements-1.txt", "measurements-2.txt"} {
+		shard, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the lines are split evenly, and at line ends
+		if n := bytes.Count(shard, []byte{'\n'}); n != 50000 || shard[len(shard)-1] != '\n' {
+			t.Errorf("shard %d has %d lines", i, n)
+		}
+		got = append(got, shard...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("the shards do not concatenate to the single file")
+	}
+	if _, err := os.Stat(sharded); !os.IsNotExist(err) {
+		t.Errorf("sharded output also wrote %s: %v", sharded, err)
+	}
+}
+
+func TestGenerateAppend(t *testing.T) {
+	dir := t.TempDir()
+	whole, appended := filepath.Join(dir, "whole.txt"), filepath.Join(dir, "appended.txt")
+	shape := []string{"-stations", "20", "-seed", "5"}
+	generateCmd(append(shape, "-lines", "100000", whole))
+	generateCmd(append(shape, "-lines", "70000", appended))
+	generateCmd(append(shape, "-lines", "30000", "-append", appended))
+
+	want, err := os.ReadFile(whole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(appended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("appending lines differs from generating them at once")
+	}
+}
+
+// malformed returns the number of lines of the measurements file at path
+// that run skips.
+func malformed(t *testing.T, path string) int64 {
+	t.Helper()
+	var s brc.Summary
+	if _, err := brc.ProcessFile(path, brc.Config{Summary: &s}); err != nil {
+		t.Fatal(err)
+	}
+	return s.Malformed
+}
+
+func TestGenerateManifest(t *testing.T) {
+	dir := t.TempDir()
+	path, sharded := filepath.Join(dir, "measurements.txt"), filepath.Join(dir, "sharded.txt")
+	shape := []string{"-stations", "20", "-seed", "9", "-inject-errors", "0.01"}
+	generateCmd(append(shape, "-lines", "60000", path))
+	m, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := m.Kinds
+	if m.Seed != 9 || m.Rate != 0.01 || m.Lines != 60000 || m.Malformed != k.Total() ||
+		k.MissingSemicolon == 0 || k.EmptyValue == 0 || k.Garbage == 0 || k.Overlong == 0 {
+		t.Fatalf("manifest = %+v", m)
+	}
+	if n := malformed(t, path); n != m.Malformed {
+		t.Errorf("run skipped %d lines, the manifest counts %d", n, m.Malformed)
+	}
+	want := fmt.Sprintf("%d %v", m.Malformed, brc.ErrMalformed)
+	if _, err := brc.ProcessFile(path, brc.Config{Strict: true}); !errors.Is(err, brc.ErrMalformed) || err.Error() != want {
+		t.Errorf("strict: %v, want %s", err, want)
+	}
+
+	// the shards have a manifest each, of the lines of the single file
+	generateCmd(append(shape, "-lines", "60000", "-out-shards", "2", sharded))
+	var lines int64
+	var kinds testdata.Injected
+	for i := range 2 {
+		shard := filepath.Join(dir, fmt.Sprintf("sharded-%d.txt", i))
+		sm, err := readManifest(shard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sm.Lines != 30000 || sm.Malformed != sm.Kinds.Total() || malformed(t, shard) != sm.Malformed {
+			t.Errorf("shard %d: manifest = %+v", i, sm)
+		}
+		lines += sm.Lines
+		kinds.Add(sm.Kinds)
+	}
+	if lines != m.Lines || kinds != m.Kinds {
+		t.Errorf("the shards have %d lines of %+v, the single file %d of %+v", lines, kinds, m.Lines, m.Kinds)
+	}
+
+	// appending adds its malformed lines to those of the manifest
+	generateCmd(append(shape, "-lines", "40000", "-append", path))
+	am, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if am.Lines != 100000 || am.Malformed <= m.Malformed || am.Malformed != am.Kinds.Total() {
+		t.Errorf("appended: manifest = %+v, was %+v", am, m)
+	}
+	if n := malformed(t, path); n != am.Malformed {
+		t.Errorf("run skipped %d lines after appending, the manifest counts %d", n, am.Malformed)
+	}
+	whole := filepath.Join(dir, "whole.txt")
+	generateCmd(append(shape, "-lines", "100000", whole))
+	if wm, err := readManifest(whole); err != nil || wm.Kinds != am.Kinds {
+		t.Errorf("appended manifest %+v, generated at once %+v, %v", am, wm, err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// hookFlags collects the expressions of the repeated -hook flag.
+type hookFlags []string
+
+func (h *hookFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *hookFlags) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+// hooks returns the brc.Hooks of the expressions of h, in order.
+func (h hookFlags) hooks() ([]brc.Hook, error) {
+	var hooks []brc.Hook
+	for _, expr := range h {
+		hook, err := parseHook(expr)
+		if err != nil {
+			return nil, fmt.Errorf("-hook %q: %w", expr, err)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// parseHook parses a -hook expression:
+//
+//	drop reading < -50.0
+//	drop reading outside -50.0..50.0
+//	drop station Las Palmas de Gran Canaria
+//	rename stations.csv
+//
+// reading compares with <, <=, >, >=, == or != and a threshold in degrees,
+// and rename reads a CSV file of from,to station lines, # starting comments,
+// an empty to dropping the station.
+func parseHook(expr string) (brc.Hook, error) {
+	verb, rest, _ := strings.Cut(strings.TrimSpace(expr), " ")
+	rest = strings.TrimSpace(rest)
+	switch verb {
+	case "rename":
+		if rest == "" {
+			return nil, fmt.Errorf("rename needs the path of a from,to CSV file")
+		}
+		names, err := readPairs(rest)
+		if err != nil {
+			return nil, err
+		}
+		return brc.Rename(names), nil
+	case "drop":
+	default:
+		return nil, fmt.Errorf("unknown hook %q, expected drop or rename", verb)
+	}
+
+	subject, cond, _ := strings.Cut(rest, " ")
+	cond = strings.TrimSpace(cond)
+	switch subject {
+	case "station":
+		if cond == "" {
+			return nil, fmt.Errorf("drop station needs a name")
+		}
+		return brc.Filter(func(station []byte, _ int32) bool { return string(station) != cond }), nil
+	case "reading":
+	default:
+		return nil, fmt.Errorf("unknown subject %q, expected reading or station", subject)
+	}
+	op, value, _ := strings.Cut(cond, " ")
+	value = strings.TrimSpace(value)
+	if op == "outside" {
+		lo, hi, ok := strings.Cut(value, "..")
+		l, err1 := parseTenths(lo)
+		h, err2 := parseTenths(hi)
+		if !ok || err1 != nil || err2 != nil || l > h {
+			return nil, fmt.Errorf("invalid range %q, expected lo..hi such as -50.0..50.0", value)
+		}
+		return brc.DropOutside(l, h), nil
+	}
+	threshold, err := parseTenths(value)
+	if err != nil {
+		return nil, err
+	}
+	var drop func(tenths int32) bool
+	switch op {
+	case "<":
+		drop = func(tenths int32) bool { return tenths < threshold }
+	case "<=":
+		drop = func(tenths int32) bool { return tenths <= threshold }
+	case ">":
+		drop = func(tenths int32) bool { return tenths > threshold }
+	case ">=":
+		drop = func(tenths int32) bool { return tenths >= threshold }
+	case "==":
+		drop = func(tenths int32) bool { return tenths == threshold }
+	case "!=":
+		drop = func(tenths int32) bool { return tenths != threshold }
+	default:
+		return nil, fmt.Errorf("unknown comparison %q, expected <, <=, >, >=, ==, != or outside", op)
+	}
+	return brc.Filter(func(_ []byte, tenths int32) bool { return !drop(tenths) }), nil
+}
+
+// parseTenths parses a reading in degrees as tenths, rounding to the nearest.
+// NaN and readings beyond ±1000, the infinities included, are invalid.
+func parseTenths(s string) (int32, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(v) || math.Abs(v) > 1000 {
+		return 0, fmt.Errorf("invalid reading %q", s)
+	}
+	return int32(math.Round(v * 10)), nil
+}
+
+// readPairs reads the CSV file at path of two fields per line, from,to
+// station renames or the id,name labels of -key-names.
+func readPairs(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 2
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	names := make(map[string]string, len(records))
+	for _, record := range records {
+		names[record[0]] = record[1]
+	}
+	return names, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTenths(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int32
+		ok   bool
+	}{
+		{"12.3", 123, true},
+		{" -50 ", -500, true},
+		{"0.05", 1, true},
+		{"1000", 10000, true},
+		{"1000.1", 0, false},
+		{"NaN", 0, false},
+		{"nan", 0, false},
+		{"Inf", 0, false},
+		{"-Inf", 0, false},
+		{"", 0, false},
+		{"12,3", 0, false},
+	} {
+		got, err := parseTenths(tt.in)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("parseTenths(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestParseHook(t *testing.T) {
+	dir := t.TempDir()
+	names := filepath.Join(dir, "names.csv")
+	if err := os.WriteFile(names, []byte("# from,to\nHamburg,Hamburg-Nord\nOslo,\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	type record struct {
+		station string
+		tenths  int32
+	}
+	records := []record{{"Hamburg", -120}, {"Oslo", -500}, {"Las Palmas de Gran Canaria", 205}, {"Abha", 499}}
+	for _, tt := range []struct {
+		expr string
+		want []record
+	}{
+		{"drop reading < -50.0", records},
+		{"drop reading <= -50.0", []record{{"Hamburg", -120}, {"Las Palmas de Gran Canaria", 205}, {"Abha", 499}}},
+		{"drop reading > 20", []record{{"Hamburg", -120}, {"Oslo", -500}}},
+		{"drop reading >= 49.9", []record{{"Hamburg", -120}, {"Oslo", -500}, {"Las Palmas de Gran Canaria", 205}}},
+		{"drop reading == -12.0", []record{{"Oslo", -500}, {"Las Palmas de Gran Canaria", 205}, {"Abha", 499}}},
+		{"  drop   reading != -12.0 ", []record{{"Hamburg", -120}}},
+		{"drop reading outside -12.0..20.5", []record{{"Hamburg", -120}, {"Las Palmas de Gran Canaria", 205}}},
+		{"drop station Las Palmas de Gran Canaria", []record{{"Hamburg", -120}, {"Oslo", -500}, {"Abha", 499}}},
+		{"rename " + names, []record{{"Hamburg-Nord", -120}, {"Las Palmas de Gran Canaria", 205}, {"Abha", 499}}},
+	} {
+		hook, err := parseHook(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		var got []record
+		for _, r := range records {
+			station, tenths, keep := hook([]byte(r.station), r.tenths)
+			if keep && len(station) > 0 {
+				got = append(got, record{string(station), tenths})
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q kept %v, expected %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"keep reading > 0",
+		"rename",
+		"rename " + filepath.Join(dir, "missing.csv"),
+		"drop",
+		"drop station",
+		"drop sensor 1",
+		"drop reading",
+		"drop reading > warm",
+		"drop reading > NaN",
+		"drop reading ~ 1.0",
+		"drop reading outside 50.0..-50.0",
+		"drop reading outside -50.0",
+		"drop reading outside NaN..1",
+	} {
+		if _, err := parseHook(expr); err == nil {
+			t.Errorf("parseHook(%q) accepted the expression", expr)
+		}
+	}
+}
+
+func TestReadPairs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pairs.csv")
+	if err := os.WriteFile(path, []byte("# id,name\n1,Hamburg\n\"2\",\"Las Palmas, Gran Canaria\"\n3,\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"1": "Hamburg", "2": "Las Palmas, Gran Canaria", "3": ""}
+	if got, err := readPairs(path); err != nil || !maps.Equal(got, want) {
+		t.Errorf("readPairs = %v, %v", got, err)
+	}
+
+	if err := os.WriteFile(path, []byte("1,Hamburg\n2,Oslo,Norway\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPairs(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("readPairs of three fields: %v", err)
+	}
+	if _, err := readPairs(filepath.Join(dir, "missing.csv")); !os.IsNotExist(err) {
+		t.Errorf("readPairs of a missing file: %v", err)
+	}
+}
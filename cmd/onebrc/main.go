@@ -0,0 +1,117 @@
+// onebrc aggregates One Billion Row Challenge measurement files.
+//
+//	onebrc [run] [flags] [measurements_file]
+//	onebrc merge [flags] partial_file...
+//	onebrc bench [flags] [measurements_file]
+//	onebrc selftest [-fixtures] [-differential n] [flags]
+//	onebrc generate [flags] [measurements_file]
+//	onebrc strategies [-json]
+//
+// run aggregates a measurements file (default measurements.txt, - for stdin)
+// and prints the results in the official format, or writes a partial
+// aggregate with -partial. Files ending in .jsonl or .ndjson are read as JSON
+// Lines and those ending in .parquet as Parquet, see -format-in. merge
+// combines partial aggregates written by run, e.g. by several machines each
+// processing a slice of the data. bench times the processing strategies and
+// writes a JSON report. selftest checks the strategies against the golden
+// fixtures bundled with the binary and on random inputs. generate writes
+// random measurements files, in parallel shards with -out-shards or growing
+// an existing one with -append. strategies lists the strategies of run
+// -strategy, bench and selftest with what each supports: mmap, streaming,
+// Windows, compressed input from a pipe and bounded memory.
+//
+// onebrc exits with status 0 on success, 1 for invalid flags, environment
+// or config file, 2 for missing or invalid input, 3 for malformed lines with
+// -strict and 4 for any other failure. bench exits with 5 when -baseline
+// shows a regression, and with the status of a failed -binaries run. run
+// exits with 6 when rules of -alerts fire, after writing the results.
+//
+// The default build is pure safe Go. Building with -tags brcfast enables the
+// fast paths of brc.BuildMode on amd64 and arm64, and bench reports which
+// build it is. Building with -tags brcnocounters leaves out the live counters
+// of -tui and -metrics, which then stay zero.
+//
+// Strategies of other packages, registered with strategy.Register, appear
+// in run, bench, selftest and strategies once linked in with a blank import
+// in this package, or, building with -tags brcplugins on Linux, FreeBSD and
+// macOS, loaded from the Go plugins that ONEBRC_PLUGINS lists.
+//
+// GOOS=wasip1 GOARCH=wasm builds a binary for WASI hosts, which reads its
+// input with the stream backend and has no CPU profiles.
+//
+// Profile-guided optimization usually gains a few percent. Record a profile
+// of a representative input where go build picks it up, build, and compare
+// against a build without it:
+//
+//	onebrc run -pgo-record cmd/onebrc/default.pgo measurements.txt >/dev/null
+//	go build -o onebrc-pgo ./cmd/onebrc
+//	go build -pgo=off -o onebrc-nopgo ./cmd/onebrc
+//	onebrc bench -strategies "" -binaries pgo=./onebrc-pgo,nopgo=./onebrc-nopgo measurements.txt
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+)
+
+const defaultMeasurementsPath = "measurements.txt"
+
+var commands = map[string]func(args []string){
+	"run":        runCmd,
+	"merge":      mergeCmd,
+	"bench":      benchCmd,
+	"selftest":   selftestCmd,
+	"generate":   generateCmd,
+	"strategies": strategiesCmd,
+}
+
+func main() {
+	args := os.Args[1:]
+	name := "run"
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			name, args = args[0], args[1:]
+		} else if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			usage()
+			return
+		}
+	}
+	if err := loadPlugins(); err != nil {
+		fatal("failed to load plugins", usageError(err))
+	}
+	commands[name](args)
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: onebrc <command> [flags] [args]\n\ncommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun \"onebrc <command> -h\" for the flags of a command\n")
+}
+
+// setupLogger builds the logger from the parsed -log-* flags and installs it
+// as the default, so fatal reports through it as well.
+func setupLogger(newLogger func() (*slog.Logger, error)) *slog.Logger {
+	log, err := newLogger()
+	if err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	slog.SetDefault(log)
+	return log
+}
+
+// fatal logs msg with err and exits with the status of err, see exitStatus.
+func fatal(msg string, err error, args ...any) {
+	status := exitStatus(err)
+	slog.Error(msg, append([]any{"err", err, "status", status}, args...)...)
+	os.Exit(status)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime/debug"
+
+	"github.com/djheidihoe/1brc/internal/cgroup"
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// checkMemory estimates the peak memory of processing the input at path
+// with cfg before the run starts. Depending on mode, off, warn or refuse,
+// it warns or fails when the heap would exceed the soft memory limit or
+// the available memory, whichever is lower. The mapped input only warrants
+// a warning, as the kernel can evict its pages.
+func checkMemory(log *slog.Logger, mode, path string, cfg brc.Config) error {
+	switch mode {
+	case "off":
+		return nil
+	case "warn", "refuse":
+	default:
+		return usageError(fmt.Errorf("unknown memory check %q, expected off, warn or refuse", mode))
+	}
+	if path == "-" {
+		log.Debug("memory check skipped, stdin cannot be probed")
+		return nil
+	}
+	e, err := brc.EstimateMemory(path, cfg)
+	if err != nil {
+		return inputError(err)
+	}
+	log.Debug("memory estimated", "stations", e.Stations, "exact", e.Exact, "heap", e.Heap(), "mapped", e.Mapped,
+		"buffers", e.Buffers, "tables", e.Tables, "interner", e.Interner, "merge", e.Merge)
+
+	available := availableMemory()
+	if limit := cgroup.Read().Memory; limit > 0 && (available == 0 || limit < available) {
+		available = limit
+	}
+	budget, what := available, "available memory"
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 && (budget == 0 || limit < budget) {
+		budget, what = limit, "memory limit"
+	}
+	if budget > 0 && e.Heap() > budget {
+		err := fmt.Errorf("the estimated peak heap of %s for %d stations exceeds the %s of %s", formatBytes(e.Heap()), e.Stations, what, formatBytes(budget))
+		if mode == "refuse" {
+			return usageError(err)
+		}
+		log.Warn("memory check failed", "err", err)
+		return nil
+	}
+	if e.Mapped > 0 && available > 0 && e.Heap()+e.Mapped > available {
+		log.Warn("the mapped input does not fit in the available memory beside the heap, its pages will be read again",
+			"mapped", formatBytes(e.Mapped), "heap", formatBytes(e.Heap()), "available", formatBytes(available))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/djheidihoe/1brc/internal/logging"
+	"github.com/djheidihoe/1brc/internal/output"
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+func mergeCmd(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	out := outputFlags(fs)
+	newLogger := logging.Flags(fs)
+	parseFlags(fs, args)
+	log := setupLogger(newLogger)
+
+	if fs.NArg() == 0 {
+		fatal("invalid arguments", usageError(errors.New("missing partial files")))
+	}
+	if err := out.check(); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+
+	res := brc.NewResult()
+	for _, path := range fs.Args() {
+		if err := readPartial(path, res); err != nil {
+			fatal("failed to merge partial aggregate", inputError(err), "path", path)
+		}
+		log.Debug("merged partial aggregate", "path", path, "stations", res.Len())
+	}
+
+	writeOutput(context.Background(), log, res, out)
+}
+
+// readPartial merges the partial aggregate at path (- for stdin) into res.
+func readPartial(path string, res *brc.Result) error {
+	if path == "-" {
+		return res.Read(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return res.Read(f)
+}
+
+// writePartial writes res to path (- for stdout) in the given encoding.
+func writePartial(path, format string, res *brc.Result) error {
+	var write func(io.Writer) error
+	switch format {
+	case "binary":
+		write = res.Write
+	case "json":
+		write = res.WriteJSON
+	default:
+		return fmt.Errorf("unknown partial format %q", format)
+	}
+
+	return output.WriteFile(path, write)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// serveMetrics serves the counters of mon at /metrics on addr for
+// Prometheus until stop is called.
+func serveMetrics(addr string, mon *brc.Monitor) (stop func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		mon.WriteMetrics(w)
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	return func() { srv.Shutdown(context.Background()) }, nil
+}
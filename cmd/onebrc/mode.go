@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// efficiencyBlockSize is the read size of the efficiency mode: fewer, larger
+// sequential reads let the storage and the CPU idle longer between them.
+const efficiencyBlockSize = 16 << 20
+
+// applyMode adjusts cfg to the -mode preset. Explicitly set flags win over
+// the preset.
+func applyMode(fs *flag.FlagSet, mode string, cfg *brc.Config) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	switch mode {
+	case "speed":
+		return nil
+	case "efficiency":
+		// minimal energy rather than minimal wall time: a few workers on
+		// the efficiency cores finish the work at a fraction of the power
+		if !set["workers"] {
+			cfg.Workers = efficiencyWorkers()
+		}
+		if !set["io"] {
+			cfg.IO = brc.IOStream
+		}
+		cfg.BlockSize = efficiencyBlockSize
+		return nil
+	default:
+		return fmt.Errorf("unknown mode %q", mode)
+	}
+}
+
+// efficiencyWorkers returns the number of efficiency cores if the platform
+// reports them, or half the CPUs.
+func efficiencyWorkers() int {
+	if n := efficiencyCores(); n > 0 {
+		return n
+	}
+	return max(brc.CPUs()/2, 1)
+}
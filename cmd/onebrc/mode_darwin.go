@@ -0,0 +1,14 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// efficiencyCores returns the number of E-cores on Apple Silicon, where
+// perflevel1 is the efficiency cluster. macOS has no thread affinity, but
+// with no more workers than E-cores the scheduler can keep the run there.
+func efficiencyCores() int {
+	n, err := unix.SysctlUint32("hw.perflevel1.logicalcpu")
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package main
+
+// efficiencyCores reports no dedicated efficiency cores.
+func efficiencyCores() int {
+	return 0
+}
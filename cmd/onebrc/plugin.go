@@ -0,0 +1,23 @@
+//go:build brcplugins
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"plugin"
+)
+
+// loadPlugins opens the Go plugins listed in ONEBRC_PLUGINS, whose init
+// functions register their strategies with strategy.Register.
+func loadPlugins() error {
+	for _, path := range filepath.SplitList(os.Getenv(envPrefix + "PLUGINS")) {
+		if path == "" {
+			continue
+		}
+		if _, err := plugin.Open(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
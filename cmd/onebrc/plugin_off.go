@@ -0,0 +1,18 @@
+//go:build !brcplugins
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// loadPlugins fails if ONEBRC_PLUGINS lists plugins, which only a build with
+// the brcplugins tag loads, so that the default binary stays statically
+// linked.
+func loadPlugins() error {
+	if os.Getenv(envPrefix+"PLUGINS") != "" {
+		return errors.New(envPrefix + "PLUGINS needs a build with -tags brcplugins")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// priority holds the scheduling flags that let a run yield to the other
+// work of a shared host.
+type priority struct {
+	nice   int
+	ionice string
+}
+
+func priorityFlags(fs *flag.FlagSet) *priority {
+	p := &priority{}
+	fs.IntVar(&p.nice, "nice", 0, "raise the nice value of the process by `n`, 1 to 19, to yield the CPUs (Linux only)")
+	fs.StringVar(&p.ionice, "ionice", "", "I/O scheduling `class`: idle, or best-effort with an optional level 0 (highest) to 7, e.g. best-effort:7 (Linux only)")
+	return p
+}
+
+// ioprio classes and the shift of the class in an ioprio value, see
+// ioprio_set(2).
+const (
+	ioprioClassBestEffort = 2
+	ioprioClassIdle       = 3
+	ioprioClassShift      = 13
+)
+
+// ioprio parses the -ionice value into an ioprio value, 0 for none.
+func (p *priority) ioprio() (int, error) {
+	class, level, _ := strings.Cut(p.ionice, ":")
+	switch class {
+	case "":
+		return 0, nil
+	case "idle":
+		if level != "" {
+			return 0, fmt.Errorf("the idle I/O class has no levels, got %q", p.ionice)
+		}
+		return ioprioClassIdle << ioprioClassShift, nil
+	case "best-effort":
+		n := 4 // the default level of the class
+		if level != "" {
+			var err error
+			if n, err = strconv.Atoi(level); err != nil || n < 0 || n > 7 {
+				return 0, fmt.Errorf("invalid best-effort I/O level %q, expected 0 to 7", level)
+			}
+		}
+		return ioprioClassBestEffort<<ioprioClassShift | n, nil
+	}
+	return 0, fmt.Errorf("unknown I/O class %q, expected idle or best-effort", class)
+}
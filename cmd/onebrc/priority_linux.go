@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioprioWhoProcess selects a single thread for ioprio_set.
+const ioprioWhoProcess = 1
+
+// apply sets the nice value and I/O priority of every thread of the
+// process. Linux schedules threads, not processes, and new threads inherit
+// the values of the thread creating them.
+func (p *priority) apply() error {
+	prio, err := p.ioprio()
+	if err != nil {
+		return err
+	}
+	if p.nice < 0 || p.nice > 19 {
+		return fmt.Errorf("invalid nice value %d, expected 0 to 19", p.nice)
+	}
+	if p.nice == 0 && prio == 0 {
+		return nil
+	}
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if p.nice > 0 {
+			cur, err := unix.Getpriority(unix.PRIO_PROCESS, tid)
+			if err != nil {
+				return fmt.Errorf("get nice value: %w", err)
+			}
+			// the raw syscall returns 20 - nice
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, min(20-cur+p.nice, 19)); err != nil {
+				return fmt.Errorf("set nice value: %w", err)
+			}
+		}
+		if prio != 0 {
+			if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 {
+				return fmt.Errorf("set I/O priority: %w", errno)
+			}
+		}
+	}
+	return nil
+}
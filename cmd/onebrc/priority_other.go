@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+func (p *priority) apply() error {
+	if _, err := p.ioprio(); err != nil {
+		return err
+	}
+	if p.nice != 0 || p.ionice != "" {
+		return errors.New("-nice and -ionice are not supported on " + runtime.GOOS)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/flamegraph"
+	"github.com/djheidihoe/1brc/internal/output"
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// profiling holds the flags of a CPU profiled run.
+type profiling struct {
+	cpuProfile, flamegraph string
+	pgoRecord              string
+	pgoDuration            time.Duration
+}
+
+func profileFlags(fs *flag.FlagSet) *profiling {
+	p := &profiling{}
+	fs.StringVar(&p.cpuProfile, "cpuprofile", "", "write a CPU profile of the run to `path`, for go tool pprof")
+	fs.StringVar(&p.flamegraph, "flamegraph", "", "profile the run and render a flame graph to `path`, an SVG for .svg and folded stacks for flamegraph.pl otherwise")
+	fs.StringVar(&p.pgoRecord, "pgo-record", "", "write a CPU profile for profile-guided optimization to `path`, processing the input again until -pgo-duration has passed; go build uses cmd/onebrc/default.pgo")
+	fs.DurationVar(&p.pgoDuration, "pgo-duration", 10*time.Second, "the minimum `duration` profiled by -pgo-record")
+	return p
+}
+
+// check reports conflicting profile flags before any work is done.
+func (p *profiling) check(path string) error {
+	if p.pgoRecord == "" {
+		return nil
+	}
+	if p.cpuProfile != "" {
+		return errors.New("-pgo-record and -cpuprofile both write the CPU profile, set one of them")
+	}
+	if path == "-" {
+		return errors.New("-pgo-record processes the input repeatedly and cannot read stdin")
+	}
+	return nil
+}
+
+// start starts the CPU profile if one is requested. The returned function
+// stops it and renders the flame graph.
+func (p *profiling) start(log *slog.Logger) (stop func(), err error) {
+	if p.cpuProfile == "" && p.flamegraph == "" && p.pgoRecord == "" {
+		return func() {}, nil
+	}
+	if runtime.GOOS == "wasip1" {
+		return nil, errors.New("CPU profiles are not supported on wasip1")
+	}
+	var f *os.File
+	if p.cpuProfile != "" {
+		f, err = os.Create(p.cpuProfile)
+	} else if p.pgoRecord != "" {
+		f, err = os.Create(p.pgoRecord)
+	} else {
+		f, err = os.CreateTemp("", "onebrc-*.pprof")
+	}
+	if err != nil {
+		return nil, err
+	}
+	path := f.Name()
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		err := f.Close()
+		if err == nil && p.flamegraph != "" {
+			err = renderFlamegraph(path, p.flamegraph)
+		}
+		if p.cpuProfile == "" && p.pgoRecord == "" {
+			os.Remove(path)
+		}
+		if err != nil {
+			fatal("failed to write profile", err, "path", path)
+		}
+		log.Info("profile written", "cpuprofile", p.cpuProfile, "flamegraph", p.flamegraph, "pgo", p.pgoRecord)
+	}, nil
+}
+
+// repeat processes the input at path again until the -pgo-record profile,
+// started at start, covers -pgo-duration. A single run of the hot loops is
+// too short to sample them well enough to guide the compiler. The repeated
+// runs neither report progress nor use the cache.
+func (p *profiling) repeat(ctx context.Context, log *slog.Logger, path string, cfg brc.Config, start time.Time) error {
+	if p.pgoRecord == "" {
+		return nil
+	}
+	cfg.Monitor, cfg.Summary, cfg.CacheDir = nil, nil, ""
+	cfg.Window.Emit = nil
+	runs := 1
+	for ; time.Since(start) < p.pgoDuration; runs++ {
+		if _, err := brc.ProcessFileContext(ctx, path, cfg); err != nil {
+			return err
+		}
+	}
+	log.Info("input profiled for PGO", "runs", runs, "duration", time.Since(start))
+	return nil
+}
+
+// renderFlamegraph writes the CPU profile at profile as a flame graph to path.
+func renderFlamegraph(profile, path string) error {
+	f, err := os.Open(profile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stacks, err := flamegraph.Fold(f)
+	if err != nil {
+		return err
+	}
+	if len(stacks) == 0 {
+		return errors.New("no CPU samples, the run was too short")
+	}
+	return output.WriteFile(path, func(w io.Writer) error {
+		if filepath.Ext(path) == ".svg" {
+			return stacks.WriteSVG(w, "onebrc CPU profile")
+		}
+		return stacks.WriteFolded(w)
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+	"github.com/djheidihoe/1brc/pkg/brc/reference"
+)
+
+// referenceChunkSize bounds the chunks -compare-reference checks, the
+// reference implementation being slow.
+const referenceChunkSize = 4 << 20
+
+// checkReference reports why cfg cannot be compared against the reference
+// implementation, which knows none of the options that rename or skip
+// lines.
+func checkReference(path string, cfg brc.Config) error {
+	switch {
+	case path == "-":
+		return errors.New("-compare-reference needs a file, not stdin")
+	case cfg.GroupBy.Column > 0 || cfg.Window.Size > 0 || cfg.KeyColumn > 0 || cfg.Normalize != 0 || len(cfg.Hooks) > 0:
+		return errors.New("-compare-reference cannot be combined with grouping, windows, key columns, name normalization or hooks")
+	case cfg.CommentPrefix != "" || cfg.SkipHeader > 0 || cfg.LimitRows > 0 || cfg.RangeStart > 0 || cfg.RangeEnd > 0:
+		return errors.New("-compare-reference cannot be combined with options skipping lines")
+	}
+	return nil
+}
+
+// compareReference processes n chunks of the input at path, sampled at
+// random and cut at line boundaries, with cfg and with the reference
+// implementation, and fails unless their results are the same.
+func compareReference(log *slog.Logger, path string, n int, cfg brc.Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	if size == 0 {
+		return nil
+	}
+	chunkSize := min(max(size/int64(n), 1), referenceChunkSize)
+
+	// the sampled chunks run alone, without the outputs of the run
+	cfg.Monitor, cfg.Summary, cfg.Audit, cfg.CacheDir = nil, nil, nil, ""
+	for range n {
+		start, err := nextLine(f, rand.Int64N(size))
+		if err != nil {
+			return err
+		}
+		end, err := nextLine(f, start+chunkSize)
+		if err != nil {
+			return err
+		}
+		if start >= end {
+			continue
+		}
+
+		chunk := cfg
+		chunk.RangeStart, chunk.RangeEnd = start, end
+		fast, err := brc.ProcessFile(path, chunk)
+		if err != nil {
+			return err
+		}
+		ref, err := reference.Process(io.NewSectionReader(f, start, end-start), cfg)
+		if err != nil {
+			return err
+		}
+		var got, expected bytes.Buffer
+		fast.WriteText(&got)
+		ref.WriteText(&expected)
+		if got.String() != expected.String() {
+			return fmt.Errorf("results of bytes %d-%d differ from the reference implementation", start, end)
+		}
+		log.Debug("chunk matches the reference", "start", start, "end", end, "stations", fast.Len())
+	}
+	return nil
+}
+
+// nextLine returns the offset of the first line of f starting at or after
+// off, or the size of f if there is none.
+func nextLine(f *os.File, off int64) (int64, error) {
+	if off <= 0 {
+		return 0, nil
+	}
+	// a line starts at off if the byte before it ends the previous one
+	buf := make([]byte, 4096)
+	pos := off - 1
+	for {
+		n, err := f.ReadAt(buf, pos)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+		pos += int64(n)
+		if err == io.EOF {
+			return pos, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
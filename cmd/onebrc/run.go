@@ -0,0 +1,677 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/alert"
+	"github.com/djheidihoe/1brc/internal/expect"
+	"github.com/djheidihoe/1brc/internal/logging"
+	"github.com/djheidihoe/1brc/internal/output"
+	"github.com/djheidihoe/1brc/internal/power"
+	"github.com/djheidihoe/1brc/pkg/brc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func runCmd(args []string) {
+	if err := runInput(args); err != nil {
+		fatal("alert rules fired", err)
+	}
+}
+
+// runInput is runCmd up to its exit: it returns the exitAlert error of
+// fired alert rules instead of exiting, so that its deferred calls have
+// stopped the profile, tracing and metrics by the time runCmd exits.
+func runInput(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	workers := fs.Int("workers", 0, "number of parallel parsers (default the CPUs, or the CPU quota of the cgroup)")
+	strategyName := fs.String("strategy", "", "apply the `strategy` of that name, see onebrc strategies, or auto to pick one for the input, file size and machine")
+	ioBackend := fs.String("io", string(brc.DefaultIO), "read backend: mmap, stream, or pipeline for -readers goroutines reading blocks in parallel for the workers to parse, mmap being unavailable on wasip1 and Windows")
+	readers := fs.Int("readers", 0, "number of IO goroutines of -io pipeline (default 4)")
+	ringSize := fs.Int("ring-size", 0, "blocks per ring between the readers and workers of -io pipeline, a power of two (default 2)")
+	formatIn := fs.String("format-in", "", "input format: text, csv as with -csv, jsonl, JSON Lines such as {\"station\":\"Oslo\",\"temp\":-3.2}, parquet with a station and a temperature column, or one registered with brc.RegisterDecoder (default by the file extension: .jsonl and .ndjson, .parquet, else text)")
+	csv := fs.Bool("csv", false, "read fields that may be quoted as in CSV, e.g. \"St. John;s\";12.3 with the delimiter in the name, with a slower quote-aware scanner")
+	aggregation := fs.String("aggregation", string(brc.AggregatePerWorker), "how workers combine stations: per-worker tables merged at the end, one shared striped table, or partitioned tables of disjoint stations")
+	parseLoop := fs.String("parse", string(brc.ParseFused), "parse loop: fused, or two-stage to scan batches of lines before aggregating them")
+	strict := fs.Bool("strict", false, "fail on malformed lines instead of skipping them, decoding two lines per iteration")
+	stationMap := fs.String("map", string(brc.MapBuiltin), "per-worker station table: builtin Go map or swiss table")
+	out := outputFlags(fs)
+	cacheDir := fs.String("cache-dir", "", "reuse results of unchanged input files cached in `dir`")
+	showTUI := fs.Bool("tui", false, "show a live dashboard on stderr while processing")
+	metricsAddr := fs.String("metrics", "", "serve the live counters at http://`addr`/metrics in the Prometheus text format while processing")
+	tracePath := fs.String("trace", "", "export OpenTelemetry spans as JSON to `path`")
+	dictPath := fs.String("dict", "", "preload the station dictionary of the file at `path`, if there is one, and save it there with the new stations after the run, for presized tables and station IDs that stay the same from run to run")
+	withIDs := fs.Bool("with-ids", false, "write the table and json results by the -dict station IDs instead of the names, for joins on the IDs of the dictionary, e.g. in its CSV form with a .csv path; implies -table for the text format, and cannot be combined with the other formats or -template")
+	cardinality := fs.Int("cardinality-hint", 0, "expected number of distinct stations, e.g. 10000 for the 10K station dataset")
+	hugePages := fs.Bool("hugepages", false, "place the stats of the tables presized by -cardinality-hint or -dict on transparent huge pages (Linux only), for hundreds of thousands of stations; warns when they did not take effect and -summary reports how many bytes did")
+	limitRows := fs.Int64("limit-rows", 0, "process only the first `n` lines")
+	byteRange := fs.String("byte-range", "", "process only the lines starting in the byte range `start:end` of the input, end may be omitted")
+	skipHeader := fs.Int("skip-header", 0, "skip the first `n` lines of the input, e.g. a station;temperature header")
+	delimiter := fs.String("delimiter", ";", "the `character` separating the fields of a line")
+	commentPrefix := fs.String("comment-prefix", "", "skip lines starting with `prefix`, e.g. #")
+	trim := fs.Bool("trim", false, "trim white space around station names and at line ends (accepts CRLF)")
+	nfc := fs.Bool("nfc", false, "group station names by their Unicode NFC form")
+	foldCase := fs.Bool("fold-case", false, "group station names case-insensitively")
+	var hookExprs hookFlags
+	fs.Var(&hookExprs, "hook", "preprocess the records with `expr` after -trim, -nfc and -fold-case: drop reading OP degrees with OP one of <, <=, >, >=, == and !=, drop reading outside lo..hi, drop station NAME, or rename PATH of a CSV file of from,to station lines; repeat to apply several in order")
+	keyColumn := fs.Int("key-column", 0, "aggregate by field `n` of lines f1;...;temperature, e.g. 1 for the station IDs of id;name;temperature lines, hashing the shorter keys")
+	keyNames := fs.String("key-names", "", "write the stations, e.g. the IDs of -key-column, by their names in the CSV file at `path` of id,name lines")
+	groupColumn := fs.Int("group-by-column", 0, "also group by the field `n` after the station (lines station;f1;...;temperature), writes a table")
+	groupPrefix := fs.Int("group-by-prefix", 0, "group by only the first `n` bytes of the -group-by-column field, e.g. 10 for the date of a timestamp")
+	stationsPath := fs.String("stations", "", "enrich the table and json results with the country, latitude and elevation of each station from the CSV file at `path`, with a station,country,latitude,elevation header")
+	countryRollup := fs.String("country-rollup", "", "also aggregate the stations by their -stations country and write the results per country to `path` (- for stdout)")
+	groupBy := fs.String("group-by", "", "write the results per group of stations instead: country for their -stations country, or the `path` of a CSV file of station,group lines")
+	alertsPath := fs.String("alerts", "", "evaluate the threshold rules of the file at `path`, e.g. \"station Hamburg max > 45.0\", print an alert line to stderr for each row they hold for and exit with status 6 if any does")
+	expectedPath := fs.String("expected-stations", "", "print the stations listed one per line in the file at `path` that are missing from the input and the unexpected ones, with suggestions for likely typos, to stderr")
+	asciiOutput := fs.Bool("ascii-output", false, "transliterate station names to ASCII in the results, e.g. São Paulo to Sao Paulo, merging the stations that fold to the same name and reporting them to stderr")
+	window := fs.Duration("window", 0, "aggregate per station and tumbling time window of `size`, e.g. 1h (lines station;timestamp;temperature), writing each window's rows once it is complete")
+	windowColumn := fs.Int("window-column", 1, "the timestamp is field `n` after the station, RFC 3339 or Unix seconds")
+	windowLateness := fs.Duration("window-lateness", 0, "keep a window open until the input is `duration` past its end (default the window size)")
+	extras := extraFlags(fs)
+	samplePerStation := fs.Int("sample-per-station", 0, "keep a uniform random sample of `n` readings per station and write it as JSON to -samples")
+	samplesPath := fs.String("samples", "samples.json", "write the -sample-per-station samples to `path` (- for stdout)")
+	chaos := fs.Uint64("chaos", 0, "perturb chunking and scheduling with `seed` to surface races and boundary bugs, best under a -race build; the results do not change")
+	maxThroughput := fs.String("max-throughput", "", "limit reading the input to `rate` bytes per second, e.g. 500MB/s, to spare the disk or NFS server of a shared host")
+	simulate := storageFlags(fs)
+	readahead := fs.String("readahead", "", "prefetch the pages of each worker's part of the mapped input `size` bytes ahead of where it parses, e.g. 8MB, to overlap the page faults of a cold page cache with parsing")
+	affinity := fs.String("affinity", string(brc.AffinityNone), "pin workers to CPUs (Linux only): none, spread across sockets, pack into one NUMA node or numa to run chunks on the node holding them")
+	mlock := fs.Bool("mlock", false, "lock the mapped input into memory before parsing, for benchmarks free of swapping and page reclaim; warns and runs unlocked when it exceeds the locked memory limit (ulimit -l)")
+	gcOff := fs.Bool("gc-off", false, "turn the garbage collector off while parsing and collect once before output")
+	chart := fs.Int("chart", 0, "draw bar charts of the mean temperature of the `n` hottest stations and of the n stations with the most readings to stderr")
+	summary := fs.Bool("summary", false, "print a summary of the run to stderr")
+	compareRef := fs.Int("compare-reference", 0, "also process `n` chunks of the input sampled at random with the naive reference implementation and fail if any result differs")
+	audit := fs.Bool("audit", false, "print the segment of the input each worker parsed to stderr and fail unless they cover every line exactly once")
+	mode := fs.String("mode", "speed", "speed for minimal wall time, or efficiency for minimal energy (fewer workers, larger reads, energy in the summary)")
+	memoryCheck := fs.String("memory-check", "warn", "before the run, estimate its peak memory from the flags and the stations of the first 4MB of the input and, when it exceeds the -memory-limit or the available memory, warn, refuse to start, or off")
+	configPath := fs.String("config", "", "read settings from the YAML or TOML file at `path`, flags on the command line override them")
+	prof := profileFlags(fs)
+	prio := priorityFlags(fs)
+	applyGC := gcFlags(fs)
+	newLogger := logging.Flags(fs)
+	parseFlags(fs, args)
+	envInput, err := loadEnv(fs)
+	if err != nil {
+		setupLogger(newLogger)
+		fatal("invalid environment", usageError(err))
+	}
+	var configInput string
+	if *configPath != "" {
+		if configInput, err = loadConfigFile(fs, *configPath); err != nil {
+			setupLogger(newLogger)
+			fatal("invalid config file", usageError(err), "path", *configPath)
+		}
+	}
+	log := setupLogger(newLogger)
+	if err := applyGC(log); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	if err := out.check(); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	if err := prio.apply(); err != nil {
+		fatal("failed to set priority", err)
+	}
+
+	path := defaultMeasurementsPath
+	switch {
+	case fs.NArg() > 0:
+		path = fs.Arg(0)
+	case envInput != "":
+		path = envInput
+	case configInput != "":
+		path = configInput
+	}
+
+	if err := prof.check(path); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	if *countryRollup != "" && *stationsPath == "" {
+		fatal("invalid arguments", usageError(errors.New("-country-rollup needs -stations")))
+	}
+	if *groupBy == "country" && *stationsPath == "" {
+		fatal("invalid arguments", usageError(errors.New("-group-by country needs -stations")))
+	}
+	if *stationsPath != "" {
+		if out.meta, err = loadStations(*stationsPath); err != nil {
+			fatal("failed to read station metadata", inputError(err), "path", *stationsPath)
+		}
+	}
+	var rules []*alert.Rule
+	if *alertsPath != "" {
+		if rules, err = alert.ReadFile(*alertsPath); err != nil {
+			fatal("invalid alert rules", usageError(err), "path", *alertsPath)
+		}
+	}
+	var expected []string
+	if *expectedPath != "" {
+		if expected, err = expect.ReadNames(*expectedPath); err != nil {
+			fatal("failed to read expected stations", inputError(err), "path", *expectedPath)
+		}
+	}
+	group, err := loadGroups(*groupBy, out.meta)
+	if err != nil {
+		fatal("invalid -group-by", inputError(err), "group-by", *groupBy)
+	}
+
+	cfg := brc.Config{
+		Workers:         *workers,
+		IO:              brc.IOBackend(*ioBackend),
+		Readers:         *readers,
+		RingSize:        *ringSize,
+		Format:          brc.InputFormat(*formatIn),
+		Aggregation:     brc.Aggregation(*aggregation),
+		Map:             brc.StationMap(*stationMap),
+		Parse:           brc.ParseLoop(*parseLoop),
+		Strict:          *strict,
+		CacheDir:        *cacheDir,
+		DisableGC:       *gcOff,
+		Affinity:        brc.Affinity(*affinity),
+		CardinalityHint: *cardinality,
+		HugePages:       *hugePages,
+		Mlock:           *mlock,
+		SkipHeader:      *skipHeader,
+		CommentPrefix:   *commentPrefix,
+		Chaos:           *chaos,
+		Logger:          log,
+	}
+	if len(*delimiter) != 1 {
+		fatal("invalid arguments", usageError(fmt.Errorf("delimiter %q is not a single byte", *delimiter)))
+	}
+	cfg.Delimiter = (*delimiter)[0]
+	if *csv {
+		if cfg.Format != "" && cfg.Format != brc.FormatCSV {
+			fatal("invalid arguments", usageError(fmt.Errorf("-csv cannot be combined with -format-in %s", cfg.Format)))
+		}
+		cfg.Format = brc.FormatCSV
+	}
+	if cfg.Format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jsonl", ".ndjson":
+			cfg.Format = brc.FormatJSONL
+		case ".parquet":
+			cfg.Format = brc.FormatParquet
+		}
+	}
+	if *byteRange != "" {
+		start, end, err := parseByteRange(*byteRange)
+		if err != nil {
+			fatal("invalid arguments", usageError(err))
+		}
+		cfg.RangeStart, cfg.RangeEnd = start, end
+	}
+	cfg.LimitRows = *limitRows
+	if *maxThroughput != "" {
+		rate, err := parseBytes(strings.TrimSuffix(*maxThroughput, "/s"))
+		if err != nil || rate == 0 {
+			fatal("invalid arguments", usageError(fmt.Errorf("invalid -max-throughput %q, expected a rate such as 500MB/s", *maxThroughput)))
+		}
+		cfg.MaxThroughput = rate
+	}
+	storage, err := simulate()
+	if err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	storage.apply(&cfg)
+	if *readahead != "" {
+		n, err := parseBytes(*readahead)
+		if err != nil {
+			fatal("invalid arguments", usageError(fmt.Errorf("invalid -readahead %q, expected a size such as 8MB", *readahead)))
+		}
+		cfg.Readahead = n
+	}
+	cfg.GroupBy = brc.GroupBy{Column: *groupColumn, Prefix: *groupPrefix}
+	if cfg.GroupBy.Column > 0 {
+		out.table = true
+	}
+	cfg.Window = brc.Window{Size: *window, Column: *windowColumn, Lateness: *windowLateness}
+	if cfg.Window.Size > 0 {
+		out.table = true
+		if out.partial == "" && len(out.sinks.List) == 0 {
+			cfg.Window.Emit = windowRows(os.Stdout, brc.Collation(out.collation))
+		}
+	}
+	if *countryRollup != "" && cfg.Window.Emit != nil {
+		fatal("invalid arguments", usageError(errors.New("-country-rollup cannot be combined with streamed -window output")))
+	}
+	if expected != nil && cfg.Window.Emit != nil {
+		fatal("invalid arguments", usageError(errors.New("-expected-stations cannot be combined with streamed -window output")))
+	}
+	if group != nil && cfg.Window.Emit != nil {
+		fatal("invalid arguments", usageError(errors.New("-group-by cannot be combined with streamed -window output")))
+	}
+	ascii := &asciiFolder{log: log, reported: map[string]bool{}}
+	if *asciiOutput && cfg.Window.Emit != nil {
+		emit := cfg.Window.Emit
+		cfg.Window.Emit = func(start time.Time, res *brc.Result) error { return emit(start, ascii.fold(res)) }
+	}
+	alerts := 0
+	if rules != nil && cfg.Window.Emit != nil {
+		// alert on each window as it is written
+		emit := cfg.Window.Emit
+		cfg.Window.Emit = func(start time.Time, res *brc.Result) error {
+			if err := emit(start, res); err != nil {
+				return err
+			}
+			alerts += writeAlerts(alert.Evaluate(rules, res))
+			return nil
+		}
+	}
+	if err := enableExtras(extras, &cfg); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	if *samplePerStation > 0 {
+		if cfg.Window.Emit != nil {
+			fatal("invalid arguments", usageError(errors.New("-sample-per-station cannot be combined with streamed -window output")))
+		}
+		cfg.SamplePerStation = *samplePerStation
+	}
+	if *trim {
+		cfg.Normalize |= brc.NormalizeTrim
+	}
+	if *nfc {
+		cfg.Normalize |= brc.NormalizeNFC
+	}
+	if *foldCase {
+		cfg.Normalize |= brc.NormalizeFoldCase
+	}
+	if cfg.Hooks, err = hookExprs.hooks(); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	cfg.KeyColumn = *keyColumn
+	dictLen := 0
+	if *dictPath != "" {
+		if cfg.Dictionary, err = loadDictionary(*dictPath); err != nil {
+			fatal("failed to read the station dictionary", inputError(err), "path", *dictPath)
+		}
+		dictLen = cfg.Dictionary.Len()
+		log.Debug("station dictionary loaded", "path", *dictPath, "stations", dictLen)
+	}
+	if *withIDs {
+		switch {
+		case cfg.Dictionary == nil:
+			fatal("invalid arguments", usageError(errors.New("-with-ids needs -dict")))
+		case out.meta != nil || group != nil || *keyNames != "" || *asciiOutput:
+			fatal("invalid arguments", usageError(errors.New("-with-ids cannot be combined with -stations, -group-by, -key-names or -ascii-output")))
+		}
+		out.ids = cfg.Dictionary
+		if out.format == "text" {
+			out.table = true
+		}
+		if err := out.checkIDs(); err != nil {
+			fatal("invalid arguments", usageError(err))
+		}
+	}
+	var labels map[string]string
+	if *keyNames != "" {
+		if cfg.Window.Emit != nil {
+			fatal("invalid arguments", usageError(errors.New("-key-names cannot be combined with streamed -window output")))
+		}
+		if labels, err = readPairs(*keyNames); err != nil {
+			fatal("failed to read key names", inputError(err), "path", *keyNames)
+		}
+	}
+	if err := applyMode(fs, *mode, &cfg); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	strat, err := applyStrategy(fs, log, *strategyName, path, &cfg)
+	if err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	processFile := brc.ProcessFileContext
+	if strat != nil {
+		processFile = strat.ProcessFile
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid arguments", usageError(err))
+	}
+	if *compareRef > 0 && cfg.Format != "" && cfg.Format != brc.FormatText {
+		fatal("invalid arguments", usageError(errors.New("-compare-reference needs text input")))
+	}
+	if *compareRef > 0 {
+		if err := checkReference(path, cfg); err != nil {
+			fatal("invalid arguments", usageError(err))
+		}
+	}
+	if err := checkMemory(log, *memoryCheck, path, cfg); err != nil {
+		fatal("memory check failed", err, "input", path)
+	}
+	if *audit {
+		cfg.Audit = new(brc.Audit)
+	}
+	if *summary || *mode == "efficiency" {
+		cfg.Summary = new(brc.Summary)
+	}
+
+	stopProfile, err := prof.start(log)
+	if err != nil {
+		fatal("failed to start CPU profile", err)
+	}
+	defer stopProfile()
+
+	ctx := context.Background()
+	if *tracePath != "" {
+		stop, err := setupTracing(*tracePath)
+		if err != nil {
+			fatal("failed to set up tracing", err, "path", *tracePath)
+		}
+		defer stop()
+		cfg.TracerProvider = otel.GetTracerProvider()
+	}
+	ctx, span := tracer.Start(ctx, "run")
+	defer span.End()
+
+	if *showTUI || *metricsAddr != "" {
+		cfg.Monitor = brc.NewMonitor()
+	}
+	if *metricsAddr != "" {
+		stop, err := serveMetrics(*metricsAddr, cfg.Monitor)
+		if err != nil {
+			fatal("failed to serve metrics", usageError(err), "addr", *metricsAddr)
+		}
+		defer stop()
+	}
+	var tuiDone chan struct{}
+	var tuiWG sync.WaitGroup
+	if *showTUI {
+		tuiDone = make(chan struct{})
+		tuiWG.Add(1)
+		go func() {
+			defer tuiWG.Done()
+			tui(os.Stderr, cfg.Monitor, tuiDone)
+		}()
+	}
+
+	log.Info("processing", "input", path, "io", cfg.IO, "workers", cfg.Workers)
+	start := time.Now()
+	energy, energyErr := power.Read()
+	var res *brc.Result
+	if path == "-" {
+		res, err = brc.ProcessContext(ctx, os.Stdin, cfg)
+	} else {
+		res, err = processFile(ctx, path, cfg)
+	}
+	if tuiDone != nil {
+		close(tuiDone)
+		tuiWG.Wait()
+	}
+	if cfg.Audit != nil {
+		cfg.Audit.WriteText(os.Stderr)
+	}
+	if err != nil {
+		fatal("failed to process input", inputError(err), "input", path)
+	}
+	if cfg.Dictionary != nil {
+		if err := saveDictionary(*dictPath, cfg.Dictionary, dictLen); err != nil {
+			fatal("failed to write the station dictionary", err, "path", *dictPath)
+		}
+	}
+	if *compareRef > 0 {
+		if err := compareReference(log, path, *compareRef, cfg); err != nil {
+			fatal("failed to compare with the reference implementation", err, "input", path)
+		}
+	}
+	if err := prof.repeat(ctx, log, path, cfg, start); err != nil {
+		fatal("failed to process input", inputError(err), "input", path)
+	}
+
+	if labels != nil {
+		var unlabeled []string
+		if res, unlabeled = res.Relabel(labels); len(unlabeled) > 0 {
+			log.Warn("stations without a -key-names name", "count", len(unlabeled), "first", unlabeled[0])
+		}
+	}
+
+	out.run = newRunInfo(path, cfg, start)
+	if cfg.Window.Emit == nil {
+		written, wout := res, out
+		if group != nil {
+			// the groups have no metadata of their own
+			grouped := *out
+			grouped.meta = nil
+			written, wout = rollup(log, res, group), &grouped
+		}
+		if *asciiOutput {
+			written = ascii.fold(written)
+			if wout.meta != nil {
+				folded := *wout
+				folded.meta = foldMetadata(wout.meta)
+				wout = &folded
+			}
+		}
+		writeOutput(ctx, log, written, wout)
+	}
+	if rules != nil && cfg.Window.Emit == nil {
+		alerts += writeAlerts(alert.Evaluate(rules, res))
+	}
+	if expected != nil {
+		expect.Check(expected, res).WriteText(os.Stderr)
+	}
+	writeExtras(extras, res)
+	if *countryRollup != "" {
+		writeRollup(*countryRollup, res, out)
+	}
+	if cfg.SamplePerStation > 0 {
+		if err := output.WriteFile(*samplesPath, res.WriteSamples); err != nil {
+			fatal("failed to write samples", err, "path", *samplesPath)
+		}
+	}
+	if *chart > 0 && cfg.Window.Emit == nil {
+		writeCharts(os.Stderr, res, *chart)
+	}
+	if cfg.Summary != nil {
+		cfg.Summary.WriteText(os.Stderr)
+		writeEnergy(log, energy, energyErr, time.Since(start))
+	}
+	if alerts > 0 {
+		return &exitError{exitAlert, fmt.Errorf("%d alerts of the rules of %s", alerts, *alertsPath)}
+	}
+	return nil
+}
+
+// writeAlerts prints alerts to stderr and returns how many there are.
+func writeAlerts(alerts []alert.Alert) int {
+	for _, a := range alerts {
+		fmt.Fprintln(os.Stderr, a)
+	}
+	return len(alerts)
+}
+
+// writeEnergy adds the energy used by the CPU packages during the run, which
+// took elapsed, to the summary on stderr.
+func writeEnergy(log *slog.Logger, energy power.Reading, err error, elapsed time.Duration) {
+	var joules float64
+	if err == nil {
+		joules, err = energy.Joules()
+	}
+	if err != nil {
+		log.Debug("energy not measured", "err", err)
+		fmt.Fprintf(os.Stderr, "energy    unavailable, %v elapsed\n", elapsed.Round(time.Microsecond))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "energy    %.2f J in %v, %.1f W\n", joules, elapsed.Round(time.Microsecond), joules/elapsed.Seconds())
+}
+
+// parseByteRange parses a -byte-range value "start:end" or "start:", both
+// offsets with optional size suffixes such as 1GiB.
+func parseByteRange(s string) (start, end int64, err error) {
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid byte range %q, expected start:end", s)
+	}
+	if start, err = parseBytes(from); err != nil {
+		return 0, 0, fmt.Errorf("invalid byte range start %q: %w", from, err)
+	}
+	if to != "" {
+		if end, err = parseBytes(to); err != nil {
+			return 0, 0, fmt.Errorf("invalid byte range end %q: %w", to, err)
+		}
+		if end <= start {
+			return 0, 0, fmt.Errorf("empty byte range %q", s)
+		}
+	}
+	return start, end, nil
+}
+
+// outputOptions holds the flags selecting where and how results are written.
+type outputOptions struct {
+	partial, partialFormat string
+	format                 string
+	table                  bool
+	sinks                  output.Sinks
+	// meta, with -stations, enriches the table and json results
+	meta brc.Metadata
+	// templatePath is the -template file, parsed into tmpl by check, and
+	// run what it renders about the run
+	templatePath string
+	tmpl         *template.Template
+	run          runInfo
+	collation    string
+	// ids, with -with-ids, is the dictionary whose IDs replace the names
+	// in the table and json results
+	ids *brc.Dictionary
+}
+
+func outputFlags(fs *flag.FlagSet) *outputOptions {
+	out := &outputOptions{}
+	fs.StringVar(&out.partial, "partial", "", "write the partial aggregate to `path` instead of the results (- for stdout)")
+	fs.StringVar(&out.partialFormat, "partial-format", "binary", "partial aggregate encoding: binary or json")
+	fs.StringVar(&out.format, "output-format", "text", "results format: text (the official format), table, json, markdown, html, a static page with a sortable table and histograms with -frequencies, or xlsx, an Excel workbook")
+	fs.BoolVar(&out.table, "table", false, "write the results as station;key;min;mean;max;count rows instead of the official format, short for -output-format table")
+	fs.StringVar(&out.templatePath, "template", "", "write the results rendered by the Go text/template at `path`, e.g. as SQL INSERT statements, instead of the official format; it gets .Stations with Name, Station, Key, Min, Mean, Max and Count, .Run with Input, Started, Elapsed and more, and the functions sql, csv and json to quote values; it replaces -output-format, which it cannot be combined with, for stdout and the -out paths of no known format")
+	fs.StringVar(&out.collation, "collate", string(brc.CollateBytes), "order of station names in the results: bytes, by their UTF-8 bytes, java, the UTF-16 order of the official baseline for byte-identical diffs, or unicode, the Unicode collation of the root locale")
+	fs.Var(&out.sinks, "out", "write the results to `[format=]path` instead of stdout (- for stdout), replacing files atomically; repeat for several sinks, a bare path takes its format from a .json, .txt, .csv, .md, .html or .xlsx extension or else -output-format")
+	return out
+}
+
+// check reports invalid output flags before any work is done.
+func (o *outputOptions) check() error {
+	if o.partial != "" && len(o.sinks.List) > 0 {
+		return errors.New("-out cannot be combined with -partial")
+	}
+	if o.templatePath != "" && (o.format != "text" || o.table) {
+		// either would be the format of stdout and the bare sinks
+		return errors.New("-template cannot be combined with -output-format or -table, -out format=path writes other formats beside it")
+	}
+	if o.templatePath != "" {
+		var err error
+		if o.tmpl, err = parseTemplate(o.templatePath); err != nil {
+			return fmt.Errorf("invalid -template: %w", err)
+		}
+	}
+	if err := brc.NewResult().SetCollation(brc.Collation(o.collation)); err != nil {
+		return fmt.Errorf("invalid -collate: %w", err)
+	}
+	formats := o.writers(nil)
+	if formats[o.defaultFormat()] == nil {
+		return fmt.Errorf("unknown output format %q", o.format)
+	}
+	for _, sink := range o.sinks.List {
+		if sink.Format != "" && formats[sink.Format] == nil {
+			return fmt.Errorf("unknown output format %q of -out %s", sink.Format, sink.Path)
+		}
+	}
+	return nil
+}
+
+// checkIDs reports the results formats of stdout and the sinks that have no
+// writer by the IDs of -with-ids, rather than have them write the names.
+func (o *outputOptions) checkIDs() error {
+	formats := o.formats(nil)
+	if f := o.defaultFormat(); formats[f] == nil {
+		return fmt.Errorf("-with-ids writes no %s results, only table and json", f)
+	}
+	for _, sink := range o.sinks.List {
+		if sink.Format != "" && formats[sink.Format] == nil {
+			return fmt.Errorf("-with-ids writes no %s results, only table and json, of -out %s", sink.Format, sink.Path)
+		}
+	}
+	return nil
+}
+
+// defaultFormat is the results format of stdout and of sinks without one.
+func (o *outputOptions) defaultFormat() string {
+	if o.tmpl != nil {
+		return "template"
+	}
+	if o.table {
+		return "table"
+	}
+	return o.format
+}
+
+// writers maps the results formats to their writers for res, enriched with
+// o.meta if set. The official text format and the reports have no room for
+// metadata. The template format exists with -template.
+func (o *outputOptions) writers(res *brc.Result) map[string]func(io.Writer) error {
+	formats := o.formats(res)
+	if o.tmpl != nil {
+		formats["template"] = func(w io.Writer) error { return writeTemplate(w, o.tmpl, res, o.run) }
+	}
+	return formats
+}
+
+func (o *outputOptions) formats(res *brc.Result) map[string]func(io.Writer) error {
+	if o.ids != nil {
+		// the other formats have no room for the IDs, see checkIDs
+		table := func(w io.Writer) error { return res.WriteIDTable(w, o.ids) }
+		return map[string]func(io.Writer) error{
+			"text":  table,
+			"table": table,
+			"json":  func(w io.Writer) error { return res.WriteIDJSON(w, o.ids) },
+		}
+	}
+	if o.meta != nil {
+		return map[string]func(io.Writer) error{
+			"text":     res.WriteText,
+			"table":    func(w io.Writer) error { return res.WriteEnrichedTable(w, o.meta) },
+			"json":     func(w io.Writer) error { return res.WriteEnrichedJSON(w, o.meta) },
+			"markdown": res.WriteMarkdown,
+			"html":     res.WriteHTML,
+			"xlsx":     res.WriteXLSX,
+		}
+	}
+	return map[string]func(io.Writer) error{
+		"text":     res.WriteText,
+		"table":    res.WriteTable,
+		"json":     res.WriteResultsJSON,
+		"markdown": res.WriteMarkdown,
+		"html":     res.WriteHTML,
+		"xlsx":     res.WriteXLSX,
+	}
+}
+
+// writeOutput writes res as a partial aggregate to out.partial if set, or as
+// the results to the sinks of -out, stdout without any.
+func writeOutput(ctx context.Context, log *slog.Logger, res *brc.Result, out *outputOptions) {
+	start := time.Now()
+	_, span := tracer.Start(ctx, "output", trace.WithAttributes(attribute.Int("stations", res.Len())))
+	defer span.End()
+
+	sinks := out.sinks
+	sinks.Default = out.defaultFormat()
+	if len(sinks.List) == 0 {
+		sinks.List = []output.Sink{{Path: output.Stdout}}
+	}
+	if out.partial != "" {
+		if err := writePartial(out.partial, out.partialFormat, res); err != nil {
+			fatal("failed to write partial aggregate", err, "path", out.partial)
+		}
+	} else if err := res.SetCollation(brc.Collation(out.collation)); err != nil {
+		fatal("failed to write results", err)
+	} else if err := sinks.Write(out.writers(res)); err != nil {
+		fatal("failed to write results", err)
+	}
+	log.Info("phase finished", "phase", "output", "duration", time.Since(start))
+}
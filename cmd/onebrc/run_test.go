@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+func TestCheckIDs(t *testing.T) {
+	for _, tt := range []struct {
+		format, template string
+		sinks            []string
+		err              string
+	}{
+		{format: "table"},
+		{format: "json", sinks: []string{"ids.csv", "table=ids", "ids.txt", "ids.json"}},
+		{format: "markdown", err: "no markdown results"},
+		{format: "table", sinks: []string{"ids.csv", "report.html"}, err: "no html results, only table and json, of -out report.html"},
+		{format: "json", sinks: []string{"xlsx=ids"}, err: "no xlsx results"},
+		{format: "table", template: "{{.Stations}}", err: "no template results"},
+	} {
+		out := &outputOptions{format: tt.format, table: tt.format == "table", ids: brc.NewDictionary()}
+		if tt.template != "" {
+			out.tmpl = template.Must(template.New("results").Parse(tt.template))
+		}
+		for _, sink := range tt.sinks {
+			if err := out.sinks.Set(sink); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := out.checkIDs()
+		if (err == nil) != (tt.err == "") || (err != nil && !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s %q: %v, expected %q", tt.format, tt.sinks, err, tt.err)
+		}
+	}
+
+	// text sinks write the table by ID too
+	d := brc.NewDictionary()
+	res, err := brc.Process(strings.NewReader("Oslo;4.0\n"), brc.Config{Dictionary: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text, table bytes.Buffer
+	formats := (&outputOptions{ids: d}).formats(res)
+	if err := formats["text"](&text); err != nil {
+		t.Fatal(err)
+	}
+	if err := res.WriteIDTable(&table, d); err != nil {
+		t.Fatal(err)
+	}
+	if text.String() != table.String() || strings.Contains(text.String(), "Oslo") {
+		t.Errorf("text with IDs = %q, expected the table %q", text.String(), table.String())
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.tmpl")
+	if err := os.WriteFile(path, []byte("{{range .Stations}}{{.Name}}\n{{end}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-template", path}, true},
+		{[]string{"-template", path, "-output-format", "text"}, true},
+		{[]string{"-template", path, "-out", "json=results", "-out", "results.csv"}, true},
+		{[]string{"-template", path, "-output-format", "json"}, false},
+		{[]string{"-template", path, "-table"}, false},
+		{[]string{"-output-format", "json", "-table"}, true},
+	} {
+		fs := flag.NewFlagSet("run", flag.ContinueOnError)
+		out := outputFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := out.check(); (err == nil) != tt.ok {
+			t.Errorf("%q: %v", tt.args, err)
+		}
+	}
+}
+
+func TestRunAlertsStopProfile(t *testing.T) {
+	dir := t.TempDir()
+	input, rules, profile := filepath.Join(dir, "measurements.txt"), filepath.Join(dir, "rules.txt"), filepath.Join(dir, "cpu.pprof")
+	if err := os.WriteFile(input, bytes.Repeat([]byte("Hamburg;46.0\nOslo;1.0\n"), 1000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rules, []byte("station Hamburg max > 45.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	stdout(t, func() { err = runInput([]string{"-alerts", rules, "-cpuprofile", profile, input}) })
+	if status := exitStatus(err); status != exitAlert {
+		t.Fatalf("run exits with %d for %v, expected %d", status, err, exitAlert)
+	}
+	// the profile was stopped, which writes all of it
+	f, err := os.Open(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := io.Copy(io.Discard, zr); err != nil || n == 0 {
+		t.Errorf("read %d bytes of the profile: %v", n, err)
+	}
+}
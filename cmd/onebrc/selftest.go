@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/logging"
+	"github.com/djheidihoe/1brc/internal/testdata"
+	"github.com/djheidihoe/1brc/pkg/brc"
+	"github.com/djheidihoe/1brc/pkg/strategy"
+)
+
+// selftestCmd checks the strategies of this binary against the golden
+// fixtures bundled with it and on random inputs against the reference
+// aggregation, so that a build can be verified where it runs.
+func selftestCmd(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	fixtures := fs.Bool("fixtures", false, "check the strategies against the bundled fixtures and their expected results")
+	differential := fs.Int("differential", 0, "check the strategies on `n` random inputs of random shapes")
+	seed := fs.Uint64("seed", uint64(time.Now().UnixNano()), "seed of the -differential inputs and -chaos, printed on failures to reproduce them")
+	withChaos := fs.Bool("chaos", false, "run the strategies with brc.Config.Chaos seeded by -seed, best under a -race build")
+	names := fs.String("strategies", strings.Join(strategy.Names(), ","), "comma separated `list` of strategies to check")
+	workers := fs.Int("workers", 0, "number of parallel parsers (default the CPUs, or the CPU quota of the cgroup)")
+	newLogger := logging.Flags(fs)
+	parseFlags(fs, args)
+	log := setupLogger(newLogger)
+	if !*fixtures && *differential <= 0 {
+		fatal("invalid arguments", usageError(errors.New("no checks selected, use -fixtures or -differential")))
+	}
+	selected := strings.Split(*names, ",")
+	for _, name := range selected {
+		if _, ok := strategy.Lookup(name); !ok {
+			fatal("invalid arguments", usageError(fmt.Errorf("unknown strategy %q", name)))
+		}
+	}
+
+	process := func(name, path string) (string, error) {
+		cfg := brc.Config{Workers: *workers, Logger: log}
+		if *withChaos {
+			cfg.Chaos = max(*seed, 1)
+		}
+		s, _ := strategy.Lookup(name)
+		s.Configure(&cfg)
+		res, err := s.ProcessFile(context.Background(), path, cfg)
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		err = res.WriteText(&out)
+		return out.String(), err
+	}
+	failed := 0
+	report := func(check string, errs []error) {
+		if len(errs) == 0 {
+			fmt.Printf("ok    %s\n", check)
+			return
+		}
+		failed++
+		fmt.Printf("FAIL  %s\n", check)
+		for _, err := range errs {
+			fmt.Printf("      %v\n", err)
+		}
+		if *withChaos {
+			fmt.Printf("      rerun with -chaos -seed %d\n", *seed)
+		}
+	}
+	checks := 0
+	if *fixtures {
+		for _, name := range selected {
+			report("fixtures "+name, testdata.Check(func(path string) (string, error) { return process(name, path) }))
+			checks++
+		}
+	}
+	if *differential > 0 {
+		log.Info("differential inputs", "seed", *seed, "inputs", *differential)
+		report(fmt.Sprintf("differential %d inputs", *differential), testdata.Differential(*seed, *differential, selected, process))
+		checks++
+	}
+	if failed > 0 {
+		fatal("selftest failed", fmt.Errorf("%d of %d checks failed", failed, checks))
+	}
+}
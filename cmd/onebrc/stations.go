@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/djheidihoe/1brc/internal/output"
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// loadStations reads the station metadata of -stations at path.
+func loadStations(path string) (brc.Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return brc.ReadMetadata(f)
+}
+
+// writeRollup writes the stations of res aggregated by country to path, in
+// the default results format. Stations without a country are left out.
+func writeRollup(path string, res *brc.Result, out *outputOptions) {
+	countries, err := res.Rollup(out.meta.Country)
+	if err != nil {
+		fatal("failed to aggregate by country", err)
+	}
+	countries.SetCollation(brc.Collation(out.collation)) // checked with the other output flags
+	plain := outputOptions{format: out.format, table: out.table, tmpl: out.tmpl, run: out.run}
+	if err := output.WriteFile(path, plain.writers(countries)[plain.defaultFormat()]); err != nil {
+		fatal("failed to write country rollup", err, "path", path)
+	}
+}
+
+// loadGroups returns the grouping of -group-by: the country of meta for
+// "country", or else the mapping of the CSV file of station,group lines at
+// spec. It is nil without -group-by. Grouped names keep their key, so the
+// groups of a -group-by-column result are "group;key".
+func loadGroups(spec string, meta brc.Metadata) (func(station, key string) string, error) {
+	var groups map[string]string
+	switch spec {
+	case "":
+		return nil, nil
+	case "country":
+		groups = make(map[string]string, len(meta))
+		for station, info := range meta {
+			groups[station] = info.Country
+		}
+	default:
+		f, err := os.Open(spec)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		cr := csv.NewReader(f)
+		cr.Comment = '#'
+		cr.FieldsPerRecord = 2
+		cr.TrimLeadingSpace = true
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("read groups: %w", err)
+		}
+		groups = make(map[string]string, len(records))
+		for _, record := range records {
+			groups[record[0]] = record[1]
+		}
+	}
+	return func(station, key string) string {
+		g := groups[station]
+		if g == "" || key == "" {
+			return g
+		}
+		return g + ";" + key
+	}, nil
+}
+
+// rollup returns the stations of res aggregated by group, warning about
+// the stations without one, which are left out.
+func rollup(log *slog.Logger, res *brc.Result, groupOf func(station, key string) string) *brc.Result {
+	group := func(name string) string { return groupOf(res.Split(name)) }
+	groups, err := res.Rollup(group)
+	if err != nil {
+		fatal("failed to aggregate by group", err)
+	}
+	ungrouped := 0
+	for name := range res.All() {
+		if group(name) == "" {
+			ungrouped++
+		}
+	}
+	if ungrouped > 0 {
+		log.Warn("stations without a group left out", "stations", ungrouped)
+	}
+	return groups
+}
+
+// asciiFolder transliterates the names of results for -ascii-output,
+// warning once about each set of stations it merges.
+type asciiFolder struct {
+	log      *slog.Logger
+	reported map[string]bool
+}
+
+func (a *asciiFolder) fold(res *brc.Result) *brc.Result {
+	folded, collisions := res.FoldASCII()
+	for _, names := range collisions {
+		key := strings.Join(names, "\x00")
+		if a.reported[key] {
+			continue
+		}
+		a.reported[key] = true
+		a.log.Warn("stations merged by -ascii-output", "name", brc.ASCII(names[0]), "stations", names)
+	}
+	return folded
+}
+
+// foldMetadata returns meta keyed by the ASCII transliterations of its
+// stations, for results folded by -ascii-output.
+func foldMetadata(meta brc.Metadata) brc.Metadata {
+	folded := make(brc.Metadata, len(meta))
+	for station, info := range meta {
+		folded[brc.ASCII(station)] = info
+	}
+	return folded
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// simulatedStorage is the slower storage of the -simulate flags, see
+// brc.Config.SimulateReadLatency.
+type simulatedStorage struct {
+	Latency   time.Duration `json:"latency,omitempty"`
+	Bandwidth int64         `json:"bandwidth_bytes_per_second,omitempty"`
+}
+
+// storageFlags registers the flags of simulated storage on fs. The returned
+// function parses them once fs is parsed.
+func storageFlags(fs *flag.FlagSet) func() (simulatedStorage, error) {
+	latency := fs.Duration("simulate-read-latency", 0, "make every read of the input wait `duration`, e.g. 2ms, as on a network filesystem, to see how a strategy degrades on slow storage")
+	bandwidth := fs.String("simulate-bandwidth", "", "limit the reads of the input to a simulated storage `rate` of e.g. 200MB/s")
+	return func() (simulatedStorage, error) {
+		s := simulatedStorage{Latency: *latency}
+		if s.Latency < 0 {
+			return s, fmt.Errorf("negative -simulate-read-latency %v", s.Latency)
+		}
+		if *bandwidth != "" {
+			rate, err := parseBytes(strings.TrimSuffix(*bandwidth, "/s"))
+			if err != nil || rate == 0 {
+				return s, fmt.Errorf("invalid -simulate-bandwidth %q, expected a rate such as 200MB/s", *bandwidth)
+			}
+			s.Bandwidth = rate
+		}
+		return s, nil
+	}
+}
+
+// apply sets the simulated storage of cfg.
+func (s simulatedStorage) apply(cfg *brc.Config) {
+	cfg.SimulateReadLatency, cfg.SimulateBandwidth = s.Latency, s.Bandwidth
+}
+
+// args returns the flags of onebrc run for s.
+func (s simulatedStorage) args() []string {
+	var args []string
+	if s.Latency > 0 {
+		args = append(args, "-simulate-read-latency", s.Latency.String())
+	}
+	if s.Bandwidth > 0 {
+		args = append(args, "-simulate-bandwidth", fmt.Sprintf("%d/s", s.Bandwidth))
+	}
+	return args
+}
+
+func (s simulatedStorage) String() string {
+	switch {
+	case s.Latency > 0 && s.Bandwidth > 0:
+		return fmt.Sprintf("%v latency, %s/s", s.Latency, formatBytes(s.Bandwidth))
+	case s.Latency > 0:
+		return fmt.Sprintf("%v latency", s.Latency)
+	case s.Bandwidth > 0:
+		return formatBytes(s.Bandwidth) + "/s"
+	}
+	return "none"
+}
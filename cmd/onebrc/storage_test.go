@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStorageFlags(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want simulatedStorage
+		ok   bool
+	}{
+		{nil, simulatedStorage{}, true},
+		{[]string{"-simulate-read-latency", "2ms"}, simulatedStorage{Latency: 2 * time.Millisecond}, true},
+		{[]string{"-simulate-bandwidth", "200MB/s"}, simulatedStorage{Bandwidth: 200e6}, true},
+		{[]string{"-simulate-bandwidth", "1GiB", "-simulate-read-latency", "1s"}, simulatedStorage{Latency: time.Second, Bandwidth: 1 << 30}, true},
+		{[]string{"-simulate-read-latency", "-1ms"}, simulatedStorage{}, false},
+		{[]string{"-simulate-bandwidth", "0MB/s"}, simulatedStorage{}, false},
+		{[]string{"-simulate-bandwidth", "fast"}, simulatedStorage{}, false},
+	} {
+		fs := flag.NewFlagSet("run", flag.ContinueOnError)
+		storage := storageFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		s, err := storage()
+		if (err == nil) != tt.ok || (tt.ok && s != tt.want) {
+			t.Errorf("%q: %+v, %v", tt.args, s, err)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		// the flags of run reproduce the storage, as bench passes them on
+		fs = flag.NewFlagSet("run", flag.ContinueOnError)
+		storage = storageFlags(fs)
+		if err := fs.Parse(s.args()); err != nil {
+			t.Fatal(err)
+		}
+		if again, err := storage(); err != nil || again != s {
+			t.Errorf("%q: args %q parse to %+v, %v", tt.args, s.args(), again, err)
+		}
+	}
+	if args := (simulatedStorage{}).args(); !slices.Equal(args, nil) {
+		t.Errorf("args without simulated storage = %q", args)
+	}
+}
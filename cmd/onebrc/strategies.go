@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/djheidihoe/1brc/pkg/strategy"
+)
+
+// strategiesCmd lists the strategies with their capabilities.
+func strategiesCmd(args []string) {
+	fs := flag.NewFlagSet("strategies", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "write the strategies as JSON")
+	parseFlags(fs, args)
+
+	type entry struct {
+		Name string `json:"name"`
+		Doc  string `json:"doc"`
+		strategy.Capabilities
+	}
+	var entries []entry
+	for _, name := range strategy.Names() {
+		s, _ := strategy.Lookup(name)
+		doc := ""
+		if d, ok := s.(strategy.Describer); ok {
+			doc = d.Describe()
+		}
+		entries = append(entries, entry{name, doc, strategy.CapabilitiesOf(s)})
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			fatal("failed to write strategies", err)
+		}
+		return
+	}
+	yes := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "-"
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "strategy\tmmap\tstreaming\twindows\tcompressed\tbounded memory\t")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, yes(e.Mmap), yes(e.Streaming), yes(e.Windows), yes(e.Compressed), yes(e.BoundedMemory), e.Doc)
+	}
+	tw.Flush()
+	fmt.Println("\nauto picks one of them for the input, file size and machine, see onebrc run -strategy")
+}
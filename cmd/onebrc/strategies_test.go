@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/djheidihoe/1brc/pkg/strategy"
+)
+
+// stdout returns what f writes to os.Stdout.
+func stdout(t *testing.T, f func()) []byte {
+	t.Helper()
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	saved := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = saved }()
+	f()
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestStrategiesJSON(t *testing.T) {
+	var entries []struct {
+		Name string `json:"name"`
+		Doc  string `json:"doc"`
+		strategy.Capabilities
+	}
+	out := stdout(t, func() { strategiesCmd([]string{"-json"}) })
+	if err := json.Unmarshal(out, &entries); err != nil {
+		t.Fatalf("%v in %s", err, out)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+		s, _ := strategy.Lookup(e.Name)
+		if e.Doc == "" || e.Capabilities != strategy.CapabilitiesOf(s) {
+			t.Errorf("%s: %+v", e.Name, e)
+		}
+	}
+	if !slices.Equal(names, strategy.Names()) {
+		t.Errorf("strategies %v, expected %v", names, strategy.Names())
+	}
+	for _, e := range entries {
+		if e.Name == "stream" && (!e.Streaming || e.Mmap || !e.BoundedMemory) {
+			t.Errorf("stream: %+v", e.Capabilities)
+		}
+		if e.Name == "mmap" && (!e.Mmap || e.Streaming || e.BoundedMemory || e.Windows) {
+			t.Errorf("mmap: %+v", e.Capabilities)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/djheidihoe/1brc/internal/cgroup"
+	"github.com/djheidihoe/1brc/pkg/brc"
+	"github.com/djheidihoe/1brc/pkg/strategy"
+)
+
+// minWorkerBytes is the least input auto gives each worker, below which
+// starting and merging a worker costs more than it parses.
+const minWorkerBytes = 1 << 20
+
+// inputProbe is what auto knows about the input and the machine.
+type inputProbe struct {
+	stdin   bool
+	size    int64  // 0 if unknown
+	memory  int64  // available memory, 0 if unknown
+	fs      string // filesystem type, "" if unknown
+	network bool   // whether fs is a network filesystem
+	cpus    int
+}
+
+// probeInput inspects the input at path and the machine.
+func probeInput(path string) inputProbe {
+	p := inputProbe{stdin: path == "-", memory: availableMemory(), cpus: brc.CPUs()}
+	if limit := cgroup.Read().Memory; limit > 0 && (p.memory == 0 || limit < p.memory) {
+		p.memory = limit
+	}
+	if p.stdin {
+		return p
+	}
+	if fi, err := os.Stat(path); err == nil {
+		p.size = fi.Size()
+	}
+	p.fs, p.network = filesystemType(path)
+	return p
+}
+
+// strategyChoice is the decision of auto with the reasons for it.
+type strategyChoice struct {
+	strategy string
+	workers  int
+	reasons  []string
+}
+
+// chooseStrategy picks the strategy and worker count for the input p
+// describes: mapping files that fit in memory on local filesystems, reading
+// those of network filesystems in large blocks in parallel, the others in
+// large blocks in order, and streaming stdin.
+func chooseStrategy(p inputProbe) strategyChoice {
+	var c strategyChoice
+	switch {
+	case p.stdin:
+		c.strategy = "stream"
+		c.reasons = append(c.reasons, "stdin cannot be mapped")
+	case brc.DefaultIO != brc.IOMmap:
+		c.strategy = "chunked"
+		c.reasons = append(c.reasons, "files cannot be mapped on "+runtime.GOOS)
+	case p.network:
+		c.strategy = "pipeline"
+		c.reasons = append(c.reasons, fmt.Sprintf("the input is on a %s network filesystem, where large reads in parallel beat page faults and hide the latency of each other", p.fs))
+	case p.memory > 0 && p.size > p.memory:
+		c.strategy = "chunked"
+		c.reasons = append(c.reasons, fmt.Sprintf("the input of %s exceeds the %s of available memory", formatBytes(p.size), formatBytes(p.memory)))
+	default:
+		c.strategy = "mmap"
+		if p.memory > 0 {
+			c.reasons = append(c.reasons, fmt.Sprintf("the input of %s fits in the %s of available memory", formatBytes(p.size), formatBytes(p.memory)))
+		} else {
+			c.reasons = append(c.reasons, "available memory unknown, assuming the input fits")
+		}
+	}
+
+	c.workers = p.cpus
+	if n := p.size / minWorkerBytes; !p.stdin && n < int64(p.cpus) {
+		c.workers = int(max(n, 1))
+		c.reasons = append(c.reasons, fmt.Sprintf("%d workers of at least %s for the small input", c.workers, formatBytes(minWorkerBytes)))
+	} else {
+		c.reasons = append(c.reasons, fmt.Sprintf("%d workers, one per available CPU", p.cpus))
+	}
+	return c
+}
+
+// applyStrategy adjusts cfg to the strategy name, or with auto to the
+// one chooseStrategy picks for the input at path, logging why, and returns
+// it, nil without a name. As with -mode, explicitly set flags win over the
+// strategy.
+func applyStrategy(fs *flag.FlagSet, log *slog.Logger, name, path string, cfg *brc.Config) (strategy.Strategy, error) {
+	if name == "" {
+		return nil, nil
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	workers := cfg.Workers
+	if name == "auto" {
+		c := chooseStrategy(probeInput(path))
+		log.Info("strategy selected", "strategy", c.strategy, "workers", c.workers, "reasons", strings.Join(c.reasons, "; "))
+		name, workers = c.strategy, c.workers
+	}
+	s, ok := strategy.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+	before := *cfg
+	s.Configure(cfg)
+	if !set["workers"] {
+		cfg.Workers = workers
+	}
+	if set["io"] {
+		cfg.IO = before.IO
+	}
+	if set["aggregation"] {
+		cfg.Aggregation = before.Aggregation
+	}
+	if set["map"] {
+		cfg.Map = before.Map
+	}
+	if set["parse"] {
+		cfg.Parse = before.Parse
+	}
+	if set["strict"] {
+		cfg.Strict = before.Strict
+	}
+	return s, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"slices"
+
+	"golang.org/x/sys/unix"
+)
+
+// availableMemory returns the physical memory, macOS reporting no estimate
+// of the available part.
+func availableMemory() int64 {
+	n, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return 0
+	}
+	return int64(n)
+}
+
+// filesystemType returns the type name of the filesystem holding path and
+// whether it is a network one.
+func filesystemType(path string) (string, bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	name := unix.ByteSliceToString(st.Fstypename[:])
+	return name, slices.Contains([]string{"nfs", "smbfs", "afpfs", "webdav", "macfuse"}, name)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+func availableMemory() int64 {
+	return 0
+}
+
+func filesystemType(string) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+func TestChooseStrategy(t *testing.T) {
+	mapped := func(s string) string {
+		if brc.DefaultIO != brc.IOMmap {
+			return "chunked" // files cannot be mapped
+		}
+		return s
+	}
+	for _, tt := range []struct {
+		name     string
+		probe    inputProbe
+		strategy string
+		workers  int
+	}{
+		{"stdin", inputProbe{stdin: true, cpus: 8}, "stream", 8},
+		{"fits", inputProbe{size: 1 << 30, memory: 4 << 30, cpus: 8}, mapped("mmap"), 8},
+		{"unknown memory", inputProbe{size: 1 << 30, cpus: 8}, mapped("mmap"), 8},
+		{"exceeds memory", inputProbe{size: 8 << 30, memory: 4 << 30, cpus: 8}, mapped("chunked"), 8},
+		{"network", inputProbe{size: 1 << 30, memory: 4 << 30, fs: "nfs", network: true, cpus: 8}, mapped("pipeline"), 8},
+		{"small", inputProbe{size: 3 << 20, memory: 4 << 30, cpus: 8}, mapped("mmap"), 3},
+		{"tiny", inputProbe{size: 100, cpus: 8}, mapped("mmap"), 1},
+		{"empty", inputProbe{cpus: 8}, mapped("mmap"), 1},
+	} {
+		c := chooseStrategy(tt.probe)
+		if c.strategy != tt.strategy || c.workers != tt.workers || len(c.reasons) != 2 {
+			t.Errorf("%s: chose %s with %d workers, because %q; expected %s with %d", tt.name, c.strategy, c.workers, c.reasons, tt.strategy, tt.workers)
+		}
+	}
+}
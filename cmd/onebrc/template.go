@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// templateData is what a -template renders.
+type templateData struct {
+	// Stations are sorted like the official output.
+	Stations []templateStation
+	Run      runInfo
+}
+
+// templateStation is a station of the results, readings in degrees.
+type templateStation struct {
+	// Name is the name in the results, "station;key" for grouped results.
+	Name, Station, Key string
+	Min, Mean, Max     float64
+	Count              int64
+}
+
+// runInfo describes the run for -template.
+type runInfo struct {
+	Input string
+	// Workers is as configured, 0 for one per CPU.
+	Workers   int
+	IO        string
+	Started   time.Time
+	Elapsed   time.Duration
+	Hostname  string
+	GoVersion string
+}
+
+// templateFuncs quote values for common report shapes.
+var templateFuncs = template.FuncMap{
+	// sql quotes s as an SQL string literal
+	"sql": func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" },
+	// csv quotes s as a CSV field if it needs to be
+	"csv": func(s string) string {
+		if !strings.ContainsAny(s, ",\"\r\n") {
+			return s
+		}
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	},
+	// json encodes v as JSON
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseTemplate parses the -template file at path.
+func parseTemplate(path string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+}
+
+// newRunInfo describes a run of cfg over input that started at start.
+func newRunInfo(input string, cfg brc.Config, start time.Time) runInfo {
+	host, _ := os.Hostname()
+	return runInfo{
+		Input:     input,
+		Workers:   cfg.Workers,
+		IO:        string(cfg.IO),
+		Started:   start,
+		Elapsed:   time.Since(start),
+		Hostname:  host,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// writeTemplate renders t for res and run to w.
+func writeTemplate(w io.Writer, t *template.Template, res *brc.Result, run runInfo) error {
+	data := templateData{Stations: make([]templateStation, 0, res.Len()), Run: run}
+	for name, s := range res.Sorted() {
+		station, key := res.Split(name)
+		data.Stations = append(data.Stations, templateStation{name, station, key, float64(s.Min) / 10, s.Mean(), float64(s.Max) / 10, s.Count})
+	}
+	return t.Execute(w, data)
+}
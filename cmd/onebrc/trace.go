@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracer is used for the spans owned by the command itself, e.g. output. It
+// is a no-op unless setupTracing installed a provider.
+var tracer = otel.Tracer("github.com/djheidihoe/1brc/cmd/onebrc")
+
+// setupTracing installs a global tracer provider exporting spans as JSON to
+// path. The returned function flushes the spans and must be called on exit.
+func setupTracing(path string) (func(), error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+
+	return func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			fatal("failed to export traces", err, "path", path)
+		}
+		if err := f.Close(); err != nil {
+			fatal("failed to export traces", err, "path", path)
+		}
+	}, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+const (
+	tuiInterval = 250 * time.Millisecond
+	tuiBarWidth = 40
+	tuiTopN     = 5
+)
+
+// tui renders a live dashboard of mon to w (usually stderr, so the results on
+// stdout stay untouched) until done is closed, then draws a final frame.
+func tui(w io.Writer, mon *brc.Monitor, done <-chan struct{}) {
+	ticker := time.NewTicker(tuiInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	last := mon.Progress()
+	lastTick := start
+	for {
+		select {
+		case <-done:
+			p := mon.Progress()
+			drawTUI(w, p, last, time.Since(lastTick), time.Since(start), mon.Snapshot())
+			return
+		case now := <-ticker.C:
+			p := mon.Progress()
+			drawTUI(w, p, last, now.Sub(lastTick), now.Sub(start), mon.Snapshot())
+			last, lastTick = p, now
+		}
+	}
+}
+
+func drawTUI(w io.Writer, p, last brc.Progress, interval, elapsed time.Duration, snapshot *brc.Result) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J") // cursor home, clear screen
+
+	bytes := p.Bytes()
+	fmt.Fprintf(&b, "onebrc  %s elapsed  %s processed", elapsed.Round(time.Millisecond), formatBytes(bytes))
+	if p.TotalBytes > 0 {
+		fmt.Fprintf(&b, " of %s\n%s %5.1f%%\n", formatBytes(p.TotalBytes), bar(float64(bytes)/float64(p.TotalBytes)), 100*float64(bytes)/float64(p.TotalBytes))
+	} else {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%d rows  %d malformed lines\n", p.Rows, p.Malformed)
+
+	// throughput of each worker over the last interval, scaled to the fastest
+	rates := make([]float64, len(p.Workers))
+	var maxRate float64
+	for i, wp := range p.Workers {
+		var prev int64
+		if i < len(last.Workers) {
+			prev = last.Workers[i].Bytes
+		}
+		rates[i] = float64(wp.Bytes-prev) / interval.Seconds()
+		maxRate = max(maxRate, rates[i])
+	}
+	b.WriteString("\nworkers\n")
+	for i, wp := range p.Workers {
+		frac := 0.0
+		if maxRate > 0 {
+			frac = rates[i] / maxRate
+		}
+		state := fmt.Sprintf("%s/s", formatBytes(int64(rates[i])))
+		if wp.Done {
+			state = "done"
+		} else if wp.TotalBytes > 0 {
+			state += fmt.Sprintf(" %5.1f%%", 100*float64(wp.Bytes)/float64(wp.TotalBytes))
+		}
+		fmt.Fprintf(&b, "%3d %s %s\n", i, bar(frac), state)
+	}
+
+	type station struct {
+		name string
+		mean float64
+	}
+	stations := make([]station, 0, snapshot.Len())
+	for _, name := range snapshot.Names() {
+		s, _ := snapshot.Get(name)
+		stations = append(stations, station{name, s.Mean()})
+	}
+	sort.SliceStable(stations, func(i, j int) bool { return stations[i].mean > stations[j].mean })
+	fmt.Fprintf(&b, "\n%d stations\n%-32s %s\n", len(stations), "hottest", "coldest")
+	for i := 0; i < tuiTopN && i < len(stations); i++ {
+		hot, cold := stations[i], stations[len(stations)-1-i]
+		fmt.Fprintf(&b, "%-26.26s %5.1f %-26.26s %5.1f\n", hot.name, hot.mean, cold.name, cold.mean)
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	fmt.Fprintf(&b, "\nmemory  heap %s  sys %s  gc %d  pause %s\n",
+		formatBytes(int64(ms.HeapAlloc)), formatBytes(int64(ms.Sys)), ms.NumGC, time.Duration(ms.PauseTotalNs).Round(time.Microsecond))
+
+	io.WriteString(w, b.String())
+}
+
+// bar renders frac (0..1) as a fixed width bar.
+func bar(frac float64) string {
+	n := int(min(max(frac, 0), 1) * tuiBarWidth)
+	return "[" + strings.Repeat("#", n) + strings.Repeat(" ", tuiBarWidth-n) + "]"
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// windowRows returns a brc.Window Emit that writes each window to w as it
+// completes, in the -table format and the order of c, so stdout follows a
+// streaming input.
+func windowRows(w io.Writer, c brc.Collation) func(time.Time, *brc.Result) error {
+	bw := bufio.NewWriter(w)
+	header := true
+	return func(_ time.Time, res *brc.Result) error {
+		if header {
+			bw.WriteString("station;key;min;mean;max;count\n")
+			header = false
+		}
+		if err := res.SetCollation(c); err != nil {
+			return err
+		}
+		for _, name := range res.Names() {
+			station, key := res.Split(name)
+			s, _ := res.Get(name)
+			bw.WriteString(station)
+			bw.WriteByte(';')
+			bw.WriteString(key)
+			bw.WriteByte(';')
+			bw.WriteString(strings.ReplaceAll(s.String(), "/", ";"))
+			bw.WriteByte(';')
+			bw.WriteString(strconv.FormatInt(s.Count, 10))
+			bw.WriteByte('\n')
+		}
+		return bw.Flush()
+	}
+}
@@ -1,14 +1,24 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/bufpool"
+	"github.com/djheidihoe/1brc/internal/logging"
+	"github.com/djheidihoe/1brc/internal/phases"
 )
 
+const blockSize = 4 << 20 // 4MB read blocks
+
 // Stats holds min, max, sum, count
 type Stats struct {
 	Min   float64
@@ -18,6 +28,16 @@ type Stats struct {
 }
 
 func main() {
+	newLogger := logging.Flags(flag.CommandLine)
+	showBreakdown := flag.Bool("breakdown", false, "print the time spent per phase and worker to stderr")
+	flag.Parse()
+	breakdown := phases.New(*showBreakdown)
+	log, err := newLogger()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	filename := "../data/measurements.txt" // change if needed
@@ -27,68 +47,96 @@ func main() {
 	}
 	defer f.Close()
 
-	reader := bufio.NewReaderSize(f, 16<<20) // 16MB read buffer
-
-	lineChan := make(chan []byte, 100000)
+	blockChan := make(chan []byte, 64)
 	resultChan := make(chan map[string]Stats, runtime.NumCPU())
 
 	workerCount := runtime.NumCPU()
 	var wg sync.WaitGroup
+	// the lines the workers skip, counted to warn about once they are done
+	var noStation, badValue atomic.Int64
 
 	// ---------------- WORKERS ----------------
 	for i := 0; i < workerCount; i++ {
 		wg.Add(1)
+		bw := breakdown.Worker(strconv.Itoa(i))
 		go func() {
 			defer wg.Done()
+			bw.Start()
+			defer bw.Stop()
 
 			local := make(map[string]Stats)
+			var skippedStation, skippedValue int64
+			defer func() {
+				noStation.Add(skippedStation)
+				badValue.Add(skippedValue)
+			}()
+
+			for block := range blockChan {
+				for rest := block; len(rest) > 0; {
+					timed := bw.Sample()
+					var t time.Time
+					if timed {
+						t = time.Now()
+					}
 
-			for line := range lineChan {
-				if len(line) == 0 {
-					continue
-				}
+					var line []byte
+					if nl := bytes.IndexByte(rest, '\n'); nl >= 0 {
+						line, rest = rest[:nl], rest[nl+1:]
+					} else {
+						line, rest = rest, nil
+					}
+					if len(line) == 0 {
+						continue
+					}
 
-				// find ';'
-				sep := -1
-				for i := 0; i < len(line); i++ {
-					if line[i] == ';' {
-						sep = i
-						break
+					// find ';'
+					sep := -1
+					for i := 0; i < len(line); i++ {
+						if line[i] == ';' {
+							sep = i
+							break
+						}
+					}
+					if sep == -1 {
+						skippedStation++
+						continue
 					}
-				}
-				if sep == -1 {
-					continue
-				}
 
-				station := string(line[:sep])
-				valBytes := line[sep+1:]
+					station := string(line[:sep])
+					valBytes := line[sep+1:]
+					if timed {
+						t = bw.Since(phases.Scan, t)
+					}
 
-				v, err := strconv.ParseFloat(string(valBytes), 64)
-				if err != nil {
-					continue
-				}
+					v, err := strconv.ParseFloat(string(valBytes), 64)
+					if err != nil {
+						skippedValue++
+						continue
+					}
+					if timed {
+						t = bw.Since(phases.Parse, t)
+					}
 
-				s, ok := local[station]
-				if !ok {
-					local[station] = Stats{
-						Min:   v,
-						Max:   v,
-						Sum:   v,
-						Count: 1,
+					s, ok := local[station]
+					if !ok {
+						s = Stats{Min: v, Max: v}
 					}
-					continue
-				}
 
-				if v < s.Min {
-					s.Min = v
-				}
-				if v > s.Max {
-					s.Max = v
-				}
-				s.Sum += v
-				s.Count++
+					if v < s.Min {
+						s.Min = v
+					}
+					if v > s.Max {
+						s.Max = v
+					}
+					s.Sum += v
+					s.Count++
 
-				local[station] = s
+					local[station] = s
+					if timed {
+						bw.Since(phases.Update, t)
+					}
+				}
+				bufpool.Put(block)
 			}
 
 			resultChan <- local
@@ -96,23 +144,46 @@ func main() {
 	}
 
 	// ---------------- READER ----------------
+	// Lines are handed to the workers in blocks of whole lines. The blocks
+	// come from a pool and the workers put them back, so reading stops
+	// allocating once the pool is warm.
+	reader := breakdown.Worker("reader")
 	go func() {
+		defer close(blockChan)
+		reader.Start()
+		defer reader.Stop()
+		buf := bufpool.Get(blockSize)
+		carry := 0
 		for {
-			line, err := reader.ReadBytes('\n')
-			if len(line) > 0 {
-				// strip newline
-				if line[len(line)-1] == '\n' {
-					line = line[:len(line)-1]
-				}
-				b := make([]byte, len(line))
-				copy(b, line)
-				lineChan <- b
+			if carry == len(buf) {
+				// line longer than a block
+				buf = bufpool.Grow(buf)
 			}
+			readStart := time.Now()
+			n, err := io.ReadFull(f, buf[carry:])
+			reader.Add(phases.Read, time.Since(readStart))
+			data := buf[:carry+n]
 			if err != nil {
-				break
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					panic(err)
+				}
+				if len(data) > 0 {
+					blockChan <- data
+				}
+				return
+			}
+
+			nl := bytes.LastIndexByte(data, '\n')
+			if nl < 0 {
+				carry = len(data)
+				continue
 			}
+			rest := data[nl+1:]
+			next := bufpool.Get(max(blockSize, len(rest)))
+			carry = copy(next, rest)
+			blockChan <- data[:nl+1]
+			buf = next
 		}
-		close(lineChan)
 	}()
 
 	// ---------------- CLOSE RESULT CHAN WHEN DONE ----------------
@@ -123,8 +194,11 @@ func main() {
 
 	// ---------------- MERGE RESULTS ----------------
 	final := make(map[string]Stats)
+	merger := breakdown.Worker("merge")
 
 	for partial := range resultChan {
+		merger.Start()
+		mergeStart := time.Now()
 		for station, p := range partial {
 			s, ok := final[station]
 			if !ok {
@@ -143,6 +217,15 @@ func main() {
 
 			final[station] = s
 		}
+		merger.Add(phases.Merge, time.Since(mergeStart))
+		merger.Stop()
+	}
+
+	if n := noStation.Load(); n > 0 {
+		log.Warn("skipped lines without station", "lines", n)
+	}
+	if n := badValue.Load(); n > 0 {
+		log.Warn("skipped lines with invalid temperature", "lines", n)
 	}
 
 	// ---------------- OUTPUT ----------------
@@ -150,4 +233,5 @@ func main() {
 		avg := s.Sum / float64(s.Count)
 		fmt.Printf("%s=%.1f/%.1f/%.1f\n", station, s.Min, avg, s.Max)
 	}
+	breakdown.WriteTable(os.Stderr)
 }
@@ -2,10 +2,16 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/hll"
+	"github.com/djheidihoe/1brc/internal/logging"
+	"github.com/djheidihoe/1brc/internal/phases"
 )
 
 // Stats holds min, max, sum, and count for each city
@@ -17,6 +23,18 @@ type Stats struct {
 }
 
 func main() {
+	newLogger := logging.Flags(flag.CommandLine)
+	showBreakdown := flag.Bool("breakdown", false, "print the time spent per phase to stderr")
+	flag.Parse()
+	breakdown := phases.New(*showBreakdown)
+	log, err := newLogger()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	bw := breakdown.Worker("main")
+	bw.Start()
+
 	// Adjust path if needed
 	file, err := os.Open("../data/measurements.txt")
 	if err != nil {
@@ -24,27 +42,53 @@ func main() {
 	}
 	defer file.Close()
 
-	stats := make(map[string]*Stats, 1<<16) // preallocate some space
+	info, err := file.Stat()
+	if err != nil {
+		panic(err)
+	}
+	// size the map for the stations of the input, so it never rehashes
+	est, err := hll.Probe(file, info.Size())
+	if err != nil {
+		panic(err)
+	}
+	stats := make(map[string]*Stats, est.Stations)
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bw.Reader(file))
 	// Increase buffer size for long lines
 	const maxCapacity = 1024 * 1024
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, maxCapacity)
 
-	for scanner.Scan() {
+	var noStation, badValue int64
+	for {
+		timed := bw.Sample()
+		var t time.Time
+		if timed {
+			t = time.Now()
+		}
+		if !scanner.Scan() {
+			break
+		}
 		line := scanner.Text()
 		// Split once on ';'
 		sep := strings.IndexByte(line, ';')
 		if sep < 0 {
+			noStation++
 			continue
 		}
 		city := line[:sep]
 		valStr := line[sep+1:]
+		if timed {
+			t = bw.Since(phases.Scan, t)
+		}
 		val, err := strconv.ParseFloat(valStr, 64)
 		if err != nil {
+			badValue++
 			continue
 		}
+		if timed {
+			t = bw.Since(phases.Parse, t)
+		}
 
 		s, ok := stats[city]
 		if !ok {
@@ -59,15 +103,26 @@ func main() {
 			s.sum += val
 			s.count++
 		}
+		if timed {
+			bw.Since(phases.Update, t)
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
 		panic(err)
 	}
+	bw.Stop()
+	if noStation > 0 {
+		log.Warn("skipped lines without station", "lines", noStation)
+	}
+	if badValue > 0 {
+		log.Warn("skipped lines with invalid temperature", "lines", badValue)
+	}
 
 	// Print results
 	for city, s := range stats {
 		avg := s.sum / float64(s.count)
 		fmt.Printf("%s => min: %.2f, max: %.2f, avg: %.2f\n", city, s.min, s.max, avg)
 	}
+	breakdown.WriteTable(os.Stderr)
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/flamegraph"
+)
+
+// Sampling rates of the contention profiles. One in mutexFraction lock
+// contentions is recorded, enough to rank the remaining locks without slowing
+// them down, and blocking events are sampled about once per blockRate
+// nanoseconds blocked, so the brief waits of the read path are kept while a
+// long wg.Wait costs a single sample.
+const (
+	mutexFraction = 10
+	blockRate     = 10_000
+)
+
+// contention enables the mutex and block profiles requested by -mutexprofile
+// and -blockprofile.
+type contention struct {
+	mutexPath, blockPath string
+}
+
+func (c contention) start() {
+	if c.mutexPath != "" {
+		runtime.SetMutexProfileFraction(mutexFraction)
+	}
+	if c.blockPath != "" {
+		runtime.SetBlockProfileRate(blockRate)
+	}
+}
+
+// stop writes the profiles and summarizes them on w.
+func (c contention) stop(w io.Writer) error {
+	for _, p := range []struct{ name, path, what string }{
+		{"mutex", c.mutexPath, "contended locks"},
+		{"block", c.blockPath, "blocking sites"},
+	} {
+		if p.path == "" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := pprof.Lookup(p.name).WriteTo(&buf, 0); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p.path, buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+		stacks, err := flamegraph.Fold(&buf)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "top %s (%s profile in %s):\n", p.what, p.name, p.path)
+		writeTopSites(w, stacks, 5)
+	}
+	return nil
+}
+
+// writeTopSites writes the n call sites with the most delay in stacks. The site
+// of a stack is its innermost frame outside the runtime and sync packages,
+// e.g. the getOrAdd waiting for a growing intern table to be copied.
+func writeTopSites(w io.Writer, stacks flamegraph.Stacks, n int) {
+	sites := map[string]int64{}
+	var total int64
+	for stack, delay := range stacks {
+		frames := strings.Split(stack, ";")
+		site := frames[len(frames)-1]
+		for i := len(frames) - 1; i >= 0; i-- {
+			if !isRuntimeFrame(frames[i]) {
+				site = frames[i]
+				break
+			}
+		}
+		sites[site] += delay
+		total += delay
+	}
+	if total == 0 {
+		fmt.Fprintln(w, "  none recorded")
+		return
+	}
+	names := make([]string, 0, len(sites))
+	for site := range sites {
+		names = append(names, site)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(sites[b], sites[a]), strings.Compare(a, b))
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, site := range names[:min(n, len(names))] {
+		fmt.Fprintf(tw, "  %v\t%.1f%%\t%s\n", time.Duration(sites[site]).Round(time.Microsecond), 100*float64(sites[site])/float64(total), site)
+	}
+	tw.Flush()
+}
+
+func isRuntimeFrame(name string) bool {
+	for _, prefix := range []string{"runtime.", "sync.", "internal/", "sync/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/cpu"
+	"github.com/djheidihoe/1brc/internal/dop"
+	"github.com/djheidihoe/1brc/internal/hll"
+	"github.com/djheidihoe/1brc/internal/phases"
 )
 
 // Stat holds metrics in integer tenths
@@ -17,67 +27,231 @@ type Stat struct {
 	count int64
 }
 
-// Intern is a sharded interner that assigns a compact int32 ID for each unique city.
-// Lookups are by 64-bit FNV-1a hash; collisions are resolved by byte-wise compare
-// against the stored string without allocating temporary strings.
+// Intern is a lock-free interner that assigns a compact int32 ID for each
+// unique city. Lookups are by 64-bit FNV-1a hash into an open-addressing
+// table of atomic slots; collisions are resolved by byte-wise compare against
+// the stored name without allocating temporary strings. A new city is added
+// with a compare-and-swap on the first empty slot of its probe sequence, so
+// workers do not wait on each other, however many cores they run on.
+//
+// The table grows in epochs: a full table is linked to one twice its size,
+// its entries are copied over and its empty slots closed, so an insert racing
+// with the copy moves on to the new table instead of being lost. Only a burst
+// of new cities during a copy makes workers wait for it. Retired tables are
+// left to the garbage collector once no worker holds them.
+//
+// Names are copied into large append-only byte arenas instead of one Go string
+// per city, so 10K cities are a handful of allocations and the output phase
+// reads names from contiguous memory.
 type Intern struct {
-	shards  [256]internShard
-	names   []string
-	namesMu sync.Mutex
+	table atomic.Pointer[internTable]
+	arena atomic.Pointer[nameArena]
+	ids   atomic.Int32 // IDs handed out
+
+	namesOnce sync.Once
+	names     [][]byte // ID -> name, built by Name once parsing is done
+}
+
+// arenaSize is the capacity of a single name arena (names are at most 100 bytes).
+const arenaSize = 1 << 20
+
+// nameArena is a name arena shared by all workers, who reserve their bytes by
+// advancing off.
+type nameArena struct {
+	buf []byte
+	off atomic.Int64
 }
 
-type internShard struct {
-	mu sync.RWMutex
-	m  map[uint64][]int32 // hash -> list of IDs to resolve collisions
+// internTable is one epoch of the interner's table.
+type internTable struct {
+	slots  []atomic.Pointer[internEntry]
+	mask   uint64
+	count  atomic.Int64
+	next   atomic.Pointer[internTable] // set once the table is full
+	ready  atomic.Bool                 // the previous epoch is copied over
+	moved  chan struct{}               // closed when ready is set
+	direct atomic.Int64                // inserts while not ready, see getOrAdd
 }
 
-func newIntern() *Intern {
+// internEntry is the immutable content of a slot. It keeps the arena bytes of
+// a name next to its ID and hash, so the read path compares without touching
+// shared state.
+type internEntry struct {
+	hash uint64
+	id   int32
+	name []byte
+}
+
+// closedSlot marks the empty slots of a table being copied to the next epoch.
+var closedSlot = &internEntry{}
+
+// newIntern returns an interner sized for about cardinality cities, so the
+// table rarely has to grow while workers register them.
+func newIntern(cardinality int) *Intern {
 	in := &Intern{}
-	for i := range in.shards {
-		in.shards[i].m = make(map[uint64][]int32, 4096)
-	}
+	t := newInternTable(2 * cardinality)
+	t.ready.Store(true)
+	close(t.moved)
+	in.table.Store(t)
+	in.arena.Store(&nameArena{buf: make([]byte, arenaSize)})
 	return in
 }
 
+// newInternTable returns a table of at least size slots, a power of two.
+func newInternTable(size int) *internTable {
+	n := 1024
+	for n < size {
+		n *= 2
+	}
+	return &internTable{slots: make([]atomic.Pointer[internEntry], n), mask: uint64(n - 1), moved: make(chan struct{})}
+}
+
 func (in *Intern) GetOrAdd(b []byte) int32 {
 	h := fnv1a64(b)
-	sh := &in.shards[h&255]
-
-	// fast read path
-	sh.mu.RLock()
-	ids := sh.m[h]
-	sh.mu.RUnlock()
-	for _, id := range ids {
-		if equalSB(in.names[id], b) {
+	var e *internEntry // the entry to add, once b is known to be new
+	for t := in.table.Load(); ; {
+		id, next, ok := t.getOrAdd(h, b, &e, in)
+		if ok {
 			return id
 		}
+		t = next
+	}
+}
+
+// getOrAdd looks b up in t and adds it if it is missing, allocating *e the
+// first time. If t is being copied to the next epoch it returns that table
+// and false instead.
+func (t *internTable) getOrAdd(h uint64, b []byte, e **internEntry, in *Intern) (int32, *internTable, bool) {
+	for i, probes := h&t.mask, 0; probes < len(t.slots); i, probes = (i+1)&t.mask, probes+1 {
+		slot := &t.slots[i]
+		cur := slot.Load()
+		for cur == nil {
+			if *e == nil {
+				*e = in.newEntry(h, b)
+			}
+			// while the previous epoch, at most half of t, is copied in,
+			// workers may add a quarter of t, so the copy always has room
+			if !t.ready.Load() && t.direct.Add(1) > int64(len(t.slots)/4) {
+				<-t.moved
+				return 0, t, false
+			}
+			if slot.CompareAndSwap(nil, *e) {
+				if n := t.count.Add(1); n > int64(len(t.slots))*3/4 && t == in.table.Load() {
+					in.grow(t)
+				}
+				return (*e).id, nil, true
+			}
+			cur = slot.Load()
+		}
+		if cur == closedSlot {
+			break
+		}
+		if cur.hash == h && equalBB(cur.name, b) {
+			return cur.id, nil, true
+		}
 	}
+	// t is closed, or filled up by workers racing the copy that closes it
+	return 0, in.grow(t), false
+}
 
-	// not found: allocate once and register
-	s := string(b)
-	in.namesMu.Lock()
-	id := int32(len(in.names))
-	in.names = append(in.names, s)
-	in.namesMu.Unlock()
+// newEntry copies b into the current arena and assigns it the next ID. If
+// another worker adds the same city first, the ID stays unused, so IDs may
+// have gaps.
+func (in *Intern) newEntry(h uint64, b []byte) *internEntry {
+	n := int64(len(b))
+	for {
+		a := in.arena.Load()
+		if end := a.off.Add(n); end <= int64(len(a.buf)) {
+			name := a.buf[end-n : end : end]
+			copy(name, b)
+			return &internEntry{hash: h, id: in.ids.Add(1) - 1, name: name}
+		}
+		na := &nameArena{buf: make([]byte, max(arenaSize, len(b)))}
+		na.off.Store(n)
+		if in.arena.CompareAndSwap(a, na) {
+			name := na.buf[:n:n]
+			copy(name, b)
+			return &internEntry{hash: h, id: in.ids.Add(1) - 1, name: name}
+		}
+	}
+}
 
-	// write into shard
-	sh.mu.Lock()
-	sh.m[h] = append(ids, id)
-	sh.mu.Unlock()
+// grow returns the next epoch of t, creating it and copying the entries of t
+// over if no other worker did. Workers that lose the race to create it insert
+// into the new table right away; entries of t they may need are found in t
+// before its closed slots. Once the copy is done the new table becomes the
+// one lookups start from.
+func (in *Intern) grow(t *internTable) *internTable {
+	if next := t.next.Load(); next != nil {
+		return next
+	}
+	next := newInternTable(2 * len(t.slots))
+	if !t.next.CompareAndSwap(nil, next) {
+		return t.next.Load()
+	}
+	for i := range t.slots {
+		e := t.slots[i].Load()
+		for e == nil && !t.slots[i].CompareAndSwap(nil, closedSlot) {
+			e = t.slots[i].Load()
+		}
+		if e != nil {
+			next.insert(e)
+		}
+	}
+	in.table.Store(next)
+	next.ready.Store(true)
+	close(next.moved)
+	return next
+}
 
-	return id
+// insert adds the entry from the previous epoch to t, unless a worker has
+// already added the same city.
+func (t *internTable) insert(e *internEntry) {
+	for i, probes := e.hash&t.mask, 0; ; i, probes = (i+1)&t.mask, probes+1 {
+		if probes == len(t.slots) {
+			panic("intern: no room for the previous epoch") // see getOrAdd
+		}
+		cur := t.slots[i].Load()
+		for cur == nil {
+			if t.slots[i].CompareAndSwap(nil, e) {
+				t.count.Add(1)
+				return
+			}
+			cur = t.slots[i].Load()
+		}
+		if cur.hash == e.hash && equalBB(cur.name, e.name) {
+			return
+		}
+	}
 }
 
-func (in *Intern) Name(id int32) string {
+// Len returns the number of IDs handed out; IDs are 0..Len()-1, and the few
+// lost to races have no name.
+func (in *Intern) Len() int {
+	return int(in.ids.Load())
+}
+
+// Name returns the name bytes of id, nil for an unused ID; they must not be
+// modified. It may only be called once all GetOrAdd calls returned.
+func (in *Intern) Name(id int32) []byte {
+	in.namesOnce.Do(func() {
+		in.names = make([][]byte, in.Len())
+		t := in.table.Load()
+		for i := range t.slots {
+			if e := t.slots[i].Load(); e != nil {
+				in.names[e.id] = e.name
+			}
+		}
+	})
 	return in.names[id]
 }
 
-func equalSB(s string, b []byte) bool {
-	if len(s) != len(b) {
+func equalBB(a, b []byte) bool {
+	if len(a) != len(b) {
 		return false
 	}
 	for i := 0; i < len(b); i++ {
-		if s[i] != b[i] {
+		if a[i] != b[i] {
 			return false
 		}
 	}
@@ -98,6 +272,19 @@ func fnv1a64(b []byte) uint64 {
 }
 
 func main() {
+	cardinalityHint := flag.Int("cardinality-hint", 0, "expected number of distinct cities, e.g. 10000 for the 10K station dataset (0 estimates it from the first 4MB)")
+	// the input is mapped, so page faults show up in the scan phase
+	showBreakdown := flag.Bool("breakdown", false, "print the time spent per phase and worker to stderr")
+	fixedWorkers := flag.Int("workers", 0, "number of workers (0 adapts it to the throughput, up to GOMAXPROCS)")
+	interval := flag.Duration("dop-interval", dop.DefaultInterval, "how long the adaptive workers measure each worker count")
+	traceWorkers := flag.Bool("trace-workers", false, "print the worker counts the adaptive workers measured to stderr")
+	var profiles contention
+	flag.StringVar(&profiles.mutexPath, "mutexprofile", "", "write a mutex contention profile to `path` and summarize the top contended locks on stderr")
+	flag.StringVar(&profiles.blockPath, "blockprofile", "", "write a blocking profile to `path` and summarize the top blocking sites on stderr")
+	flag.Parse()
+	breakdown := phases.New(*showBreakdown)
+	profiles.start()
+
 	// --- CPU profiling ---
 	cpuFile, err := os.Create("cpu.prof")
 	if err != nil {
@@ -140,89 +327,149 @@ func main() {
 	defer syscall.Munmap(data)
 
 	// --- parallel parsing ---
-	nCPU := runtime.NumCPU()
-	// Empirically, 6–10 workers can be optimal on M2 Max due to memory bandwidth vs. GC;
-	// use min(nCPU, 8) as a starting point.
-	workers := nCPU
-	if workers > 8 {
-		workers = 8
+	// workers claim blocks of the input in turn, up to as many as there
+	// are CPUs the runtime uses, and the controller parks those past the
+	// count at which the throughput stops scaling, e.g. at the memory
+	// bandwidth
+	workers := runtime.GOMAXPROCS(0)
+	var ctl *dop.Controller
+	if *fixedWorkers > 0 {
+		workers = *fixedWorkers
+	} else {
+		ctl = dop.New(workers, *interval)
+	}
+
+	// the interner holds every city, a worker's map those of its blocks
+	est := hll.Stations(data[:min(len(data), hll.SampleSize)], int64(len(data)))
+	if *cardinalityHint > 0 {
+		est.Stations = *cardinalityHint
 	}
-	runtime.GOMAXPROCS(workers)
+	perWorker := est.Within(1 / float64(workers))
 
-	chunk := len(data) / workers
-	intern := newIntern()
+	intern := newIntern(est.Stations)
+	blocks := (len(data) + blockSize - 1) / blockSize
+	var claimed atomic.Int64
 
-	locals := make([]map[int32]Stat, workers)
+	locals := make([]local, workers)
 	var wg sync.WaitGroup
 	wg.Add(workers)
 
 	for i := 0; i < workers; i++ {
-		start := i * chunk
-		end := start + chunk
-		if i == workers-1 {
-			end = len(data)
-		}
-		// align start to line boundary (skip partial line)
-		if i > 0 {
-			for start < end && data[start] != '\n' {
-				start++
-			}
-			if start < end {
-				start++
-			}
-		}
-		// align end to include up to next newline (so last line is complete)
-		if i < workers-1 {
-			for end < len(data) && data[end] != '\n' {
-				end++
-			}
-		}
-
-		go func(idx, s, e int) {
+		bw := breakdown.Worker(strconv.Itoa(i))
+		go func(idx int) {
 			defer wg.Done()
-			// heuristic pre-size: unique cities per worker are usually small relative to rows
-			m := make(map[int32]Stat, 8192)
-			parseChunkIDs(data[s:e], m, intern)
-			locals[idx] = m
-		}(i, start, end)
+			m := make(map[int32]Stat, perWorker)
+			locals[idx].m = m
+			for ctl.Wait(idx) {
+				b := int(claimed.Add(1) - 1)
+				if b >= blocks {
+					ctl.Finish()
+					return
+				}
+				block := lineBlock(data, b)
+				// the wall clock leaves out the time parked
+				bw.Start()
+				parseChunkIDs(block, m, intern, bw)
+				bw.Stop()
+				ctl.Add(len(block))
+			}
+		}(i)
 	}
 
 	wg.Wait()
+	if *traceWorkers {
+		ctl.WriteTable(os.Stderr)
+	}
 
 	// --- merge results ---
-	global := make(map[int32]Stat, 1<<16)
-	for _, m := range locals {
-		for id, st := range m {
-			if g, ok := global[id]; !ok {
-				global[id] = st
-			} else {
-				if st.min < g.min {
-					g.min = st.min
-				}
-				if st.max > g.max {
-					g.max = st.max
-				}
-				g.sum += st.sum
-				g.count += st.count
-				global[id] = g
+	// IDs are dense, so the merge indexes a slice instead of hashing into a
+	// third map, however many cities there are
+	merger := breakdown.Worker("merge")
+	merger.Start()
+	mergeStart := time.Now()
+	global := make([]Stat, intern.Len())
+	for _, l := range locals {
+		for id, st := range l.m {
+			g := &global[id]
+			if g.count == 0 {
+				*g = st
+				continue
 			}
+			if st.min < g.min {
+				g.min = st.min
+			}
+			if st.max > g.max {
+				g.max = st.max
+			}
+			g.sum += st.sum
+			g.count += st.count
 		}
 	}
+	merger.Add(phases.Merge, time.Since(mergeStart))
+	merger.Stop()
 
 	// --- output ---
 	for id, s := range global {
+		if s.count == 0 {
+			continue
+		}
 		avg := float64(s.sum) / float64(s.count) / 10.0
 		fmt.Printf("%s => min: %.1f, max: %.1f, avg: %.2f\n",
-			intern.Name(id), float64(s.min)/10.0, float64(s.max)/10.0, avg)
+			intern.Name(int32(id)), float64(s.min)/10.0, float64(s.max)/10.0, avg)
+	}
+	breakdown.WriteTable(os.Stderr)
+	if err := profiles.stop(os.Stderr); err != nil {
+		panic(err)
 	}
 }
 
+// local is the state of a worker, on cache lines of its own so that workers
+// updating theirs do not take turns owning a line.
+type local struct {
+	m map[int32]Stat
+	_ cpu.CacheLinePad
+}
+
+// blockSize is the size of the blocks of the input the workers claim, small
+// enough for the controller to park and add workers within a run and large
+// enough for a claim to cost nothing next to parsing it.
+const blockSize = 4 << 20
+
+// lineBlock returns block i of data, from the line that starts in it or at
+// its start up to the line that does so in the next.
+func lineBlock(data []byte, i int) []byte {
+	start, end := i*blockSize, min((i+1)*blockSize, len(data))
+	if i > 0 {
+		start = lineStart(data, start)
+	}
+	end = lineStart(data, end)
+	return data[start:max(start, end)]
+}
+
+// lineStart returns the start of the first line at or after off, that
+// after the newline at off-1 or later.
+func lineStart(data []byte, off int) int {
+	if off >= len(data) {
+		return len(data)
+	}
+	nl := bytes.IndexByte(data[off-1:], '\n')
+	if nl < 0 {
+		return len(data)
+	}
+	return off + nl
+}
+
 // parseChunkIDs scans buffer line-by-line, aggregates by city ID (int32).
-// Format: City;[-]dd.d\n
-func parseChunkIDs(buf []byte, m map[int32]Stat, intern *Intern) {
+// Format: City;[-]dd.d\n. One in phases.SampleEvery lines is timed on bw.
+func parseChunkIDs(buf []byte, m map[int32]Stat, intern *Intern, bw *phases.Worker) {
 	n := len(buf)
 	i := 0
 	for i < n {
+		timed := bw.Sample()
+		var t time.Time
+		if timed {
+			t = time.Now()
+		}
 		lineStart := i
 
 		// find semicolon
@@ -245,6 +492,9 @@ func parseChunkIDs(buf []byte, m map[int32]Stat, intern *Intern) {
 		if semi < 0 {
 			break
 		}
+		if timed {
+			t = bw.Since(phases.Scan, t)
+		}
 
 		// parse temperature
 		sign := int32(1)
@@ -285,6 +535,9 @@ func parseChunkIDs(buf []byte, m map[int32]Stat, intern *Intern) {
 		if i < n && buf[i] == '\n' {
 			i++
 		}
+		if timed {
+			t = bw.Since(phases.Parse, t)
+		}
 
 		// get city ID via interner, avoiding temp string allocations
 		cityID := intern.GetOrAdd(buf[lineStart:semi])
@@ -308,5 +561,8 @@ func parseChunkIDs(buf []byte, m map[int32]Stat, intern *Intern) {
 				count: 1,
 			}
 		}
+		if timed {
+			bw.Since(phases.Update, t)
+		}
 	}
 }
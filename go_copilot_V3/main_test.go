@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestInternConcurrent has workers add the same cities in different orders
+// to an interner too small for them, so that they race each other's inserts
+// and the copies of every epoch. Run it with -race.
+func TestInternConcurrent(t *testing.T) {
+	const workers, cities = 8, 20000
+	names := make([][]byte, cities)
+	for i := range names {
+		names[i] = fmt.Appendf(nil, "city-%d", i)
+	}
+	in := newIntern(16)
+	ids := make([][]int32, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids[w] = make([]int32, cities)
+			for k := range cities {
+				// each worker starts at a city of its own
+				i := (k + w*cities/workers) % cities
+				ids[w][i] = in.GetOrAdd(names[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[int32]int, cities)
+	for i, name := range names {
+		id := ids[0][i]
+		for w := 1; w < workers; w++ {
+			if ids[w][i] != id {
+				t.Fatalf("%s has ID %d for worker 0 and %d for worker %d", name, id, ids[w][i], w)
+			}
+		}
+		if j, dup := seen[id]; dup {
+			t.Fatalf("%s and %s share ID %d", name, names[j], id)
+		}
+		seen[id] = i
+		if got := in.Name(id); string(got) != string(name) {
+			t.Fatalf("Name(%d) = %q, want %q", id, got, name)
+		}
+	}
+	if in.Len() < cities {
+		t.Errorf("Len = %d, want at least %d", in.Len(), cities)
+	}
+}
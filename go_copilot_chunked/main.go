@@ -1,12 +1,37 @@
 package main
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/bufpool"
+	"github.com/djheidihoe/1brc/internal/cpu"
+	"github.com/djheidihoe/1brc/internal/hll"
+	"github.com/djheidihoe/1brc/internal/output"
+	"github.com/djheidihoe/1brc/internal/phases"
 )
 
+// blockSize is the read size of the pooled worker buffers.
+const blockSize = 4 << 20
+
+// local is the state of a worker, on cache lines of its own so that workers
+// updating theirs do not take turns owning a line.
+type local struct {
+	m map[string]Stat
+	_ cpu.CacheLinePad
+}
+
 // Stat holds metrics in integer tenths for speed and precision
 type Stat struct {
 	min   int32
@@ -16,6 +41,15 @@ type Stat struct {
 }
 
 func main() {
+	// Lines are at most 100 bytes of name, ';', "-99.9" and '\n' per spec, so
+	// a worker never reads more than this past its chunk to finish its last
+	// line.
+	maxLineLength := flag.Int("max-line-length", 128, "longest expected line in `bytes`, bounds the overlap read at chunk boundaries")
+	showBreakdown := flag.Bool("breakdown", false, "print the time spent per phase and worker to stderr")
+	outPath := flag.String("out", output.Stdout, "write the results to `path`, replaced atomically (- for stdout)")
+	flag.Parse()
+	breakdown := phases.New(*showBreakdown)
+
 	// --- CPU profiling setup ---
 	cpuFile, err := os.Create("cpu.prof")
 	if err != nil {
@@ -57,9 +91,9 @@ func main() {
 	workers := nCPU
 
 	// Chunking with overlap to align at newline boundaries
-	// Each worker reads [start, end+overlap] and then trims to full lines
+	// Each worker owns the lines starting in [start, end] and reads up to
+	// maxLineLength past end to finish the last of them
 	chunk := size / int64(workers)
-	const overlap = int64(1 << 20) // 1MB overlap for boundary search
 
 	type Work struct {
 		start int64
@@ -78,78 +112,48 @@ func main() {
 
 	// Per-worker local maps to avoid contention.
 	// We use map[string]Stat; keys are city names as strings (allocation unavoidable).
-	locals := make([]map[string]Stat, workers)
-	// Heuristic: estimate average line length ~ 20-40 bytes; pre-size maps to reduce rehash.
-	estPerWorker := int(size/int64(workers)) / 32
-	if estPerWorker < 2048 {
-		estPerWorker = 2048
+	locals := make([]local, workers)
+	// Size the maps for the stations of the input and of a worker's share
+	// of it, as estimated from its start, so that they never rehash.
+	est, err := hll.Probe(f, size)
+	if err != nil {
+		panic(err)
 	}
+	perWorker := est.Within(1 / float64(workers))
 
 	var wg sync.WaitGroup
 	wg.Add(workers)
+	var straddling atomic.Int64
 
 	for i := 0; i < workers; i++ {
 		i := i
+		bw := breakdown.Worker(strconv.Itoa(i))
 		go func() {
 			defer wg.Done()
+			bw.Start()
+			defer bw.Stop()
 
-			// Read with overlap
-			start := wks[i].start
-			end := wks[i].end
-			readStart := start
-			readEnd := end + overlap
-			if readEnd >= size {
-				readEnd = size - 1
-			}
-			readLen := readEnd - readStart + 1
-			buf := make([]byte, readLen)
-			_, err := f.ReadAt(buf, readStart)
-			if err != nil {
-				// For big files, partial read errors are possible; keep simple: panic
-				panic(err)
-			}
-
-			// Adjust to start at the first newline after 'start' (unless first chunk)
-			offset := int64(0)
-			if start != 0 {
-				for offset < readLen {
-					if buf[offset] == '\n' {
-						offset++
-						break
-					}
-					offset++
-				}
-				if offset >= readLen {
-					// No newline found in overlap; nothing to process
-					return
-				}
-			}
-
-			// Trim end to the last newline before end+overlap
-			limit := readLen
-			if end < size-1 {
-				// scan backward to newline
-				j := readLen - 1
-				for j >= 0 && buf[j] != '\n' {
-					j--
-				}
-				if j >= 0 {
-					limit = j + 1 // include newline
-				}
+			m := make(map[string]Stat, perWorker)
+			if off, ok := readRange(f, wks[i].start, wks[i].end+1, size, int64(*maxLineLength), m, bw); !ok {
+				straddling.Add(1)
+				fmt.Fprintf(os.Stderr, "line at offset %d runs past the %d byte overlap of chunk %d, skipped\n", off, *maxLineLength, i)
 			}
-
-			m := make(map[string]Stat, estPerWorker)
-			parseChunk(buf[offset:limit], m)
-			locals[i] = m
+			locals[i].m = m
 		}()
 	}
 
 	wg.Wait()
+	if n := straddling.Load(); n > 0 {
+		fmt.Fprintf(os.Stderr, "%d lines longer than -max-line-length straddled chunk boundaries, raise it to include them\n", n)
+	}
 
 	// Merge local maps
-	global := make(map[string]Stat, workers*estPerWorker)
-	for _, m := range locals {
-		for city, st := range m {
+	merger := breakdown.Worker("merge")
+	merger.Start()
+	mergeStart := time.Now()
+	global := make(map[string]Stat, est.Stations)
+	for _, l := range locals {
+		for city, st := range l.m {
 			if g, ok := global[city]; !ok {
 				global[city] = st
 			} else {
@@ -166,21 +170,112 @@ func main() {
 			}
 		}
 	}
+	merger.Add(phases.Merge, time.Since(mergeStart))
+	merger.Stop()
+	breakdown.WriteTable(os.Stderr)
+
+	// Output: min, max, avg with two decimals, sorted by city
+	err = output.WriteFile(*outPath, func(w io.Writer) error {
+		for _, city := range slices.Sorted(maps.Keys(global)) {
+			s := global[city]
+			avg := float64(s.sum) / float64(s.count) / 10.0
+			if _, err := fmt.Fprintf(w, "%s => min: %.1f, max: %.1f, avg: %.2f\n",
+				city, float64(s.min)/10.0, float64(s.max)/10.0, avg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// readRange parses the lines of f starting in [start, end) into m, reading
+// blocks of blockSize from the shared buffer pool instead of holding the whole
+// range in memory. The line running into start belongs to the previous
+// worker and is skipped. The last line may extend up to overlap bytes past
+// end; if it runs further, readRange stops there and returns false with the
+// offset of that line. The reads and the parsing are timed on bw.
+func readRange(f *os.File, start, end, size, overlap int64, m map[string]Stat, bw *phases.Worker) (int64, bool) {
+	if start >= end {
+		return 0, true
+	}
+	buf := bufpool.Get(blockSize)
+	defer func() { bufpool.Put(buf) }()
+
+	off := start
+	skipFirst := false
+	if start > 0 {
+		// start begins a line of its own only if the byte before it ends one
+		off, skipFirst = start-1, true
+	}
+	limit := min(end+overlap, size)
+	carry := 0 // bytes of an incomplete line kept at the front of buf
+	for off < limit {
+		if carry == len(buf) {
+			buf = bufpool.Grow(buf)
+		}
+		n := int(min(int64(len(buf)-carry), limit-off))
+		readStart := time.Now()
+		if _, err := f.ReadAt(buf[carry:carry+n], off); err != nil && err != io.EOF {
+			// For big files, partial read errors are possible; keep simple: panic
+			panic(err)
+		}
+		bw.Add(phases.Read, time.Since(readStart))
+		data, base := buf[:carry+n], off-int64(carry) // base is the file offset of data[0]
+		off += int64(n)
+
+		if skipFirst {
+			nl := bytes.IndexByte(data, '\n')
+			if nl < 0 {
+				carry = 0
+				continue
+			}
+			data, base = data[nl+1:], base+int64(nl+1)
+			skipFirst = false
+		}
+		if base >= end {
+			// the skipped line covered the whole chunk
+			return 0, true
+		}
+
+		if off >= end {
+			// the last owned line ends at the first newline from end-1 on
+			from := int(end - 1 - base)
+			if nl := bytes.IndexByte(data[from:], '\n'); nl >= 0 {
+				parseChunk(data[:from+nl+1], m, bw)
+				return 0, true
+			}
+			if off == size {
+				parseChunk(data, m, bw)
+				return 0, true
+			}
+		}
 
-	// Output: min, max, avg with two decimals
-	// for city, s := range global {
-	// 	avg := float64(s.sum) / float64(s.count) / 10.0
-	// 	fmt.Printf("%s => min: %.1f, max: %.1f, avg: %.2f\n",
-	// 		city, float64(s.min)/10.0, float64(s.max)/10.0, avg)
-	// }
+		// keep the trailing incomplete line for the next block
+		nl := bytes.LastIndexByte(data, '\n')
+		parseChunk(data[:nl+1], m, bw)
+		carry = copy(buf, data[nl+1:])
+		if off == limit {
+			return off - int64(carry), false
+		}
+	}
+	return 0, true
 }
 
 // parseChunk scans the buffer line-by-line using byte ops,
-// lines are "City;[-]dd.d\n"
-func parseChunk(buf []byte, m map[string]Stat) {
+// lines are "City;[-]dd.d\n". One in phases.SampleEvery lines is timed on bw.
+func parseChunk(buf []byte, m map[string]Stat, bw *phases.Worker) {
 	n := len(buf)
 	i := 0
 	for i < n {
+		timed := bw.Sample()
+		var t time.Time
+		if timed {
+			t = time.Now()
+		}
+
 		// line start
 		lineStart := i
 
@@ -206,6 +301,9 @@ func parseChunk(buf []byte, m map[string]Stat) {
 			// no semicolon found until end; stop
 			break
 		}
+		if timed {
+			t = bw.Since(phases.Scan, t)
+		}
 
 		// parse temperature after ';' until newline
 		// format: [+-]?digits '.' digit
@@ -253,6 +351,9 @@ func parseChunk(buf []byte, m map[string]Stat) {
 		if i < n && buf[i] == '\n' {
 			i++ // advance to next line
 		}
+		if timed {
+			t = bw.Since(phases.Parse, t)
+		}
 
 		// city key as string
 		city := string(buf[lineStart:semi]) // allocates once per city occurrence
@@ -279,6 +380,9 @@ func parseChunk(buf []byte, m map[string]Stat) {
 				count: 1,
 			}
 		}
+		if timed {
+			bw.Since(phases.Update, t)
+		}
 		_ = lineEnd // kept for clarity; not needed after city extraction
 	}
 }
@@ -2,21 +2,26 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"hash/fnv"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/djheidihoe/1brc/internal/hll"
+	"github.com/djheidihoe/1brc/internal/logging"
+	"github.com/djheidihoe/1brc/internal/phases"
 )
 
 const (
 	inputFile     = "../data/measurements.txt"
-	tmpDir        = "shards_tmp"
-	shardCount    = 32
 	maxLineLength = 128
 )
 
@@ -27,12 +32,18 @@ type Stats struct {
 	Count int64
 }
 
+// errEmpty is the error of mmapFile for an empty file, which cannot be
+// mapped.
+var errEmpty = errors.New("file empty")
+
 // mmap the entire file into memory
 func mmapFile(path string) ([]byte, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	// the mapping outlives the file
+	defer f.Close()
 	stat, err := f.Stat()
 	if err != nil {
 		return nil, err
@@ -40,7 +51,7 @@ func mmapFile(path string) ([]byte, error) {
 
 	size := stat.Size()
 	if size == 0 {
-		return nil, errors.New("file empty")
+		return nil, errEmpty
 	}
 
 	data, err := syscall.Mmap(
@@ -57,11 +68,45 @@ func mmapFile(path string) ([]byte, error) {
 	return data, nil
 }
 
-// much faster value parser for formats like -12.3, 4.3, -0.1
+// much faster value parser for formats like -12.3, 4.3, -0.1: their digits
+// are read from b as an integer, which one division by a power of ten
+// rounds exactly as strconv.ParseFloat does. Other formats, such as
+// exponents, fall back to it.
 func fastParseFloat(b []byte) (float64, error) {
-	return strconv.ParseFloat(string(b), 64)
+	i, neg := 0, false
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		neg, i = b[0] == '-', 1
+	}
+	var mant int64
+	digits, decimals, dot := 0, 0, false
+	for ; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c >= '0' && c <= '9':
+			mant = mant*10 + int64(c-'0')
+			digits++
+			if dot {
+				decimals++
+			}
+		case c == '.' && !dot:
+			dot = true
+		default:
+			return strconv.ParseFloat(string(b), 64)
+		}
+	}
+	if digits == 0 || digits > 15 || decimals >= len(pow10) {
+		return strconv.ParseFloat(string(b), 64)
+	}
+	v := float64(mant) / pow10[decimals]
+	if neg {
+		v = -v
+	}
+	return v, nil
 }
 
+// pow10 are the powers of ten fastParseFloat divides by, all exact.
+var pow10 = [...]float64{1, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11, 1e12, 1e13, 1e14, 1e15}
+
 // find ';' without bounds checks and without allocations
 func findSep(b []byte) int {
 	for i := 0; i < len(b); i++ {
@@ -72,18 +117,80 @@ func findSep(b []byte) int {
 	return -1
 }
 
-func shardIndex(b []byte) int {
+// interner assigns the stations of a shard compact IDs, indexing its Stats,
+// and copies each name once: looking a name up by string(b) does not
+// allocate, unlike keeping it as a map key for each line.
+type interner struct {
+	ids   map[string]int32
+	names []string
+}
+
+func newInterner(size int) *interner {
+	return &interner{ids: make(map[string]int32, size), names: make([]string, 0, size)}
+}
+
+// id returns the ID of the station b, adding it if it is new.
+func (in *interner) id(b []byte) int32 {
+	if id, ok := in.ids[string(b)]; ok {
+		return id
+	}
+	id := int32(len(in.names))
+	name := string(b)
+	in.ids[name] = id
+	in.names = append(in.names, name)
+	return id
+}
+
+func shardIndex(b []byte, shards int) int {
 	h := fnv.New32a()
 	_, _ = h.Write(b)
-	return int(h.Sum32()) % shardCount
+	return int(h.Sum32() % uint32(shards))
+}
+
+// removeOnExit removes dir on SIGINT or SIGTERM, after which it exits with
+// 128 plus the signal number as shells do, and returns the func that removes
+// it otherwise, deferred by main and by the workers that may panic.
+func removeOnExit(dir string) func() {
+	var once sync.Once
+	remove := func() { once.Do(func() { os.RemoveAll(dir) }) }
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		remove()
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
+	return func() {
+		signal.Stop(sigs)
+		remove()
+	}
 }
 
 func main() {
 	start := time.Now()
 
+	newLogger := logging.Flags(flag.CommandLine)
+	// the input is mapped, so page faults show up in the scan phase of the
+	// shard row, and its shard file writes under other
+	showBreakdown := flag.Bool("breakdown", false, "print the time spent per phase and worker to stderr")
+	shardCount := flag.Int("shards", 32, "number of shard files the stations are partitioned into")
+	tmpParent := flag.String("tmp-dir", os.TempDir(), "`directory` to write the shard files to, in a directory of their own removed on exit")
+	flag.Parse()
+	breakdown := phases.New(*showBreakdown)
+	log, err := newLogger()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *shardCount < 1 {
+		fmt.Fprintln(os.Stderr, "-shards must be at least 1")
+		os.Exit(2)
+	}
+	shards := *shardCount
+
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	fmt.Println("M2 Max optimized version running...")
+	log.Info("starting", "input", inputFile, "shards", shards, "cpus", runtime.NumCPU())
 
 	// mmap file
 	data, err := mmapFile(inputFile)
@@ -91,13 +198,19 @@ func main() {
 		panic(err)
 	}
 
-	// prepare shard directory
-	_ = os.RemoveAll(tmpDir)
-	_ = os.Mkdir(tmpDir, 0o755)
+	// prepare shard directory, unique so that runs sharing a directory do
+	// not collide
+	tmpDir, err := os.MkdirTemp(*tmpParent, "go_v1-shards-")
+	if err != nil {
+		panic(err)
+	}
+	cleanup := removeOnExit(tmpDir)
+	defer cleanup()
+	log.Debug("shard directory created", "path", tmpDir)
 
 	// create shard writers
-	shardFiles := make([]*os.File, shardCount)
-	shardBuf := make([][]byte, shardCount)
+	shardFiles := make([]*os.File, shards)
+	shardBuf := make([][]byte, shards)
 
 	for i := range shardFiles {
 		path := filepath.Join(tmpDir, fmt.Sprintf("shard_%02d", i))
@@ -109,10 +222,21 @@ func main() {
 		shardBuf[i] = make([]byte, 0, 8<<20) // 8MB buffers
 	}
 
+	// the shards partition the stations, so each map is sized for its
+	// share of those estimated from the start of the input
+	est := hll.Stations(data[:min(len(data), hll.SampleSize)], int64(len(data)))
+	log.Debug("stations estimated", "stations", est.Stations, "lines", est.Lines)
+
 	//////////////////////////////
 	// PHASE 1: SHARD (mmap scan)
 	//////////////////////////////
+	phaseStart := time.Now()
 	lineStart := 0
+	var skipped int64
+	sharder := breakdown.Worker("shard")
+	sharder.Start()
+	timed := sharder.Sample()
+	t := time.Now()
 
 	for i := 0; i < len(data); i++ {
 		if data[i] != '\n' {
@@ -129,54 +253,102 @@ func main() {
 		// find station end
 		sep := findSep(line)
 		if sep <= 0 {
+			skipped++
 			continue
 		}
+		if timed {
+			t = sharder.Since(phases.Scan, t)
+		}
 
 		station := line[:sep] // raw bytes
-		sh := shardIndex(station)
+		sh := shardIndex(station, shards)
 
 		// append to shard buffer
 		shardBuf[sh] = append(shardBuf[sh], line...)
 		shardBuf[sh] = append(shardBuf[sh], '\n')
+		if timed {
+			sharder.Since(phases.Update, t)
+		}
+		// the scan of the next line starts here
+		if timed = sharder.Sample(); timed {
+			t = time.Now()
+		}
 	}
 
 	// write shard buffers
 	for i := range shardFiles {
-		_, _ = shardFiles[i].Write(shardBuf[i])
-		shardFiles[i].Close()
+		if _, err := shardFiles[i].Write(shardBuf[i]); err != nil {
+			panic(err)
+		}
+		if err := shardFiles[i].Close(); err != nil {
+			panic(err)
+		}
+	}
+	sharder.Stop()
+	if skipped > 0 {
+		log.Warn("skipped lines without station", "phase", "shard", "lines", skipped)
 	}
+	log.Info("phase finished", "phase", "shard", "duration", time.Since(phaseStart), "bytes", len(data))
 
 	//////////////////////////////
 	// PHASE 2: PARALLEL AGGREGATE
 	//////////////////////////////
 
+	// the stations of a shard, by their IDs
 	type ShardOut struct {
-		m map[string]Stats
+		names []string
+		stats []Stats
 	}
 
-	out := make(chan ShardOut, shardCount)
+	phaseStart = time.Now()
+	out := make(chan ShardOut, shards)
 	var wg sync.WaitGroup
+	var skippedValues atomic.Int64
 
 	sem := make(chan struct{}, runtime.NumCPU())
 
-	for s := 0; s < shardCount; s++ {
+	for s := 0; s < shards; s++ {
 		wg.Add(1)
 		sem <- struct{}{}
+		bw := breakdown.Worker(strconv.Itoa(s))
 
 		go func(idx int) {
+			// a panic here ends the process without the defers of main
+			defer func() {
+				if r := recover(); r != nil {
+					cleanup()
+					panic(r)
+				}
+			}()
 			defer wg.Done()
 			defer func() { <-sem }()
+			bw.Start()
+			defer bw.Stop()
 
+			log.Debug("worker started", "shard", idx)
+			workerStart := time.Now()
+
+			// the shard is parsed in place, its page faults showing up
+			// in the scan phase
 			path := filepath.Join(tmpDir, fmt.Sprintf("shard_%02d", idx))
-			raw, err := os.ReadFile(path)
-			if err != nil {
-				out <- ShardOut{m: make(map[string]Stats)}
+			raw, err := mmapFile(path)
+			bw.Add(phases.Read, time.Since(workerStart))
+			switch {
+			case errors.Is(err, errEmpty):
+			case err != nil:
+				log.Error("failed to map shard, its stations are missing from the results", "shard", idx, "err", err)
+				out <- ShardOut{}
 				return
+			default:
+				defer syscall.Munmap(raw)
 			}
 
-			m := make(map[string]Stats, 512)
+			in := newInterner(est.Stations/shards + 1)
+			stats := make([]Stats, 0, est.Stations/shards+1)
 			start := 0
 
+			timed := bw.Sample()
+			t := time.Now()
 			for i := 0; i < len(raw); i++ {
 				if raw[i] != '\n' {
 					continue
@@ -190,15 +362,23 @@ func main() {
 					continue
 				}
 
-				station := string(line[:sep])
+				station := line[:sep]
 				valBytes := line[sep+1:]
+				if timed {
+					t = bw.Since(phases.Scan, t)
+				}
 
 				v, err := fastParseFloat(valBytes)
 				if err != nil {
+					skippedValues.Add(1)
 					continue
 				}
+				if timed {
+					t = bw.Since(phases.Parse, t)
+				}
 
-				if st, ok := m[station]; ok {
+				if id := in.id(station); int(id) < len(stats) {
+					st := &stats[id]
 					if v < st.Min {
 						st.Min = v
 					}
@@ -207,13 +387,20 @@ func main() {
 					}
 					st.Sum += v
 					st.Count++
-					m[station] = st
 				} else {
-					m[station] = Stats{Min: v, Max: v, Sum: v, Count: 1}
+					stats = append(stats, Stats{Min: v, Max: v, Sum: v, Count: 1})
+				}
+				if timed {
+					bw.Since(phases.Update, t)
+				}
+				// the scan of the next line starts here
+				if timed = bw.Sample(); timed {
+					t = time.Now()
 				}
 			}
 
-			out <- ShardOut{m: m}
+			log.Debug("worker finished", "shard", idx, "duration", time.Since(workerStart), "bytes", len(raw), "stations", len(stats))
+			out <- ShardOut{names: in.names, stats: stats}
 		}(s)
 	}
 
@@ -227,10 +414,15 @@ func main() {
 	// FINAL MERGE
 	//////////////////////////////
 
-	final := make(map[string]Stats)
+	final := make(map[string]Stats, est.Stations)
+	merger := breakdown.Worker("merge")
 
+	mergeStart := time.Now()
 	for sh := range out {
-		for station, s := range sh.m {
+		merger.Start()
+		shardStart := time.Now()
+		for id, s := range sh.stats {
+			station := sh.names[id]
 			if ex, ok := final[station]; ok {
 				if s.Min < ex.Min {
 					ex.Min = s.Min
@@ -245,8 +437,17 @@ func main() {
 				final[station] = s
 			}
 		}
+		merger.Add(phases.Merge, time.Since(shardStart))
+		merger.Stop()
 	}
 
+	if n := skippedValues.Load(); n > 0 {
+		log.Warn("skipped lines with invalid temperature", "phase", "aggregate", "lines", n)
+	}
+	// aggregation and merge overlap, so the merge time is the wait for the last shard
+	log.Info("phase finished", "phase", "aggregate", "duration", time.Since(phaseStart), "stations", len(final))
+	log.Info("phase finished", "phase", "merge", "duration", time.Since(mergeStart))
+
 	//////////////////////////////
 	// PRINT
 	//////////////////////////////
@@ -256,6 +457,9 @@ func main() {
 		fmt.Printf("%s=%.1f/%.1f/%.1f\n", st, s.Min, avg, s.Max)
 	}
 
-	end := time.Since(start)
-	fmt.Printf("\nCompleted in %v (M2 Max optimized)\n", end)
+	// stdout carries only the results, so downstream tools can parse it
+	if !logging.Quiet(flag.CommandLine) {
+		fmt.Fprintf(os.Stderr, "Completed in %v (M2 Max optimized)\n", time.Since(start))
+	}
+	breakdown.WriteTable(os.Stderr)
 }
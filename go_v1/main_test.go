@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"testing"
+)
+
+// TestFastParseFloat checks fastParseFloat against strconv.ParseFloat, bit
+// for bit, so that the sign of -0.0 counts, and error for error.
+func TestFastParseFloat(t *testing.T) {
+	inputs := []string{
+		"0.0", "-0.0", "+0.0", "-0", "+1.0", "1", "12.3", "-12.3", "-0.1", "99.9", "-99.9",
+		".5", "-.5", "5.", "007.50",
+		// 15 digits are parsed, 16 fall back
+		"123456789012345", "12345.6789012345", "-0.00000000000001", "999999999999999",
+		"1234567890123456", "1234567.890123456", "9007199254740993", "0.1234567890123456",
+		// so do exponents and the rest
+		"1e3", "-1.5E-2", "12.3e1", "Inf", "NaN", "0x1p-2", "1_000",
+		"", "-", "+", ".", "-.", "1.2.3", "12.3x", "abc", "--1", "1-",
+	}
+	for i := -999; i <= 999; i++ {
+		inputs = append(inputs, fmt.Sprintf("%.1f", float64(i)/10))
+	}
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 10000 {
+		digits := strconv.FormatUint(r.Uint64N(1e15), 10)
+		dot := r.IntN(len(digits) + 1)
+		inputs = append(inputs, digits[:dot]+"."+digits[dot:])
+	}
+	for _, in := range inputs {
+		got, gotErr := fastParseFloat([]byte(in))
+		want, wantErr := strconv.ParseFloat(in, 64)
+		if math.Float64bits(got) != math.Float64bits(want) || (gotErr == nil) != (wantErr == nil) {
+			t.Errorf("fastParseFloat(%q) = %v, %v; strconv.ParseFloat = %v, %v", in, got, gotErr, want, wantErr)
+		}
+	}
+}
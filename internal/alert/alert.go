@@ -0,0 +1,215 @@
+// Package alert evaluates threshold rules against results, which turns
+// onebrc into a basic data-quality monitor. A rules file holds one rule per
+// line, optionally as a YAML list under a rules key:
+//
+//	rules:
+//	  - station Hamburg max > 45.0
+//	  - station Las Palmas de Gran Canaria mean < 10
+//	  - any min <= -60
+//	  - any count == 0 from expected.txt
+//
+// A rule names its subject, station NAME or any (station) for every row of
+// the results, a field of min, mean, max or count, a comparison of >, >=, <,
+// <=, == or != and a threshold, readings in degrees. "from PATH" makes the
+// subject the stations listed one per line in the file at PATH, relative to
+// the rules file, and a listed station absent from the results a row with a
+// count of 0, whose other fields never alert.
+//
+// Rules apply to the rows of the results, so to every key of a station in
+// grouped or windowed results.
+package alert
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/djheidihoe/1brc/internal/expect"
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// Rule is a threshold rule of a rules file.
+type Rule struct {
+	// Text is the rule as written and Line its line in the rules file.
+	Text string
+	Line int
+	// Station is the subject of the rule, or "" for any station.
+	Station string
+	// Expected, if set, are the stations any applies to instead of the
+	// rows of the results.
+	Expected []string
+	Field    string
+	Op       string
+	Value    float64
+}
+
+// Alert is a row of the results for which a Rule holds.
+type Alert struct {
+	Rule  *Rule
+	Name  string
+	Value float64
+}
+
+func (a Alert) String() string {
+	prec := 1
+	if a.Rule.Field == "count" {
+		prec = 0
+	}
+	return fmt.Sprintf("alert: %s %s %s (rule %d: %s)", a.Name, a.Rule.Field, strconv.FormatFloat(a.Value, 'f', prec, 64), a.Rule.Line, a.Rule.Text)
+}
+
+var (
+	fields = []string{"min", "mean", "max", "count"}
+	ops    = []string{">", ">=", "<", "<=", "==", "!="}
+)
+
+// ReadFile reads the rules of the rules file at path.
+func ReadFile(path string) ([]*Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []*Rule
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line == "---" || line == "rules:" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "-"))
+		if len(line) > 1 && (line[0] == '"' || line[0] == '\'') && line[len(line)-1] == line[0] {
+			line = line[1 : len(line)-1]
+		}
+		rule, from, err := parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		rule.Line = n
+		if from != "" {
+			if !filepath.IsAbs(from) {
+				from = filepath.Join(filepath.Dir(path), from)
+			}
+			if rule.Expected, err = expect.ReadNames(from); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, sc.Err()
+}
+
+// parse parses a rule, returning the path of its from clause apart.
+func parse(text string) (rule *Rule, from string, err error) {
+	rule = &Rule{Text: text}
+	words := strings.Fields(text)
+	if i := slices.Index(words, "from"); i >= 0 {
+		if i != len(words)-2 {
+			return nil, "", fmt.Errorf("expected from PATH at the end of %q", text)
+		}
+		from, words = words[i+1], words[:i]
+	}
+	if len(words) < 4 {
+		return nil, "", fmt.Errorf("expected SUBJECT FIELD OP VALUE, got %q", text)
+	}
+	subject, cond := words[:len(words)-3], words[len(words)-3:]
+	switch {
+	case subject[0] == "any" && (len(subject) == 1 || len(subject) == 2 && subject[1] == "station"):
+	case subject[0] == "station" && len(subject) > 1:
+		if from != "" {
+			return nil, "", fmt.Errorf("from applies to any, not to station in %q", text)
+		}
+		rule.Station = strings.Join(subject[1:], " ")
+	default:
+		return nil, "", fmt.Errorf("expected station NAME or any before the field in %q", text)
+	}
+	rule.Field, rule.Op = cond[0], cond[1]
+	if !slices.Contains(fields, rule.Field) {
+		return nil, "", fmt.Errorf("unknown field %q, expected one of %s", rule.Field, strings.Join(fields, ", "))
+	}
+	if !slices.Contains(ops, rule.Op) {
+		return nil, "", fmt.Errorf("unknown comparison %q, expected one of %s", rule.Op, strings.Join(ops, " "))
+	}
+	if rule.Value, err = strconv.ParseFloat(cond[2], 64); err != nil || math.IsNaN(rule.Value) {
+		return nil, "", fmt.Errorf("invalid threshold %q", cond[2])
+	}
+	return rule, from, nil
+}
+
+// Evaluate returns the alerts of rules for res, in the order of the rules
+// and then of the rows.
+func Evaluate(rules []*Rule, res *brc.Result) []Alert {
+	rows := map[string][]string{} // the names of the rows of each station
+	for _, name := range res.Names() {
+		station, _ := res.Split(name)
+		rows[station] = append(rows[station], name)
+	}
+
+	var alerts []Alert
+	check := func(rule *Rule, name string, s brc.Stats) {
+		if v, ok := value(rule.Field, s); ok && holds(v, rule.Op, rule.Value) {
+			alerts = append(alerts, Alert{rule, name, v})
+		}
+	}
+	for _, rule := range rules {
+		var stations []string
+		switch {
+		case rule.Station != "":
+			stations = []string{rule.Station}
+		case rule.Expected != nil:
+			stations = rule.Expected
+		default:
+			for name, s := range res.Sorted() {
+				check(rule, name, s)
+			}
+			continue
+		}
+		for _, station := range stations {
+			if len(rows[station]) == 0 {
+				check(rule, station, brc.Stats{})
+			}
+			for _, name := range rows[station] {
+				s, _ := res.Get(name)
+				check(rule, name, s)
+			}
+		}
+	}
+	return alerts
+}
+
+// value returns field of s, in degrees for readings, if s has it.
+func value(field string, s brc.Stats) (float64, bool) {
+	switch {
+	case field == "count":
+		return float64(s.Count), true
+	case s.Count == 0:
+		return 0, false
+	case field == "min":
+		return float64(s.Min) / 10, true
+	case field == "max":
+		return float64(s.Max) / 10, true
+	}
+	return s.Mean(), true
+}
+
+func holds(v float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	case "==":
+		return v == threshold
+	}
+	return v != threshold
+}
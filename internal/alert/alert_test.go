@@ -0,0 +1,65 @@
+package alert
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+func TestEvaluate(t *testing.T) {
+	dir := t.TempDir()
+	rules := "rules:\n" +
+		"  # heat\n" +
+		"  - station Las Palmas max > 45.0\n" +
+		"  - 'any station min <= -10'\n" +
+		"  - any count == 0 from expected.txt\n" +
+		"  - station Oslo mean != 1.5\n"
+	if err := os.WriteFile(filepath.Join(dir, "rules.yaml"), []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "expected.txt"), []byte("Oslo\nRome\n\nBern\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ReadFile(filepath.Join(dir, "rules.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := brc.Process(strings.NewReader("Las Palmas;45.0\nLas Palmas;45.1\nOslo;-10.0\nOslo;13.0\nBern;1.0\n"), brc.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range Evaluate(parsed, res) {
+		got = append(got, a.String())
+	}
+	expected := []string{
+		"alert: Las Palmas max 45.1 (rule 3: station Las Palmas max > 45.0)",
+		"alert: Oslo min -10.0 (rule 4: any station min <= -10)",
+		"alert: Rome count 0 (rule 5: any count == 0 from expected.txt)",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Wrong alerts, expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, text := range []string{
+		"station max > 1",
+		"any max >",
+		"any median > 1",
+		"any max => 1",
+		"any max > warm",
+		"station Oslo count == 0 from list.txt",
+		"any count == 0 from",
+		"every max > 1",
+	} {
+		if _, _, err := parse(text); err == nil {
+			t.Errorf("parse(%q) succeeded", text)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Package arch describes the properties of the target architecture that the
+// scanners of onebrc depend on, so that they pick their word-at-a-time paths
+// only where those pay off and map no more of a file than the address space
+// holds. Everything they load is decoded explicitly little endian, so the
+// byte order only decides what is fast, never what is correct.
+package arch
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"runtime"
+)
+
+// Is64Bit reports whether a uint64 fits a register. The SWAR scanners,
+// which test 8 bytes of a line per instruction, need it to gain over
+// scanning byte by byte.
+const Is64Bit = bits.UintSize == 64
+
+// MaxMap is the size of the largest file mapped into memory at once: a
+// quarter of the 4GB address space of 32-bit architectures, leaving room for
+// the heap, and far beyond any input on 64-bit ones. Larger files are read
+// as streams.
+const MaxMap int64 = 1 << 30 << (bits.UintSize - 32)
+
+// LittleEndian reports whether the architecture is little endian, which
+// makes decoding a little endian word a plain load. s390x and some MIPS and
+// PowerPC variants are big endian and swap the bytes of each word.
+var LittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// UnalignedLoads reports whether words load from any address without a
+// penalty or fault. Elsewhere, e.g. on 32-bit ARM and MIPS, a word at an
+// unaligned address is assembled from its bytes.
+var UnalignedLoads = runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64" || runtime.GOARCH == "386" || runtime.GOARCH == "ppc64le" || runtime.GOARCH == "ppc64" || runtime.GOARCH == "s390x" || runtime.GOARCH == "loong64"
+
+// FastWords reports whether loading and decoding a little endian word of 8
+// bytes costs about one instruction, the assumption of the SWAR scanners.
+var FastWords = Is64Bit && LittleEndian && UnalignedLoads
@@ -0,0 +1,59 @@
+// Package bufpool provides byte buffers from size-classed sync.Pools, so the
+// read backends of onebrc and the go_* variants can reuse their blocks instead
+// of allocating one per read.
+package bufpool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Buffers are pooled in power of two size classes from 4KB to 1GB, larger
+// requests are allocated directly.
+const (
+	minClass = 12
+	maxClass = 30
+)
+
+var pools [maxClass + 1]sync.Pool
+
+// class returns the size class holding buffers of n bytes.
+func class(n int) int {
+	if n <= 1<<minClass {
+		return minClass
+	}
+	return bits.Len(uint(n - 1))
+}
+
+// Get returns a buffer of length n. Its capacity is n rounded up to the size
+// class, so Put can file it back.
+func Get(n int) []byte {
+	c := class(n)
+	if c > maxClass {
+		return make([]byte, n)
+	}
+	if p, ok := pools[c].Get().(*[]byte); ok {
+		return (*p)[:n]
+	}
+	return make([]byte, n, 1<<c)
+}
+
+// Put returns b to the pool of its size class. b and any slices of it must
+// not be used afterwards. Buffers that did not come from Get are dropped.
+func Put(b []byte) {
+	c := class(cap(b))
+	if c > maxClass || cap(b) != 1<<c {
+		return
+	}
+	b = b[:cap(b)]
+	pools[c].Put(&b)
+}
+
+// Grow returns a buffer twice as long as b holding the contents of b, and
+// releases b. It makes room for lines longer than a whole read block.
+func Grow(b []byte) []byte {
+	g := Get(2 * max(len(b), 1))
+	copy(g, b)
+	Put(b)
+	return g
+}
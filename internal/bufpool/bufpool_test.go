@@ -0,0 +1,38 @@
+package bufpool
+
+import "testing"
+
+func TestGet(t *testing.T) {
+	for _, tc := range []struct {
+		n, cap int
+	}{
+		{0, 4096},
+		{1, 4096},
+		{4096, 4096},
+		{4097, 8192},
+		{4 << 20, 4 << 20},
+		{4<<20 + 1, 8 << 20},
+	} {
+		b := Get(tc.n)
+		if len(b) != tc.n || cap(b) != tc.cap {
+			t.Errorf("Wrong buffer for %d: len %d cap %d, expected cap %d", tc.n, len(b), cap(b), tc.cap)
+		}
+		Put(b)
+	}
+}
+
+func TestGrow(t *testing.T) {
+	b := Get(4096)
+	copy(b, "abc")
+	g := Grow(b[:3])
+	if len(g) != 6 || string(g[:3]) != "abc" {
+		t.Errorf("Wrong grown buffer: %q", g)
+	}
+}
+
+func TestPutDropsForeignBuffers(t *testing.T) {
+	Put(make([]byte, 5000)) // not a size class, must not be handed out
+	if b := Get(5000); cap(b) != 8192 {
+		t.Errorf("Wrong capacity %d", cap(b))
+	}
+}
@@ -0,0 +1,92 @@
+// Package cgroup reads the CPU quota and memory limit that the Linux cgroup
+// of the process imposes, which runtime.NumCPU and /proc/meminfo ignore, so
+// that a container given two of the host's 64 CPUs does not start 64
+// workers.
+package cgroup
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Limits are the limits of the cgroup of the process, zero where there is
+// none.
+type Limits struct {
+	// CPUs is the CPU quota in CPUs, e.g. 1.5 for 150ms of every 100ms.
+	CPUs float64
+	// Memory is the memory limit in bytes.
+	Memory int64
+}
+
+// CPUCount returns the quota rounded up to whole CPUs, at most n, and n
+// without a quota.
+func (l Limits) CPUCount(n int) int {
+	if l.CPUs <= 0 {
+		return n
+	}
+	return max(min(n, int(math.Ceil(l.CPUs))), 1)
+}
+
+// parseCPUMax parses the "quota period" of a cgroup v2 cpu.max file,
+// "max 100000" having no quota.
+func parseCPUMax(s string) float64 {
+	quota, period, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return 0
+	}
+	return parseQuota(quota, period)
+}
+
+// parseQuota returns quota over period in CPUs, 0 unless both are positive
+// numbers, as the -1 of cgroup v1 cpu.cfs_quota_us without a quota is not.
+func parseQuota(quota, period string) float64 {
+	q, err := strconv.ParseInt(strings.TrimSpace(quota), 10, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseInt(strings.TrimSpace(period), 10, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return float64(q) / float64(p)
+}
+
+// parseMemory parses a cgroup v2 memory.max or v1 memory.limit_in_bytes
+// file. "max" and the page-aligned maximum of v1 mean no limit.
+func parseMemory(s string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n <= 0 || n >= 1<<62 {
+		return 0
+	}
+	return n
+}
+
+// parseSelf parses /proc/self/cgroup into the cgroup path of each v1
+// controller, and the v2 path under "".
+func parseSelf(s string) map[string]string {
+	paths := map[string]string{}
+	for _, line := range strings.Split(s, "\n") {
+		// hierarchy-ID:controller-list:path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			paths[""] = parts[2]
+			continue
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			paths[c] = parts[2]
+		}
+	}
+	return paths
+}
+
+// lower returns the lower of two limits, zero being none.
+func lower[T int64 | float64](a, b T) T {
+	if a == 0 || b != 0 && b < a {
+		return b
+	}
+	return a
+}
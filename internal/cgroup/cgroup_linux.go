@@ -0,0 +1,65 @@
+package cgroup
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// root is where the cgroup hierarchies are mounted.
+const root = "/sys/fs/cgroup"
+
+// Read returns the limits of the cgroup of the process, the lowest of those
+// on the path from it to the root, as each level caps those below it.
+// Inside a container the path of the process may be that of the host, which
+// is not mounted, and only the levels that exist are read.
+func Read() Limits {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return Limits{}
+	}
+	paths := parseSelf(string(data))
+
+	var l Limits
+	if p, ok := paths[""]; ok && exists(filepath.Join(root, "cgroup.controllers")) {
+		walk(root, p, func(dir string) {
+			l.CPUs = lower(l.CPUs, parseCPUMax(readFile(dir, "cpu.max")))
+			l.Memory = lower(l.Memory, parseMemory(readFile(dir, "memory.max")))
+		})
+		return l
+	}
+	if p, ok := paths["cpu"]; ok {
+		walk(filepath.Join(root, "cpu"), p, func(dir string) {
+			l.CPUs = lower(l.CPUs, parseQuota(readFile(dir, "cpu.cfs_quota_us"), readFile(dir, "cpu.cfs_period_us")))
+		})
+	}
+	if p, ok := paths["memory"]; ok {
+		walk(filepath.Join(root, "memory"), p, func(dir string) {
+			l.Memory = lower(l.Memory, parseMemory(readFile(dir, "memory.limit_in_bytes")))
+		})
+	}
+	return l
+}
+
+// walk calls f with the directory of the cgroup p under the hierarchy
+// mounted at mount and of each of its ancestors that exists.
+func walk(mount, p string, f func(dir string)) {
+	for p = path.Clean("/" + p); ; p = path.Dir(p) {
+		if dir := filepath.Join(mount, p); exists(dir) {
+			f(dir)
+		}
+		if p == "/" {
+			return
+		}
+	}
+}
+
+func readFile(dir, name string) string {
+	data, _ := os.ReadFile(filepath.Join(dir, name))
+	return string(data)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package cgroup
+
+// Read returns no limits, cgroups being Linux only.
+func Read() Limits {
+	return Limits{}
+}
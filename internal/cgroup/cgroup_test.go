@@ -0,0 +1,49 @@
+package cgroup
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		expected float64
+	}{
+		{"max 100000\n", 0},
+		{"200000 100000\n", 2},
+		{"150000 100000", 1.5},
+		{"garbage", 0},
+	} {
+		if got := parseCPUMax(tc.s); got != tc.expected {
+			t.Errorf("parseCPUMax(%q) = %v, expected %v", tc.s, got, tc.expected)
+		}
+	}
+	if got := parseQuota("-1\n", "100000\n"); got != 0 {
+		t.Errorf("v1 quota without limit parsed as %v", got)
+	}
+	for s, expected := range map[string]int64{"max\n": 0, "9223372036854771712\n": 0, "536870912\n": 512 << 20} {
+		if got := parseMemory(s); got != expected {
+			t.Errorf("parseMemory(%q) = %d, expected %d", s, got, expected)
+		}
+	}
+
+	paths := parseSelf("12:cpu,cpuacct:/docker/abc\n4:memory:/docker/abc\n0::/user.slice\n")
+	if paths["cpu"] != "/docker/abc" || paths["cpuacct"] != "/docker/abc" || paths["memory"] != "/docker/abc" || paths[""] != "/user.slice" {
+		t.Errorf("Wrong cgroup paths %v", paths)
+	}
+}
+
+func TestCPUCount(t *testing.T) {
+	for _, tc := range []struct {
+		cpus     float64
+		n        int
+		expected int
+	}{
+		{0, 8, 8},
+		{1.5, 8, 2},
+		{16, 8, 8},
+		{0.1, 8, 1},
+	} {
+		if got := (Limits{CPUs: tc.cpus}).CPUCount(tc.n); got != tc.expected {
+			t.Errorf("CPUCount(%d) with %v CPUs = %d, expected %d", tc.n, tc.cpus, got, tc.expected)
+		}
+	}
+}
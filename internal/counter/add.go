@@ -0,0 +1,12 @@
+//go:build !brcnocounters
+
+package counter
+
+// Enabled reports whether the counters count, false with the
+// brcnocounters tag.
+const Enabled = true
+
+// Add adds n to stripe i, that of the writer.
+func (c *Striped) Add(i int, n int64) {
+	c.stripes[i].n.Add(n)
+}
@@ -0,0 +1,10 @@
+//go:build brcnocounters
+
+package counter
+
+// Enabled reports whether the counters count, false with the
+// brcnocounters tag.
+const Enabled = false
+
+// Add does nothing with the brcnocounters tag.
+func (c *Striped) Add(i int, n int64) {}
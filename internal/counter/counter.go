@@ -0,0 +1,46 @@
+// Package counter provides the striped counters of the live stats of a run,
+// such as its bytes and malformed lines. Each worker adds to a stripe of its
+// own, on a cache line of its own, so that counting costs an uncontended
+// atomic add, and readers sum the stripes when they poll, which they do far
+// less often than workers count.
+//
+// Built with the brcnocounters tag, Add does nothing and the counters stay
+// zero, for builds that must not pay for observability at all.
+package counter
+
+import (
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/djheidihoe/1brc/internal/cpu"
+)
+
+// Striped is a counter with a stripe per writer.
+type Striped struct {
+	stripes []stripe
+}
+
+type stripe struct {
+	n atomic.Int64
+	_ [cpu.CacheLineSize - unsafe.Sizeof(atomic.Int64{})%cpu.CacheLineSize]byte
+}
+
+// New returns a Striped of n stripes, one per writer.
+func New(n int) *Striped {
+	return &Striped{stripes: make([]stripe, n)}
+}
+
+// Stripe returns the count of stripe i.
+func (c *Striped) Stripe(i int) int64 {
+	return c.stripes[i].n.Load()
+}
+
+// Load returns the sum of the stripes, which may be added to while it sums
+// them.
+func (c *Striped) Load() int64 {
+	var n int64
+	for i := range c.stripes {
+		n += c.stripes[i].n.Load()
+	}
+	return n
+}
@@ -0,0 +1,30 @@
+package counter
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStriped(t *testing.T) {
+	const writers, adds = 8, 10_000
+	c := New(writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Go(func() {
+			for range adds {
+				c.Add(i, 2)
+			}
+		})
+	}
+	wg.Wait()
+	var want, stripe int64
+	if Enabled {
+		want, stripe = writers*adds*2, adds*2
+	}
+	if got := c.Load(); got != want {
+		t.Errorf("Load = %d, want %d", got, want)
+	}
+	if got := c.Stripe(3); got != stripe {
+		t.Errorf("Stripe(3) = %d, want %d", got, stripe)
+	}
+}
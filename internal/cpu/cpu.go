@@ -0,0 +1,15 @@
+// Package cpu describes the cache of the target architecture, so that state
+// that different goroutines write, such as the counters of the workers and
+// the indices of the rings between them, sits on cache lines of its own.
+// Two cores writing the same line take turns owning it even if they write
+// different words of it, which costs as much as contending for one.
+package cpu
+
+// CacheLineSize is the size in bytes of what cores exchange as a unit: 64 on
+// x86 and most others, 128 on arm64, whose Apple and Neoverse cores fetch
+// lines in pairs, and on ppc64, 256 on s390x and 32 on arm and mips.
+const CacheLineSize = cacheLineSize
+
+// CacheLinePad is padding that puts what follows it on another cache line
+// than what precedes it.
+type CacheLinePad struct{ _ [CacheLineSize]byte }
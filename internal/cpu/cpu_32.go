@@ -0,0 +1,5 @@
+//go:build arm || mips || mipsle || mips64 || mips64le
+
+package cpu
+
+const cacheLineSize = 32
@@ -0,0 +1,5 @@
+//go:build !386 && !amd64 && !arm64 && !ppc64 && !ppc64le && !s390x && !arm && !mips && !mipsle && !mips64 && !mips64le
+
+package cpu
+
+const cacheLineSize = 64
@@ -0,0 +1,5 @@
+//go:build ppc64 || ppc64le
+
+package cpu
+
+const cacheLineSize = 128
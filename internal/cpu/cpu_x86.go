@@ -0,0 +1,5 @@
+//go:build 386 || amd64
+
+package cpu
+
+const cacheLineSize = 64
@@ -0,0 +1,291 @@
+// Package dop adjusts the degree of parallelism of a run while it runs: how
+// many of its workers parse at a time. Past the memory bandwidth of a
+// machine, more workers only contend for it and for the caches, so that e.g.
+// 6 to 10 workers do best on an M2 Max whatever its core count. Instead of a
+// count made for one machine, a Controller measures the throughput the
+// workers reach together, adds workers while it scales with them and parks
+// those that stop adding to it.
+package dop
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultInterval is how long a Controller measures each worker count.
+const DefaultInterval = 50 * time.Millisecond
+
+const (
+	// efficiency is the share of the throughput per worker an added worker
+	// must add for it to scale.
+	efficiency = 0.5
+	// tolerance is the share of the throughput a parked worker may take
+	// with it for the fewer workers to do as well.
+	tolerance = 0.03
+	// probeEvery is the number of intervals at a settled count between
+	// probes of one worker more or less, as the input or the machine
+	// changes under a run.
+	probeEvery = 10
+)
+
+// Controller decides how many of up to max workers are active. Workers call
+// Wait before each unit of work, which parks those past the active count,
+// and Add with the bytes of each they are done with. A nil *Controller keeps
+// every worker active, for a fixed count.
+type Controller struct {
+	max      int
+	interval time.Duration
+	bytes    atomic.Int64
+	units    atomic.Int64
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	active   int
+	finished bool
+
+	policy  policy
+	steps   []Step
+	start   time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Step is a worker count a Controller measured, over an interval or as many
+// as it took for each active worker to parse a unit, whichever is longer.
+type Step struct {
+	// At is the end of the interval since the start.
+	At time.Duration
+	// Workers is the number of active workers during it.
+	Workers int
+	// Throughput is the bytes per second they parsed together.
+	Throughput float64
+}
+
+// New returns a Controller of up to max workers, which starts with a single
+// one and measures each count for interval, DefaultInterval if zero, until
+// Finish.
+func New(max int, interval time.Duration) *Controller {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	c := &Controller{
+		max:      max,
+		interval: interval,
+		active:   1,
+		policy:   policy{max: max, active: 1},
+		start:    time.Now(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	go c.run()
+	return c
+}
+
+// Wait blocks worker, from 0 to max-1, while it is parked and reports
+// whether there is work left, false once Finish was called.
+func (c *Controller) Wait(worker int) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for worker >= c.active && !c.finished {
+		c.cond.Wait()
+	}
+	return !c.finished
+}
+
+// Add records that a unit of n more bytes was parsed.
+func (c *Controller) Add(n int) {
+	if c == nil {
+		return
+	}
+	c.bytes.Add(int64(n))
+	c.units.Add(1)
+}
+
+// Finish ends the run, once a worker found no more work, and releases the
+// parked workers. It may be called more than once.
+func (c *Controller) Finish() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if !c.finished {
+		c.finished = true
+		close(c.stop)
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	<-c.stopped
+}
+
+// Active returns the number of active workers.
+func (c *Controller) Active() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// Steps returns the counts measured, after Finish.
+func (c *Controller) Steps() []Step {
+	<-c.stopped
+	return c.steps
+}
+
+func (c *Controller) run() {
+	defer close(c.stopped)
+	tick := time.NewTicker(c.interval)
+	defer tick.Stop()
+	last, lastBytes, lastUnits := time.Now(), int64(0), int64(0)
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-tick.C:
+			// units parsed in part are not counted yet, so that shorter
+			// measurements are noise
+			units := c.units.Load()
+			if units-lastUnits < int64(c.policy.active) {
+				continue
+			}
+			n := c.bytes.Load()
+			t := float64(n-lastBytes) / now.Sub(last).Seconds()
+			last, lastBytes, lastUnits = now, n, units
+			c.steps = append(c.steps, Step{now.Sub(c.start), c.policy.active, t})
+			if next := c.policy.next(t); next != c.Active() {
+				c.mu.Lock()
+				c.active = next
+				c.cond.Broadcast()
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+// WriteTable writes the steps of c, after Finish, with the count it settled
+// on.
+func (c *Controller) WriteTable(w io.Writer) error {
+	if c == nil {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "at\tworkers\tMB/s\tMB/s per worker\t")
+	for _, s := range c.Steps() {
+		fmt.Fprintf(tw, "%v\t%d\t%.0f\t%.0f\t\n", s.At.Round(time.Millisecond), s.Workers, s.Throughput/1e6, s.Throughput/1e6/float64(s.Workers))
+	}
+	fmt.Fprintf(tw, "settled on %d of %d workers\t\t\t\t\n", c.policy.base, c.max)
+	return tw.Flush()
+}
+
+// phase is what a policy does with the next measurement.
+type phase int
+
+const (
+	// growing doubles the workers while the throughput scales
+	growing phase = iota
+	// climbing adds them one at a time, from the last count that scaled
+	climbing
+	// holding stays at the count, probing around it every probeEvery
+	// intervals
+	holding
+	// probingUp and probingDown measure a worker more or less
+	probingUp
+	probingDown
+)
+
+// policy picks the next worker count from the throughput measured at the
+// current one: it compares each count with the base count it moved from,
+// doubling and then adding workers while they scale, and going back to the
+// base when one does not.
+type policy struct {
+	max, active int
+	// base is the count the active one is compared with, measured at baseT
+	base  int
+	baseT float64
+	phase phase
+	held  int
+	up    bool // the next probe is up
+}
+
+// scales reports whether the throughput t of the active count makes the
+// workers it added to the base worth it.
+func (p *policy) scales(t float64) bool {
+	perWorker := p.baseT / float64(p.base)
+	return t-p.baseT >= efficiency*perWorker*float64(p.active-p.base)
+}
+
+// next records the throughput t of the active count and returns the next.
+func (p *policy) next(t float64) int {
+	switch {
+	case p.base == 0:
+		p.settle(t)
+		p.grow()
+	case p.phase == growing || p.phase == climbing || p.phase == probingUp:
+		switch {
+		case p.scales(t):
+			p.settle(t)
+			if p.phase == probingUp {
+				p.phase = climbing
+			}
+			p.grow()
+		case p.phase == growing && p.active-p.base > 1:
+			p.phase = climbing
+			p.active = p.base + 1
+		default:
+			p.hold()
+		}
+	case p.phase == probingDown:
+		if t >= p.baseT*(1-tolerance) {
+			// the parked worker added nothing
+			p.settle(t)
+		}
+		p.hold()
+	default:
+		p.baseT = t
+		if p.held++; p.held >= probeEvery {
+			p.probe()
+		}
+	}
+	return p.active
+}
+
+// settle makes the active count the base, at t.
+func (p *policy) settle(t float64) {
+	p.base, p.baseT = p.active, t
+}
+
+// grow moves on from the base, or holds at max.
+func (p *policy) grow() {
+	next := p.base + 1
+	if p.phase == growing {
+		next = 2 * p.base
+	}
+	if next = min(next, p.max); next == p.base {
+		p.hold()
+		return
+	}
+	p.active = next
+}
+
+// hold goes back to the base count.
+func (p *policy) hold() {
+	p.active, p.phase, p.held = p.base, holding, 0
+}
+
+// probe measures a worker more or less than the base, in turn.
+func (p *policy) probe() {
+	p.held = 0
+	p.up = !p.up
+	switch {
+	case p.up && p.base < p.max:
+		p.active, p.phase = p.base+1, probingUp
+	case !p.up && p.base > 1:
+		p.active, p.phase = p.base-1, probingDown
+	}
+}
@@ -0,0 +1,71 @@
+package dop
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		max        int
+		throughput func(n int) float64
+		want       int
+	}{
+		// 100MB/s per worker up to a bandwidth of 600MB/s
+		{"saturated", 16, func(n int) float64 { return float64(min(n, 6)) * 100e6 }, 6},
+		// past which contention lowers it
+		{"contended", 16, func(n int) float64 {
+			if n <= 6 {
+				return float64(n) * 100e6
+			}
+			return 600e6 - float64(n-6)*50e6
+		}, 6},
+		{"scaling", 12, func(n int) float64 { return float64(n) * 100e6 }, 12},
+		{"single", 1, func(n int) float64 { return 100e6 }, 1},
+	} {
+		p := policy{max: tt.max, active: 1}
+		for range 100 {
+			p.next(tt.throughput(p.active))
+			if p.active < 1 || p.active > tt.max {
+				t.Fatalf("%s: %d workers of %d", tt.name, p.active, tt.max)
+			}
+		}
+		if p.base != tt.want {
+			t.Errorf("%s: settled on %d workers, want %d", tt.name, p.base, tt.want)
+		}
+	}
+}
+
+func TestController(t *testing.T) {
+	const workers = 4
+	c := New(workers, time.Millisecond)
+	var work atomic.Int64
+	work.Store(2000)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Go(func() {
+			for c.Wait(i) {
+				if work.Add(-1) < 0 {
+					c.Finish()
+					return
+				}
+				time.Sleep(10 * time.Microsecond)
+				c.Add(1 << 20)
+			}
+		})
+	}
+	// the parked workers return once Finish releases them
+	wg.Wait()
+	if a := c.Active(); a < 1 || a > workers {
+		t.Errorf("Active = %d", a)
+	}
+	var b bytes.Buffer
+	if err := c.WriteTable(&b); err != nil || !strings.Contains(b.String(), "settled on") {
+		t.Errorf("WriteTable = %q, %v", b.String(), err)
+	}
+}
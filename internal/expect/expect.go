@@ -0,0 +1,175 @@
+// Package expect checks the stations of results against a list of expected
+// stations, reporting those missing from the input and the unexpected names
+// that appeared instead, with the expected names they are likely typos of.
+package expect
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// ReadNames reads the station names listed one per line in the file at
+// path, skipping empty lines and lines starting with #.
+func ReadNames(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for line := range strings.Lines(string(data)) {
+		if line = strings.TrimSpace(line); line != "" && line[0] != '#' {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// Report is the outcome of Check.
+type Report struct {
+	// Expected is the number of distinct expected stations and Present how
+	// many of them the results have.
+	Expected, Present int
+	// Missing are the expected stations absent from the results, sorted.
+	Missing []string
+	// Unexpected are the stations of the results that were not expected,
+	// sorted by name.
+	Unexpected []Unexpected
+}
+
+// Unexpected is a station that was not expected.
+type Unexpected struct {
+	Name string
+	// Suggestion is the expected station closest to Name by edit distance,
+	// missing ones first on a tie, or "" if none is close enough to be a
+	// typo of it.
+	Suggestion string
+	Distance   int
+}
+
+// Check compares the stations of res, with the key of grouped names
+// ignored, to expected.
+func Check(expected []string, res *brc.Result) *Report {
+	want := make(map[string]bool, len(expected))
+	for _, name := range expected {
+		want[name] = true
+	}
+	seen := map[string]bool{}
+	for name := range res.All() {
+		station, _ := res.Split(name)
+		seen[station] = true
+	}
+
+	r := &Report{Expected: len(want)}
+	for name := range want {
+		if seen[name] {
+			r.Present++
+		} else {
+			r.Missing = append(r.Missing, name)
+		}
+	}
+	slices.Sort(r.Missing)
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for station := range seen {
+		if want[station] {
+			continue
+		}
+		u := Unexpected{Name: station}
+		u.Suggestion, u.Distance = suggest(station, names, r.Missing)
+		r.Unexpected = append(r.Unexpected, u)
+	}
+	slices.SortFunc(r.Unexpected, func(a, b Unexpected) int { return strings.Compare(a.Name, b.Name) })
+	return r
+}
+
+// WriteText writes a line per missing and per unexpected station and the
+// totals of r.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, name := range r.Missing {
+		fmt.Fprintf(&b, "missing      %s\n", name)
+	}
+	for _, u := range r.Unexpected {
+		if u.Suggestion != "" {
+			fmt.Fprintf(&b, "unexpected   %s, did you mean %s?\n", u.Name, u.Suggestion)
+		} else {
+			fmt.Fprintf(&b, "unexpected   %s\n", u.Name)
+		}
+	}
+	fmt.Fprintf(&b, "completeness %d of %d expected stations present, %d missing, %d unexpected\n", r.Present, r.Expected, len(r.Missing), len(r.Unexpected))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// suggest returns the name of names, which are sorted, closest to name
+// within a typo's distance, preferring those in missing on a tie.
+func suggest(name string, names, missing []string) (string, int) {
+	s := []rune(name)
+	limit := maxTypos(len(s))
+	best, bestDist, bestMissing := "", limit+1, false
+	for _, candidate := range names {
+		c := []rune(candidate)
+		if abs(len(c)-len(s)) > min(limit, bestDist) {
+			continue
+		}
+		d := distance(s, c, min(limit, bestDist))
+		_, isMissing := slices.BinarySearch(missing, candidate)
+		if d < bestDist || d == bestDist && isMissing && !bestMissing {
+			best, bestDist, bestMissing = candidate, d, isMissing
+		}
+	}
+	if bestDist > limit {
+		return "", 0
+	}
+	return best, bestDist
+}
+
+// maxTypos is the largest edit distance taken for a typo in a name of n
+// runes: 1 for short names, up to a quarter of the name for long ones.
+func maxTypos(n int) int {
+	return max(1, n/4)
+}
+
+// distance returns the edit distance between a and b, counting a swap of
+// adjacent runes as one edit like an insertion, deletion or substitution, or
+// limit+1 if it is larger than limit, which ends the computation early.
+func distance(a, b []rune, limit int) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(b)], limit+1)
+}
+
+func abs(n int) int {
+	return max(n, -n)
+}
@@ -0,0 +1,48 @@
+package expect
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+func TestCheck(t *testing.T) {
+	res, err := brc.Process(strings.NewReader("Hamburg;1.0\nBerlni;3.0\nOslo;-2.0\nZürich;1.0\nBern;2.0\nXyz;0.0\n"), brc.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Check([]string{"Hamburg", "Berlin", "Bern", "Oslo", "Zurich", "Rome", "Oslo"}, res)
+	var out bytes.Buffer
+	r.WriteText(&out)
+	expected := "missing      Berlin\n" +
+		"missing      Rome\n" +
+		"missing      Zurich\n" +
+		"unexpected   Berlni, did you mean Berlin?\n" +
+		"unexpected   Xyz\n" +
+		"unexpected   Zürich, did you mean Zurich?\n" +
+		"completeness 3 of 6 expected stations present, 3 missing, 3 unexpected\n"
+	if out.String() != expected {
+		t.Errorf("Wrong report, expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestDistance(t *testing.T) {
+	for _, c := range []struct {
+		a, b  string
+		limit int
+		d     int
+	}{
+		{"kitten", "sitting", 5, 3},
+		{"", "abc", 5, 3},
+		{"Zürich", "Zurich", 5, 1},
+		{"same", "same", 0, 0},
+		{"abcdef", "uvwxyz", 2, 3},
+		{"Berlni", "Berlin", 5, 1},
+	} {
+		if d := distance([]rune(c.a), []rune(c.b), c.limit); d != c.d {
+			t.Errorf("distance(%q, %q, %d) = %d, expected %d", c.a, c.b, c.limit, d, c.d)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package flamegraph renders the CPU profiles written by runtime/pprof as
+// folded stacks, the input format of Brendan Gregg's flamegraph.pl, or as a
+// self-contained SVG flame graph. It reads the profile.proto format itself,
+// so no pprof tooling is needed.
+package flamegraph
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Stacks maps folded stacks, the frames from the root to the leaf joined by
+// semicolons, to their total sample value.
+type Stacks map[string]int64
+
+// Fold reads a profile in the pprof format from r and folds its samples by
+// stack, weighted by the last sample value, as pprof does by default: CPU
+// time for a CPU profile.
+func Fold(r io.Reader) (Stacks, error) {
+	p, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	stacks := Stacks{}
+	for _, s := range p.samples {
+		if len(s.values) == 0 || len(s.locations) == 0 {
+			continue
+		}
+		if v := s.values[len(s.values)-1]; v > 0 {
+			stacks[strings.Join(p.stack(s), ";")] += v
+		}
+	}
+	return stacks, nil
+}
+
+// WriteFolded writes s as sorted "frame;frame;frame value" lines.
+func (s Stacks) WriteFolded(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, stack := range slices.Sorted(maps.Keys(s)) {
+		fmt.Fprintf(bw, "%s %d\n", stack, s[stack])
+	}
+	return bw.Flush()
+}
+
+type node struct {
+	name     string
+	value    int64
+	children map[string]*node
+}
+
+func (s Stacks) tree() *node {
+	root := &node{name: "all", children: map[string]*node{}}
+	for stack, v := range s {
+		n := root
+		n.value += v
+		for frame := range strings.SplitSeq(stack, ";") {
+			c := n.children[frame]
+			if c == nil {
+				c = &node{name: frame, children: map[string]*node{}}
+				n.children[frame] = c
+			}
+			c.value += v
+			n = c
+		}
+	}
+	return root
+}
+
+// The SVG layout, in pixels.
+const (
+	svgWidth    = 1200
+	frameHeight = 16
+	charWidth   = 7 // of the 12px monospace labels
+	minWidth    = 0.1
+)
+
+// WriteSVG writes s as an SVG flame graph with the root at the bottom. Each
+// frame's width is proportional to its value, its tooltip gives the share.
+func (s Stacks) WriteSVG(w io.Writer, title string) error {
+	root := s.tree()
+	depth := root.depth()
+	height := (depth+2)*frameHeight + 20
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" font-family="monospace" font-size="12">
+<rect width="100%%" height="100%%" fill="#f8f8f8"/>
+<text x="%d" y="20" text-anchor="middle" font-size="16">%s</text>
+`, svgWidth, height, svgWidth, height, svgWidth/2, html.EscapeString(title))
+	if root.value > 0 {
+		scale := float64(svgWidth-20) / float64(root.value)
+		root.writeSVG(bw, 10, float64(height-frameHeight), scale, root.value)
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+func (n *node) depth() int {
+	d := 0
+	for _, c := range n.children {
+		d = max(d, c.depth())
+	}
+	return d + 1
+}
+
+// writeSVG draws n at x and y and its children, sorted by name as in
+// flamegraph.pl, on top of it.
+func (n *node) writeSVG(w io.Writer, x, y, scale float64, total int64) {
+	width := float64(n.value) * scale
+	if width < minWidth {
+		return
+	}
+	label := html.EscapeString(n.name)
+	fmt.Fprintf(w, `<g><title>%s (%d, %.2f%%)</title><rect x="%.1f" y="%.1f" width="%.1f" height="%d" rx="2" fill="%s"/>`,
+		label, n.value, 100*float64(n.value)/float64(total), x, y, width, frameHeight-1, color(n.name))
+	if chars := int(width-6) / charWidth; chars >= 3 {
+		text := n.name
+		if len(text) > chars {
+			text = text[:chars-2] + ".."
+		}
+		fmt.Fprintf(w, `<text x="%.1f" y="%.1f">%s</text>`, x+3, y+frameHeight-4, html.EscapeString(text))
+	}
+	fmt.Fprintln(w, "</g>")
+
+	for _, name := range slices.Sorted(maps.Keys(n.children)) {
+		c := n.children[name]
+		c.writeSVG(w, x, y-frameHeight, scale, total)
+		x += float64(c.value) * scale
+	}
+}
+
+// color returns a warm color derived from name, so a function keeps its color
+// across graphs.
+func color(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, 80+(v>>8)%150, (v>>16)%55)
+}
@@ -0,0 +1,70 @@
+package flamegraph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	// a goroutine profile has one sample per stack, so every stack shows up
+	// without having to burn CPU
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	stacks, err := Fold(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for stack, v := range stacks {
+		if v <= 0 {
+			t.Errorf("Wrong value %d of %s", v, stack)
+		}
+		frames := strings.Split(stack, ";")
+		if strings.HasSuffix(frames[len(frames)-1], "TestFold") {
+			t.Errorf("TestFold is not the leaf of %s", stack)
+		}
+		if strings.Contains(stack, "testing.tRunner;github.com/djheidihoe/1brc/internal/flamegraph.TestFold;") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("No stack from tRunner through TestFold in %v", stacks)
+	}
+
+	var folded bytes.Buffer
+	if err := stacks.WriteFolded(&folded); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(folded.String(), "\n"); lines != len(stacks) {
+		t.Errorf("Wrong number of folded lines: %d instead of %d", lines, len(stacks))
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	stacks := Stacks{"main;parse;<lines>": 3, "main;parse": 1, "main;merge": 4}
+	var buf bytes.Buffer
+	if err := stacks.WriteSVG(&buf, "cpu & more"); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Groups []struct {
+			Title string `xml:"title"`
+		} `xml:"g"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("Invalid SVG: %v\n%s", err, buf.String())
+	}
+	var titles []string
+	for _, g := range doc.Groups {
+		titles = append(titles, g.Title)
+	}
+	expected := "all (8, 100.00%)|main (8, 100.00%)|merge (4, 50.00%)|parse (4, 50.00%)|<lines> (3, 37.50%)"
+	if got := strings.Join(titles, "|"); got != expected {
+		t.Errorf("Wrong frames:\n%s\nexpected\n%s", got, expected)
+	}
+}
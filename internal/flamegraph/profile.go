@@ -0,0 +1,223 @@
+package flamegraph
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The pprof profile.proto messages and fields read by parse.
+const (
+	profileSampleType  = 1
+	profileSample      = 2
+	profileLocation    = 4
+	profileFunction    = 5
+	profileStringTable = 6
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+
+	functionID   = 1
+	functionName = 2
+)
+
+type sample struct {
+	locations []uint64 // leaf first
+	values    []int64
+}
+
+type profile struct {
+	sampleTypes int
+	samples     []sample
+	locations   map[uint64][]uint64 // location to function IDs, innermost first
+	functions   map[uint64]int64    // function to name index
+	strings     []string
+}
+
+// parse decodes a gzipped or plain profile.proto message, keeping only what
+// is needed to name the frames of each sample.
+func parse(r io.Reader) (*profile, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		src = zr
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &profile{locations: map[uint64][]uint64{}, functions: map[uint64]int64{}}
+	err = fields(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case profileSampleType:
+			p.sampleTypes++
+		case profileSample:
+			var s sample
+			err := fields(b, func(field int, v uint64, b []byte) (err error) {
+				switch field {
+				case sampleLocationID:
+					s.locations, err = appendUints(s.locations, v, b)
+				case sampleValue:
+					var vs []uint64
+					vs, err = appendUints(nil, v, b)
+					for _, v := range vs {
+						s.values = append(s.values, int64(v))
+					}
+				}
+				return err
+			})
+			p.samples = append(p.samples, s)
+			return err
+		case profileLocation:
+			var id uint64
+			var funcs []uint64
+			err := fields(b, func(field int, v uint64, b []byte) error {
+				switch field {
+				case locationID:
+					id = v
+				case locationLine:
+					return fields(b, func(field int, v uint64, _ []byte) error {
+						if field == lineFunctionID {
+							funcs = append(funcs, v)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			p.locations[id] = funcs
+			return err
+		case profileFunction:
+			var id uint64
+			var name int64
+			err := fields(b, func(field int, v uint64, _ []byte) error {
+				switch field {
+				case functionID:
+					id = v
+				case functionName:
+					name = int64(v)
+				}
+				return nil
+			})
+			p.functions[id] = name
+			return err
+		case profileStringTable:
+			p.strings = append(p.strings, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile: %w", err)
+	}
+	return p, nil
+}
+
+// fields calls fn with each field of the protobuf message in data: its number
+// and either its varint value or its length-delimited bytes. Fixed-size
+// fields are skipped.
+func fields(data []byte, fn func(field int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := uvarint(data)
+		if n == 0 {
+			return errTruncated
+		}
+		data = data[n:]
+		field, wire := int(key>>3), key&7
+		var v uint64
+		var b []byte
+		switch wire {
+		case 0:
+			if v, n = uvarint(data); n == 0 {
+				return errTruncated
+			}
+			data = data[n:]
+		case 1, 5:
+			size := 8
+			if wire == 5 {
+				size = 4
+			}
+			if len(data) < size {
+				return errTruncated
+			}
+			data = data[size:]
+			continue
+		case 2:
+			l, n := uvarint(data)
+			if n == 0 || uint64(len(data)-n) < l {
+				return errTruncated
+			}
+			b, data = data[n:n+int(l)], data[n+int(l):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+		if err := fn(field, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errTruncated = errors.New("truncated message")
+
+// appendUints appends a repeated integer field to s, either the varint v or,
+// when packed, the varints in b.
+func appendUints(s []uint64, v uint64, b []byte) ([]uint64, error) {
+	if b == nil {
+		return append(s, v), nil
+	}
+	for len(b) > 0 {
+		v, n := uvarint(b)
+		if n == 0 {
+			return s, errTruncated
+		}
+		s, b = append(s, v), b[n:]
+	}
+	return s, nil
+}
+
+// uvarint decodes a varint from b and its length, 0 if b holds none.
+func uvarint(b []byte) (uint64, int) {
+	var v uint64
+	for i, c := range b {
+		if i == 10 {
+			return 0, 0
+		}
+		v |= uint64(c&0x7f) << (7 * i)
+		if c < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// stack returns the function names of s from the root to the leaf.
+func (p *profile) stack(s sample) []string {
+	var names []string
+	for i := len(s.locations) - 1; i >= 0; i-- {
+		funcs := p.locations[s.locations[i]]
+		for j := len(funcs) - 1; j >= 0; j-- {
+			names = append(names, p.name(funcs[j]))
+		}
+	}
+	return names
+}
+
+func (p *profile) name(function uint64) string {
+	i, ok := p.functions[function]
+	if !ok || i < 0 || i >= int64(len(p.strings)) || p.strings[i] == "" {
+		return "?"
+	}
+	return p.strings[i]
+}
@@ -0,0 +1,81 @@
+package hll
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10_000, 1_000_000} {
+		var s Sketch
+		for i := range n {
+			// every name twice, which must not count
+			s.Add(fmt.Appendf(nil, "station %d", i))
+			s.Add(fmt.Appendf(nil, "station %d", i))
+		}
+		if got := s.Count(); math.Abs(got-float64(n)) > 0.03*float64(n)+0.5 {
+			t.Errorf("Count of %d names = %.0f", n, got)
+		}
+	}
+}
+
+// lines returns n lines of the stations name(i).
+func lines(n int, name func(i int) string) []byte {
+	var b bytes.Buffer
+	for i := range n {
+		fmt.Fprintf(&b, "%s;12.3\n", name(i))
+	}
+	return b.Bytes()
+}
+
+func TestStations(t *testing.T) {
+	repeated := lines(100_000, func(i int) string { return fmt.Sprintf("s%d", i%1000) })
+	unique := lines(100_000, func(i int) string { return fmt.Sprintf("u%d", i) })
+	for _, tt := range []struct {
+		name     string
+		prefix   []byte
+		size     int64
+		stations int
+		lines    int64
+	}{
+		{"whole", repeated, int64(len(repeated)), 1000, 100_000},
+		// the stations of a saturated prefix stay the same
+		{"repeated", repeated, 10 * int64(len(repeated)), 1000, 1_000_000},
+		// those of a prefix of only new ones grow with the input
+		{"unique", unique, 10 * int64(len(unique)), 1_000_000, 1_000_000},
+		{"empty", nil, 0, 0, 0},
+	} {
+		e := Stations(tt.prefix, tt.size)
+		if math.Abs(float64(e.Stations-tt.stations)) > 0.05*float64(tt.stations) || e.Lines != tt.lines {
+			t.Errorf("%s: Stations = %+v, want %d stations of %d lines", tt.name, e, tt.stations, tt.lines)
+		}
+	}
+
+	e := Estimate{Stations: 1000, Lines: 1_000_000}
+	if got := e.Within(0.5); got != 1000 {
+		t.Errorf("Within(0.5) of %+v = %d, want all stations", e, got)
+	}
+	if got := (Estimate{Stations: 1_000_000, Lines: 1_000_000}).Within(0.25); got != 250_000 {
+		t.Errorf("Within(0.25) of unique stations = %d, want 250000", got)
+	}
+	// each of 100K stations has 10 of the lines, and is missing from a
+	// tenth of them with probability 0.9^10
+	if got := (Estimate{Stations: 100_000, Lines: 1_000_000}).Within(0.1); math.Abs(float64(got-65_132)) > 1 {
+		t.Errorf("Within(0.1) of 10 lines per station = %d, want about 65132", got)
+	}
+	for _, share := range []float64{0, 0.01, 0.5, 1} {
+		if got, lines := (Estimate{Stations: 5000, Lines: 6000}).Within(share), int(share*6000); got > lines || got > 5000 {
+			t.Errorf("Within(%v) of 5000 stations of 6000 lines = %d, more than the %d lines or the stations", share, got, lines)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	data := lines(1000, func(i int) string { return fmt.Sprintf("s%d", i%10) })
+	e, err := Probe(bytes.NewReader(data), int64(len(data)))
+	if err != nil || e.Stations != 10 || e.Lines != 1000 {
+		t.Errorf("Probe = %+v, %v, want 10 stations of 1000 lines", e, err)
+	}
+}
@@ -0,0 +1,62 @@
+// Package hugepage allocates pointer-free scratch memory from anonymous
+// mappings that the kernel is advised to back with transparent huge pages
+// (madvise MADV_HUGEPAGE on Linux), so that probing large arrays misses the
+// TLB less often. Where there are none, or the kernel declines, New returns
+// nil and Make falls back to the Go heap, so callers need no second path.
+//
+// The garbage collector does not scan the mappings, which therefore must not
+// hold pointers, and unmaps them once their Arena is unreachable.
+package hugepage
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// Size is the size of a huge page on amd64 and arm64 with 4K base pages.
+const Size = 2 << 20
+
+// Arena hands out slices of a mapping in order. A nil Arena hands out
+// slices of the Go heap. An Arena must not be used concurrently.
+type Arena struct {
+	mem []byte // aligned to Size
+	off int
+}
+
+// New maps an Arena of at least size bytes, nil if that fails or its
+// platform has no huge pages.
+func New(size int) *Arena {
+	mem, aligned := mapHuge((size + Size - 1) &^ (Size - 1))
+	if mem == nil {
+		return nil
+	}
+	a := &Arena{mem: aligned}
+	runtime.AddCleanup(a, unmap, mem)
+	return a
+}
+
+// Make returns a slice of n elements and capacity c from a, or from the Go
+// heap if a is nil or too full for it. Appends beyond c move it to the heap.
+func Make[T int32 | int64](a *Arena, n, c int) []T {
+	var zero T
+	size := c * int(unsafe.Sizeof(zero))
+	if a == nil || c == 0 || a.off+size > len(a.mem) {
+		return make([]T, n, c)
+	}
+	off := (a.off + int(unsafe.Alignof(zero)) - 1) &^ (int(unsafe.Alignof(zero)) - 1)
+	if off+size > len(a.mem) {
+		return make([]T, n, c)
+	}
+	a.off = off + size
+	return unsafe.Slice((*T)(unsafe.Pointer(&a.mem[off])), c)[:n]
+}
+
+// HugeBytes returns how much of a the kernel backs with huge pages, 0 if a
+// is nil or the kernel does not tell. Pages are backed as they are first
+// written, so it is meaningful after a has been filled.
+func (a *Arena) HugeBytes() int64 {
+	if a == nil {
+		return 0
+	}
+	return hugeBytes(a.mem)
+}
@@ -0,0 +1,74 @@
+package hugepage
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapHuge maps size bytes and a huge page more, so that size bytes of it
+// start at a huge page boundary, which it returns as well, and advises them
+// for huge pages. The kernel only backs aligned ranges with them.
+func mapHuge(size int) (mem, aligned []byte) {
+	mem, err := unix.Mmap(-1, 0, size+Size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, nil
+	}
+	skip := -int(uintptr(unsafe.Pointer(&mem[0]))) & (Size - 1)
+	aligned = mem[skip : skip+size]
+	if unix.Madvise(aligned, unix.MADV_HUGEPAGE) != nil {
+		unix.Munmap(mem)
+		return nil, nil
+	}
+	return mem, aligned
+}
+
+func unmap(mem []byte) {
+	unix.Munmap(mem)
+}
+
+// hugeBytes sums the AnonHugePages of the mappings of /proc/self/smaps
+// within mem.
+func hugeBytes(mem []byte) int64 {
+	f, err := os.Open("/proc/self/smaps")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	start := uint64(uintptr(unsafe.Pointer(&mem[0])))
+	end := start + uint64(len(mem))
+	var total int64
+	inside := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Bytes()
+		// a mapping starts with its address range "start-end perms ..."
+		if from, to, ok := addressRange(line); ok {
+			inside = from < end && to > start
+			continue
+		}
+		if rest, ok := bytes.CutPrefix(line, []byte("AnonHugePages:")); inside && ok {
+			kb, _ := strconv.ParseInt(string(bytes.TrimSpace(bytes.TrimSuffix(bytes.TrimSpace(rest), []byte("kB")))), 10, 64)
+			total += kb << 10
+		}
+	}
+	return total
+}
+
+func addressRange(line []byte) (from, to uint64, ok bool) {
+	field, _, _ := bytes.Cut(line, []byte{' '})
+	lo, hi, ok := bytes.Cut(field, []byte{'-'})
+	if !ok {
+		return 0, 0, false
+	}
+	from, err := strconv.ParseUint(string(lo), 16, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	to, err = strconv.ParseUint(string(hi), 16, 64)
+	return from, to, err == nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package hugepage
+
+func mapHuge(int) (mem, aligned []byte) {
+	return nil, nil
+}
+
+func unmap([]byte) {}
+
+func hugeBytes([]byte) int64 {
+	return 0
+}
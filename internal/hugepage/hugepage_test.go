@@ -0,0 +1,48 @@
+package hugepage
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+func TestMake(t *testing.T) {
+	if s := Make[int64](nil, 2, 4); len(s) != 2 || cap(s) != 4 {
+		t.Errorf("Make from the heap = len %d cap %d", len(s), cap(s))
+	}
+	a := New(Size)
+	if a == nil {
+		if runtime.GOOS == "linux" {
+			t.Log("no huge pages on this kernel")
+		}
+		return
+	}
+	if start := uintptr(unsafe.Pointer(&a.mem[0])); start%Size != 0 {
+		t.Errorf("Arena at %#x is not aligned to a huge page", start)
+	}
+	small := Make[int32](a, 1, 1)
+	large := Make[int64](a, 0, Size/8-1)
+	if !inside(a, small) || !inside(a, large) {
+		t.Error("Expected the slices in the arena")
+	}
+	if uintptr(unsafe.Pointer(unsafe.SliceData(large)))%8 != 0 {
+		t.Error("Expected an aligned int64 slice")
+	}
+	// the arena is full
+	if full := Make[int32](a, 0, 2); inside(a, full) {
+		t.Error("Expected a full arena to fall back to the heap")
+	}
+	for i := range cap(large) {
+		large = append(large, int64(i))
+	}
+	if small[0] != 0 || large[len(large)-1] != Size/8-2 {
+		t.Error("Expected zeroed and writable slices")
+	}
+	t.Logf("%d bytes on huge pages", a.HugeBytes())
+}
+
+func inside[T int32 | int64](a *Arena, s []T) bool {
+	p := uintptr(unsafe.Pointer(unsafe.SliceData(s)))
+	start := uintptr(unsafe.Pointer(&a.mem[0]))
+	return p >= start && p < start+uintptr(len(a.mem))
+}
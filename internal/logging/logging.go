@@ -0,0 +1,54 @@
+// Package logging sets up log/slog loggers from the -log-level and
+// -log-format command line flags shared by onebrc and the go_* variants.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// New returns a logger writing to w at the given level (debug, info, warn or
+// error) in the given format (text or json).
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+// Flags registers -log-level, -log-format and -quiet on fs. The returned
+// function builds the stderr logger once fs is parsed. Logs never go to
+// stdout, which carries only results.
+func Flags(fs *flag.FlagSet) func() (*slog.Logger, error) {
+	level := fs.String("log-level", "warn", "log `level`: debug, info, warn or error")
+	format := fs.String("log-format", "text", "log `format`: text or json")
+	fs.Bool("quiet", false, "log only errors and print no other diagnostics to stderr, overrides -log-level")
+	return func() (*slog.Logger, error) {
+		l := *level
+		if Quiet(fs) {
+			l = "error"
+		}
+		return New(os.Stderr, l, *format)
+	}
+}
+
+// Quiet reports whether -quiet is set on fs, for the diagnostics that are
+// printed rather than logged.
+func Quiet(fs *flag.FlagSet) bool {
+	f := fs.Lookup("quiet")
+	return f != nil && f.Value.String() == "true"
+}
@@ -0,0 +1,144 @@
+// Package output writes results to sinks, stdout or files, for onebrc and
+// the go_* variants. Files are written atomically: a temporary file next to
+// the destination is renamed over it once complete, so a reader never sees
+// a partial result and a failed run leaves the previous one in place.
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stdout is the path of the standard output.
+const Stdout = "-"
+
+// WriteFile fills the file at path with write, atomically unless path is
+// Stdout or an existing file that is not a regular one, such as /dev/null or
+// a named pipe, which is written in place. Output is buffered.
+func WriteFile(path string, write func(io.Writer) error) error {
+	if path == Stdout {
+		return writeTo(os.Stdout, write)
+	}
+	if fi, err := os.Stat(path); err == nil && !fi.Mode().IsRegular() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		err = writeTo(f, write)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = writeTo(f, write)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// CreateTemp makes files private, give them the usual permissions
+		err = os.Chmod(f.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func writeTo(w io.Writer, write func(io.Writer) error) error {
+	bw := bufio.NewWriter(w)
+	if err := write(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Sink is a destination of results in a format.
+type Sink struct {
+	Format string
+	Path   string
+}
+
+func (s Sink) String() string {
+	return s.Format + "=" + s.Path
+}
+
+// Sinks is a flag.Value collecting the sinks of a repeated flag, each
+// "format=path" or a bare path in the format of its extension, see
+// Extensions.
+type Sinks struct {
+	List []Sink
+	// Default is the format of bare paths with unknown extensions.
+	Default string
+}
+
+// Extensions maps file extensions to the format they imply.
+var Extensions = map[string]string{
+	".json": "json",
+	".txt":  "text",
+	".csv":  "table",
+	".md":   "markdown",
+	".html": "html",
+	".xlsx": "xlsx",
+}
+
+func (s *Sinks) String() string {
+	if s == nil {
+		return ""
+	}
+	items := make([]string, len(s.List))
+	for i, sink := range s.List {
+		items[i] = sink.String()
+	}
+	return strings.Join(items, ",")
+}
+
+func (s *Sinks) Set(v string) error {
+	format, path, ok := strings.Cut(v, "=")
+	if !ok {
+		format, path = Extensions[filepath.Ext(v)], v
+	}
+	if path == "" {
+		return fmt.Errorf("sink %q has no path", v)
+	}
+	s.List = append(s.List, Sink{format, path})
+	return nil
+}
+
+// Write writes every sink with the writer of its format, or of s.Default
+// if it has none, and returns the first error. All sinks are checked for a
+// known format before any is written.
+func (s *Sinks) Write(formats map[string]func(io.Writer) error) error {
+	for _, sink := range s.List {
+		if formats[s.format(sink)] == nil {
+			return fmt.Errorf("sink %s: unknown format %q", sink.Path, s.format(sink))
+		}
+	}
+	for _, sink := range s.List {
+		if err := WriteFile(sink.Path, formats[s.format(sink)]); err != nil {
+			return fmt.Errorf("sink %s: %w", sink.Path, err)
+		}
+	}
+	return nil
+}
+
+func (s *Sinks) format(sink Sink) string {
+	if sink.Format == "" {
+		return s.Default
+	}
+	return sink.Format
+}
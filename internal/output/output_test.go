@@ -0,0 +1,67 @@
+package output
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+	if err := WriteFile(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "first")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed write leaves the previous file and no temporary one
+	if err := WriteFile(path, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("broken")
+	}); err == nil {
+		t.Error("Expected the error of write")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "first" {
+		t.Errorf("Wrong content %q after a failed write: %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Temporary files left: %v", entries)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	dir := t.TempDir()
+	s := Sinks{Default: "text"}
+	for _, v := range []string{filepath.Join(dir, "a.json"), "table=" + filepath.Join(dir, "b"), filepath.Join(dir, "c")} {
+		if err := s.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	formats := map[string]func(io.Writer) error{}
+	for _, f := range []string{"json", "table", "text"} {
+		formats[f] = func(w io.Writer) error {
+			_, err := io.WriteString(w, f)
+			return err
+		}
+	}
+	if err := s.Write(formats); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"a.json": "json", "b": "table", "c": "text"} {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != expected {
+			t.Errorf("%s has %q, expected %q", name, data, expected)
+		}
+	}
+
+	s.Set("xml=" + filepath.Join(dir, "d"))
+	if err := s.Write(formats); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "d")); err == nil {
+		t.Error("Sink written despite an unknown format")
+	}
+}
@@ -0,0 +1,154 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// The encodings of values and levels.
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+)
+
+// decodeHybrid decodes n values of width bits from the RLE/bit-packing
+// hybrid encoding of levels and dictionary indices at the start of b.
+func decodeHybrid(b []byte, width, n int) ([]uint32, error) {
+	if width < 0 || width > 32 {
+		return nil, fmt.Errorf("%w: bit width %d", errCorrupt, width)
+	}
+	if n < 0 || n > maxPageValues {
+		return nil, fmt.Errorf("%w: %d values", errCorrupt, n)
+	}
+	out := make([]uint32, 0, n)
+	byteWidth := (width + 7) / 8
+	for len(out) < n {
+		h, k := binary.Uvarint(b)
+		if k <= 0 {
+			return nil, fmt.Errorf("%w: %d of %d values", errCorrupt, len(out), n)
+		}
+		b = b[k:]
+		if h&1 == 0 {
+			// a run of a value of byteWidth bytes
+			if len(b) < byteWidth {
+				return nil, errCorrupt
+			}
+			var v uint32
+			for i := range byteWidth {
+				v |= uint32(b[i]) << (8 * i)
+			}
+			b = b[byteWidth:]
+			for run := h >> 1; run > 0 && len(out) < n; run-- {
+				out = append(out, v)
+			}
+			continue
+		}
+		// groups of 8 values packed from the least significant bit
+		if width == 0 {
+			out = append(out, make([]uint32, min(h>>1*8, uint64(n-len(out))))...)
+			continue
+		}
+		if h>>1 > uint64(len(b)) {
+			return nil, errCorrupt
+		}
+		size := int(h>>1) * width
+		if size > len(b) {
+			return nil, errCorrupt
+		}
+		packed := b[:size]
+		b = b[size:]
+		mask := uint64(1)<<width - 1
+		for bit := 0; bit+width <= 8*size && len(out) < n; bit += width {
+			var word [8]byte
+			copy(word[:], packed[bit/8:])
+			out = append(out, uint32(binary.LittleEndian.Uint64(word[:])>>(bit%8)&mask))
+		}
+	}
+	return out, nil
+}
+
+// decodePlain appends n values of c in the PLAIN encoding at the start of b
+// to v.
+func decodePlain(b []byte, c Column, n int, v *Values) error {
+	switch c.Type {
+	case ByteArray:
+		for range n {
+			if len(b) < 4 {
+				return errCorrupt
+			}
+			l := binary.LittleEndian.Uint32(b)
+			if uint64(l) > uint64(len(b)-4) {
+				return errCorrupt
+			}
+			v.Bytes = append(v.Bytes, b[4:4+l:4+l])
+			b = b[4+l:]
+		}
+	case FixedLenByteArray:
+		l := c.typeLength
+		if l <= 0 || n > len(b)/l {
+			return errCorrupt
+		}
+		for i := range n {
+			v.Bytes = append(v.Bytes, b[i*l:(i+1)*l:(i+1)*l])
+		}
+	case Float, Int32:
+		if n > len(b)/4 {
+			return errCorrupt
+		}
+		for i := range n {
+			u := binary.LittleEndian.Uint32(b[4*i:])
+			if c.Type == Float {
+				v.Floats = append(v.Floats, float64(math.Float32frombits(u)))
+			} else {
+				v.Floats = append(v.Floats, float64(int32(u)))
+			}
+		}
+	case Double, Int64:
+		if n > len(b)/8 {
+			return errCorrupt
+		}
+		for i := range n {
+			u := binary.LittleEndian.Uint64(b[8*i:])
+			if c.Type == Double {
+				v.Floats = append(v.Floats, math.Float64frombits(u))
+			} else {
+				v.Floats = append(v.Floats, float64(int64(u)))
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported column type %v", c.Type)
+	}
+	return nil
+}
+
+// decodeDictionary appends n values of the dictionary indices at the start
+// of b, a byte of their bit width and their hybrid encoding, to v.
+func decodeDictionary(b []byte, dict *Values, n int, v *Values) error {
+	if dict == nil {
+		return fmt.Errorf("%w: dictionary encoded page without a dictionary", errCorrupt)
+	}
+	if len(b) == 0 {
+		if n == 0 {
+			return nil
+		}
+		return errCorrupt
+	}
+	indices, err := decodeHybrid(b[1:], int(b[0]), n)
+	if err != nil {
+		return err
+	}
+	for _, i := range indices {
+		switch {
+		case dict.Bytes != nil && int(i) < len(dict.Bytes):
+			v.Bytes = append(v.Bytes, dict.Bytes[i])
+		case dict.Floats != nil && int(i) < len(dict.Floats):
+			v.Floats = append(v.Floats, dict.Floats[i])
+		default:
+			return fmt.Errorf("%w: dictionary index %d out of range", errCorrupt, i)
+		}
+	}
+	return nil
+}
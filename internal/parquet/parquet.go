@@ -0,0 +1,428 @@
+// Package parquet reads the columns of Parquet files as far as measurements
+// need: flat schemas of required or optional columns of strings and
+// numbers, PLAIN and dictionary encoded in data pages of either version, and
+// uncompressed or compressed with SNAPPY or GZIP. Each row group of a column
+// is read on its own, so row groups can be decoded in parallel.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+)
+
+// Type is the physical type of a column.
+type Type int
+
+// The physical types, numbered as in the Parquet format.
+const (
+	Boolean Type = iota
+	Int32
+	Int64
+	Int96
+	Float
+	Double
+	ByteArray
+	FixedLenByteArray
+)
+
+var typeNames = []string{"BOOLEAN", "INT32", "INT64", "INT96", "FLOAT", "DOUBLE", "BYTE_ARRAY", "FIXED_LEN_BYTE_ARRAY"}
+
+func (t Type) String() string {
+	if t >= 0 && int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Numeric reports whether Values of columns of t are Floats.
+func (t Type) Numeric() bool {
+	return t == Int32 || t == Int64 || t == Float || t == Double
+}
+
+// Column is a leaf column of the schema.
+type Column struct {
+	// Name is the path of the column, its parts joined by dots.
+	Name string
+	Type Type
+	// Optional columns may have null values.
+	Optional   bool
+	typeLength int
+	// maxDef and maxRep are the highest definition and repetition levels
+	maxDef, maxRep int
+}
+
+// Values are the values of a column in a row group, Floats for numeric
+// columns and Bytes for the others.
+type Values struct {
+	Bytes  [][]byte
+	Floats []float64
+	// Null, set for optional columns, marks the rows without a value, whose
+	// Bytes or Floats are zero.
+	Null []bool
+}
+
+// Len returns the number of values.
+func (v *Values) Len() int {
+	return max(len(v.Bytes), len(v.Floats))
+}
+
+// File is an open Parquet file.
+type File struct {
+	r         io.ReaderAt
+	columns   []Column
+	rowGroups []rowGroup
+}
+
+type rowGroup struct {
+	rows   int64
+	chunks []chunk
+}
+
+// chunk is a column of a row group.
+type chunk struct {
+	codec          int64
+	values         int64
+	offset, length int64
+}
+
+const magic = "PAR1"
+
+// Open reads the metadata of the Parquet file of size bytes in r.
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	if size < 12 {
+		return nil, errors.New("not a parquet file: too short")
+	}
+	var head, tail [8]byte
+	if _, err := r.ReadAt(head[:4], 0); err != nil {
+		return nil, err
+	}
+	if _, err := r.ReadAt(tail[:], size-8); err != nil {
+		return nil, err
+	}
+	if string(head[:4]) != magic || string(tail[4:]) != magic {
+		return nil, errors.New("not a parquet file: no PAR1 magic")
+	}
+	n := int64(binary.LittleEndian.Uint32(tail[:]))
+	if n > size-12 {
+		return nil, fmt.Errorf("%w: footer of %d bytes", errCorrupt, n)
+	}
+	footer := make([]byte, n)
+	if _, err := r.ReadAt(footer, size-8-n); err != nil {
+		return nil, err
+	}
+	meta, _, err := decodeStruct(footer)
+	if err != nil {
+		return nil, fmt.Errorf("footer: %w", err)
+	}
+
+	f := &File{r: r}
+	schema := meta.list(2)
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("%w: no schema", errCorrupt)
+	}
+	root, _ := schema[0].(thriftFields)
+	rest, err := f.addColumns(schema[1:], int(root.int(5, 0)), nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: schema has %d elements left over", errCorrupt, len(rest))
+	}
+	for _, g := range meta.list(4) {
+		g, _ := g.(thriftFields)
+		rg := rowGroup{rows: g.int(3, 0)}
+		if rg.rows < 0 {
+			return nil, fmt.Errorf("%w: row group of %d rows", errCorrupt, rg.rows)
+		}
+		cols := g.list(1)
+		if len(cols) != len(f.columns) {
+			return nil, fmt.Errorf("%w: row group of %d columns, schema of %d", errCorrupt, len(cols), len(f.columns))
+		}
+		for _, c := range cols {
+			c, _ := c.(thriftFields)
+			if len(c.bytes(1)) > 0 {
+				return nil, fmt.Errorf("unsupported column in file %s", c.bytes(1))
+			}
+			m := c.fields(3)
+			ch := chunk{codec: m.int(4, 0), values: m.int(5, 0), offset: m.int(9, 0), length: m.int(7, 0)}
+			if d := m.int(11, 0); d > 0 && d < ch.offset {
+				ch.offset = d
+			}
+			if ch.offset < 4 || ch.length < 0 || ch.offset > size-ch.length || ch.values < 0 {
+				return nil, fmt.Errorf("%w: column chunk at %d of %d bytes", errCorrupt, ch.offset, ch.length)
+			}
+			rg.chunks = append(rg.chunks, ch)
+		}
+		f.rowGroups = append(f.rowGroups, rg)
+	}
+	return f, nil
+}
+
+// addColumns adds the leaves of the first n elements of schema, and their
+// children, to f.columns, and returns the elements after them. path, def and
+// rep are of their parent.
+func (f *File) addColumns(schema []any, n int, path []string, def, rep int) ([]any, error) {
+	for range n {
+		if len(schema) == 0 {
+			return nil, fmt.Errorf("%w: schema ends early", errCorrupt)
+		}
+		e, _ := schema[0].(thriftFields)
+		schema = schema[1:]
+		p := append(path[:len(path):len(path)], string(e.bytes(4)))
+		d, r := def, rep
+		switch e.int(3, 0) {
+		case 1: // OPTIONAL
+			d++
+		case 2: // REPEATED
+			d++
+			r++
+		}
+		if children := int(e.int(5, 0)); children > 0 {
+			var err error
+			if schema, err = f.addColumns(schema, children, p, d, r); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		f.columns = append(f.columns, Column{
+			Name:       strings.Join(p, "."),
+			Type:       Type(e.int(1, 0)),
+			Optional:   d > 0,
+			typeLength: int(e.int(2, 0)),
+			maxDef:     d,
+			maxRep:     r,
+		})
+	}
+	return schema, nil
+}
+
+// Columns returns the leaf columns in schema order.
+func (f *File) Columns() []Column {
+	return f.columns
+}
+
+// RowGroups returns the number of row groups.
+func (f *File) RowGroups() int {
+	return len(f.rowGroups)
+}
+
+// Rows returns the number of rows of row group rg.
+func (f *File) Rows(rg int) int64 {
+	return f.rowGroups[rg].rows
+}
+
+// Bytes returns the size of the column chunks of row group rg in the file.
+func (f *File) Bytes(rg int) int64 {
+	var n int64
+	for _, ch := range f.rowGroups[rg].chunks {
+		n += ch.length
+	}
+	return n
+}
+
+// The page types.
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// ReadColumn reads the values of column col in row group rg. Bytes point
+// into a buffer of their own, which stays valid.
+func (f *File) ReadColumn(rg, col int) (*Values, error) {
+	c := f.columns[col]
+	if c.maxRep > 0 {
+		return nil, fmt.Errorf("unsupported repeated column %s", c.Name)
+	}
+	ch := f.rowGroups[rg].chunks[col]
+	buf := make([]byte, ch.length)
+	if _, err := f.r.ReadAt(buf, ch.offset); err != nil {
+		return nil, err
+	}
+	rows := f.rowGroups[rg].rows
+	v := &Values{}
+	if c.Optional {
+		// the rows of a corrupt footer do not allocate beyond a page
+		v.Null = make([]bool, 0, min(rows, maxPageValues))
+	}
+	var dict *Values
+	// a page has values for every row, nulls included
+	for int64(v.Len()) < ch.values && len(buf) > 0 {
+		header, n, err := decodeStruct(buf)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: page header: %w", c.Name, err)
+		}
+		size := header.int(3, 0)
+		if size < 0 || size > int64(len(buf)-n) {
+			return nil, fmt.Errorf("column %s: %w: page of %d bytes", c.Name, errCorrupt, size)
+		}
+		page := buf[n : n+int(size)]
+		buf = buf[n+int(size):]
+		uncompressed := int(header.int(2, 0))
+		switch header.int(1, -1) {
+		case pageDictionary:
+			h := header.fields(7)
+			data, err := decompress(ch.codec, page, uncompressed)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.Name, err)
+			}
+			dict = &Values{}
+			if c.Type.Numeric() {
+				dict.Floats = []float64{}
+			} else {
+				dict.Bytes = [][]byte{}
+			}
+			if err := decodePlain(data, c, int(h.int(1, 0)), dict); err != nil {
+				return nil, fmt.Errorf("column %s: dictionary: %w", c.Name, err)
+			}
+		case pageData:
+			h := header.fields(5)
+			data, err := decompress(ch.codec, page, uncompressed)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.Name, err)
+			}
+			var levels []byte
+			if c.maxDef > 0 {
+				if len(data) < 4 || h.int(3, encodingRLE) != encodingRLE {
+					return nil, fmt.Errorf("column %s: %w: definition levels", c.Name, errCorrupt)
+				}
+				l := binary.LittleEndian.Uint32(data)
+				if uint64(l) > uint64(len(data)-4) {
+					return nil, fmt.Errorf("column %s: %w: definition levels", c.Name, errCorrupt)
+				}
+				levels, data = data[4:4+l], data[4+l:]
+			}
+			if err := v.decodePage(c, data, levels, h.int(1, 0), rows, h.int(2, 0), dict); err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.Name, err)
+			}
+		case pageDataV2:
+			h := header.fields(8)
+			defLen, repLen := h.int(5, 0), h.int(6, 0)
+			if defLen < 0 || repLen < 0 || defLen+repLen > int64(len(page)) {
+				return nil, fmt.Errorf("column %s: %w: levels", c.Name, errCorrupt)
+			}
+			levels, data := page[repLen:repLen+defLen], page[repLen+defLen:]
+			if h.bool(7, true) {
+				if data, err = decompress(ch.codec, data, uncompressed-int(defLen+repLen)); err != nil {
+					return nil, fmt.Errorf("column %s: %w", c.Name, err)
+				}
+			}
+			if err := v.decodePage(c, data, levels, h.int(1, 0), rows, h.int(4, 0), dict); err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.Name, err)
+			}
+		}
+	}
+	if int64(v.Len()) != rows {
+		return nil, fmt.Errorf("column %s: %w: %d values in row group of %d rows", c.Name, errCorrupt, v.Len(), rows)
+	}
+	return v, nil
+}
+
+// decodePage appends the n values of a data page to v, levels being its
+// definition levels. They must fit in the row group of rows rows after the
+// values of v.
+func (v *Values) decodePage(c Column, data, levels []byte, n, rows, encoding int64, dict *Values) error {
+	if n < 0 || n > rows-int64(v.Len()) || n > maxPageValues {
+		return fmt.Errorf("%w: page of %d values", errCorrupt, n)
+	}
+	present := int(n)
+	var defs []uint32
+	if c.maxDef > 0 {
+		var err error
+		if defs, err = decodeHybrid(levels, bits.Len(uint(c.maxDef)), int(n)); err != nil {
+			return fmt.Errorf("definition levels: %w", err)
+		}
+		present = 0
+		for _, d := range defs {
+			if int(d) == c.maxDef {
+				present++
+			}
+		}
+	}
+	dense := &Values{}
+	var err error
+	switch encoding {
+	case encodingPlain:
+		err = decodePlain(data, c, present, dense)
+	case encodingPlainDictionary, encodingRLEDictionary:
+		err = decodeDictionary(data, dict, present, dense)
+	default:
+		err = fmt.Errorf("unsupported encoding %d", encoding)
+	}
+	if err != nil {
+		return err
+	}
+	if defs == nil {
+		v.Bytes = append(v.Bytes, dense.Bytes...)
+		v.Floats = append(v.Floats, dense.Floats...)
+		return nil
+	}
+	i := 0
+	for _, d := range defs {
+		null := int(d) != c.maxDef
+		v.Null = append(v.Null, null)
+		switch {
+		case null && c.Type.Numeric():
+			v.Floats = append(v.Floats, 0)
+		case null:
+			v.Bytes = append(v.Bytes, nil)
+		case c.Type.Numeric():
+			v.Floats = append(v.Floats, dense.Floats[i])
+			i++
+		default:
+			v.Bytes = append(v.Bytes, dense.Bytes[i])
+			i++
+		}
+	}
+	return nil
+}
+
+// The compression codecs.
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+)
+
+var codecNames = map[int64]string{3: "LZO", 4: "BROTLI", 5: "LZ4", 6: "ZSTD", 7: "LZ4_RAW"}
+
+// maxPage bounds the uncompressed size of pages, which writers keep to a few
+// MB, so that corrupt headers do not allocate without bounds.
+const maxPage = 1 << 30
+
+// maxPageValues bounds the values of pages, and of the levels and indices
+// decoded for them, likewise.
+const maxPageValues = 1 << 24
+
+// decompress returns data of codec decompressed into n bytes.
+func decompress(codec int64, data []byte, n int) ([]byte, error) {
+	if codec != codecUncompressed && (n < 0 || n > maxPage) {
+		return nil, fmt.Errorf("%w: page of %d bytes", errCorrupt, n)
+	}
+	switch codec {
+	case codecUncompressed:
+		return data, nil
+	case codecSnappy:
+		return decodeSnappy(data, n)
+	case codecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, n)
+		if _, err := io.ReadFull(zr, out); err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return out, nil
+	}
+	if name, ok := codecNames[codec]; ok {
+		return nil, fmt.Errorf("unsupported compression codec %s", name)
+	}
+	return nil, fmt.Errorf("%w: compression codec %d", errCorrupt, codec)
+}
@@ -0,0 +1,146 @@
+package parquet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/djheidihoe/1brc/internal/testdata"
+)
+
+func TestSnappy(t *testing.T) {
+	// a literal "abc" and a copy of offset 3 and length 6
+	got, err := decodeSnappy([]byte{9, 2 << 2, 'a', 'b', 'c', 2<<2 | 1, 3}, 9)
+	if err != nil || string(got) != "abcabcabc" {
+		t.Errorf("decodeSnappy = %q, %v, want abcabcabc", got, err)
+	}
+	if _, err := decodeSnappy([]byte{9, 2 << 2, 'a', 'b', 'c', 2<<2 | 1, 4}, 9); err == nil {
+		t.Error("decodeSnappy of a copy before the start succeeded")
+	}
+	if _, err := decodeSnappy([]byte{9, 2 << 2, 'a', 'b', 'c'}, 9); err == nil {
+		t.Error("decodeSnappy of a short block succeeded")
+	}
+}
+
+func TestHybrid(t *testing.T) {
+	for _, tt := range []struct {
+		b     []byte
+		width int
+		want  []uint32
+	}{
+		// a run of 5 ones
+		{[]byte{5 << 1, 1}, 1, []uint32{1, 1, 1, 1, 1}},
+		// a bit-packed group of 0 to 7 in 3 bits
+		{[]byte{1<<1 | 1, 0x88, 0xc6, 0xfa}, 3, []uint32{0, 1, 2, 3, 4, 5, 6, 7}},
+		// a run of a 2 byte value, whose truncated run after it is not read
+		{[]byte{2 << 1, 0x34, 0x12, 1<<1 | 1, 0xff}, 9, []uint32{0x1234, 0x1234}},
+		{[]byte{1<<1 | 1}, 0, []uint32{0, 0, 0}},
+	} {
+		got, err := decodeHybrid(tt.b, tt.width, len(tt.want))
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("decodeHybrid(% x, %d) = %v, %v, want %v", tt.b, tt.width, got, err, tt.want)
+		}
+	}
+	if _, err := decodeHybrid([]byte{5 << 1, 1}, 1, 6); !errors.Is(err, errCorrupt) {
+		t.Errorf("decodeHybrid of too few values = %v, want %v", err, errCorrupt)
+	}
+}
+
+func TestReadColumn(t *testing.T) {
+	input := []byte("Hamburg;12.0\nBulawayo;8.9\nPalembang;38.8\nHamburg;-4.5\nSt. John's;15.2\n")
+	names := []string{"Hamburg", "Bulawayo", "Palembang", "Hamburg", "St. John's"}
+	temps := []float64{12, 8.9, 38.8, -4.5, 15.2}
+	for _, s := range []testdata.ParquetShape{
+		{},
+		{RowGroup: 2, PageRows: 1},
+		{Dictionary: true, Codec: "snappy"},
+		{Dictionary: true, V2: true, Codec: "gzip", RowGroup: 3},
+		{Optional: true, Float: true, PageRows: 2},
+		{Optional: true, Dictionary: true, V2: true, Codec: "snappy"},
+	} {
+		t.Run(fmt.Sprintf("%+v", s), func(t *testing.T) {
+			data := testdata.Parquet(input, s)
+			f, err := Open(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cols := f.Columns()
+			if len(cols) != 2 || cols[0].Name != "station" || cols[0].Type != ByteArray || cols[1].Name != "temperature" || !cols[1].Type.Numeric() || cols[0].Optional != s.Optional {
+				t.Fatalf("Columns = %+v", cols)
+			}
+			var gotNames []string
+			var gotTemps []float64
+			for rg := range f.RowGroups() {
+				station, err := f.ReadColumn(rg, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				temperature, err := f.ReadColumn(rg, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if int64(station.Len()) != f.Rows(rg) || int64(temperature.Len()) != f.Rows(rg) {
+					t.Fatalf("row group %d has %d and %d values, want %d", rg, station.Len(), temperature.Len(), f.Rows(rg))
+				}
+				for i := range station.Len() {
+					// the rows testdata.Parquet adds with nulls
+					if s.Optional && (station.Null[i] || temperature.Null[i]) {
+						continue
+					}
+					gotNames = append(gotNames, string(station.Bytes[i]))
+					gotTemps = append(gotTemps, float64(float32(temperature.Floats[i])))
+				}
+			}
+			if !slices.Equal(gotNames, names) {
+				t.Errorf("stations = %q, want %q", gotNames, names)
+			}
+			for i := range temps {
+				if i < len(gotTemps) && float64(float32(temps[i])) != gotTemps[i] {
+					t.Errorf("temperature %d = %g, want %g", i, gotTemps[i], temps[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	data := testdata.Parquet([]byte("Hamburg;12.0\n"), testdata.ParquetShape{})
+	for name, b := range map[string][]byte{
+		"short":     []byte("PAR1PAR1"),
+		"text":      []byte("Hamburg;12.0\nHamburg;12.0\n"),
+		"truncated": data[:len(data)-20],
+		"footer":    append(bytes.Clone(data[:len(data)-8]), 0xff, 0xff, 0xff, 0x0f, 'P', 'A', 'R', '1'),
+	} {
+		if _, err := Open(bytes.NewReader(b), int64(len(b))); err == nil {
+			t.Errorf("Open of %s succeeded", name)
+		}
+	}
+}
+
+// FuzzReadColumn reads corrupt files, which must fail instead of panicking,
+// such as testdata/fuzz/FuzzReadColumn/negative-num-values.
+func FuzzReadColumn(f *testing.F) {
+	input := []byte("Hamburg;12.0\nBulawayo;8.9\nHamburg;-4.5\n")
+	for _, s := range []testdata.ParquetShape{
+		{},
+		{Dictionary: true, Codec: "snappy", PageRows: 2},
+		{Optional: true, Dictionary: true, V2: true, Codec: "gzip"},
+	} {
+		f.Add(testdata.Parquet(input, s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pf, err := Open(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		for rg := range pf.RowGroups() {
+			for col := range pf.Columns() {
+				if v, err := pf.ReadColumn(rg, col); err == nil && int64(v.Len()) != pf.Rows(rg) {
+					t.Errorf("row group %d column %d has %d values, want %d", rg, col, v.Len(), pf.Rows(rg))
+				}
+			}
+		}
+	})
+}
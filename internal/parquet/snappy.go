@@ -0,0 +1,73 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// decodeSnappy decompresses the Snappy block src, which Parquet's SNAPPY
+// codec uses without the framing format, into n bytes.
+func decodeSnappy(src []byte, n int) ([]byte, error) {
+	size, k := binary.Uvarint(src)
+	if k <= 0 || size != uint64(n) {
+		return nil, fmt.Errorf("snappy: %w: length %d, expected %d", errCorrupt, size, n)
+	}
+	dst := make([]byte, 0, n)
+	for s := src[k:]; len(s) > 0; {
+		tag := s[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0: // literal
+			length = int(tag >> 2)
+			s = s[1:]
+			if length >= 60 {
+				// the length follows in 1 to 4 bytes
+				b := length - 59
+				if len(s) < b {
+					return nil, fmt.Errorf("snappy: %w", errCorrupt)
+				}
+				length = 0
+				for i := b - 1; i >= 0; i-- {
+					length = length<<8 | int(s[i])
+				}
+				s = s[b:]
+			}
+			length++
+			if length > len(s) || length > n-len(dst) {
+				return nil, fmt.Errorf("snappy: %w", errCorrupt)
+			}
+			dst = append(dst, s[:length]...)
+			s = s[length:]
+			continue
+		case 1:
+			if len(s) < 2 {
+				return nil, fmt.Errorf("snappy: %w", errCorrupt)
+			}
+			length, offset = 4+int(tag>>2&7), int(tag>>5)<<8|int(s[1])
+			s = s[2:]
+		case 2:
+			if len(s) < 3 {
+				return nil, fmt.Errorf("snappy: %w", errCorrupt)
+			}
+			length, offset = 1+int(tag>>2), int(binary.LittleEndian.Uint16(s[1:]))
+			s = s[3:]
+		case 3:
+			if len(s) < 5 {
+				return nil, fmt.Errorf("snappy: %w", errCorrupt)
+			}
+			length, offset = 1+int(tag>>2), int(binary.LittleEndian.Uint32(s[1:]))
+			s = s[5:]
+		}
+		if offset <= 0 || offset > len(dst) || length > n-len(dst) {
+			return nil, fmt.Errorf("snappy: %w", errCorrupt)
+		}
+		// copies may overlap what they append
+		for i := len(dst) - offset; length > 0; i, length = i+1, length-1 {
+			dst = append(dst, dst[i])
+		}
+	}
+	if len(dst) != n {
+		return nil, fmt.Errorf("snappy: %w: %d bytes, expected %d", errCorrupt, len(dst), n)
+	}
+	return dst, nil
+}
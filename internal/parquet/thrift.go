@@ -0,0 +1,211 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// errCorrupt reports metadata or pages that do not decode.
+var errCorrupt = errors.New("corrupt parquet data")
+
+// The types of the Thrift compact protocol, which Parquet encodes its
+// metadata and page headers in.
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+// maxDepth bounds the nesting of structs and lists, which is below 10 in
+// Parquet metadata, so corrupt input cannot exhaust the stack.
+const maxDepth = 32
+
+// thriftFields are the fields of a decoded struct by id. Values are int64
+// for all integers, bool, float64, []byte, []any for lists and sets,
+// thriftFields for structs and nil for maps, which Parquet metadata only has
+// in parts that are not read.
+type thriftFields map[int16]any
+
+// int returns field id of s as an int64, or def if it is not set.
+func (s thriftFields) int(id int16, def int64) int64 {
+	if v, ok := s[id].(int64); ok {
+		return v
+	}
+	return def
+}
+
+func (s thriftFields) bool(id int16, def bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (s thriftFields) bytes(id int16) []byte {
+	v, _ := s[id].([]byte)
+	return v
+}
+
+func (s thriftFields) list(id int16) []any {
+	v, _ := s[id].([]any)
+	return v
+}
+
+func (s thriftFields) fields(id int16) thriftFields {
+	v, _ := s[id].(thriftFields)
+	return v
+}
+
+// thriftDecoder decodes the compact protocol from b.
+type thriftDecoder struct {
+	b   []byte
+	pos int
+	err error
+}
+
+// decodeStruct decodes the struct at the start of b and returns it and its
+// length in bytes.
+func decodeStruct(b []byte) (thriftFields, int, error) {
+	d := &thriftDecoder{b: b}
+	s := d.structure(0)
+	if d.err != nil {
+		return nil, 0, d.err
+	}
+	return s, d.pos, nil
+}
+
+func (d *thriftDecoder) fail() {
+	if d.err == nil {
+		d.err = errCorrupt
+	}
+	d.pos = len(d.b)
+}
+
+func (d *thriftDecoder) byte() byte {
+	if d.pos >= len(d.b) {
+		d.fail()
+		return 0
+	}
+	c := d.b[d.pos]
+	d.pos++
+	return c
+}
+
+func (d *thriftDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b[d.pos:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *thriftDecoder) varint() int64 {
+	u := d.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (d *thriftDecoder) structure(depth int) thriftFields {
+	if depth > maxDepth {
+		d.fail()
+		return nil
+	}
+	s := thriftFields{}
+	var id int16
+	for d.err == nil {
+		h := d.byte()
+		if h&0x0f == thriftStop {
+			break
+		}
+		if delta := h >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			id = int16(d.varint())
+		}
+		switch typ := h & 0x0f; typ {
+		case thriftTrue:
+			s[id] = true
+		case thriftFalse:
+			s[id] = false
+		default:
+			s[id] = d.value(typ, depth)
+		}
+	}
+	return s
+}
+
+func (d *thriftDecoder) value(typ byte, depth int) any {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		// elements of lists are a byte each
+		return d.byte() == thriftTrue
+	case thriftByte:
+		return int64(int8(d.byte()))
+	case thriftI16, thriftI32, thriftI64:
+		return d.varint()
+	case thriftDouble:
+		if len(d.b)-d.pos < 8 {
+			d.fail()
+			return 0.0
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(d.b[d.pos:]))
+		d.pos += 8
+		return v
+	case thriftBinary:
+		n := d.uvarint()
+		if n > uint64(len(d.b)-d.pos) {
+			d.fail()
+			return nil
+		}
+		v := d.b[d.pos : d.pos+int(n)]
+		d.pos += int(n)
+		return v
+	case thriftList, thriftSet:
+		h := d.byte()
+		n := uint64(h >> 4)
+		if n == 15 {
+			n = d.uvarint()
+		}
+		// every element takes a byte at least
+		if n > uint64(len(d.b)-d.pos) {
+			d.fail()
+			return nil
+		}
+		l := make([]any, 0, n)
+		for range n {
+			l = append(l, d.value(h&0x0f, depth+1))
+		}
+		return l
+	case thriftMap:
+		n := d.uvarint()
+		if n == 0 {
+			return nil
+		}
+		if n > uint64(len(d.b)-d.pos) {
+			d.fail()
+			return nil
+		}
+		kv := d.byte()
+		for range n {
+			d.value(kv>>4, depth+1)
+			d.value(kv&0x0f, depth+1)
+		}
+		return nil
+	case thriftStruct:
+		return d.structure(depth + 1)
+	}
+	d.fail()
+	return nil
+}
@@ -0,0 +1,250 @@
+// Package phases breaks the time of a run down by phase and worker for the
+// -breakdown flag of the go_* variants. Per-line phases are timed on one line
+// in SampleEvery and extrapolated, so the clock is read rarely enough not to
+// distort what it measures; coarse phases such as reads and merges are timed
+// exactly.
+package phases
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/cpu"
+)
+
+// Phase is a part of the work on the input.
+type Phase int
+
+const (
+	// Read is reading input into memory, including page faults where they
+	// can be told apart from scanning.
+	Read Phase = iota
+	// Scan is finding the line and field separators.
+	Scan
+	// Parse is converting the temperature.
+	Parse
+	// Update is looking up the station and updating its stats.
+	Update
+	// Merge is combining the per-worker results.
+	Merge
+	numPhases
+)
+
+var names = [numPhases]string{"read", "scan", "parse", "update", "merge"}
+
+func (p Phase) String() string {
+	return names[p]
+}
+
+// SampleEvery is the share of lines whose phases are timed.
+const SampleEvery = 1024
+
+// Breakdown collects the timings of the workers of a run. A nil *Breakdown
+// hands out nil Workers, which record nothing, so instrumented code needs no
+// checks of its own when -breakdown is off.
+type Breakdown struct {
+	workers []*Worker
+	clock   time.Duration
+}
+
+// New returns a breakdown if enabled and nil otherwise.
+func New(enabled bool) *Breakdown {
+	if !enabled {
+		return nil
+	}
+	return &Breakdown{clock: clockCost()}
+}
+
+// clockCost measures the typical time between two readings of the clock.
+// Phases of a line take tens of nanoseconds, about as long as reading the
+// clock on some virtual machines, so Since subtracts it from every sample.
+func clockCost() time.Duration {
+	d := make([]time.Duration, 1001)
+	for i := range d {
+		t := time.Now()
+		d[i] = time.Since(t)
+	}
+	slices.Sort(d)
+	return d[len(d)/2]
+}
+
+// Worker adds a row for a worker named name. Each Worker must only be used by
+// one goroutine.
+func (b *Breakdown) Worker(name string) *Worker {
+	if b == nil {
+		return nil
+	}
+	w := &Worker{name: name, clock: b.clock}
+	b.workers = append(b.workers, w)
+	return w
+}
+
+// Worker holds the timings of one worker.
+type Worker struct {
+	name    string
+	lines   int64
+	timed   int64 // sampled lines
+	sampled [numPhases]time.Duration
+	exact   [numPhases]time.Duration
+	start   time.Time
+	wall    time.Duration
+	clock   time.Duration // see clockCost
+	added   time.Duration // total of exact, to leave it out of samples
+	mark    time.Duration // added at the last sampled reading of the clock
+	// the counts are written on every line, apart from those of the
+	// worker allocated next
+	_ cpu.CacheLinePad
+}
+
+// Start starts the wall clock of w.
+func (w *Worker) Start() {
+	if w != nil {
+		w.start = time.Now()
+	}
+}
+
+// Stop stops the wall clock of w. The time neither sampled nor added to a
+// phase is reported as other, e.g. waiting for input.
+func (w *Worker) Stop() {
+	if w != nil {
+		w.wall += time.Since(w.start)
+	}
+}
+
+// Sample counts a line and reports whether its phases are to be timed with
+// Since.
+func (w *Worker) Sample() bool {
+	if w == nil {
+		return false
+	}
+	w.lines++
+	if w.lines%SampleEvery != 0 {
+		return false
+	}
+	w.timed++
+	w.mark = w.added
+	return true
+}
+
+// Since records the time since t for phase p of a sampled line and returns
+// the current time, the start of the next phase. Time added with Add in the
+// meantime, such as a read refilling a buffer, is not counted again.
+func (w *Worker) Since(p Phase, t time.Time) time.Time {
+	now := time.Now()
+	w.sampled[p] += now.Sub(t) - w.clock - (w.added - w.mark)
+	w.mark = w.added
+	return now
+}
+
+// Add records d spent in phase p, for phases timed as a whole.
+func (w *Worker) Add(p Phase, d time.Duration) {
+	if w != nil {
+		w.exact[p] += d
+		w.added += d
+	}
+}
+
+// Reader returns r, timing its reads as phase Read of w.
+func (w *Worker) Reader(r io.Reader) io.Reader {
+	if w == nil {
+		return r
+	}
+	return &reader{r, w}
+}
+
+type reader struct {
+	r io.Reader
+	w *Worker
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.r.Read(p)
+	r.w.Add(Read, time.Since(start))
+	return n, err
+}
+
+// estimates returns the time spent in each phase, extrapolating the sampled
+// lines to all lines. Timing a phase on its own stalls the overlap of
+// consecutive lines in the CPU, so sampled phases come out long; where they
+// add up to more than the wall time left by the exact ones they are scaled
+// down to fit, leaving the shares intact.
+func (w *Worker) estimates() [numPhases]time.Duration {
+	var est [numPhases]time.Duration
+	var sampled, exact time.Duration
+	for p := range numPhases {
+		if w.timed > 0 {
+			est[p] = time.Duration(float64(max(w.sampled[p], 0)) * float64(w.lines) / float64(w.timed))
+		}
+		sampled += est[p]
+		exact += w.exact[p]
+	}
+	if budget := w.wall - exact; w.wall > 0 && sampled > budget {
+		scale := float64(max(budget, 0)) / float64(sampled)
+		for p := range est {
+			est[p] = time.Duration(float64(est[p]) * scale)
+		}
+	}
+	for p := range est {
+		est[p] += w.exact[p]
+	}
+	return est
+}
+
+// WriteTable writes a row per worker and the totals with their shares.
+func (b *Breakdown) WriteTable(w io.Writer) error {
+	if b == nil {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "worker\tlines\t")
+	for p := range numPhases {
+		fmt.Fprintf(tw, "%v\t", p)
+	}
+	fmt.Fprint(tw, "other\twall\t\n")
+
+	var lines int64
+	var wall time.Duration
+	var totals [numPhases + 1]time.Duration // the phases and other
+	for _, wk := range b.workers {
+		fmt.Fprintf(tw, "%s\t%d\t", wk.name, wk.lines)
+		var accounted time.Duration
+		for p, d := range wk.estimates() {
+			accounted += d
+			totals[p] += d
+			fmt.Fprintf(tw, "%v\t", round(d))
+		}
+		other := max(wk.wall-accounted, 0)
+		totals[numPhases] += other
+		fmt.Fprintf(tw, "%v\t%v\t\n", round(other), round(wk.wall))
+		lines += wk.lines
+		wall += wk.wall
+	}
+
+	fmt.Fprintf(tw, "all\t%d\t", lines)
+	for _, d := range totals {
+		fmt.Fprintf(tw, "%v\t", round(d))
+	}
+	fmt.Fprintf(tw, "%v\t\n", round(wall))
+	fmt.Fprint(tw, "share\t\t")
+	var sum time.Duration
+	for _, d := range totals {
+		sum += d
+	}
+	for _, d := range totals {
+		share := 0.0
+		if sum > 0 {
+			share = 100 * float64(d) / float64(sum)
+		}
+		fmt.Fprintf(tw, "%.1f%%\t", share)
+	}
+	fmt.Fprint(tw, "\t\n")
+	return tw.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
@@ -0,0 +1,72 @@
+package phases
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreakdown(t *testing.T) {
+	b := New(true)
+	w := b.Worker("0")
+	w.Start()
+	for range 10 * SampleEvery {
+		if w.Sample() {
+			t := time.Now().Add(-time.Microsecond)
+			t = w.Since(Scan, t)
+			w.Since(Parse, t.Add(-2*time.Microsecond))
+		}
+	}
+	w.Add(Read, time.Millisecond)
+	w.Stop()
+
+	if w.lines != 10*SampleEvery || w.timed != 10 {
+		t.Errorf("Wrong counts: %d lines, %d timed", w.lines, w.timed)
+	}
+	// each sampled line stands for SampleEvery lines
+	w.wall = time.Second
+	est := w.estimates()
+	if d := est[Scan]; d < SampleEvery*10*time.Microsecond {
+		t.Errorf("Wrong scan estimate %v", d)
+	}
+	if d := est[Parse]; d < SampleEvery*20*time.Microsecond {
+		t.Errorf("Wrong parse estimate %v", d)
+	}
+	if d := est[Read]; d != time.Millisecond {
+		t.Errorf("Wrong read time %v", d)
+	}
+
+	// samples beyond the wall time are scaled down to what the exact phases
+	// leave of it
+	w.wall = 11 * time.Millisecond
+	est = w.estimates()
+	if d := est[Scan] + est[Parse]; d < 9900*time.Microsecond || d > 10*time.Millisecond {
+		t.Errorf("Wrong scaled estimates %v and %v", est[Scan], est[Parse])
+	}
+	if est[Parse] < est[Scan] {
+		t.Errorf("Scaling changed the shares: %v and %v", est[Scan], est[Parse])
+	}
+
+	var out strings.Builder
+	if err := b.WriteTable(&out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(strings.TrimSpace(lines[1]), "0  10240") || !strings.HasPrefix(strings.TrimSpace(lines[2]), "all") {
+		t.Errorf("Wrong table:\n%s", out.String())
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	b := New(false)
+	w := b.Worker("0")
+	w.Start()
+	if w.Sample() {
+		t.Error("Disabled worker samples")
+	}
+	w.Add(Merge, time.Second)
+	w.Stop()
+	if err := b.WriteTable(nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+// Package power measures the energy used by the CPU packages through the
+// Linux powercap RAPL counters, where the platform exposes them.
+package power
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const raplDir = "/sys/class/powercap"
+
+// ErrUnavailable is returned where no package energy counters can be read,
+// e.g. on other OSes, in VMs or without permission.
+var ErrUnavailable = errors.New("package energy counters unavailable")
+
+// Reading is a snapshot of the energy counters of all CPU packages.
+type Reading struct {
+	domains []domain
+}
+
+type domain struct {
+	path     string
+	energyUJ uint64
+	rangeUJ  uint64
+}
+
+// Read snapshots the energy counter of every package level RAPL domain.
+func Read() (Reading, error) {
+	// package domains are intel-rapl:N, their subdomains intel-rapl:N:M
+	paths, _ := filepath.Glob(filepath.Join(raplDir, "intel-rapl:*"))
+	var r Reading
+	for _, path := range paths {
+		if strings.Count(filepath.Base(path), ":") != 1 {
+			continue
+		}
+		energy, err := readUint(filepath.Join(path, "energy_uj"))
+		if err != nil {
+			continue
+		}
+		rng, _ := readUint(filepath.Join(path, "max_energy_range_uj"))
+		r.domains = append(r.domains, domain{path, energy, rng})
+	}
+	if len(r.domains) == 0 {
+		return Reading{}, ErrUnavailable
+	}
+	return r, nil
+}
+
+// Joules returns the energy used by all packages since r was read, taking a
+// single wraparound of each counter into account.
+func (r Reading) Joules() (float64, error) {
+	var total uint64
+	for _, d := range r.domains {
+		energy, err := readUint(filepath.Join(d.path, "energy_uj"))
+		if err != nil {
+			return 0, err
+		}
+		if energy < d.energyUJ {
+			energy += d.rangeUJ
+		}
+		total += energy - d.energyUJ
+	}
+	return float64(total) / 1e6, nil
+}
+
+func readUint(path string) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
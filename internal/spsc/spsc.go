@@ -0,0 +1,104 @@
+// Package spsc provides a bounded lock-free queue for one producer and one
+// consumer goroutine, which hand over a value with an atomic store and load
+// instead of the lock and the parking of a channel.
+//
+// The indices of the producer and the consumer sit on cache lines of their
+// own, each with its copy of the other's index, so that a push or a pop only
+// touches the other side's line when the ring looks full or empty.
+package spsc
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/djheidihoe/1brc/internal/cpu"
+)
+
+// Ring is a bounded queue of values of type T for a single producer, which
+// calls TryPush and Close, and a single consumer, which calls TryPop.
+type Ring[T any] struct {
+	buf  []T
+	mask uint64
+	_    cpu.CacheLinePad
+	producer
+	_ [cpu.CacheLineSize - unsafe.Sizeof(producer{})%cpu.CacheLineSize]byte
+	consumer
+	_ [cpu.CacheLineSize - unsafe.Sizeof(consumer{})%cpu.CacheLineSize]byte
+}
+
+// producer is the producer's line, which the consumer reads when the ring
+// looks empty.
+type producer struct {
+	tail       atomic.Uint64 // the next slot to write
+	cachedHead uint64        // head when last loaded
+	full       uint64
+	closed     atomic.Bool
+}
+
+// consumer is the consumer's line, which the producer reads when the ring
+// looks full.
+type consumer struct {
+	head       atomic.Uint64 // the next slot to read
+	cachedTail uint64        // tail when last loaded
+	empty      uint64
+}
+
+// New returns a Ring of at least size values, rounded up to a power of two.
+func New[T any](size int) *Ring[T] {
+	n := uint64(1) << bits.Len(uint(max(size, 1)-1))
+	return &Ring[T]{buf: make([]T, n), mask: n - 1}
+}
+
+// Cap returns the number of values r holds.
+func (r *Ring[T]) Cap() int {
+	return len(r.buf)
+}
+
+// TryPush adds v unless r is full, which the producer then counts.
+func (r *Ring[T]) TryPush(v T) bool {
+	tail := r.tail.Load()
+	if tail-r.cachedHead == uint64(len(r.buf)) {
+		r.cachedHead = r.head.Load()
+		if tail-r.cachedHead == uint64(len(r.buf)) {
+			r.full++
+			return false
+		}
+	}
+	r.buf[tail&r.mask] = v
+	r.tail.Store(tail + 1)
+	return true
+}
+
+// Close marks the end of the values, after the last TryPush.
+func (r *Ring[T]) Close() {
+	r.closed.Store(true)
+}
+
+// TryPop removes the oldest value. If there is none, ok is false, the
+// consumer counts it and done reports that r is closed as well.
+func (r *Ring[T]) TryPop() (v T, ok, done bool) {
+	head := r.head.Load()
+	if head == r.cachedTail {
+		// closed is loaded first, so that a tail loaded after it holds
+		// every value pushed before Close
+		closed := r.closed.Load()
+		r.cachedTail = r.tail.Load()
+		if head == r.cachedTail {
+			r.empty++
+			return v, false, closed
+		}
+	}
+	i := head & r.mask
+	v = r.buf[i]
+	var zero T
+	r.buf[i] = zero
+	r.head.Store(head + 1)
+	return v, true, false
+}
+
+// Stats returns how often the producer found r full and the consumer found
+// it empty. It must only be called once both are done.
+func (r *Ring[T]) Stats() (full, empty uint64) {
+	return r.full, r.empty
+}
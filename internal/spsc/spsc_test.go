@@ -0,0 +1,56 @@
+package spsc
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/djheidihoe/1brc/internal/cpu"
+)
+
+func TestRing(t *testing.T) {
+	r := New[int](3)
+	if r.Cap() != 4 {
+		t.Errorf("Cap = %d, want 4", r.Cap())
+	}
+	const n = 100000
+	go func() {
+		for i := range n {
+			for !r.TryPush(i) {
+				runtime.Gosched()
+			}
+		}
+		r.Close()
+	}()
+	next := 0
+	for {
+		v, ok, done := r.TryPop()
+		if done {
+			break
+		}
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		if v != next {
+			t.Fatalf("popped %d, want %d", v, next)
+		}
+		next++
+	}
+	if next != n {
+		t.Errorf("popped %d values, want %d", next, n)
+	}
+	if _, ok, done := r.TryPop(); ok || !done {
+		t.Error("Expected a closed and empty ring")
+	}
+	full, empty := r.Stats()
+	t.Logf("%d full, %d empty", full, empty)
+}
+
+func TestLayout(t *testing.T) {
+	var r Ring[int]
+	producer, consumer := unsafe.Offsetof(r.producer), unsafe.Offsetof(r.consumer)
+	if consumer-producer < cpu.CacheLineSize || producer < cpu.CacheLineSize || unsafe.Sizeof(r)-consumer < cpu.CacheLineSize {
+		t.Errorf("indices at %d and %d of %d bytes share cache lines", producer, consumer, unsafe.Sizeof(r))
+	}
+}
@@ -0,0 +1,260 @@
+// Package swiss provides a SwissTable-style hash table keyed by byte slices,
+// for aggregation loops that look up one key per input line and rarely
+// insert. Lookups do not convert the key to a string, and a probe compares
+// the 7-bit hash tags of a whole group of 16 slots at once, so most misses
+// and hits touch a single control word before the matching key.
+//
+// Go has no portable SIMD, so the 16 control bytes are matched as two 64-bit
+// words with the usual bit tricks, which is what the SSE2 version of the
+// original does in one instruction.
+//
+// Keys are hashed a word at a time with a seeded multiply, which costs a few
+// nanoseconds less than hash/maphash for station names but is not meant to
+// withstand inputs crafted to collide. Keys of up to 16 bytes, most station
+// names, are also compared as two words.
+package swiss
+
+import (
+	"encoding/binary"
+	"iter"
+	"math/bits"
+	"math/rand/v2"
+)
+
+const (
+	groupSize = 16
+	// empty marks a free slot. Used slots hold the low 7 bits of their
+	// hash, so the high bit distinguishes the two. There are no deletions
+	// and therefore no tombstones.
+	empty = 0x80
+
+	lsb = 0x0101010101010101
+	msb = 0x8080808080808080
+)
+
+// Table maps byte keys to values of type V. The zero value is not usable,
+// create tables with New. A Table must not be used concurrently.
+type Table[V any] struct {
+	seed   uint64
+	groups []group[V]
+	mask   uint64 // len(groups) - 1
+	n      int
+	grow   int // n at which the table doubles
+}
+
+// group holds groupSize slots and their control bytes, byte i of ctrl in
+// little endian order being that of slot i.
+type group[V any] struct {
+	ctrl  [2]uint64
+	slots [groupSize]slot[V]
+}
+
+// slot holds a key, and its Words if it is short.
+type slot[V any] struct {
+	w0, w1 uint64
+	key    string
+	value  V
+}
+
+// New returns a table sized for hint keys without growing.
+func New[V any](hint int) *Table[V] {
+	t := &Table[V]{seed: rand.Uint64()}
+	groups := 1
+	for groups*groupSize*7/8 < hint {
+		groups *= 2
+	}
+	t.init(groups)
+	return t
+}
+
+func (t *Table[V]) init(groups int) {
+	t.groups = make([]group[V], groups)
+	for i := range t.groups {
+		t.groups[i].ctrl = [2]uint64{lsb * empty, lsb * empty}
+	}
+	t.mask = uint64(groups - 1)
+	t.grow = groups * groupSize * 7 / 8
+}
+
+// Len returns the number of keys.
+func (t *Table[V]) Len() int {
+	return t.n
+}
+
+// Get returns a pointer to the value of key, nil if key is not present.
+// The pointer is valid until the next insertion.
+func (t *Table[V]) Get(key []byte) *V {
+	w0, w1 := Words(key)
+	v, _ := t.find(key, w0, w1, t.hash(key, w0, w1), false)
+	return v
+}
+
+// Upsert returns a pointer to the value of key, inserting the zero value if
+// key is not present, and reports whether it was. The pointer is valid until
+// the next insertion.
+func (t *Table[V]) Upsert(key []byte) (v *V, found bool) {
+	w0, w1 := Words(key)
+	return t.find(key, w0, w1, t.hash(key, w0, w1), true)
+}
+
+// UpsertWords is Upsert for a key of at most ShortKey bytes whose Words the
+// caller loaded already, e.g. straight from its input. Short keys are hashed
+// and compared by their words, without reading the key bytes again.
+func (t *Table[V]) UpsertWords(key []byte, w0, w1 uint64) (v *V, found bool) {
+	return t.find(key, w0, w1, hashWords(w0, w1, len(key), t.seed), true)
+}
+
+// Hash returns the hash of key in t, which stays valid as t grows.
+func (t *Table[V]) Hash(key []byte) uint64 {
+	w0, w1 := Words(key)
+	return t.hash(key, w0, w1)
+}
+
+// UpsertHash is Upsert with the Hash of key computed ahead.
+func (t *Table[V]) UpsertHash(key []byte, h uint64) (v *V, found bool) {
+	w0, w1 := Words(key)
+	return t.find(key, w0, w1, h, true)
+}
+
+// Touch loads the first control word of the group a lookup of hash h starts
+// at, so that the lookup, issued a few keys later, finds it in the cache. Go
+// has no prefetch instruction; fold the result into a value that is used, so
+// the load is not optimized away.
+func (t *Table[V]) Touch(h uint64) uint64 {
+	return t.groups[(h>>7)&t.mask].ctrl[0]
+}
+
+// find looks up key, whose Words are w0 and w1 if it is short, by its hash h.
+func (t *Table[V]) find(key []byte, w0, w1, h uint64, insert bool) (*V, bool) {
+	tag := uint64(h & 0x7f)
+	i := (h >> 7) & t.mask
+	for step := uint64(1); ; step++ {
+		g := &t.groups[i]
+		lo, hi := g.ctrl[0], g.ctrl[1]
+		for m := match(lo, tag); m != 0; m &= m - 1 {
+			if s := &g.slots[bits.TrailingZeros64(m)/8]; s.is(key, w0, w1) {
+				return &s.value, true
+			}
+		}
+		for m := match(hi, tag); m != 0; m &= m - 1 {
+			if s := &g.slots[8+bits.TrailingZeros64(m)/8]; s.is(key, w0, w1) {
+				return &s.value, true
+			}
+		}
+		if (lo|hi)&msb != 0 {
+			if !insert {
+				return nil, false
+			}
+			if t.n >= t.grow {
+				t.resize()
+				return t.find(key, w0, w1, h, true)
+			}
+			s := g.claim(tag)
+			s.key, s.w0, s.w1 = string(key), w0, w1
+			t.n++
+			return &s.value, false
+		}
+		// triangular probing visits every group of a power of two table
+		i = (i + step) & t.mask
+	}
+}
+
+// is reports whether s holds key, whose Words are w0 and w1 if it is short.
+func (s *slot[V]) is(key []byte, w0, w1 uint64) bool {
+	if len(key) <= ShortKey {
+		return s.w0 == w0 && s.w1 == w1 && len(s.key) == len(key)
+	}
+	return s.key == string(key)
+}
+
+// ShortKey is the length up to which keys are compared as two words.
+const ShortKey = 16
+
+// Words returns the first ShortKey bytes of key as two little endian words,
+// zero padded.
+func Words(key []byte) (w0, w1 uint64) {
+	var buf [ShortKey]byte
+	copy(buf[:], key)
+	return binary.LittleEndian.Uint64(buf[:]), binary.LittleEndian.Uint64(buf[8:])
+}
+
+const mul = 0x9e3779b97f4a7c15
+
+// hash mixes the words of key, which are w0 and w1 if it is short.
+func (t *Table[V]) hash(key []byte, w0, w1 uint64) uint64 {
+	if len(key) <= ShortKey {
+		return hashWords(w0, w1, len(key), t.seed)
+	}
+	h := t.seed
+	n := len(key)
+	for ; len(key) > ShortKey; key = key[8:] {
+		h = bits.RotateLeft64((h^binary.LittleEndian.Uint64(key))*mul, 29)
+	}
+	w0, w1 = Words(key)
+	return hashWords(w0, w1, n, h)
+}
+
+// hashWords mixes the last two words of a key of n bytes into seed.
+func hashWords(w0, w1 uint64, n int, seed uint64) uint64 {
+	h := bits.RotateLeft64((seed^uint64(n)*mul^w0)*mul, 29)
+	h = (h ^ w1) * mul
+	return h ^ h>>32
+}
+
+// claim tags the first empty slot of g, which must have one, and returns it.
+func (g *group[V]) claim(tag uint64) *slot[V] {
+	half := 0
+	if g.ctrl[0]&msb == 0 {
+		half = 1
+	}
+	shift := bits.TrailingZeros64(g.ctrl[half]&msb) &^ 7
+	g.ctrl[half] = g.ctrl[half]&^(0xff<<shift) | tag<<shift
+	return &g.slots[half*8+shift/8]
+}
+
+// match returns the high bit of each byte of w equal to tag. Bytes above a
+// match may be reported falsely, which costs a key comparison but no wrong
+// result.
+func match(w, tag uint64) uint64 {
+	x := w ^ (lsb * tag)
+	return (x - lsb) &^ x & msb
+}
+
+// resize doubles the number of groups and reinserts every key.
+func (t *Table[V]) resize() {
+	old := t.groups
+	t.init(2 * len(old))
+	for gi := range old {
+		g := &old[gi]
+		for j := range g.slots {
+			if byte(g.ctrl[j/8]>>(j%8*8)) == empty {
+				continue
+			}
+			key := []byte(g.slots[j].key)
+			h := t.hash(key, g.slots[j].w0, g.slots[j].w1)
+			i := (h >> 7) & t.mask
+			for step := uint64(1); ; step++ {
+				if ng := &t.groups[i]; (ng.ctrl[0]|ng.ctrl[1])&msb != 0 {
+					*ng.claim(h & 0x7f) = g.slots[j]
+					break
+				}
+				i = (i + step) & t.mask
+			}
+		}
+	}
+}
+
+// All yields the keys and pointers to their values in unspecified order.
+// The table must not be modified during iteration.
+func (t *Table[V]) All() iter.Seq2[string, *V] {
+	return func(yield func(string, *V) bool) {
+		for gi := range t.groups {
+			g := &t.groups[gi]
+			for j := range g.slots {
+				if byte(g.ctrl[j/8]>>(j%8*8)) != empty && !yield(g.slots[j].key, &g.slots[j].value) {
+					return
+				}
+			}
+		}
+	}
+}
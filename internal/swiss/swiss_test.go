@@ -0,0 +1,96 @@
+package swiss
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	tab := New[int](0)
+	expected := map[string]int{}
+	// enough keys for several resizes, each added a few times
+	for i := range 10000 {
+		key := fmt.Sprintf("station %d", i%3000)
+		v, found := tab.Upsert([]byte(key))
+		if _, ok := expected[key]; ok != found {
+			t.Fatalf("Upsert(%q) found %v, expected %v", key, found, ok)
+		}
+		*v += i
+		expected[key] += i
+	}
+	if tab.Len() != len(expected) {
+		t.Errorf("Wrong length %d, expected %d", tab.Len(), len(expected))
+	}
+	for key, sum := range expected {
+		if v := tab.Get([]byte(key)); v == nil || *v != sum {
+			t.Errorf("Get(%q) = %v, expected %d", key, v, sum)
+		}
+	}
+	if v := tab.Get([]byte("missing")); v != nil {
+		t.Errorf("Get of a missing key returned %d", *v)
+	}
+
+	seen := 0
+	for key, v := range tab.All() {
+		if *v != expected[key] {
+			t.Errorf("All yielded %q=%d, expected %d", key, *v, expected[key])
+		}
+		seen++
+	}
+	if seen != len(expected) {
+		t.Errorf("All yielded %d keys, expected %d", seen, len(expected))
+	}
+
+	// hashes computed ahead survive growth
+	h := tab.Hash([]byte("late"))
+	for i := range 5000 {
+		tab.Upsert(fmt.Appendf(nil, "more %d", i))
+	}
+	tab.Touch(h)
+	if v, found := tab.UpsertHash([]byte("late"), h); found || v == nil {
+		t.Errorf("UpsertHash of a new key found %v", found)
+	}
+	if v := tab.Get([]byte("late")); v == nil {
+		t.Error("key inserted by UpsertHash is missing")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	w := uint64(0x80_12_34_12_80_00_7f_12)
+	if m := match(w, 0x12); m != 0x00_80_00_80_00_00_00_80 {
+		t.Errorf("Wrong matches %#x", m)
+	}
+	if m := match(w, 0x55); m != 0 {
+		t.Errorf("Matched absent tag: %#x", m)
+	}
+	// empty slots never match
+	if m := match(lsb*empty, 0); m != 0 {
+		t.Errorf("Matched empty slots: %#x", m)
+	}
+}
+
+func BenchmarkUpsert(b *testing.B) {
+	keys := make([][]byte, 413)
+	for i := range keys {
+		keys[i] = fmt.Appendf(nil, "station %d", i)
+	}
+	b.Run("swiss", func(b *testing.B) {
+		tab := New[int64](len(keys))
+		for i := range b.N {
+			v, _ := tab.Upsert(keys[i%len(keys)])
+			*v++
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		m := make(map[string]*int64, len(keys))
+		for i := range b.N {
+			key := keys[i%len(keys)]
+			v, ok := m[string(key)]
+			if !ok {
+				v = new(int64)
+				m[string(key)] = v
+			}
+			*v++
+		}
+	})
+}
@@ -0,0 +1,139 @@
+// Package tdigest implements the merging t-digest of Dunning and Ertl, a
+// compact sketch of a distribution that answers quantile queries with small
+// relative error at the tails. Digests of parts of a data set merge into the
+// digest of the whole, so each worker can keep its own.
+package tdigest
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultCompression bounds a digest to about 100 centroids.
+const DefaultCompression = 100
+
+type centroid struct {
+	mean, weight float64
+}
+
+// Digest is a t-digest. The zero value is not usable, see New.
+type Digest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid // unmerged points
+	count       float64
+	min, max    float64
+}
+
+// New returns an empty digest, compression trades size for accuracy.
+func New(compression float64) *Digest {
+	return &Digest{compression: compression, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// Count returns the total weight added.
+func (d *Digest) Count() float64 {
+	return d.count
+}
+
+// Add records a value of weight 1.
+func (d *Digest) Add(x float64) {
+	d.add(centroid{x, 1})
+}
+
+func (d *Digest) add(c centroid) {
+	d.buffer = append(d.buffer, c)
+	d.count += c.weight
+	d.min = math.Min(d.min, c.mean)
+	d.max = math.Max(d.max, c.mean)
+	if len(d.buffer) >= 4*int(d.compression) {
+		d.compress()
+	}
+}
+
+// Merge adds the values of o to d.
+func (d *Digest) Merge(o *Digest) {
+	for _, c := range o.centroids {
+		d.add(c)
+	}
+	for _, c := range o.buffer {
+		d.add(c)
+	}
+	// centroids keep their means, the extremes are those of the values
+	d.min = math.Min(d.min, o.min)
+	d.max = math.Max(d.max, o.max)
+}
+
+// Clone returns a copy of d.
+func (d *Digest) Clone() *Digest {
+	c := *d
+	c.centroids = append([]centroid(nil), d.centroids...)
+	c.buffer = append([]centroid(nil), d.buffer...)
+	return &c
+}
+
+// k is the k1 scale function, centroids may span at most one unit of it.
+func (d *Digest) k(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*math.Min(math.Max(q, 0), 1)-1)
+}
+
+// compress merges the buffer into the centroids.
+func (d *Digest) compress() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := append(d.centroids, d.buffer...)
+	d.buffer = d.buffer[:0]
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	out := all[:1]
+	var before float64 // weight left of the current centroid
+	for _, c := range all[1:] {
+		cur := &out[len(out)-1]
+		w := cur.weight + c.weight
+		if d.k((before+w)/d.count)-d.k(before/d.count) <= 1 {
+			cur.mean += (c.mean - cur.mean) * c.weight / w
+			cur.weight = w
+		} else {
+			before += cur.weight
+			out = append(out, c)
+		}
+	}
+	d.centroids = out
+}
+
+// Quantile returns the estimated value at quantile q in [0, 1], NaN for an
+// empty digest.
+func (d *Digest) Quantile(q float64) float64 {
+	d.compress()
+	c := d.centroids
+	switch {
+	case len(c) == 0:
+		return math.NaN()
+	case len(c) == 1 || q <= 0:
+		if q <= 0 {
+			return d.min
+		}
+		return c[0].mean
+	case q >= 1:
+		return d.max
+	}
+
+	// each centroid's mean sits at the middle of its weight, interpolate
+	// between neighbouring middles and towards min and max at the ends
+	target := q * d.count
+	if first := c[0].weight / 2; target < first {
+		return d.min + (c[0].mean-d.min)*target/first
+	}
+	var cum float64
+	for i := 0; i < len(c)-1; i++ {
+		left := cum + c[i].weight/2
+		right := cum + c[i].weight + c[i+1].weight/2
+		if target <= right {
+			return c[i].mean + (c[i+1].mean-c[i].mean)*(target-left)/(right-left)
+		}
+		cum += c[i].weight
+	}
+	last := c[len(c)-1]
+	left := d.count - last.weight/2
+	return last.mean + (d.max-last.mean)*(target-left)/(last.weight/2)
+}
@@ -0,0 +1,56 @@
+package tdigest
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestQuantile(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := make([]float64, 100000)
+	for i := range values {
+		values[i] = rng.NormFloat64()*100 + 50
+	}
+
+	// one digest per part, as the workers keep them
+	whole := New(DefaultCompression)
+	for part := 0; part < 4; part++ {
+		d := New(DefaultCompression)
+		for _, v := range values[part*len(values)/4 : (part+1)*len(values)/4] {
+			d.Add(v)
+		}
+		whole.Merge(d)
+	}
+	sort.Float64s(values)
+
+	if whole.Count() != float64(len(values)) {
+		t.Errorf("Wrong count %v", whole.Count())
+	}
+	for _, q := range []float64{0, 0.01, 0.1, 0.5, 0.9, 0.99, 0.999, 1} {
+		exact := values[min(int(q*float64(len(values))), len(values)-1)]
+		// the error is bounded in rank, which is about 1 for 0.1% of 100000
+		if got := whole.Quantile(q); math.Abs(got-exact) > 2 {
+			t.Errorf("Wrong quantile %v: expected about %.2f, got %.2f", q, exact, got)
+		}
+	}
+	if len(whole.centroids) > 2*DefaultCompression {
+		t.Errorf("Too many centroids: %d", len(whole.centroids))
+	}
+}
+
+func TestQuantileSmall(t *testing.T) {
+	if q := New(DefaultCompression).Quantile(0.5); !math.IsNaN(q) {
+		t.Errorf("Wrong quantile of an empty digest: %v", q)
+	}
+	d := New(DefaultCompression)
+	for _, v := range []float64{1, 2, 3, 4, 5} {
+		d.Add(v)
+	}
+	for _, tc := range []struct{ q, expected float64 }{{0, 1}, {0.5, 3}, {1, 5}} {
+		if got := d.Quantile(tc.q); got != tc.expected {
+			t.Errorf("Wrong quantile %v: expected %v, got %v", tc.q, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+//go:build ignore
+
+// gen writes the fixtures and their expected results, computed by
+// testdata.Reference. Run it with go generate.
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/djheidihoe/1brc/internal/testdata"
+)
+
+func main() {
+	rng := rand.New(rand.NewPCG(1, 1))
+	fixtures := map[string]string{
+		"small":                random(rng, names(rng, 40), 1000),
+		"medium":               random(rng, names(rng, 413), 20000),
+		"empty":                "",
+		"no-trailing-newline":  "b;1.0\na;-2.5\nb;3.3",
+		"one-station":          random(rng, []string{"Oslo"}, 500),
+		"extremes":             "max;99.9\nmax;99.9\nmin;-99.9\nmin;-99.9\nzero;0.0\nzero;-0.0\nmixed;-99.9\nmixed;99.9\n",
+		"rounding-ties":        "a;0.0\na;-0.1\nb;0.1\nb;0.0\nc;-1.2\nc;-1.3\nd;1.2\nd;1.3\ne;-0.2\ne;0.1\n",
+		"long-names":           random(rng, longNames(), 300),
+		"shared-prefixes":      random(rng, prefixNames(), 400),
+		"single-digit-integer": "a;1.0\na;-1.0\nb;9.9\nb;-9.9\nc;10.0\nc;-10.0\n",
+	}
+	dir := "fixtures"
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	for name, input := range fixtures {
+		if err := os.WriteFile(filepath.Join(dir, name+".txt"), []byte(input), 0o644); err != nil {
+			log.Fatal(err)
+		}
+		expected, err := testdata.Reference([]byte(input))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".out"), []byte(expected), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// names returns n distinct station names, some of them in other scripts.
+func names(rng *rand.Rand, n int) []string {
+	syllables := []string{"ka", "ri", "bo", "ne", "tu", "sa", "lo", "mi", "é", "ø", "ü", "ñ", "ве", "ка", "東", "京", "ال", "ق"}
+	seen := map[string]bool{}
+	var out []string
+	for len(out) < n {
+		var b strings.Builder
+		for range 2 + rng.IntN(5) {
+			b.WriteString(syllables[rng.IntN(len(syllables))])
+		}
+		if name := b.String(); !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// longNames returns names up to the 100 byte limit, multi-byte runes
+// included.
+func longNames() []string {
+	return []string{
+		strings.Repeat("x", 100),
+		strings.Repeat("x", 99) + "y",
+		strings.Repeat("é", 50),
+		strings.Repeat("東", 33),
+		strings.Repeat("ab", 32) + strings.Repeat("c", 36),
+		"short",
+	}
+}
+
+// prefixNames returns names sharing prefixes of the word sizes the fast
+// paths compare at once.
+func prefixNames() []string {
+	var out []string
+	for _, n := range []int{1, 7, 8, 9, 15, 16, 17, 31, 32, 33} {
+		out = append(out, strings.Repeat("p", n), strings.Repeat("p", n)+"q")
+	}
+	return out
+}
+
+// random returns n lines of readings for stations drawn from names.
+func random(rng *rand.Rand, names []string, n int) string {
+	var b strings.Builder
+	for range n {
+		tenths := rng.IntN(1999) - 999
+		sign := ""
+		if tenths < 0 {
+			sign = "-"
+		}
+		abs := max(tenths, -tenths)
+		fmt.Fprintf(&b, "%s;%s%d.%d\n", names[rng.IntN(len(names))], sign, abs/10, abs%10)
+	}
+	return b.String()
+}
@@ -0,0 +1,223 @@
+package testdata
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// blockLines is the number of lines drawn from one random stream.
+const blockLines = 1 << 16
+
+// Generator writes random inputs of a shape too large to hold in memory,
+// e.g. the billion lines of the challenge. Line i depends only on the seed,
+// the shape and i, so the files of consecutive ranges of lines concatenate
+// to the file of them all, and a file grows by the lines that follow.
+type Generator struct {
+	seed  uint64
+	shape Shape
+	names []string
+	// means are in tenths of a degree
+	means []float64
+}
+
+// NewGenerator returns a Generator of the stations and distribution of s
+// from seed, s being valid, see Shape.Validate. s.Lines and
+// s.NoFinalNewline are left to the caller.
+func NewGenerator(seed uint64, s Shape) *Generator {
+	g := &Generator{seed: seed, shape: s}
+	g.names, g.means = stations(rand.New(rand.NewPCG(seed, 0)), s)
+	return g
+}
+
+// NewStationsGenerator returns a Generator of s.Stations stations drawn from
+// seed out of stations, or of all of them if there are no more, with the
+// distribution of s. The names and means of stations replace those drawn by
+// NewGenerator, so s.MaxName and s.Names do not apply.
+func NewStationsGenerator(seed uint64, s Shape, stations []Station) *Generator {
+	g := &Generator{seed: seed, shape: s}
+	if s.Stations < len(stations) {
+		rng := rand.New(rand.NewPCG(seed, 0))
+		stations = slices.Clone(stations)
+		rng.Shuffle(len(stations), func(i, j int) { stations[i], stations[j] = stations[j], stations[i] })
+		stations = stations[:s.Stations]
+	}
+	for _, st := range stations {
+		g.names = append(g.names, st.Name)
+		g.means = append(g.means, st.Mean*10)
+	}
+	return g
+}
+
+// Injected counts the malformed lines of Shape.Errors by kind.
+type Injected struct {
+	// MissingSemicolon lines have the name run into the reading.
+	MissingSemicolon int64 `json:"missing_semicolon"`
+	// EmptyValue lines have no reading after the semicolon.
+	EmptyValue int64 `json:"empty_value"`
+	// Garbage lines are random bytes without a semicolon.
+	Garbage int64 `json:"garbage"`
+	// Overlong lines have a reading of thousands of digits.
+	Overlong int64 `json:"overlong"`
+}
+
+// Total returns the number of malformed lines.
+func (in Injected) Total() int64 {
+	return in.MissingSemicolon + in.EmptyValue + in.Garbage + in.Overlong
+}
+
+// Add adds the counts of o to in.
+func (in *Injected) Add(o Injected) {
+	in.MissingSemicolon += o.MissingSemicolon
+	in.EmptyValue += o.EmptyValue
+	in.Garbage += o.Garbage
+	in.Overlong += o.Overlong
+}
+
+// WriteLines writes lines from up to to, excluded, to w, and returns the
+// malformed ones among them.
+func (g *Generator) WriteLines(w io.Writer, from, to int64) (Injected, error) {
+	var injected Injected
+	bw := bufio.NewWriterSize(w, 1<<20)
+	var line []byte
+	for block := from / blockLines; block*blockLines < to; block++ {
+		// the lines of a block before from are drawn to skip them
+		rng := rand.New(rand.NewPCG(g.seed, uint64(block)+1))
+		pick := g.picker(rng)
+		for i := block * blockLines; i < min((block+1)*blockLines, to); i++ {
+			count := &injected
+			if i < from {
+				count = &Injected{}
+			}
+			if g.shape.Errors > 0 && rng.Float64() < g.shape.Errors {
+				line = g.appendMalformed(line[:0], rng, pick, count)
+			} else {
+				line = g.appendLine(line[:0], rng, pick)
+			}
+			if i >= from {
+				if _, err := bw.Write(line); err != nil {
+					return injected, err
+				}
+			}
+		}
+	}
+	return injected, bw.Flush()
+}
+
+// picker returns the draw of the index of the station of a line from rng,
+// Zipfian with Shape.Zipf.
+func (g *Generator) picker(rng *rand.Rand) func() int {
+	if g.shape.Zipf > 1 {
+		z := rand.NewZipf(rng, g.shape.Zipf, 1, uint64(len(g.names)-1))
+		return func() int { return int(z.Uint64()) }
+	}
+	return func() int { return rng.IntN(len(g.names)) }
+}
+
+// appendLine appends a line of the station pick draws and a reading from rng
+// to b.
+func (g *Generator) appendLine(b []byte, rng *rand.Rand, pick func() int) []byte {
+	i := pick()
+	var tenths int
+	switch g.shape.Distribution {
+	case Normal:
+		tenths = min(max(int(g.means[i])+int(rng.NormFloat64()*100), -999), 999)
+	case Java:
+		tenths = min(max(int(math.Floor(g.means[i]+rng.NormFloat64()*100+0.5)), -999), 999)
+	case Extremes:
+		tenths = []int{-999, -998, -1, 0, 1, 998, 999}[rng.IntN(7)]
+	default:
+		tenths = rng.IntN(1999) - 999
+	}
+	b = append(b, g.names[i]...)
+	b = append(b, ';')
+	if tenths < 0 {
+		b = append(b, '-')
+	}
+	abs := max(tenths, -tenths)
+	b = strconv.AppendInt(b, int64(abs/10), 10)
+	return append(b, '.', byte('0'+abs%10), '\n')
+}
+
+// appendMalformed appends a malformed line of a kind drawn from rng to b and
+// counts it in count. Every kind is malformed to the parsers of package brc,
+// whatever their options short of Config.CommentPrefix.
+func (g *Generator) appendMalformed(b []byte, rng *rand.Rand, pick func() int, count *Injected) []byte {
+	switch rng.IntN(4) {
+	case 0:
+		count.MissingSemicolon++
+		b = g.appendLine(b, rng, pick)
+		i := bytes.LastIndexByte(b, ';')
+		return append(b[:i], b[i+1:]...)
+	case 1:
+		count.EmptyValue++
+		b = append(b, g.names[pick()]...)
+		return append(b, ';', '\n')
+	case 2:
+		count.Garbage++
+		for range 1 + rng.IntN(64) {
+			c := byte(rng.IntN(256))
+			if c == ';' || c == '\n' {
+				c = 0
+			}
+			b = append(b, c)
+		}
+		return append(b, '\n')
+	default:
+		count.Overlong++
+		b = append(b, g.names[pick()]...)
+		b = append(b, ';')
+		for range 1024 + rng.IntN(3072) {
+			b = append(b, byte('0'+rng.IntN(10)))
+		}
+		return append(b, '\n')
+	}
+}
+
+// Station is a station of generated inputs and the mean of its readings in
+// degrees.
+type Station struct {
+	Name string
+	Mean float64
+}
+
+// ReadWeatherStations reads stations from name;mean lines, as in the
+// data/weather_stations.csv of the official generator, skipping # comments.
+// A repeated name keeps its first mean.
+func ReadWeatherStations(r io.Reader) ([]Station, error) {
+	var stations []Station
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Bytes()
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		name, mean, ok := bytes.Cut(line, []byte{';'})
+		if !ok || len(name) == 0 || len(name) > 100 || !utf8.Valid(name) {
+			return nil, fmt.Errorf("line %d: want a name of 1 to 100 bytes of UTF-8 and a mean, got %q", n, line)
+		}
+		m, err := strconv.ParseFloat(string(mean), 64)
+		if err != nil || m < -99.9 || m > 99.9 {
+			return nil, fmt.Errorf("line %d: invalid mean %q", n, mean)
+		}
+		if !seen[string(name)] {
+			seen[string(name)] = true
+			stations = append(stations, Station{string(name), m})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(stations) == 0 {
+		return nil, errors.New("no stations")
+	}
+	return stations, nil
+}
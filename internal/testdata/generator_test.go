@@ -0,0 +1,54 @@
+package testdata
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteLines(t *testing.T) {
+	const lines = 3*blockLines/2 + 7
+	for _, s := range []Shape{
+		{Stations: 50, MaxName: 16, Distribution: Normal},
+		{Stations: 50, MaxName: 16, Distribution: Java, Zipf: 1.2, Errors: 0.01},
+	} {
+		g := NewGenerator(1, s)
+		var whole bytes.Buffer
+		all, err := g.WriteLines(&whole, 0, lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := bytes.Count(whole.Bytes(), []byte{'\n'}); n != lines {
+			t.Fatalf("%v: %d lines, want %d", s, n, lines)
+		}
+		if s.Errors == 0 && all.Total() != 0 || s.Errors > 0 && all.Total() == 0 {
+			t.Errorf("%v: %+v malformed lines", s, all)
+		}
+
+		// pieces split anywhere, at the blocks of the random streams too,
+		// are the lines of the whole, as shards and appended lines are
+		var pieces bytes.Buffer
+		var injected Injected
+		bounds := []int64{0, 1, blockLines - 1, blockLines, blockLines + 1, lines - 1, lines}
+		for i := range bounds[1:] {
+			in, err := NewGenerator(1, s).WriteLines(&pieces, bounds[i], bounds[i+1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			injected.Add(in)
+		}
+		if !bytes.Equal(pieces.Bytes(), whole.Bytes()) {
+			t.Errorf("%v: the pieces differ from the whole", s)
+		}
+		if injected != all {
+			t.Errorf("%v: the pieces have %+v malformed lines, the whole %+v", s, injected, all)
+		}
+
+		var other bytes.Buffer
+		if _, err := NewGenerator(2, s).WriteLines(&other, 0, lines); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(other.Bytes(), whole.Bytes()) {
+			t.Errorf("%v: seeds 1 and 2 generate the same lines", s)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package testdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// ParquetShape describes how Parquet encodes an input.
+type ParquetShape struct {
+	// RowGroup is the number of rows per row group, all of them if 0.
+	RowGroup int
+	// PageRows is the number of rows per data page, all rows of a row
+	// group if 0.
+	PageRows int
+	// Dictionary encodes the station column with a dictionary per row
+	// group.
+	Dictionary bool
+	// Optional makes both columns optional and adds a row with a null
+	// station and one with a null temperature before every 100 rows.
+	Optional bool
+	// V2 writes version 2 data pages.
+	V2 bool
+	// Float writes the temperatures as FLOAT instead of DOUBLE.
+	Float bool
+	// Codec compresses the pages: "" or "snappy", encoded with literals
+	// only, or "gzip".
+	Codec string
+}
+
+// Parquet encodes the name;reading lines of input as a Parquet file with a
+// station and a temperature column, for tests of Parquet readers. Lines
+// that do not split at a semicolon are left out.
+func Parquet(input []byte, s ParquetShape) []byte {
+	var names [][]byte
+	var temps []float64
+	var nulls []int // 0, or 1 for a null station and 2 for a null temperature
+	for line := range bytes.SplitSeq(input, []byte{'\n'}) {
+		name, reading, ok := bytes.Cut(line, []byte{';'})
+		if !ok {
+			continue
+		}
+		if s.Optional && len(names)%102 == 0 {
+			names, temps, nulls = append(names, nil, []byte("null temperature")), append(temps, 1, 0), append(nulls, 1, 2)
+		}
+		v, _ := strconv.ParseFloat(string(reading), 64)
+		names, temps, nulls = append(names, name), append(temps, v), append(nulls, 0)
+	}
+
+	pw := &parquetWriter{shape: s}
+	pw.b = append(pw.b, "PAR1"...)
+	rows := s.RowGroup
+	if rows <= 0 {
+		rows = len(names)
+	}
+	var groups compact
+	n := 0
+	for from := 0; from < len(names); from += rows {
+		to := min(from+rows, len(names))
+		n++
+		groups.beginStruct()
+		groups.list(1, thriftStruct, 2)
+		start := len(pw.b)
+		pw.column(&groups, "station", 6, from, to, nulls, 1, func(v *[]byte, i int) {
+			*v = binary.LittleEndian.AppendUint32(*v, uint32(len(names[i])))
+			*v = append(*v, names[i]...)
+		}, names)
+		pw.column(&groups, "temperature", pw.temperatureType(), from, to, nulls, 2, func(v *[]byte, i int) {
+			if s.Float {
+				*v = binary.LittleEndian.AppendUint32(*v, math.Float32bits(float32(temps[i])))
+			} else {
+				*v = binary.LittleEndian.AppendUint64(*v, math.Float64bits(temps[i]))
+			}
+		}, nil)
+		groups.i64(2, int64(len(pw.b)-start))
+		groups.i64(3, int64(to-from))
+		groups.end()
+	}
+
+	var meta compact
+	meta.beginStruct()
+	meta.i32(1, 1)
+	meta.list(2, thriftStruct, 3)
+	meta.beginStruct()
+	meta.binary(4, "schema")
+	meta.i32(5, 2)
+	meta.end()
+	repetition := int64(0)
+	if s.Optional {
+		repetition = 1
+	}
+	meta.beginStruct()
+	meta.i32(1, 6)
+	meta.i32(3, repetition)
+	meta.binary(4, "station")
+	meta.i32(6, 0) // UTF8
+	meta.end()
+	meta.beginStruct()
+	meta.i32(1, pw.temperatureType())
+	meta.i32(3, repetition)
+	meta.binary(4, "temperature")
+	meta.end()
+	meta.i64(3, int64(len(names)))
+	meta.list(4, thriftStruct, n)
+	meta.b = append(meta.b, groups.b...)
+	meta.end()
+
+	pw.b = append(pw.b, meta.b...)
+	pw.b = binary.LittleEndian.AppendUint32(pw.b, uint32(len(meta.b)))
+	return append(pw.b, "PAR1"...)
+}
+
+type parquetWriter struct {
+	shape ParquetShape
+	b     []byte
+}
+
+func (pw *parquetWriter) temperatureType() int64 {
+	if pw.shape.Float {
+		return 4
+	}
+	return 5
+}
+
+// column writes the pages of rows from up to to of a column of type typ,
+// using plain to append the PLAIN encoding of row i, and its ColumnChunk to
+// meta. Rows whose nulls are null are null. dict, if set with
+// ParquetShape.Dictionary, are the values to dictionary encode instead.
+func (pw *parquetWriter) column(meta *compact, name string, typ int64, from, to int, nulls []int, null int, plain func(*[]byte, int), dict [][]byte) {
+	start := len(pw.b)
+	dictOffset := -1
+	var indices map[string]int
+	var encodings []int64
+	if pw.shape.Dictionary && dict != nil {
+		indices = map[string]int{}
+		var values []byte
+		for i := from; i < to; i++ {
+			if _, ok := indices[string(dict[i])]; !ok && nulls[i] != null {
+				indices[string(dict[i])] = len(indices)
+				plain(&values, i)
+			}
+		}
+		dictOffset = len(pw.b)
+		compressed := pw.compress(values)
+		var h compact
+		h.beginStruct()
+		h.i32(1, 2)
+		h.i32(2, int64(len(values)))
+		h.i32(3, int64(len(compressed)))
+		h.structure(7)
+		h.i32(1, int64(len(indices)))
+		h.i32(2, 0)
+		h.end()
+		h.end()
+		pw.b = append(append(pw.b, h.b...), compressed...)
+		encodings = append(encodings, 0)
+	}
+	dataOffset := len(pw.b)
+	encoding := int64(0)
+	if indices != nil {
+		encoding = 2
+		if pw.shape.V2 {
+			encoding = 8
+		}
+	}
+	encodings = append(encodings, encoding, 3)
+	uncompressed := 0
+	pageRows := pw.shape.PageRows
+	if pageRows <= 0 {
+		pageRows = to - from
+	}
+	for p := from; p < to; p += pageRows {
+		end := min(p+pageRows, to)
+		var levels, values []byte
+		nullCount := 0
+		if pw.shape.Optional {
+			defs := make([]int, 0, end-p)
+			for i := p; i < end; i++ {
+				if nulls[i] == null {
+					defs = append(defs, 0)
+					nullCount++
+				} else {
+					defs = append(defs, 1)
+				}
+			}
+			levels = rleRuns(defs)
+		}
+		if indices != nil {
+			var idx []int
+			for i := p; i < end; i++ {
+				if nulls[i] != null {
+					idx = append(idx, indices[string(dict[i])])
+				}
+			}
+			width := 0
+			for 1<<width < len(indices) {
+				width++
+			}
+			values = append([]byte{byte(width)}, bitPacked(idx, width)...)
+		} else {
+			for i := p; i < end; i++ {
+				if nulls[i] != null {
+					plain(&values, i)
+				}
+			}
+		}
+		var h compact
+		h.beginStruct()
+		if pw.shape.V2 {
+			compressed := pw.compress(values)
+			h.i32(1, 3)
+			h.i32(2, int64(len(levels)+len(values)))
+			h.i32(3, int64(len(levels)+len(compressed)))
+			h.structure(8)
+			h.i32(1, int64(end-p))
+			h.i32(2, int64(nullCount))
+			h.i32(3, int64(end-p))
+			h.i32(4, encoding)
+			h.i32(5, int64(len(levels)))
+			h.i32(6, 0)
+			h.end()
+			h.end()
+			uncompressed += len(h.b) + len(levels) + len(values)
+			pw.b = append(append(append(pw.b, h.b...), levels...), compressed...)
+			continue
+		}
+		var page []byte
+		if pw.shape.Optional {
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+			page = append(page, levels...)
+		}
+		page = append(page, values...)
+		compressed := pw.compress(page)
+		h.i32(1, 0)
+		h.i32(2, int64(len(page)))
+		h.i32(3, int64(len(compressed)))
+		h.structure(5)
+		h.i32(1, int64(end-p))
+		h.i32(2, encoding)
+		h.i32(3, 3)
+		h.i32(4, 3)
+		h.end()
+		h.end()
+		uncompressed += len(h.b) + len(page)
+		pw.b = append(append(pw.b, h.b...), compressed...)
+	}
+
+	meta.beginStruct()
+	meta.i64(2, int64(start))
+	meta.structure(3)
+	meta.i32(1, typ)
+	meta.list(2, thriftI32, len(encodings))
+	for _, e := range encodings {
+		meta.b = binary.AppendUvarint(meta.b, zigzag(e))
+	}
+	meta.list(3, thriftBinary, 1)
+	meta.b = binary.AppendUvarint(meta.b, uint64(len(name)))
+	meta.b = append(meta.b, name...)
+	meta.i32(4, pw.codec())
+	meta.i64(5, int64(to-from))
+	meta.i64(6, int64(uncompressed))
+	meta.i64(7, int64(len(pw.b)-start))
+	meta.i64(9, int64(dataOffset))
+	if dictOffset >= 0 {
+		meta.i64(11, int64(dictOffset))
+	}
+	meta.end()
+	meta.end()
+}
+
+func (pw *parquetWriter) codec() int64 {
+	switch pw.shape.Codec {
+	case "snappy":
+		return 1
+	case "gzip":
+		return 2
+	}
+	return 0
+}
+
+func (pw *parquetWriter) compress(data []byte) []byte {
+	switch pw.shape.Codec {
+	case "snappy":
+		out := binary.AppendUvarint(nil, uint64(len(data)))
+		for len(data) > 0 {
+			n := min(len(data), 1<<16)
+			// a literal with a 2 byte length
+			out = append(out, 61<<2, byte(n-1), byte((n-1)>>8))
+			out = append(out, data[:n]...)
+			data = data[n:]
+		}
+		return out
+	case "gzip":
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		zw.Write(data)
+		zw.Close()
+		return b.Bytes()
+	}
+	return data
+}
+
+// rleRuns encodes levels of 0 and 1 as runs of the RLE/bit-packing hybrid.
+func rleRuns(levels []int) []byte {
+	var b []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		b = binary.AppendUvarint(b, uint64(j-i)<<1)
+		b = append(b, byte(levels[i]))
+		i = j
+	}
+	return b
+}
+
+// bitPacked encodes values of width bits as a bit-packed run of the
+// RLE/bit-packing hybrid.
+func bitPacked(values []int, width int) []byte {
+	groups := (len(values) + 7) / 8
+	b := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups*width)
+	for i, v := range values {
+		for j := range width {
+			if v>>j&1 != 0 {
+				bit := i*width + j
+				packed[bit/8] |= 1 << (bit % 8)
+			}
+		}
+	}
+	return append(b, packed...)
+}
+
+// The types of the Thrift compact protocol used by Parquet metadata.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// compact encodes structs in the Thrift compact protocol.
+type compact struct {
+	b   []byte
+	ids []int16 // the last field ids of the open structs
+}
+
+func (c *compact) beginStruct() {
+	c.ids = append(c.ids, 0)
+}
+
+// structure starts a struct in field id.
+func (c *compact) structure(id int16) {
+	c.field(id, thriftStruct)
+	c.beginStruct()
+}
+
+func (c *compact) end() {
+	c.b = append(c.b, 0)
+	c.ids = c.ids[:len(c.ids)-1]
+}
+
+func (c *compact) field(id int16, typ byte) {
+	last := &c.ids[len(c.ids)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		c.b = append(c.b, byte(d)<<4|typ)
+	} else {
+		c.b = append(c.b, typ)
+		c.b = binary.AppendUvarint(c.b, zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (c *compact) i32(id int16, v int64) {
+	c.field(id, thriftI32)
+	c.b = binary.AppendUvarint(c.b, zigzag(v))
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, thriftI64)
+	c.b = binary.AppendUvarint(c.b, zigzag(v))
+}
+
+func (c *compact) binary(id int16, s string) {
+	c.field(id, thriftBinary)
+	c.b = binary.AppendUvarint(c.b, uint64(len(s)))
+	c.b = append(c.b, s...)
+}
+
+// list starts a list of n elements of typ in field id, which follow.
+func (c *compact) list(id int16, typ byte, n int) {
+	c.field(id, thriftList)
+	if n < 15 {
+		c.b = append(c.b, byte(n)<<4|typ)
+	} else {
+		c.b = append(c.b, 0xf0|typ)
+		c.b = binary.AppendUvarint(c.b, uint64(n))
+	}
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1 ^ v>>63)
+}
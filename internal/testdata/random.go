@@ -0,0 +1,301 @@
+package testdata
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// Distribution is how the readings of random inputs are spread.
+type Distribution string
+
+const (
+	// Uniform spreads readings over the whole -99.9 to 99.9 range.
+	Uniform Distribution = "uniform"
+	// Normal clusters the readings of each station around a mean of its own.
+	Normal Distribution = "normal"
+	// Extremes draws only the bounds, zero and the values around them.
+	Extremes Distribution = "extremes"
+	// Java draws readings like the official Java generator, from a Gaussian
+	// of σ 10 degrees around the mean of each station, rounded half up.
+	Java Distribution = "java"
+)
+
+var distributions = []Distribution{Uniform, Normal, Extremes}
+
+// NameSet is how the station names of random inputs are drawn.
+type NameSet string
+
+const (
+	// RandomNames are of random runes and lengths up to Shape.MaxName.
+	RandomNames NameSet = "random"
+	// LongNames are all Shape.MaxName bytes long, of multi-byte runes
+	// padded with ASCII, to stress name comparisons and copies.
+	LongNames NameSet = "long"
+	// CollidingNames share the low 16 bits of their 32-bit FNV-1a hash, so
+	// they fall into the same bucket of tables of up to 65536 buckets
+	// indexed by the low bits of that hash, and all into one shard of the
+	// go_v1 variant.
+	CollidingNames NameSet = "fnv-collide"
+)
+
+// Shape describes a random input.
+type Shape struct {
+	Lines    int
+	Stations int
+	// MaxName is the longest name in bytes, at most 100.
+	MaxName      int
+	Distribution Distribution
+	// NoFinalNewline leaves out the newline of the last line.
+	NoFinalNewline bool
+	// Names selects the names of the stations, defaults to RandomNames.
+	Names NameSet
+	// Zipf, if above 1, is the exponent of Zipfian station frequencies,
+	// the first station being the most frequent, instead of uniform ones.
+	Zipf float64
+	// Errors is the fraction of lines a Generator replaces by malformed
+	// ones, see Injected.
+	Errors float64
+}
+
+// Validate reports whether the stations of s can be drawn: at least one and
+// no more than there are names of s.Names and up to s.MaxName bytes, which
+// is from 1 to 100. Generate and NewGenerator do not return for others.
+func (s Shape) Validate() error {
+	switch {
+	case s.Lines < 0 || s.Stations < 1:
+		return fmt.Errorf("invalid shape: %v", s)
+	case s.MaxName < 1 || s.MaxName > 100:
+		return fmt.Errorf("invalid name length %d, from 1 to 100 bytes", s.MaxName)
+	case int64(s.Stations) > s.names():
+		return fmt.Errorf("%d stations of %s names of up to %d bytes, of which there are about %d", s.Stations, cmp.Or(s.Names, RandomNames), s.MaxName, s.names())
+	}
+	return nil
+}
+
+// names returns a lower bound of the distinct names of s, as far as they
+// are of the runes of a byte. Of CollidingNames it counts half of the 1 in
+// 65536 expected, how many there are being up to the hash. The count is an
+// int64 to saturate the same on 32-bit platforms.
+func (s Shape) names() int64 {
+	const most = 1 << 40
+	// pow returns the number of strings of n of k bytes, upTo those of 1 to
+	// n, up to most
+	pow := func(k int64, n int) int64 {
+		p := int64(1)
+		for range n {
+			p = min(p*k, most)
+		}
+		return p
+	}
+	upTo := func(k int64, n int) int64 {
+		sum := int64(0)
+		for i := 1; i <= n; i++ {
+			sum = min(sum+pow(k, i), most)
+		}
+		return sum
+	}
+	switch s.Names {
+	case LongNames:
+		// those of padding only
+		return pow(int64(len(alphanumeric)), s.MaxName)
+	case CollidingNames:
+		return upTo(asciiRunes, s.MaxName-1) * int64(len(alphanumeric)) >> 17
+	default:
+		return upTo(asciiRunes, s.MaxName)
+	}
+}
+
+func (s Shape) String() string {
+	str := fmt.Sprintf("%d lines, %d stations, names up to %d bytes, %s readings", s.Lines, s.Stations, s.MaxName, s.Distribution)
+	if s.Names != "" && s.Names != RandomNames {
+		str += fmt.Sprintf(", %s names", s.Names)
+	}
+	if s.Zipf > 1 {
+		str += fmt.Sprintf(", Zipfian stations of exponent %g", s.Zipf)
+	}
+	if s.Errors > 0 {
+		str += fmt.Sprintf(", %g malformed", s.Errors)
+	}
+	return str
+}
+
+// RandomShape draws a valid shape, from a few lines to tens of thousands and
+// from one station to thousands.
+func RandomShape(rng *rand.Rand) Shape {
+	for {
+		s := Shape{
+			Lines:          1 + rng.IntN(50000),
+			Stations:       1 + rng.IntN(3000),
+			MaxName:        1 + rng.IntN(100),
+			Distribution:   distributions[rng.IntN(len(distributions))],
+			NoFinalNewline: rng.IntN(4) == 0,
+		}
+		if s.Validate() == nil {
+			return s
+		}
+	}
+}
+
+// nameRunes are the runes of generated names, of one to four bytes.
+var nameRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 -'.éüøñçЖжд東京語ال😀")
+
+// asciiRunes is the number of nameRunes of a byte.
+const asciiRunes = 66
+
+// Generate returns a valid input of shape s, which must be valid, see
+// Shape.Validate.
+func Generate(rng *rand.Rand, s Shape) []byte {
+	g := &Generator{shape: s}
+	g.names, g.means = stations(rng, s)
+	var b []byte
+	pick := g.picker(rng)
+	for range s.Lines {
+		b = g.appendLine(b, rng, pick)
+	}
+	if s.NoFinalNewline {
+		b = b[:max(len(b)-1, 0)]
+	}
+	return b
+}
+
+// stations draws the names of the stations of shape s and the means of
+// their readings in tenths of a degree.
+func stations(rng *rand.Rand, s Shape) (names []string, means []float64) {
+	names = make([]string, 0, s.Stations)
+	seen := map[string]bool{}
+	for len(names) < s.Stations {
+		var name string
+		switch s.Names {
+		case LongNames:
+			name = longName(rng, s.MaxName)
+		case CollidingNames:
+			name = collidingName(rng, max(s.MaxName, 2))
+		default:
+			name = randomName(rng, 1+rng.IntN(s.MaxName))
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	means = make([]float64, len(names))
+	for i := range means {
+		means[i] = float64(rng.IntN(1599) - 799)
+	}
+	return names, means
+}
+
+// randomName returns a name of at most n bytes, and at least one.
+func randomName(rng *rand.Rand, n int) string {
+	var b []byte
+	for {
+		r := nameRunes[rng.IntN(len(nameRunes))]
+		if len(b)+utf8.RuneLen(r) > n {
+			break
+		}
+		b = utf8.AppendRune(b, r)
+	}
+	if len(b) == 0 {
+		b = append(b, 'x')
+	}
+	return string(b)
+}
+
+// longName returns a name of exactly n bytes, of runes of two to four bytes
+// while they fit.
+func longName(rng *rand.Rand, n int) string {
+	var b []byte
+	for {
+		r := nameRunes[rng.IntN(len(nameRunes))]
+		if utf8.RuneLen(r) == 1 {
+			continue
+		}
+		if len(b)+utf8.RuneLen(r) > n {
+			break
+		}
+		b = utf8.AppendRune(b, r)
+	}
+	for len(b) < n {
+		b = append(b, alphanumeric[rng.IntN(len(alphanumeric))])
+	}
+	return string(b)
+}
+
+// alphanumeric are the last bytes of CollidingNames and the padding of
+// LongNames.
+const alphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// collidingName returns a name of at most n bytes, and at least two, whose
+// 32-bit FNV-1a hash has its low 16 bits zero. It draws prefixes and tries
+// each alphanumeric last byte on them.
+func collidingName(rng *rand.Rand, n int) string {
+	const prime = 16777619
+	for {
+		prefix := randomName(rng, 1+rng.IntN(n-1))
+		h := uint32(2166136261)
+		for i := 0; i < len(prefix); i++ {
+			h = (h ^ uint32(prefix[i])) * prime
+		}
+		for i := 0; i < len(alphanumeric); i++ {
+			if (h^uint32(alphanumeric[i]))*prime&0xFFFF == 0 {
+				return prefix + alphanumeric[i:i+1]
+			}
+		}
+	}
+}
+
+// Divergence is the error of a random input on which a strategy's results
+// differ from Reference.
+type Divergence struct {
+	Seed     uint64
+	Input    int
+	Shape    Shape
+	Strategy string
+	*Mismatch
+}
+
+func (d *Divergence) Error() string {
+	return fmt.Sprintf("seed %d input %d (%v): strategy %s diverges: %v", d.Seed, d.Input, d.Shape, d.Strategy, d.Mismatch)
+}
+
+// Differential generates n random inputs of random shapes from seed and
+// checks the results process returns for each of strategies on them against
+// Reference, which makes all strategies byte-identical when none fails. It
+// returns a *Divergence for each differing result, or the error of process.
+// The same seed generates the same inputs.
+func Differential(seed uint64, n int, strategies []string, process func(strategy, path string) (string, error)) []error {
+	dir, err := os.MkdirTemp("", "onebrc-differential")
+	if err != nil {
+		return []error{err}
+	}
+	defer os.RemoveAll(dir)
+
+	var errs []error
+	for i := range n {
+		rng := rand.New(rand.NewPCG(seed, uint64(i)))
+		shape := RandomShape(rng)
+		input := Generate(rng, shape)
+		expected, err := Reference(input)
+		if err != nil {
+			return append(errs, err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("input-%d.txt", i))
+		if err := os.WriteFile(path, input, 0o644); err != nil {
+			return append(errs, err)
+		}
+		for _, strategy := range strategies {
+			got, err := process(strategy, path)
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("seed %d input %d (%v): strategy %s: %w", seed, i, shape, strategy, err))
+			case got != expected:
+				errs = append(errs, &Divergence{seed, i, shape, strategy, &Mismatch{filepath.Base(path), expected, got}})
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,57 @@
+package testdata
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		shape Shape
+		valid bool
+	}{
+		{Shape{Stations: 413, MaxName: 24}, true},
+		{Shape{Stations: 66, MaxName: 1}, true},
+		{Shape{Stations: 67, MaxName: 1}, false},
+		{Shape{Stations: 62, MaxName: 1, Names: LongNames}, true},
+		{Shape{Stations: 63, MaxName: 1, Names: LongNames}, false},
+		{Shape{Stations: 10000, MaxName: 100, Names: LongNames}, true},
+		{Shape{Stations: 1, MaxName: 2, Names: CollidingNames}, false},
+		{Shape{Stations: 2, MaxName: 3, Names: CollidingNames}, true},
+		{Shape{Stations: 3, MaxName: 3, Names: CollidingNames}, false},
+		{Shape{Stations: 100, MaxName: 4, Names: CollidingNames}, true},
+		{Shape{Stations: 1000, MaxName: 4, Names: CollidingNames}, false},
+		{Shape{Stations: 0, MaxName: 24}, false},
+		{Shape{Stations: 1, MaxName: 0}, false},
+		{Shape{Stations: 1, MaxName: 101}, false},
+		{Shape{Lines: -1, Stations: 1, MaxName: 24}, false},
+	} {
+		if err := tc.shape.Validate(); (err == nil) != tc.valid {
+			t.Errorf("Validate(%v) = %v, expected valid %v", tc.shape, err, tc.valid)
+		}
+	}
+}
+
+func TestCollidingNames(t *testing.T) {
+	// the most stations of short names that validate are drawn
+	for _, maxName := range []int{3, 4} {
+		s := Shape{Stations: 1, MaxName: maxName, Names: CollidingNames}
+		for s.Validate() == nil {
+			s.Stations++
+		}
+		s.Stations--
+		names, _ := stations(rand.New(rand.NewPCG(1, 0)), s)
+		for _, name := range names {
+			h := uint32(2166136261)
+			for i := 0; i < len(name); i++ {
+				h = (h ^ uint32(name[i])) * 16777619
+			}
+			if len(name) < 2 || len(name) > s.MaxName || h&0xFFFF != 0 {
+				t.Errorf("name %q of %d bytes has hash %#x", name, len(name), h)
+			}
+		}
+		if len(names) != s.Stations {
+			t.Errorf("%d names of up to %d bytes, expected %d", len(names), maxName, s.Stations)
+		}
+	}
+}
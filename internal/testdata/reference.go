@@ -0,0 +1,67 @@
+package testdata
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type stats struct {
+	min, max   int
+	sum, count int
+}
+
+// Reference returns the results of input in the official format, computed
+// by a naive aggregation that shares no code with brc. Empty lines are
+// skipped, input must be otherwise well-formed.
+func Reference(input []byte) (string, error) {
+	all := map[string]*stats{}
+	for _, line := range strings.Split(string(input), "\n") {
+		if line == "" {
+			continue
+		}
+		i := strings.LastIndexByte(line, ';')
+		if i < 0 {
+			return "", fmt.Errorf("line %q has no ';'", line)
+		}
+		name, value := line[:i], line[i+1:]
+		neg := strings.HasPrefix(value, "-")
+		whole, frac, _ := strings.Cut(strings.TrimPrefix(value, "-"), ".")
+		tenths, err := strconv.Atoi(whole + frac)
+		if err != nil || len(frac) != 1 {
+			return "", fmt.Errorf("line %q has an invalid temperature", line)
+		}
+		if neg {
+			tenths = -tenths
+		}
+		s, ok := all[name]
+		if !ok {
+			s = &stats{min: tenths, max: tenths}
+			all[name] = s
+		}
+		s.min, s.max = min(s.min, tenths), max(s.max, tenths)
+		s.sum += tenths
+		s.count++
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, name := range slices.Sorted(maps.Keys(all)) {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		s := all[name]
+		// the mean rounds half up like Java's Math.round, without -0.0
+		mean := math.Floor(float64(s.sum)/float64(s.count)+0.5) / 10
+		if mean == 0 {
+			mean = 0
+		}
+		fmt.Fprintf(&b, "%s=%.1f/%.1f/%.1f", name, float64(s.min)/10, mean, float64(s.max)/10)
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
@@ -0,0 +1,101 @@
+// Package testdata bundles measurement fixtures with their expected results
+// in the official format, so that the brc tests, the strategies of onebrc
+// and onebrc selftest all check against the same goldens. Besides a small
+// and a medium file the fixtures cover edge cases such as an empty input, no
+// trailing newline, 100 byte names and rounding ties.
+//
+// gen.go generates the fixtures and computes their results with Reference,
+// see go generate. Generate makes random inputs for differential tests, and
+// Generator streams inputs of any size for onebrc generate. Parquet encodes
+// inputs as Parquet files for the tests of Parquet input.
+package testdata
+
+//go:generate go run gen.go
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed fixtures
+var files embed.FS
+
+// Fixture is a measurements file and its expected results.
+type Fixture struct {
+	Name     string
+	Input    []byte
+	Expected string
+}
+
+// Fixtures returns the bundled fixtures in name order.
+func Fixtures() []Fixture {
+	inputs, err := fs.Glob(files, "fixtures/*.txt")
+	if err != nil {
+		panic(err)
+	}
+	fixtures := make([]Fixture, 0, len(inputs))
+	for _, input := range inputs {
+		data, err := files.ReadFile(input)
+		if err != nil {
+			panic(err)
+		}
+		expected, err := files.ReadFile(strings.TrimSuffix(input, ".txt") + ".out")
+		if err != nil {
+			panic(err)
+		}
+		fixtures = append(fixtures, Fixture{strings.TrimSuffix(path.Base(input), ".txt"), data, string(expected)})
+	}
+	return fixtures
+}
+
+// Mismatch is the error of a fixture whose results differ from the expected.
+type Mismatch struct {
+	Fixture       string
+	Expected, Got string
+}
+
+func (m *Mismatch) Error() string {
+	// show where the results start to differ, they are long for big files
+	i := 0
+	for i < len(m.Expected) && i < len(m.Got) && m.Expected[i] == m.Got[i] {
+		i++
+	}
+	from := max(i-40, 0)
+	return fmt.Sprintf("fixture %s: results differ at byte %d, expected %q, got %q", m.Fixture, i, excerpt(m.Expected, from), excerpt(m.Got, from))
+}
+
+func excerpt(s string, from int) string {
+	return s[min(from, len(s)):min(from+80, len(s))]
+}
+
+// Check writes every fixture to a temporary file, calls process with its
+// path and returns a *Mismatch for each fixture whose results differ from
+// the expected, or the error of process for it.
+func Check(process func(path string) (string, error)) []error {
+	dir, err := os.MkdirTemp("", "onebrc-fixtures")
+	if err != nil {
+		return []error{err}
+	}
+	defer os.RemoveAll(dir)
+
+	var errs []error
+	for _, f := range Fixtures() {
+		p := filepath.Join(dir, f.Name+".txt")
+		if err := os.WriteFile(p, f.Input, 0o644); err != nil {
+			return append(errs, err)
+		}
+		got, err := process(p)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("fixture %s: %w", f.Name, err))
+		case got != f.Expected:
+			errs = append(errs, &Mismatch{f.Name, f.Expected, got})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,156 @@
+// Package xlsx writes Excel workbooks (Office Open XML spreadsheets) row by
+// row into a zip stream, so memory stays flat however many rows there are.
+// It writes what results need: sheets of strings and numbers with inline
+// strings, no styles and no shared string table.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer writes a workbook. Add sheets with Sheet, rows to the last one with
+// Row, and finish with Close.
+type Writer struct {
+	zw     *zip.Writer
+	sheets []string
+	rows   int
+	bw     *bufio.Writer // of the current sheet
+	err    error
+}
+
+// NewWriter returns a Writer writing a workbook to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zw: zip.NewWriter(w)}
+}
+
+// Sheet ends the current sheet, if any, and starts one named name, which
+// Excel limits to 31 characters without any of []:*?/\.
+func (w *Writer) Sheet(name string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len([]rune(name)) > 31 || strings.ContainsAny(name, `[]:*?/\`) {
+		return fmt.Errorf("invalid sheet name %q", name)
+	}
+	w.endSheet()
+	f, err := w.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)+1))
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.sheets = append(w.sheets, name)
+	w.rows = 0
+	w.bw = bufio.NewWriter(f)
+	w.bw.WriteString(xml.Header)
+	w.bw.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return nil
+}
+
+// Row appends a row to the current sheet. Cells are strings, integers or
+// floats, nil leaves a cell empty.
+func (w *Writer) Row(cells ...any) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.bw == nil {
+		return errors.New("row before the first sheet")
+	}
+	w.rows++
+	fmt.Fprintf(w.bw, `<row r="%d">`, w.rows)
+	for i, c := range cells {
+		ref := column(i) + strconv.Itoa(w.rows)
+		switch v := c.(type) {
+		case nil:
+		case string:
+			fmt.Fprintf(w.bw, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(w.bw, []byte(v))
+			w.bw.WriteString(`</t></is></c>`)
+		case int:
+			fmt.Fprintf(w.bw, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case int64:
+			fmt.Fprintf(w.bw, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(w.bw, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'g', -1, 64))
+		default:
+			return fmt.Errorf("unsupported cell type %T", c)
+		}
+	}
+	w.bw.WriteString(`</row>`)
+	return nil
+}
+
+// endSheet closes the XML of the current sheet.
+func (w *Writer) endSheet() {
+	if w.bw == nil {
+		return
+	}
+	w.bw.WriteString(`</sheetData></worksheet>`)
+	if err := w.bw.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+	w.bw = nil
+}
+
+// Close ends the last sheet and writes the parts listing the sheets. It
+// does not close the underlying writer.
+func (w *Writer) Close() error {
+	w.endSheet()
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.sheets) == 0 {
+		return errors.New("workbook without sheets")
+	}
+	var types, sheets, rels strings.Builder
+	for i, name := range w.sheets {
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+	}
+	for _, p := range parts {
+		f, err := w.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, xml.Header+p.content); err != nil {
+			return err
+		}
+	}
+	return w.zw.Close()
+}
+
+// column returns the letters of the column with index i, A for 0.
+func column(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Row("too early"); err == nil {
+		t.Error("Row before a sheet succeeded")
+	}
+	if err := w.Sheet("a/b"); err == nil {
+		t.Error("Sheet with a slash succeeded")
+	}
+	w.Sheet("Summary")
+	w.Row("stations", 2)
+	w.Sheet("Stations")
+	w.Row("Station", "Mean")
+	w.Row("Tromsø <N>", -1.5)
+	w.Row("empty", nil, int64(7))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(data)
+		// every part is well-formed XML
+		d := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("Workbook lacks %s", name)
+		}
+	}
+	if s := parts["xl/workbook.xml"]; !strings.Contains(s, `<sheet name="Summary" sheetId="1" r:id="rId1"/><sheet name="Stations" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("Wrong sheets in %s", s)
+	}
+	sheet := parts["xl/worksheets/sheet2.xml"]
+	for _, cell := range []string{
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">Tromsø &lt;N&gt;</t></is></c><c r="B2"><v>-1.5</v></c>`,
+		`<row r="3"><c r="A3" t="inlineStr"><is><t xml:space="preserve">empty</t></is></c><c r="C3"><v>7</v></c></row>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("Sheet lacks %s:\n%s", cell, sheet)
+		}
+	}
+}
+
+func TestColumn(t *testing.T) {
+	for i, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if c := column(i); c != expected {
+			t.Errorf("column(%d) = %s, expected %s", i, c, expected)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package brc
+
+// Accumulator is a custom per-station metric, e.g. a count of readings above
+// a threshold or heating degree-days, computed alongside the Stats. Each
+// worker keeps one Accumulator per station, which are merged like the Stats,
+// so an implementation needs no locking.
+type Accumulator interface {
+	// Observe records a reading in tenths of a degree.
+	Observe(tenths int32)
+	// Merge folds other, an Accumulator of the same kind for the same
+	// station, into the receiver.
+	Merge(other Accumulator)
+	// Result returns the value of the metric.
+	Result() any
+}
+
+// observeCustom records a reading of station name in its custom Accumulator.
+func (r *Result) observeCustom(name []byte, tenths int32) {
+	a, ok := r.custom[string(name)]
+	if !ok {
+		a = r.newAccumulator()
+		r.custom[string(name)] = a
+	}
+	a.Observe(tenths)
+}
+
+// mergeCustom folds the Accumulator o of station name into r.
+func (r *Result) mergeCustom(name string, o Accumulator) {
+	if r.custom == nil || o == nil {
+		return
+	}
+	a, ok := r.custom[name]
+	if !ok {
+		a = r.newAccumulator()
+		r.custom[name] = a
+	}
+	a.Merge(o)
+}
+
+// Accumulated returns the Result of the custom Accumulator of station name.
+// It is only available for results of a run with Config.NewAccumulator.
+func (r *Result) Accumulated(name string) (any, bool) {
+	a, ok := r.custom[name]
+	if !ok {
+		return nil, false
+	}
+	return a.Result(), true
+}
@@ -0,0 +1,182 @@
+package brc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Affinity selects how worker threads are pinned to CPUs.
+type Affinity string
+
+const (
+	// AffinityNone leaves thread placement to the OS scheduler.
+	AffinityNone Affinity = "none"
+	// AffinitySpread pins workers round robin across CPU sockets, so each
+	// socket's memory bandwidth and caches are used.
+	AffinitySpread Affinity = "spread"
+	// AffinityPack pins workers to the CPUs of a single NUMA node, so all of
+	// them share one memory controller and last level cache.
+	AffinityPack Affinity = "pack"
+	// AffinityNUMA pins workers round robin across NUMA nodes and, for
+	// ProcessFile with IOMmap, hands each chunk to a worker on the node whose
+	// memory holds the chunk's pages. Per-worker tables are allocated after
+	// pinning, so first-touch places them on the worker's node as well.
+	AffinityNUMA Affinity = "numa"
+)
+
+// cpuInfo is the placement of a CPU the process may run on.
+type cpuInfo struct {
+	id     int
+	socket int
+	node   int
+}
+
+// placeWorkers returns the CPU of each of n workers under policy, given the
+// CPUs available to the process. It returns nil if workers are not pinned.
+func placeWorkers(policy Affinity, n int, cpus []cpuInfo) ([]int, error) {
+	switch policy {
+	case "", AffinityNone:
+		return nil, nil
+	case AffinitySpread, AffinityPack, AffinityNUMA:
+	default:
+		return nil, fmt.Errorf("unknown affinity policy %q", policy)
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("no CPUs available for affinity policy %q", policy)
+	}
+
+	cpus = append([]cpuInfo(nil), cpus...)
+	sort.Slice(cpus, func(i, j int) bool { return cpus[i].id < cpus[j].id })
+
+	var order []int
+	switch policy {
+	case AffinityPack:
+		// the node of the lowest numbered CPU, usually node 0
+		for _, c := range cpus {
+			if c.node == cpus[0].node {
+				order = append(order, c.id)
+			}
+		}
+	case AffinitySpread:
+		order = interleave(cpus, func(c cpuInfo) int { return c.socket })
+	case AffinityNUMA:
+		order = interleave(cpus, func(c cpuInfo) int { return c.node })
+	}
+
+	placement := make([]int, n)
+	for i := range placement {
+		placement[i] = order[i%len(order)]
+	}
+	return placement, nil
+}
+
+// interleave orders cpus (sorted by id) round robin across the groups
+// returned by key. Within a group ascending ids visit distinct cores before
+// their SMT siblings.
+func interleave(cpus []cpuInfo, key func(cpuInfo) int) []int {
+	groups := map[int][]int{}
+	var keys []int
+	for _, c := range cpus {
+		k := key(c)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], c.id)
+	}
+	sort.Ints(keys)
+
+	order := make([]int, 0, len(cpus))
+	for i := 0; len(order) < len(cpus); i++ {
+		for _, k := range keys {
+			if i < len(groups[k]) {
+				order = append(order, groups[k][i])
+			}
+		}
+	}
+	return order
+}
+
+// placeChunks returns the CPU of the worker for each chunk, given the NUMA
+// node holding each chunk (-1 if unknown). Chunks go round robin to the CPUs
+// of their node, chunks of unknown or unavailable nodes are spread over all
+// nodes.
+func placeChunks(nodes []int, cpus []cpuInfo) []int {
+	cpus = append([]cpuInfo(nil), cpus...)
+	sort.Slice(cpus, func(i, j int) bool { return cpus[i].id < cpus[j].id })
+	byNode := map[int][]int{}
+	for _, c := range cpus {
+		byNode[c.node] = append(byNode[c.node], c.id)
+	}
+	fallback := interleave(cpus, func(c cpuInfo) int { return c.node })
+
+	placement := make([]int, len(nodes))
+	next := map[int]int{}
+	var k int
+	for i, node := range nodes {
+		if ids := byNode[node]; len(ids) > 0 {
+			placement[i] = ids[next[node]%len(ids)]
+			next[node]++
+		} else {
+			placement[i] = fallback[k%len(fallback)]
+			k++
+		}
+	}
+	return placement
+}
+
+// placement returns the CPU of each of n workers under c.Affinity. If chunks
+// holds the mapped input of each worker, AffinityNUMA places every worker on
+// the node of its chunk.
+func (c Config) placement(n int, chunks [][]byte) ([]int, error) {
+	if c.Affinity == "" || c.Affinity == AffinityNone {
+		return nil, nil
+	}
+	cpus, err := availableCPUs()
+	if err != nil {
+		return nil, fmt.Errorf("affinity: %w", err)
+	}
+	if c.Affinity != AffinityNUMA || chunks == nil || len(cpus) == 0 {
+		return placeWorkers(c.Affinity, n, cpus)
+	}
+
+	nodes := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		nodes[i] = chunkNode(chunk)
+		c.logger().Debug("chunk placement", "worker", i, "node", nodes[i])
+	}
+	return placeChunks(nodes, cpus), nil
+}
+
+// chunkNodeSamples is the number of pages of a chunk whose node is looked up.
+const chunkNodeSamples = 16
+
+// chunkNode returns the NUMA node holding most of the sampled pages of chunk,
+// or -1 if none of them is resident.
+func chunkNode(chunk []byte) int {
+	nodes := pageNodes(chunk, chunkNodeSamples)
+	votes := map[int]int{}
+	best := -1
+	for _, node := range nodes {
+		if node < 0 {
+			continue
+		}
+		votes[node]++
+		if best < 0 || votes[node] > votes[best] {
+			best = node
+		}
+	}
+	return best
+}
+
+// pinWorker locks the calling goroutine to its OS thread and pins the thread
+// to the CPU planned for worker, if any. The thread is never unlocked, so it
+// exits with the goroutine instead of returning to the scheduler pinned.
+func (c Config) pinWorker(placement []int, worker int) {
+	if placement == nil {
+		return
+	}
+	if err := pinThread(placement[worker]); err != nil {
+		c.logger().Warn("failed to pin worker", "worker", worker, "cpu", placement[worker], "err", err)
+		placement[worker] = -1
+	}
+}
@@ -0,0 +1,99 @@
+package brc
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// availableCPUs returns the CPUs in the affinity mask of the process with
+// their socket and NUMA node from sysfs. CPUs sysfs does not describe are
+// placed on socket and node 0.
+func availableCPUs() ([]cpuInfo, error) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, err
+	}
+
+	var cpus []cpuInfo
+	for id := 0; id < len(set)*64; id++ {
+		if !set.IsSet(id) {
+			continue
+		}
+		dir := "/sys/devices/system/cpu/cpu" + strconv.Itoa(id)
+		c := cpuInfo{id: id}
+		if b, err := os.ReadFile(filepath.Join(dir, "topology", "physical_package_id")); err == nil {
+			c.socket, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+		}
+		if nodes, _ := filepath.Glob(filepath.Join(dir, "node[0-9]*")); len(nodes) > 0 {
+			c.node, _ = strconv.Atoi(strings.TrimPrefix(filepath.Base(nodes[0]), "node"))
+		}
+		cpus = append(cpus, c)
+	}
+	return cpus, nil
+}
+
+// pinThread locks the calling goroutine to its thread and restricts the
+// thread to cpu.
+func pinThread(cpu int) error {
+	runtime.LockOSThread()
+	var set unix.CPUSet
+	set.Set(cpu)
+	return unix.SchedSetaffinity(0, &set)
+}
+
+// pageSink keeps the page touching loads of pageNodes from being optimized
+// away.
+var pageSink byte
+
+// pageNodes returns the NUMA node of up to samples pages spread evenly over b,
+// -1 for pages that are not resident. It asks mincore(2) which pages are in
+// memory and move_pages(2), without moving anything, for the nodes of those
+// only: touching the others would read them from storage onto the node of
+// the caller, reporting where the lookup ran instead of where the page was.
+func pageNodes(b []byte, samples int) []int {
+	if len(b) == 0 {
+		return nil
+	}
+	pageSize := uintptr(os.Getpagesize())
+	start := uintptr(unsafe.Pointer(&b[0]))
+	first := start &^ (pageSize - 1)
+	pages := int((start + uintptr(len(b)) - first + pageSize - 1) / pageSize)
+
+	n := min(samples, pages)
+	nodes := make([]int, n)
+	var addrs []uintptr
+	var sampled []int // the index in nodes of each of addrs
+	for i := range nodes {
+		nodes[i] = -1
+		addr := first + uintptr(i*pages/n)*pageSize
+		var resident byte
+		if _, _, errno := unix.Syscall(unix.SYS_MINCORE, addr, pageSize, uintptr(unsafe.Pointer(&resident))); errno != 0 || resident&1 == 0 {
+			continue
+		}
+		// map the cached page into this mapping, which a page never touched
+		// through it is not, so that it has a node to report; it is in
+		// memory, so this is a minor fault that reads nothing
+		pageSink += b[max(addr, start)-start]
+		addrs = append(addrs, addr)
+		sampled = append(sampled, i)
+	}
+	if len(addrs) == 0 {
+		return nodes
+	}
+	status := make([]int32, len(addrs))
+	_, _, errno := unix.Syscall6(unix.SYS_MOVE_PAGES, 0, uintptr(len(addrs)),
+		uintptr(unsafe.Pointer(&addrs[0])), 0, uintptr(unsafe.Pointer(&status[0])), 0)
+	for j, i := range sampled {
+		// failed lookups report -errno in status
+		if errno == 0 && status[j] >= 0 {
+			nodes[i] = int(status[j])
+		}
+	}
+	return nodes
+}
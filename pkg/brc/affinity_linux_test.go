@@ -0,0 +1,52 @@
+package brc
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPageNodes(t *testing.T) {
+	pageSize := os.Getpagesize()
+	b, err := unix.Mmap(-1, 0, 64*pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Munmap(b)
+
+	// pages never touched have no node, and looking them up does not fault
+	// them in
+	for i, node := range pageNodes(b, 16) {
+		if node != -1 {
+			t.Errorf("page %d of untouched memory is on node %d", i, node)
+		}
+	}
+	resident := make([]byte, 64)
+	if _, _, errno := unix.Syscall(unix.SYS_MINCORE, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), uintptr(unsafe.Pointer(&resident[0]))); errno != 0 {
+		t.Fatal(errno)
+	}
+	for i, r := range resident {
+		if r&1 != 0 {
+			t.Fatalf("pageNodes faulted in page %d", i)
+		}
+	}
+
+	// the samples are every fourth page, of which every other one is written
+	for i := 0; i < 64; i += 8 {
+		b[i*pageSize] = 1
+	}
+	nodes := pageNodes(b, 16)
+	if len(nodes) != 16 {
+		t.Fatalf("%d nodes for 16 samples", len(nodes))
+	}
+	if nodes[0] == -1 {
+		t.Skip("move_pages reports no nodes here")
+	}
+	for i, node := range nodes {
+		if written := i%2 == 0; (node >= 0) != written {
+			t.Errorf("sample %d of page %d is on node %d", i, i*64/16, node)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package brc
+
+import "errors"
+
+var errAffinityUnsupported = errors.New("CPU affinity is only supported on Linux")
+
+func availableCPUs() ([]cpuInfo, error) {
+	return nil, errAffinityUnsupported
+}
+
+func pinThread(cpu int) error {
+	return errAffinityUnsupported
+}
+
+func pageNodes(b []byte, samples int) []int {
+	return nil
+}
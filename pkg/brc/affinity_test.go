@@ -0,0 +1,47 @@
+package brc
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPlaceWorkers(t *testing.T) {
+	// two sockets with two cores and their SMT siblings each, one node per
+	// socket, numbered like Linux does
+	cpus := []cpuInfo{
+		{0, 0, 0}, {1, 0, 0}, {2, 1, 1}, {3, 1, 1},
+		{4, 0, 0}, {5, 0, 0}, {6, 1, 1}, {7, 1, 1},
+	}
+	for _, tc := range []struct {
+		policy   Affinity
+		workers  int
+		expected string
+	}{
+		{AffinityNone, 4, "[]"},
+		{AffinitySpread, 4, "[0 2 1 3]"},
+		{AffinitySpread, 10, "[0 2 1 3 4 6 5 7 0 2]"},
+		{AffinityPack, 6, "[0 1 4 5 0 1]"},
+	} {
+		placement, err := placeWorkers(tc.policy, tc.workers, cpus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := fmt.Sprint(placement); actual != tc.expected {
+			t.Errorf("Wrong placement for %s with %d workers, expected %s, got %s", tc.policy, tc.workers, tc.expected, actual)
+		}
+	}
+
+	if _, err := placeWorkers("bogus", 1, cpus); err == nil {
+		t.Errorf("Expected error for unknown policy")
+	}
+}
+
+func TestPlaceChunks(t *testing.T) {
+	cpus := []cpuInfo{{0, 0, 0}, {1, 0, 0}, {2, 1, 1}, {3, 1, 1}}
+	// chunks 0-1 on node 0, 2-4 on node 1, 5 not resident, 6 on a node
+	// without available CPUs
+	placement := placeChunks([]int{0, 0, 1, 1, 1, -1, 7}, cpus)
+	if actual, expected := fmt.Sprint(placement), "[0 1 2 3 2 0 2]"; actual != expected {
+		t.Errorf("Wrong placement, expected %s, got %s", expected, actual)
+	}
+}
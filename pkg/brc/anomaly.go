@@ -0,0 +1,88 @@
+package brc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// moments are the sum of squares of the readings of a station, in tenths²,
+// which with its Stats give the variance. 999² per reading overflows int64
+// only after 9·10^12 readings.
+type moments struct {
+	sumSquares int64
+}
+
+// addMoments records a reading of station name.
+func (r *Result) addMoments(name []byte, tenths int32) {
+	m, ok := r.moments[string(name)]
+	if !ok {
+		m = new(moments)
+		r.moments[string(name)] = m
+	}
+	m.sumSquares += int64(tenths) * int64(tenths)
+}
+
+// StdDev returns the population standard deviation of the readings of
+// station name in degrees. It is only available for results of a run with
+// Config.Moments.
+func (r *Result) StdDev(name string) (float64, bool) {
+	m, ok := r.moments[name]
+	if !ok {
+		return 0, false
+	}
+	s := r.stations.get(name)
+	if s.Count == 0 {
+		return 0, false
+	}
+	mean := float64(s.Sum) / float64(s.Count)
+	variance := float64(m.sumSquares)/float64(s.Count) - mean*mean
+	return math.Sqrt(max(variance, 0)) / 10, true
+}
+
+// Anomaly is a station whose extreme readings lie implausibly far from its
+// mean, e.g. a sensor reporting 99.9 among readings around 10.
+type Anomaly struct {
+	Name   string
+	Stats  Stats
+	StdDev float64
+	// MinSigmas and MaxSigmas are the distances of the minimum and maximum
+	// from the mean in standard deviations.
+	MinSigmas, MaxSigmas float64
+}
+
+// Anomalies returns the stations, in the order of Names, with a minimum or
+// maximum more than k standard deviations from their mean. Stations whose
+// readings are all equal have none. It needs a result of a run with
+// Config.Moments and returns nil otherwise.
+func (r *Result) Anomalies(k float64) []Anomaly {
+	var anomalies []Anomaly
+	for _, name := range r.Names() {
+		sd, ok := r.StdDev(name)
+		if !ok || sd == 0 {
+			continue
+		}
+		s := r.stations.get(name)
+		mean := float64(s.Sum) / float64(s.Count) / 10
+		a := Anomaly{name, s, sd, (mean - float64(s.Min)/10) / sd, (float64(s.Max)/10 - mean) / sd}
+		if a.MinSigmas > k || a.MaxSigmas > k {
+			anomalies = append(anomalies, a)
+		}
+	}
+	return anomalies
+}
+
+// WriteAnomalies writes the Anomalies of r for k as semicolon separated rows
+// with a header, for data cleaning:
+//
+//	station;count;mean;stddev;min;max;min_sigmas;max_sigmas
+//	Abha;1204;18.0;2.31;-23.0;59.2;17.7;17.8
+func (r *Result) WriteAnomalies(w io.Writer, k float64) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("station;count;mean;stddev;min;max;min_sigmas;max_sigmas\n")
+	for _, a := range r.Anomalies(k) {
+		fmt.Fprintf(bw, "%s;%d;%.1f;%.2f;%.1f;%.1f;%.1f;%.1f\n", a.Name, a.Stats.Count, a.Stats.Mean(), a.StdDev, float64(a.Stats.Min)/10, float64(a.Stats.Max)/10, a.MinSigmas, a.MaxSigmas)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,69 @@
+package brc
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// asciiLetters are the transliterations of letters that do not decompose
+// into an ASCII letter and combining marks.
+var asciiLetters = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th",
+	'Þ': "Th", 'ı': "i", 'ħ': "h", 'Ħ': "H", 'ŧ': "t", 'Ŧ': "T", 'ŋ': "ng",
+	'‘': "'", '’': "'", 'ʻ': "'", 'ʼ': "'", '“': `"`, '”': `"`, '–': "-", '—': "-",
+}
+
+// ASCII transliterates name to ASCII for systems that cannot handle UTF-8,
+// e.g. "São Paulo" to "Sao Paulo": accents are dropped, letters such as ß
+// and ø spelled out, and runes of other scripts replaced by ?.
+func ASCII(name string) string {
+	ascii := true
+	for i := 0; i < len(name); i++ {
+		ascii = ascii && name[i] < utf8.RuneSelf
+	}
+	if ascii {
+		return name
+	}
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			// a combining mark of the previous letter
+		default:
+			if s, ok := asciiLetters[r]; ok {
+				b.WriteString(s)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+// FoldASCII returns r with its names transliterated by ASCII, the stations
+// it keeps apart still aggregated separately. Names that fold to the same
+// are merged, and returned as collisions, each sorted, in the order of the
+// folded names. Extras such as distinct counts are not kept.
+func (r *Result) FoldASCII() (folded *Result, collisions [][]string) {
+	byFold := map[string][]string{}
+	for name := range r.All() {
+		f := ASCII(name)
+		byFold[f] = append(byFold[f], name)
+	}
+	folded, _ = r.Rollup(ASCII) // no overflow, each reading is counted once
+	for _, f := range slices.Sorted(maps.Keys(byFold)) {
+		if names := byFold[f]; len(names) > 1 {
+			slices.Sort(names)
+			collisions = append(collisions, names)
+		}
+	}
+	return folded, collisions
+}
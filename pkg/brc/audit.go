@@ -0,0 +1,164 @@
+package brc
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrAudit is returned, wrapped, when Config.Audit finds that the workers
+// did not process every line of the input exactly once.
+var ErrAudit = errors.New("boundary audit failed")
+
+// Audit records how a run split its input between workers and checks it,
+// since off-by-one errors at chunk boundaries are the most common bug of a
+// parallel parser. Set Config.Audit to have it filled by ProcessFile or
+// Process, which then fail with ErrAudit if the segments do not cover the
+// input exactly, split a line, or if the workers processed a different
+// number of lines than the input holds.
+type Audit struct {
+	// Segments are the runs of lines handed to the workers, in input order:
+	// a chunk per worker when mapped, a block each when streamed.
+	Segments []Segment
+	// Start and End delimit the bytes of the input that were processed.
+	Start, End int64
+	// Lines is the number of non-empty lines of the input, counted apart
+	// from the segments and the parsers.
+	Lines int64
+	// Processed is the number of lines the workers aggregated or found
+	// malformed.
+	Processed int64
+
+	mu sync.Mutex
+}
+
+// Segment is a run of lines parsed by a worker.
+type Segment struct {
+	Worker       int
+	Offset, Size int64
+	// Lines is the number of non-empty lines in the segment.
+	Lines int64
+	// First and Last are the first and last line of the segment.
+	First, Last string
+
+	terminated bool // by a newline
+}
+
+// reset empties a for a new run.
+func (a *Audit) reset() {
+	if a != nil {
+		a.Segments = a.Segments[:0]
+	}
+}
+
+// add records the segment of data at offset parsed by worker.
+func (a *Audit) add(worker int, offset int64, data []byte) {
+	if a == nil {
+		return
+	}
+	s := Segment{Worker: worker, Offset: offset, Size: int64(len(data)), Lines: countLines(data), terminated: bytes.HasSuffix(data, []byte{'\n'})}
+	trimmed := bytes.TrimSuffix(data, []byte{'\n'})
+	first, _, _ := bytes.Cut(trimmed, []byte{'\n'})
+	s.First = string(first)
+	s.Last = string(trimmed[bytes.LastIndexByte(trimmed, '\n')+1:])
+	a.mu.Lock()
+	a.Segments = append(a.Segments, s)
+	a.mu.Unlock()
+}
+
+// check fills in the totals of a run over [start, end) and reports what
+// does not add up.
+func (a *Audit) check(start, end, lines, processed int64) error {
+	if a == nil {
+		return nil
+	}
+	a.Start, a.End, a.Lines, a.Processed = start, end, lines, processed
+	slices.SortFunc(a.Segments, func(x, y Segment) int { return cmp.Compare(x.Offset, y.Offset) })
+
+	var errs []error
+	next, total := start, int64(0)
+	for i, s := range a.Segments {
+		if s.Offset != next {
+			errs = append(errs, fmt.Errorf("segment of worker %d starts at byte %d, expected %d", s.Worker, s.Offset, next))
+		}
+		if s.Size == 0 {
+			errs = append(errs, fmt.Errorf("segment of worker %d at byte %d is empty", s.Worker, s.Offset))
+		}
+		if i < len(a.Segments)-1 && !s.terminated {
+			errs = append(errs, fmt.Errorf("segment of worker %d at byte %d ends inside the line %q", s.Worker, s.Offset, s.Last))
+		}
+		next, total = s.Offset+s.Size, total+s.Lines
+	}
+	if next != end {
+		errs = append(errs, fmt.Errorf("segments end at byte %d, expected %d", next, end))
+	}
+	if total != lines {
+		errs = append(errs, fmt.Errorf("segments hold %d lines, the input %d, so some are split or repeated", total, lines))
+	}
+	if processed != lines {
+		errs = append(errs, fmt.Errorf("workers processed %d lines, the input holds %d", processed, lines))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrAudit, errors.Join(errs...))
+	}
+	return nil
+}
+
+// WriteText writes a line per segment and the totals of a.
+func (a *Audit) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, s := range a.Segments {
+		fmt.Fprintf(&b, "worker %-3d bytes %d-%d, %d lines, first %q, last %q\n", s.Worker, s.Offset, s.Offset+s.Size, s.Lines, s.First, s.Last)
+	}
+	fmt.Fprintf(&b, "audit      bytes %d-%d, %d lines, %d processed, %d segments\n", a.Start, a.End, a.Lines, a.Processed, len(a.Segments))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// countLines returns the number of non-empty lines of data, the last one
+// with or without a newline.
+func countLines(data []byte) int64 {
+	var c lineCounter
+	c.count(data)
+	return c.lines()
+}
+
+// lineCounter counts the non-empty lines of input fed to it in pieces.
+type lineCounter struct {
+	n    int64
+	last byte
+	seen bool // any byte, so last is set
+}
+
+func (c *lineCounter) count(p []byte) {
+	for _, b := range p {
+		if b == '\n' && c.seen && c.last != '\n' {
+			c.n++
+		}
+		c.last, c.seen = b, true
+	}
+}
+
+func (c *lineCounter) lines() int64 {
+	if c.seen && c.last != '\n' {
+		return c.n + 1
+	}
+	return c.n
+}
+
+// countingReader feeds what is read from r to a lineCounter.
+type countingReader struct {
+	r io.Reader
+	lineCounter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.count(p[:n])
+	return n, err
+}
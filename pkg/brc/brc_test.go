@@ -0,0 +1,1645 @@
+package brc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/arch"
+	"github.com/djheidihoe/1brc/internal/counter"
+	"github.com/djheidihoe/1brc/internal/swiss"
+	"github.com/djheidihoe/1brc/internal/testdata"
+)
+
+const samplesDir = "../../src/test/resources/samples"
+
+// configs are the strategies every sample and fixture is checked with.
+var configs = []Config{
+	{IO: IOMmap},
+	{IO: IOMmap, Workers: 7},
+	{IO: IOStream},
+	{IO: IOStream, Workers: 3, BlockSize: 16},
+	{IO: IOMmap, Workers: 7, Aggregation: AggregateShared},
+	{IO: IOStream, Workers: 3, BlockSize: 16, Aggregation: AggregateShared},
+	{IO: IOMmap, Workers: 7, Map: MapSwiss},
+	{IO: IOStream, Workers: 3, BlockSize: 16, Map: MapSwiss, Provenance: true},
+	{IO: IOMmap, Workers: 7, Parse: ParseTwoStage},
+	{IO: IOStream, Workers: 3, BlockSize: 16, Parse: ParseTwoStage},
+	{IO: IOMmap, Workers: 7, Strict: true},
+	{IO: IOStream, Workers: 3, BlockSize: 16, Strict: true},
+	{IO: IOMmap, Workers: 7, Chaos: 1},
+	{IO: IOStream, Workers: 3, BlockSize: 64, Aggregation: AggregateShared, Chaos: 2},
+	{IO: IOMmap, Workers: 7, Aggregation: AggregatePartitioned},
+	{IO: IOMmap, Workers: 3, Aggregation: AggregatePartitioned, Map: MapSwiss, Chaos: 4},
+}
+
+func TestSamples(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join(samplesDir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no samples found in %s", samplesDir)
+	}
+
+	for _, cfg := range configs {
+		for _, input := range inputs {
+			expected, err := os.ReadFile(strings.TrimSuffix(input, ".txt") + ".out")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := ProcessFile(input, cfg)
+			if err != nil {
+				t.Fatalf("%+v %s: %v", cfg, input, err)
+			}
+			var out bytes.Buffer
+			res.WriteText(&out)
+			if out.String() != string(expected) {
+				t.Errorf("Wrong output for %+v %s, expected:\n%s\ngot:\n%s", cfg, filepath.Base(input), expected, out.String())
+			}
+		}
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	for _, cfg := range configs {
+		for _, err := range testdata.Check(func(path string) (string, error) {
+			res, err := ProcessFile(path, cfg)
+			if err != nil {
+				return "", err
+			}
+			var out bytes.Buffer
+			res.WriteText(&out)
+			return out.String(), nil
+		}) {
+			t.Errorf("%+v %v", cfg, err)
+		}
+	}
+}
+
+func TestDifferential(t *testing.T) {
+	strategies := make([]string, len(configs))
+	for i, cfg := range configs {
+		strategies[i] = fmt.Sprintf("%+v", cfg)
+	}
+	for _, err := range testdata.Differential(1, 5, strategies, func(strategy, path string) (string, error) {
+		res, err := ProcessFile(path, configs[slices.Index(strategies, strategy)])
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		return out.String(), nil
+	}) {
+		t.Error(err)
+	}
+}
+
+// TestParquet checks that the fixtures read from Parquet match the text, over
+// the encodings the writer of the tests has.
+func TestParquet(t *testing.T) {
+	for _, s := range []testdata.ParquetShape{
+		{},
+		{RowGroup: 3, PageRows: 2, Dictionary: true, Codec: "snappy"},
+		{RowGroup: 50, Optional: true, V2: true, Float: true, Codec: "gzip"},
+		{RowGroup: 10, Optional: true, Dictionary: true, V2: true},
+	} {
+		for _, cfg := range []Config{
+			{Format: FormatParquet},
+			{Format: FormatParquet, Workers: 3, Map: MapSwiss},
+			{Format: FormatParquet, Workers: 3, Aggregation: AggregateShared, Chaos: 1},
+		} {
+			for _, fixture := range testdata.Fixtures() {
+				path := filepath.Join(t.TempDir(), fixture.Name+".parquet")
+				if err := os.WriteFile(path, testdata.Parquet(fixture.Input, s), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				summary := new(Summary)
+				cfg.Summary = summary
+				res, err := ProcessFile(path, cfg)
+				if err != nil {
+					t.Fatalf("%+v %+v %s: %v", s, cfg, fixture.Name, err)
+				}
+				var out bytes.Buffer
+				res.WriteText(&out)
+				if out.String() != fixture.Expected {
+					t.Errorf("%+v %+v: %v", s, cfg, &testdata.Mismatch{Fixture: fixture.Name, Expected: fixture.Expected, Got: out.String()})
+				}
+				// rows with nulls come before every 100
+				if s.Optional && summary.Rows > 0 && summary.Malformed == 0 {
+					t.Errorf("%+v %s: no malformed rows counted for the nulls", s, fixture.Name)
+				}
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "m.parquet")
+	if err := os.WriteFile(path, testdata.Parquet([]byte("a;1.0\nb;-120.5\na;3.0\n"), testdata.ParquetShape{}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ProcessFile(path, Config{Format: FormatParquet, Strict: true}); !errors.Is(err, ErrMalformed) || err.Error() != "1 malformed lines" {
+		t.Errorf("Expected the reading out of range to be malformed, got %v", err)
+	}
+	if _, err := ProcessFile(path, Config{Strict: true}); err == nil {
+		t.Error("Expected an error reading Parquet as strict text")
+	}
+	if _, err := Process(strings.NewReader(""), Config{Format: FormatParquet}); err == nil {
+		t.Error("Expected an error for Parquet input to Process")
+	}
+}
+
+func TestAudit(t *testing.T) {
+	input := "a;1.0\nbb;2.0\n\nbad\nc;3.0\nd;-4.0"
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []Config{
+		{IO: IOMmap, Workers: 3},
+		{IO: IOStream, Workers: 2, BlockSize: 8},
+		{IO: IOMmap, Workers: 3, Aggregation: AggregateShared, Chaos: 3},
+	} {
+		cfg.Audit = new(Audit)
+		if _, err := ProcessFile(path, cfg); err != nil {
+			t.Fatalf("%+v: %v", cfg, err)
+		}
+		a := cfg.Audit
+		if a.Lines != 5 || a.Processed != 5 || a.End != int64(len(input)) || len(a.Segments) < 2 {
+			t.Errorf("Wrong audit for %+v: %+v", cfg, a)
+		}
+	}
+
+	// a chunk overlapping the next and one split inside a line
+	a := new(Audit)
+	data := []byte(input)
+	a.add(0, 0, data[:12])
+	a.add(1, 6, data[6:14])
+	a.add(2, 14, data[14:])
+	if err := a.check(0, int64(len(data)), countLines(data), 5); !errors.Is(err, ErrAudit) {
+		t.Errorf("Expected an audit error, got %v", err)
+	}
+	if _, err := Process(strings.NewReader(input), Config{Audit: a, LimitRows: 2}); err == nil {
+		t.Error("Audit with LimitRows did not fail")
+	}
+}
+
+func TestParseTenths(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected string
+	}{
+		{value: "-99.9", expected: "-999"},
+		{value: "-12.3", expected: "-123"},
+		{value: "-1.5", expected: "-15"},
+		{value: "0.0", expected: "0"},
+		{value: "0.3", expected: "3"},
+		{value: "12.3", expected: "123"},
+		{value: "99.9", expected: "999"},
+		{value: "", expected: "malformed"},
+		{value: "-", expected: "malformed"},
+		{value: "1", expected: "malformed"},
+		{value: "1.", expected: "malformed"},
+		{value: "123.4", expected: "malformed"},
+		{value: "1.23", expected: "malformed"},
+		{value: "a.b", expected: "malformed"},
+		{value: "+1.0", expected: "malformed"},
+		{value: " 1.0", expected: "malformed"},
+		{value: "a1.0", expected: "malformed"},
+		{value: "+12.3", expected: "malformed"},
+		{value: " 9.9", expected: "malformed"},
+	} {
+		got := "malformed"
+		if v, ok := parseTenths([]byte(tc.value)); ok {
+			got = fmt.Sprintf("%d", v)
+		}
+		if got != tc.expected {
+			t.Errorf("Wrong parsing of %q, expected: %s, got: %s", tc.value, tc.expected, got)
+		}
+
+		// decodeTenths reads a word past the newline
+		got = "malformed"
+		w := binary.LittleEndian.Uint64([]byte(tc.value + "\nAbha;1.0"))
+		if v, n, ok := decodeTenths(w); ok && n == len(tc.value) {
+			got = fmt.Sprintf("%d", v)
+		}
+		if got != tc.expected {
+			t.Errorf("Wrong decoding of %q, expected: %s, got: %s", tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestParseQuotedLine(t *testing.T) {
+	for _, tc := range []struct {
+		line     string
+		expected string
+	}{
+		{line: "Hamburg;12.0", expected: "Hamburg 120"},
+		{line: `"St. John;s";12.3`, expected: "St. John;s 123"},
+		{line: `"The ""Rock""";-9.1`, expected: `The "Rock" -91`},
+		{line: `""";";0.5`, expected: `"; 5`},
+		{line: `Abha;"1.0"`, expected: "Abha 10"},
+		{line: `"Abha";"-1.0"`, expected: "Abha -10"},
+		{line: `"";1.0`, expected: "malformed"},
+		{line: `"St. John;s;12.3`, expected: "malformed"},
+		{line: `"St. John"s;12.3`, expected: "malformed"},
+		{line: `"St. John;s"`, expected: "malformed"},
+		{line: `"a";"1.0`, expected: "malformed"},
+		{line: ";1.0", expected: "malformed"},
+	} {
+		var buf []byte
+		got := "malformed"
+		if name, v, ok := parseQuotedLine([]byte(tc.line), ';', &buf); ok {
+			got = fmt.Sprintf("%s %d", name, v)
+		}
+		if got != tc.expected {
+			t.Errorf("Wrong parsing of %q, expected: %s, got: %s", tc.line, tc.expected, got)
+		}
+	}
+
+	input := "\"St. John;s\";1.0\n\"a\"\"b\";2.0\nSt. John;3.0\n\"St. John;s\";-5.0\n\"broken;4.0\n"
+	for _, cfg := range []Config{{Format: FormatCSV}, {Format: FormatCSV, Workers: 3, BlockSize: 16, Map: MapSwiss}, {Format: FormatCSV, Aggregation: AggregateShared}, {Format: FormatCSV, Provenance: true}} {
+		summary := new(Summary)
+		cfg.Summary = summary
+		res, err := Process(strings.NewReader(input), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if expected := "{St. John=3.0/3.0/3.0, St. John;s=-5.0/-2.0/1.0, a\"b=2.0/2.0/2.0}\n"; out.String() != expected || summary.Malformed != 1 {
+			t.Errorf("%+v: expected %q and 1 malformed line, got %q and %d", cfg, expected, out.String(), summary.Malformed)
+		}
+	}
+	if _, err := NewConfig(WithFormat(FormatCSV), WithGroupBy(GroupBy{Column: 1})); err == nil {
+		t.Error("Expected an error for CSV input with GroupBy")
+	}
+}
+
+func TestParseJSONLine(t *testing.T) {
+	for _, tc := range []struct {
+		line     string
+		expected string
+	}{
+		{line: `{"station":"Oslo","temp":-3.2}`, expected: "Oslo -32"},
+		{line: ` { "temp" : 12.0 , "station" : "Abha" } `, expected: "Abha 120"},
+		{line: `{"station":"Oslo","temperature":7}`, expected: "Oslo 70"},
+		{line: `{"station":"Oslo","temp":-3.25}`, expected: "Oslo -33"},
+		{line: `{"station":"Oslo","temp":1e1}`, expected: "Oslo 100"},
+		{line: `{"ts":"2024-01-01T00:00:00Z","tags":{"a":[1,true,null,{"b":"}"}]},"station":"Oslo","temp":0.5,"ok":false}`, expected: "Oslo 5"},
+		{line: `{"station":"S\u00e3o \"Paulo\"\/\ud83c\udf21","temp":25.1}`, expected: `São "Paulo"/🌡 251`},
+		{line: `{"st\u0061tion":"x","station":"Oslo","temp":1.0}`, expected: "Oslo 10"},
+		{line: `{"station":"Oslo","temp":100.0}`, expected: "malformed"},
+		{line: `{"station":"Oslo","temp":"3.2"}`, expected: "malformed"},
+		{line: `{"station":"Oslo","temp":null}`, expected: "malformed"},
+		{line: `{"station":"Oslo"}`, expected: "malformed"},
+		{line: `{"station":"","temp":1.0}`, expected: "malformed"},
+		{line: `{"station":"a\nb","temp":1.0}`, expected: "malformed"},
+		{line: `{"station":"Oslo","temp":1.0`, expected: "malformed"},
+		{line: `{"station":"Oslo" "temp":1.0}`, expected: "malformed"},
+		{line: `{"station":"Oslo","temp":1.0} x`, expected: "malformed"},
+		{line: `["Oslo",1.0]`, expected: "malformed"},
+		{line: `Oslo;1.0`, expected: "malformed"},
+	} {
+		var buf []byte
+		got := "malformed"
+		if name, v, ok := parseJSONLine([]byte(tc.line), &buf); ok {
+			got = fmt.Sprintf("%s %d", name, v)
+		}
+		if got != tc.expected {
+			t.Errorf("Wrong parsing of %s, expected: %s, got: %s", tc.line, tc.expected, got)
+		}
+	}
+
+	input := `{"station":"Oslo","temp":-3.2}` + "\n" + `{"station":"Abha","temp":1.0}` + "\n\n" + `{"station":"Oslo","temp":` + "\n" + `{"station":"Oslo","temp":4.0}`
+	for _, cfg := range []Config{{Format: FormatJSONL}, {Format: FormatJSONL, IO: IOStream, Workers: 3, BlockSize: 16, Parse: ParseTwoStage}, {Format: FormatJSONL, Aggregation: AggregateShared, Strict: true}} {
+		res, err := Process(strings.NewReader(input), cfg)
+		if cfg.Strict {
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("%+v: expected a malformed line, got %v", cfg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if expected := "{Abha=1.0/1.0/1.0, Oslo=-3.2/0.4/4.0}\n"; out.String() != expected {
+			t.Errorf("%+v: expected %q, got %q", cfg, expected, out.String())
+		}
+	}
+}
+
+// kvDecoder decodes syslog-like records "station=<name> temp=<reading>".
+type kvDecoder struct{}
+
+func (kvDecoder) Decode(record []byte) ([]byte, int32, bool) {
+	station, temp, ok := bytes.Cut(record, []byte(" temp="))
+	if !ok || !bytes.HasPrefix(station, []byte("station=")) {
+		return nil, 0, false
+	}
+	tenths, ok := parseTenths(temp)
+	return station[len("station="):], tenths, ok
+}
+
+func TestRecordDecoder(t *testing.T) {
+	RegisterDecoder("test-kv", func(Config) RecordDecoder { return kvDecoder{} })
+	input := "# header\nstation=Oslo temp=-3.2\nstation= temp=1.0\nOslo;1.0\nstation=oslo temp=4.0\n"
+	for _, cfg := range []Config{
+		{Format: "test-kv", CommentPrefix: "#", Normalize: NormalizeFoldCase},
+		{Format: "test-kv", CommentPrefix: "#", Normalize: NormalizeFoldCase, IO: IOStream, Workers: 3, BlockSize: 16, Map: MapSwiss},
+	} {
+		summary := new(Summary)
+		cfg.Summary = summary
+		res, err := Process(strings.NewReader(input), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if expected := "{oslo=-3.2/0.4/4.0}\n"; out.String() != expected || summary.Malformed != 2 {
+			t.Errorf("%+v: expected %q and 2 malformed lines, got %q and %d", cfg, expected, out.String(), summary.Malformed)
+		}
+	}
+	if _, err := NewConfig(WithFormat("test-kv"), WithWindow(Window{Size: time.Hour})); err == nil {
+		t.Error("Expected an error for a registered format with Window")
+	}
+	for _, format := range []InputFormat{"test-kv", FormatCSV, FormatText, ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterDecoder of %q did not panic", format)
+				}
+			}()
+			RegisterDecoder(format, func(Config) RecordDecoder { return kvDecoder{} })
+		}()
+	}
+}
+
+func TestSplitShort(t *testing.T) {
+	if !arch.FastWords {
+		t.Skip("names are not split by words on this architecture")
+	}
+	for _, c := range []struct {
+		buf  string
+		n    int
+		name string
+	}{
+		{"Abha;-23.0\nBeirut;1.0\n", 10, "Abha"},
+		{"Petropavlovsk;1.0\n", 17, "Petropavlovsk"},
+		{"Lodwar;2.0\nx;1.0\n", 10, "Lodwar"},
+		{"Mogadishu1234567;1.0\n", 20, ""}, // too long
+		{";1.0\nAbha;-23.0\n", 4, ""},      // empty name
+		{"no semi\nAbha;1.0\n", 7, ""},     // semicolon of the next line
+		{"Abha;1.0\n", 8, ""},              // too close to the end
+	} {
+		name, w0, w1, ok := splitShort([]byte(c.buf), c.n)
+		if ok != (c.name != "") || string(name) != c.name {
+			t.Errorf("splitShort(%q) = %q, %v, expected %q", c.buf, name, ok, c.name)
+			continue
+		}
+		if e0, e1 := swiss.Words([]byte(c.name)); ok && (w0 != e0 || w1 != e1) {
+			t.Errorf("splitShort(%q) words %#x %#x, expected %#x %#x", c.buf, w0, w1, e0, e1)
+		}
+	}
+}
+
+func TestMalformedLinesAreSkipped(t *testing.T) {
+	input := "a;1.0\n\nno semicolon\n;2.0\nb;x\na;3.0"
+	for _, cfg := range []Config{{}, {Parse: ParseTwoStage}, {Map: MapSwiss}} {
+		res, err := Process(strings.NewReader(input), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if expected := "{a=1.0/2.0/3.0}\n"; out.String() != expected {
+			t.Errorf("%+v: expected %q, got %q", cfg, expected, out.String())
+		}
+	}
+
+	// strict runs decode the well-formed pairs and fail on the rest, signs
+	// other than '-' included
+	for _, io := range []IOBackend{IOMmap, IOStream} {
+		path := filepath.Join(t.TempDir(), "m.txt")
+		if err := os.WriteFile(path, []byte("a;1.0\nb;-12.5\n"+input+"\nc;+1.0\nc; 1.0\nc;a1.0\nb;99.9\na;1.0\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ProcessFile(path, Config{IO: io, Strict: true}); !errors.Is(err, ErrMalformed) || err.Error() != "6 malformed lines" {
+			t.Errorf("%s: expected 6 malformed lines, got %v", io, err)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	input := "a;1.0\nno semicolon\nb;2.0\na;3.0\n"
+	summary := new(Summary)
+	if _, err := Process(strings.NewReader(input), Config{Workers: 2, DisableGC: true, Summary: summary}); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Rows != 3 || summary.Malformed != 1 || summary.Stations != 2 || summary.Bytes != int64(len(input)) {
+		t.Errorf("Wrong totals: %+v", summary)
+	}
+	if len(summary.Phases) != 2 || summary.Phases[0].Name != "parse" || summary.Phases[1].Name != "merge" {
+		t.Errorf("Wrong phases: %+v", summary.Phases)
+	}
+	if !summary.GC.DisabledDuringParse || summary.GC.Cycles == 0 {
+		t.Errorf("Wrong GC stats: %+v", summary.GC)
+	}
+	if gcPercent() < 0 {
+		t.Errorf("GC left disabled")
+	}
+	if runtime.GOOS == "linux" && (summary.Usage.MaxRSS == 0 || summary.Phases[1].Usage.MaxRSS > summary.Usage.MaxRSS) {
+		t.Errorf("Wrong resource usage: %+v of the run, %+v of the merge", summary.Usage, summary.Phases[1].Usage)
+	}
+}
+
+func TestMaxThroughput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.txt")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("a;1.0\n"), 50000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 300KB at 1MB/s, less the burst of 100KB, take 200ms, of which the
+	// pacing may cut a block short
+	const least = 150 * time.Millisecond
+	for _, io := range []IOBackend{IOMmap, IOStream} {
+		start := time.Now()
+		res, err := ProcessFile(path, Config{IO: io, MaxThroughput: 1e6})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < least {
+			t.Errorf("%s: read 300KB in %v, expected at least %v", io, d, least)
+		}
+		if s, _ := res.Get("a"); s.Count != 50000 {
+			t.Errorf("%s: wrong count %d", io, s.Count)
+		}
+	}
+}
+
+func TestSimulatedStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.txt")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("a;1.0\n"), 50000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 300KB in reads of 64KB, each taking 20ms, which the parallel reads of
+	// the pipeline overlap, or of a 1MB block of mapped input
+	for io, least := range map[IOBackend]time.Duration{IOMmap: 20 * time.Millisecond, IOStream: 100 * time.Millisecond, IOPipeline: 20 * time.Millisecond} {
+		start := time.Now()
+		res, err := ProcessFile(path, Config{IO: io, Workers: 1, Readers: 5, BlockSize: 64 << 10, SimulateReadLatency: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < least {
+			t.Errorf("%s: read 300KB in %v, expected at least %v", io, d, least)
+		}
+		if s, _ := res.Get("a"); s.Count != 50000 {
+			t.Errorf("%s: wrong count %d", io, s.Count)
+		}
+	}
+	if err := (Config{SimulateBandwidth: 1e6, Readahead: 1 << 20}).Validate(); err == nil {
+		t.Error("Expected an error for Readahead with simulated storage")
+	}
+}
+
+func TestReadahead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.txt")
+	data := bytes.Repeat([]byte("a;1.0\nb;-2.0\n"), 300000)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// windows smaller than the blocks parsed, a page and larger than the chunks
+	for _, n := range []int64{64 << 10, 4096, 16 << 20} {
+		res, err := ProcessFile(path, Config{Workers: 3, IO: IOMmap, Readahead: n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, _ := res.Get("a"); a.Count != 300000 || res.Len() != 2 {
+			t.Errorf("readahead %d: wrong results %v", n, res)
+		}
+	}
+	if err := (Config{Readahead: -1}).Validate(); err == nil {
+		t.Error("Expected an error for a negative readahead")
+	}
+}
+
+// TestReadaheadStop runs many short mapped runs whose readahead may still
+// prefetch when the workers return, which would fault once the input is
+// unmapped unless stop waits for it.
+func TestReadaheadStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.txt")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("a;1.0\nb;-2.0\n"), 2<<20/13), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	runs := 500
+	if testing.Short() {
+		runs = 50
+	}
+	for range runs {
+		if _, err := ProcessFile(path, Config{Workers: 8, IO: IOMmap, Readahead: 64 << 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("\n")
+	for i := range 5000 {
+		fmt.Fprintf(&b, "station %d;%d.%d\n", i%37, i%100-50, i%10)
+		if i%1000 == 0 {
+			// longer than a block, and empty lines
+			fmt.Fprintf(&b, "%s;1.0\n\n\n", strings.Repeat("long", 100))
+		}
+	}
+	b.WriteString("last;2.0")
+	input := b.String()
+	path := filepath.Join(t.TempDir(), "m.txt")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := Process(strings.NewReader(input), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	expected.WriteText(&want)
+	for _, blockSize := range []int{100, 4096, 1 << 20} {
+		// the default, and sizes rounded up to a power of two
+		for ringSize, capacity := range map[int]int{0: 2, 1: 1, 3: 4} {
+			audit, summary := new(Audit), new(Summary)
+			res, err := ProcessFile(path, Config{IO: IOPipeline, Workers: 3, Readers: 2, RingSize: ringSize, BlockSize: blockSize, Audit: audit, Summary: summary})
+			if err != nil {
+				t.Fatalf("block size %d, ring size %d: %v", blockSize, ringSize, err)
+			}
+			var out bytes.Buffer
+			res.WriteText(&out)
+			if out.String() != want.String() {
+				t.Errorf("block size %d, ring size %d: results differ from streaming", blockSize, ringSize)
+			}
+			if p := summary.Pipeline; p.Rings != 3 || p.RingSize != capacity {
+				t.Errorf("ring size %d: pipeline %+v, want 3 rings of %d", ringSize, p, capacity)
+			}
+		}
+	}
+	if err := (Config{IO: IOPipeline, SkipHeader: 1}).Validate(); err == nil {
+		t.Error("Expected an error for IOPipeline with SkipHeader")
+	}
+	if err := (Config{Aggregation: AggregatePartitioned, Hooks: []Hook{DropOutside(-500, 500)}}).Validate(); err == nil {
+		t.Error("Expected an error for AggregatePartitioned with Hooks")
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	data := []byte(strings.Repeat("a;1.0\nb;-2.5\nbroken\n", 1000))
+	path := filepath.Join(t.TempDir(), "m.txt")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, agg := range []Aggregation{AggregatePerWorker, AggregateShared, AggregatePartitioned} {
+		mon := NewMonitor()
+		if _, err := ProcessFile(path, Config{Workers: 3, Aggregation: agg, Monitor: mon}); err != nil {
+			t.Fatal(err)
+		}
+		// the workers count their rows when done, the shared table is
+		// counted when polled
+		p := mon.Progress()
+		want := Progress{TotalBytes: int64(len(data)), Rows: 2000, Malformed: 1000}
+		if !counter.Enabled {
+			want.Rows, want.Malformed = 0, 0
+		}
+		if p.TotalBytes != want.TotalBytes || p.Rows != want.Rows || p.Malformed != want.Malformed || len(p.Workers) != 3 {
+			t.Errorf("%s: Progress = %+v, want %+v", agg, p, want)
+		}
+		if counter.Enabled && p.Bytes() != int64(len(data)) {
+			t.Errorf("%s: %d bytes processed of %d", agg, p.Bytes(), len(data))
+		}
+		var b bytes.Buffer
+		if err := mon.WriteMetrics(&b); err != nil || !strings.Contains(b.String(), fmt.Sprintf("\nonebrc_rows_total %d\n", want.Rows)) {
+			t.Errorf("%s: WriteMetrics = %q, %v", agg, b.String(), err)
+		}
+	}
+}
+
+func TestMlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.txt")
+	data := bytes.Repeat([]byte("a;1.0\n"), 1000)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	summary := new(Summary)
+	var log bytes.Buffer
+	res, err := ProcessFile(path, Config{IO: IOMmap, Mlock: true, Summary: summary, Logger: slog.New(slog.NewTextHandler(&log, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := res.Get("a"); a.Count != 1000 {
+		t.Errorf("Wrong count %d", a.Count)
+	}
+	// a locked memory limit too low for the input, or a platform without
+	// mlock, only warns
+	if warned := strings.Contains(log.String(), "input not locked in memory"); warned {
+		if summary.Locked != 0 {
+			t.Errorf("Locked %d bytes after warning %s", summary.Locked, log.String())
+		}
+		t.Skipf("the input was not locked: %s", log.String())
+	}
+	if summary.Locked != int64(len(data)) {
+		t.Errorf("Locked %d bytes of %d", summary.Locked, len(data))
+	}
+}
+
+func TestHugePages(t *testing.T) {
+	var b bytes.Buffer
+	for i := range 200000 {
+		fmt.Fprintf(&b, "s%d;%d.%d\n", i%150000, i%90-45, i%10)
+	}
+	res, err := Process(bytes.NewReader(b.Bytes()), Config{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected, out bytes.Buffer
+	res.WriteText(&expected)
+	// presized beyond a huge page and not, whose columns grow on the heap
+	for _, hint := range []int{150000, 100} {
+		summary := new(Summary)
+		res, err := Process(bytes.NewReader(b.Bytes()), Config{Workers: 2, HugePages: true, CardinalityHint: hint, Summary: summary})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		res.WriteText(&out)
+		if out.String() != expected.String() {
+			t.Errorf("hint %d: results differ on huge pages", hint)
+		}
+		if hint == 100 && summary.HugePages != 0 {
+			t.Errorf("hint %d: %d bytes on huge pages of tables too small for one", hint, summary.HugePages)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	// "Zu\u0308rich" is the decomposed spelling of "Zürich"
+	input := "Zürich;1.0\r\nZu\u0308rich ;2.0\nzürich;3.0 \n ;4.0\nZÜRICH;5.0\n"
+	for _, tc := range []struct {
+		normalize Normalize
+		expected  string
+	}{
+		{0, "{ =4.0/4.0/4.0, Zu\u0308rich =2.0/2.0/2.0, ZÜRICH=5.0/5.0/5.0}\n"},
+		{NormalizeTrim, "{Zu\u0308rich=2.0/2.0/2.0, ZÜRICH=5.0/5.0/5.0, Zürich=1.0/1.0/1.0, zürich=3.0/3.0/3.0}\n"},
+		{NormalizeTrim | NormalizeNFC, "{ZÜRICH=5.0/5.0/5.0, Zürich=1.0/1.5/2.0, zürich=3.0/3.0/3.0}\n"},
+		{NormalizeTrim | NormalizeNFC | NormalizeFoldCase, "{zürich=1.0/2.8/5.0}\n"},
+	} {
+		res, err := Process(strings.NewReader(input), Config{Normalize: tc.normalize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if out.String() != tc.expected {
+			t.Errorf("Wrong output for normalization %d, expected %q, got %q", tc.normalize, tc.expected, out.String())
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	input := "Hamburg;12.0\nHH;60.0\nHH;-3.5\nBulawayo;8.9\nBulawayo;-70.0\nno semicolon\nSkip;1.0\n"
+	hooks := []Hook{
+		DropOutside(-500, 500),
+		Rename(map[string]string{"HH": "Hamburg", "Bulawayo": ""}),
+		Filter(func(station []byte, _ int32) bool { return string(station) != "Skip" }),
+	}
+	for _, cfg := range []Config{
+		{Hooks: hooks},
+		{Hooks: hooks, IO: IOStream, Workers: 3, BlockSize: 16, Parse: ParseTwoStage},
+		{Hooks: hooks, Aggregation: AggregateShared},
+		{Hooks: hooks, GroupBy: GroupBy{Column: 1}},
+	} {
+		data := input
+		if cfg.GroupBy.Column > 0 {
+			data = strings.ReplaceAll(input, ";", ";k;")
+		}
+		summary := new(Summary)
+		cfg.Summary = summary
+		res, err := Process(strings.NewReader(data), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		expected := "{Hamburg=-3.5/4.3/12.0}\n"
+		if cfg.GroupBy.Column > 0 {
+			expected = "{Hamburg;k=-3.5/4.3/12.0}\n"
+		}
+		if out.String() != expected || summary.Malformed != 1 || summary.Rows != 2 {
+			t.Errorf("%+v: expected %q with 2 rows and 1 malformed line, got %q with %d and %d", cfg, expected, out.String(), summary.Rows, summary.Malformed)
+		}
+	}
+	if _, err := NewConfig(WithHooks(hooks...), WithAudit(new(Audit))); err == nil {
+		t.Error("Expected an error for Hooks with Audit")
+	}
+	// no hooks are no hooks, whether the slice is nil or empty
+	empty := Config{Hooks: []Hook{}, Audit: new(Audit)}
+	if err := empty.Validate(); err != nil {
+		t.Errorf("Validate with empty Hooks: %v", err)
+	}
+	if empty.Audit = nil; !empty.cacheable() || (Config{Hooks: hooks}).cacheable() {
+		t.Error("cacheable differs for nil and empty Hooks")
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	d := NewDictionary()
+	for _, cfg := range []Config{{Dictionary: d}, {Dictionary: d, IO: IOStream, Workers: 3, BlockSize: 16, Map: MapSwiss}} {
+		res, err := Process(strings.NewReader("Oslo;1.0\nBern;2.0\nOslo;3.0\n"), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if expected := "{Bern=2.0/2.0/2.0, Oslo=1.0/2.0/3.0}\n"; out.String() != expected {
+			t.Errorf("%+v: expected %q, got %q", cfg, expected, out.String())
+		}
+	}
+	if names := d.Names(); len(names) != 2 {
+		t.Fatalf("Expected the 2 stations in the dictionary, got %q", names)
+	}
+	oslo, _ := d.ID("Oslo")
+
+	var b bytes.Buffer
+	if err := d.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadDictionary(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Process(strings.NewReader("Rome;5.0\nOslo;4.0\n"), Config{Dictionary: loaded, Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.WriteText(&out)
+	if expected := "{Oslo=4.0/4.0/4.0, Rome=5.0/5.0/5.0}\n"; out.String() != expected {
+		t.Errorf("Expected %q with a loaded dictionary, got %q", expected, out.String())
+	}
+	if id, ok := loaded.ID("Oslo"); !ok || id != oslo {
+		t.Errorf("Expected the ID %d of Oslo to stay, got %d, %v", oslo, id, ok)
+	}
+	if id, ok := loaded.ID("Rome"); !ok || id != 2 || loaded.Len() != 3 {
+		t.Errorf("Expected Rome to be added as ID 2, got %d, %v of %d", id, ok, loaded.Len())
+	}
+
+	out.Reset()
+	if err := res.WriteIDTable(&out, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("id;min;mean;max;count\n%d;4.0;4.0;4.0;1\n2;5.0;5.0;5.0;1\n", oslo); out.String() != expected {
+		t.Errorf("Expected the table by ID %q, got %q", expected, out.String())
+	}
+	if err := res.WriteIDTable(io.Discard, d); err == nil {
+		t.Error("Expected an error writing a station without an ID")
+	}
+	out.Reset()
+	if err := res.WriteIDJSON(&out, loaded); err != nil {
+		t.Fatal(err)
+	}
+	var rows []idJSON
+	if err := json.Unmarshal(out.Bytes(), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []idJSON{{oslo, 4, 4, 4, 1}, {2, 5, 5, 5, 1}}; !slices.Equal(rows, expected) {
+		t.Errorf("Expected the JSON by ID %+v, got %s", expected, out.String())
+	}
+	if err := res.WriteIDJSON(io.Discard, d); err == nil {
+		t.Error("Expected an error writing a station without an ID as JSON")
+	}
+	b.Reset()
+	if err := loaded.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	if fromCSV, err := ReadDictionary(bytes.NewReader(b.Bytes())); err != nil || !slices.Equal(fromCSV.Names(), loaded.Names()) {
+		t.Errorf("Expected the CSV form %q to read back, got %v", b.String(), err)
+	}
+
+	duplicate := append([]byte("1BRD\x01\x02"), "\x04Oslo\x04Oslo"...)
+	for name, data := range map[string][]byte{"magic": []byte("1BRC\x01\x00"), "truncated": append([]byte("1BRD\x01\x02"), "\x04Oslo\x04Ro"...), "duplicate": duplicate, "CSV order": []byte("id,station\n1,Oslo\n")} {
+		if _, err := ReadDictionary(bytes.NewReader(data)); err == nil {
+			t.Errorf("Expected an error reading a dictionary with a bad %s", name)
+		}
+	}
+	if err := (Config{Dictionary: d, Aggregation: AggregateShared}).Validate(); err == nil {
+		t.Error("Expected an error for Dictionary with AggregateShared")
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, lines int, line func(i int) string) string {
+		var b strings.Builder
+		for i := range lines {
+			b.WriteString(line(i))
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	small := write("small.txt", 100, func(i int) string { return fmt.Sprintf("s%d;1.0\n", i%7) })
+	repeated := write("repeated.txt", 600_000, func(i int) string { return fmt.Sprintf("s%03d;1.0\n", i%1000) })
+	unique := write("unique.txt", 500_000, func(i int) string { return fmt.Sprintf("u%07d;1.0\n", i) })
+
+	for _, tt := range []struct {
+		path     string
+		stations int
+		exact    bool
+	}{{small, 7, true}, {repeated, 1000, false}, {unique, 500_000, false}} {
+		e, err := EstimateMemory(tt.path, Config{Workers: 4, IO: IOMmap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Exact != tt.exact || math.Abs(float64(e.Stations-tt.stations)) > float64(tt.stations)/100 {
+			t.Errorf("%s: estimated %d stations, exact %v, expected %d, %v", filepath.Base(tt.path), e.Stations, e.Exact, tt.stations, tt.exact)
+		}
+		fi, _ := os.Stat(tt.path)
+		if e.Mapped != fi.Size() || e.Buffers != 0 || e.Tables < 4*int64(e.Stations) || e.Heap() != e.Tables+e.Interner+e.Merge {
+			t.Errorf("%s: unexpected estimate %+v", filepath.Base(tt.path), e)
+		}
+	}
+
+	plain, err := EstimateMemory(repeated, Config{Workers: 4, IO: IOStream, BlockSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.Mapped != 0 || plain.Buffers != 9<<20 {
+		t.Errorf("Expected 9 blocks of 1MB in flight and nothing mapped, got %+v", plain)
+	}
+	hinted, err := EstimateMemory(repeated, Config{Workers: 4, IO: IOStream, BlockSize: 1 << 20, CardinalityHint: 5000, Percentiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the batches of partitions grow with the workers, not their square
+	var partitioned [2]MemoryEstimate
+	for i, workers := range []int{8, 64} {
+		if partitioned[i], err = EstimateMemory(repeated, Config{Workers: workers, IO: IOMmap, Aggregation: AggregatePartitioned}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if partitioned[0].Buffers == 0 || partitioned[1].Buffers > 8*partitioned[0].Buffers {
+		t.Errorf("Expected buffers linear in the workers, got %d for 8 and %d for 64", partitioned[0].Buffers, partitioned[1].Buffers)
+	}
+	if hinted.Stations != 5000 || hinted.Tables <= 5*plain.Tables {
+		t.Errorf("Expected the hint and larger tables with Percentiles, got %+v and %+v without", hinted, plain)
+	}
+	if _, err := EstimateMemory(filepath.Join(dir, "missing.txt"), Config{}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist for a missing file, got %v", err)
+	}
+}
+
+func TestKeyColumn(t *testing.T) {
+	input := "1;Hamburg;12.0\n2;Springfield;1.0\n3;Springfield;3.0\n1;Hamburg;-4.0\n4;Oslo;2.0\n;Nowhere;1.0\n5;Bergen\n"
+	for _, cfg := range []Config{{KeyColumn: 1}, {KeyColumn: 1, IO: IOStream, Workers: 3, BlockSize: 16, Map: MapSwiss}} {
+		res, err := Process(strings.NewReader(input), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if expected := "{1=-4.0/4.0/12.0, 2=1.0/1.0/1.0, 3=3.0/3.0/3.0, 4=2.0/2.0/2.0}\n"; out.String() != expected {
+			t.Errorf("%+v: expected %q, got %q", cfg, expected, out.String())
+		}
+
+		relabeled, unlabeled := res.Relabel(map[string]string{"1": "Hamburg", "2": "Springfield", "3": "Springfield", "9": "Unused"})
+		out.Reset()
+		relabeled.WriteText(&out)
+		if expected := "{4=2.0/2.0/2.0, Hamburg=-4.0/4.0/12.0, Springfield (2)=1.0/1.0/1.0, Springfield (3)=3.0/3.0/3.0}\n"; out.String() != expected || !slices.Equal(unlabeled, []string{"4"}) {
+			t.Errorf("Wrong relabeling, expected %q and [4] unlabeled, got %q and %v", expected, out.String(), unlabeled)
+		}
+	}
+
+	res, err := Process(strings.NewReader(input), Config{KeyColumn: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := res.Names(); !slices.Equal(names, []string{"Hamburg", "Nowhere", "Oslo", "Springfield"}) {
+		t.Errorf("Wrong stations by the second column: %v", names)
+	}
+	if _, err := NewConfig(WithKeyColumn(1), WithGroupBy(GroupBy{Column: 1})); err == nil {
+		t.Error("Expected an error for KeyColumn with GroupBy")
+	}
+}
+
+func TestRelabelExtras(t *testing.T) {
+	// Oslo is unlabeled and the label of 2, so the two are merged
+	input := "1;x;12.0\n1;x;-4.0\n1;x;12.0\n2;y;1.0\nOslo;z;3.0\n"
+	res, err := Process(strings.NewReader(input), Config{KeyColumn: 1, Distinct: true, Moments: true, Percentiles: true, Frequencies: true, Provenance: true, SamplePerStation: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	relabeled, _ := res.Relabel(map[string]string{"1": "Hamburg", "2": "Oslo"})
+	for _, tt := range []struct {
+		name             string
+		distinct         int
+		minLine, maxLine int64
+	}{
+		{"Hamburg", 2, 2, 1},
+		{"Oslo", 2, 4, 5},
+	} {
+		if n, ok := relabeled.Distinct(tt.name); !ok || n != tt.distinct {
+			t.Errorf("%s: %d distinct readings, %v", tt.name, n, ok)
+		}
+		if _, ok := relabeled.StdDev(tt.name); !ok {
+			t.Errorf("%s: no standard deviation", tt.name)
+		}
+		if _, ok := relabeled.Percentile(tt.name, 0.5); !ok {
+			t.Errorf("%s: no percentiles", tt.name)
+		}
+		if samples, ok := relabeled.Samples(tt.name); !ok || len(samples) != int(relabeled.stations.get(tt.name).Count) {
+			t.Errorf("%s: samples %v, %v", tt.name, samples, ok)
+		}
+		if e, ok := relabeled.Extremes(tt.name); !ok || e.MinLine != tt.minLine || e.MaxLine != tt.maxLine {
+			t.Errorf("%s: extremes %+v, %v", tt.name, e, ok)
+		}
+	}
+	if n, ok := relabeled.Frequency("Hamburg", 120); !ok || n != 2 {
+		t.Errorf("Hamburg read 12.0 %d times, %v", n, ok)
+	}
+	if _, ok := relabeled.Distinct("1"); ok {
+		t.Error("the distinct readings of 1 stayed under its key")
+	}
+}
+
+func TestASCII(t *testing.T) {
+	for name, expected := range map[string]string{
+		"São Paulo":    "Sao Paulo",
+		"Zürich":       "Zurich",
+		"Tromsø":       "Tromso",
+		"Düsseldorf":   "Dusseldorf",
+		"Łódź":         "Lodz",
+		"Straße":       "Strasse",
+		"Ad Dīwānīyah": "Ad Diwaniyah",
+		"Al Jahrā’":    "Al Jahra'",
+		"東京":           "??",
+		"plain":        "plain",
+	} {
+		if got := ASCII(name); got != expected {
+			t.Errorf("ASCII(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+
+	res, err := Process(strings.NewReader("São Paulo;1.0\nSao Paulo;3.0\nZürich;2.0\n"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	folded, collisions := res.FoldASCII()
+	var out bytes.Buffer
+	folded.WriteText(&out)
+	if expected := "{Sao Paulo=1.0/2.0/3.0, Zurich=2.0/2.0/2.0}\n"; out.String() != expected {
+		t.Errorf("Wrong folded results, expected %q, got %q", expected, out.String())
+	}
+	if expected := [][]string{{"Sao Paulo", "São Paulo"}}; !reflect.DeepEqual(collisions, expected) {
+		t.Errorf("Wrong collisions %q, expected %q", collisions, expected)
+	}
+}
+
+func TestCollation(t *testing.T) {
+	res, err := Process(strings.NewReader("Zürich;1.0\nZulu;2.0\nｂ;3.0\n😀;4.0\nÎle;5.0\nIvry;6.0\n"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c, expected := range map[Collation][]string{
+		"":             {"Ivry", "Zulu", "Zürich", "Île", "ｂ", "😀"},
+		CollateBytes:   {"Ivry", "Zulu", "Zürich", "Île", "ｂ", "😀"},
+		CollateJava:    {"Ivry", "Zulu", "Zürich", "Île", "😀", "ｂ"},
+		CollateUnicode: {"😀", "ｂ", "Île", "Ivry", "Zulu", "Zürich"},
+	} {
+		if err := res.SetCollation(c); err != nil {
+			t.Fatal(err)
+		}
+		if names := res.Names(); !slices.Equal(names, expected) {
+			t.Errorf("Names with collation %q = %q, expected %q", c, names, expected)
+		}
+	}
+	if err := res.SetCollation("klingon"); err == nil {
+		t.Error("Unknown collation accepted")
+	}
+}
+
+func TestHeaderAndComments(t *testing.T) {
+	input := "station;temperature\n# exported 2024-01-01\na;1.0\n#b;9.0\nb;2.0\na;3.0\n"
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, io := range []IOBackend{IOMmap, IOStream} {
+		summary := new(Summary)
+		res, err := ProcessFile(path, Config{IO: io, SkipHeader: 1, CommentPrefix: "#", Summary: summary})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if expected := "{a=1.0/2.0/3.0, b=2.0/2.0/2.0}\n"; out.String() != expected {
+			t.Errorf("Wrong output for %s, expected %q, got %q", io, expected, out.String())
+		}
+		if summary.Malformed != 0 {
+			t.Errorf("Wrong malformed count for %s: %d", io, summary.Malformed)
+		}
+	}
+}
+
+func TestByteRangesPartitionInput(t *testing.T) {
+	input := "a;1.0\nbb;2.0\nccc;3.0\na;4.0\nbb;5.0\n"
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expected := "{a=1.0/2.5/4.0, bb=2.0/3.5/5.0, ccc=3.0/3.0/3.0}\n"
+	for _, io := range []IOBackend{IOMmap, IOStream} {
+		// any split point must count every line exactly once
+		for split := int64(0); split <= int64(len(input)); split++ {
+			first, err := ProcessFile(path, Config{IO: io, RangeEnd: split})
+			if split == 0 {
+				first, err = NewResult(), nil
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := ProcessFile(path, Config{IO: io, RangeStart: split})
+			if err != nil {
+				t.Fatal(err)
+			}
+			first.merge(second)
+			var out bytes.Buffer
+			first.WriteText(&out)
+			if out.String() != expected {
+				t.Errorf("Wrong output for %s split at %d, expected %q, got %q", io, split, expected, out.String())
+			}
+		}
+
+		res, err := ProcessFile(path, Config{IO: io, RangeStart: 7, LimitRows: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if expected := "{a=4.0/4.0/4.0, ccc=3.0/3.0/3.0}\n"; out.String() != expected {
+			t.Errorf("Wrong output for %s with row limit, expected %q, got %q", io, expected, out.String())
+		}
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	input := "station;temperature\na;1.0\nb;2.0\na;-3.0\n# c\na;5.0\nb;2.0\na;5.0\n"
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []Config{
+		{IO: IOMmap},
+		{IO: IOMmap, Workers: 4},
+		{IO: IOStream, Workers: 3, BlockSize: 16},
+	} {
+		cfg.Provenance, cfg.SkipHeader, cfg.CommentPrefix = true, 1, "#"
+		res, err := ProcessFile(path, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteExtremes(&out)
+		expected := "station;min;min_line;min_offset;max;max_line;max_offset\n" +
+			"a;-3.0;4;32;5.0;6;43\n" +
+			"b;2.0;3;26;2.0;3;26\n"
+		if out.String() != expected {
+			t.Errorf("Wrong extremes for %+v, expected:\n%s\ngot:\n%s", cfg, expected, out.String())
+		}
+
+		// lines count from the range start, offsets from the input start
+		cfg.RangeStart = 33
+		res, err = ProcessFile(path, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, _ := res.Extremes("b"); e != (Extremes{MinOffset: 49, MaxOffset: 49, MinLine: 3, MaxLine: 3}) {
+			t.Errorf("Wrong extremes of b for %+v: %+v", cfg, e)
+		}
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	input := "a;1.0\na;1.0\nb;-99.9\na;-1.0\nb;99.9\na;1.0\nb;-99.9\n"
+	for _, cfg := range []Config{
+		{Distinct: true},
+		{Distinct: true, Workers: 3, BlockSize: 16},
+	} {
+		res, err := Process(strings.NewReader(input), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteDistinct(&out)
+		if expected := "station;count;distinct\na;4;2\nb;3;2\n"; out.String() != expected {
+			t.Errorf("Wrong distinct counts for %+v, expected %q, got %q", cfg, expected, out.String())
+		}
+	}
+}
+
+func TestSharedAggregation(t *testing.T) {
+	input := "a;x;1.0\nbb;y;2.0\na;x;4.0\na;y;-2.0\nbb;y;5.0\n"
+	cfg := Config{Workers: 3, BlockSize: 8, Aggregation: AggregateShared, GroupBy: GroupBy{Column: 1}}
+	res, err := Process(strings.NewReader(input), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.WriteText(&out)
+	if expected := "{a;x=1.0/2.5/4.0, a;y=-2.0/-2.0/-2.0, bb;y=2.0/3.5/5.0}\n"; out.String() != expected {
+		t.Errorf("Wrong output, expected %q, got %q", expected, out.String())
+	}
+
+	cfg.Distinct = true
+	if _, err := Process(strings.NewReader(input), cfg); err == nil {
+		t.Error("shared aggregation with Distinct did not fail")
+	}
+	if _, err := Process(strings.NewReader(input), Config{Aggregation: "global"}); err == nil {
+		t.Error("unknown aggregation did not fail")
+	}
+}
+
+func TestAnomalies(t *testing.T) {
+	var b strings.Builder
+	for i := range 50 {
+		fmt.Fprintf(&b, "a;1%d.0\nb;%d.5\n", i%10, i%2)
+	}
+	b.WriteString("a;99.9\nc;5.0\nc;5.0\n")
+	for _, cfg := range []Config{
+		{Moments: true},
+		{Moments: true, Workers: 3, BlockSize: 16},
+	} {
+		res, err := Process(strings.NewReader(b.String()), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sd, ok := res.StdDev("c"); !ok || sd != 0 {
+			t.Errorf("Wrong stddev of constant readings for %+v: %v, %v", cfg, sd, ok)
+		}
+		if sd, _ := res.StdDev("b"); math.Abs(sd-0.5) > 1e-9 {
+			t.Errorf("Wrong stddev of b for %+v: %v", cfg, sd)
+		}
+		var out bytes.Buffer
+		res.WriteAnomalies(&out, 4)
+		expected := "station;count;mean;stddev;min;max;min_sigmas;max_sigmas\n" +
+			"a;51;16.2;12.18;10.0;99.9;0.5;6.9\n"
+		if out.String() != expected {
+			t.Errorf("Wrong anomalies for %+v, expected:\n%s\ngot:\n%s", cfg, expected, out.String())
+		}
+	}
+	res, err := Process(strings.NewReader("a;1.0\n"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := res.StdDev("a"); ok || res.Anomalies(1) != nil {
+		t.Error("StdDev available without Config.Moments")
+	}
+}
+
+func TestAtomicStats(t *testing.T) {
+	var s atomicStats
+	var expected Stats
+	var wg sync.WaitGroup
+	for w := range 4 {
+		for i := range 20000 {
+			expected.add(int32((i*7+w)%1999 - 999))
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 20000 {
+				s.add(int32((i*7+w)%1999 - 999))
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		if st := s.load(); st.Count > 0 && (st.Min > st.Max || st.Sum < int64(st.Min)*st.Count || st.Sum > int64(st.Max)*st.Count) {
+			t.Fatalf("Inconsistent snapshot %+v", st)
+		}
+	}
+	if st := s.load(); st != expected {
+		t.Errorf("Wrong stats, expected %+v, got %+v", expected, st)
+	}
+
+	// the reading reaching spillCount moves the packed sum and count
+	s = atomicStats{}
+	s.add(-5)
+	sum := int64(-2)
+	s.sumCount.Add(uint64(sum)<<countBits + spillCount - 2)
+	s.add(3)
+	if st, expected := s.load(), (Stats{Min: -5, Max: 3, Sum: -4, Count: spillCount}); st != expected || s.sumCount.Load() != 0 {
+		t.Errorf("Wrong stats after spill, expected %+v, got %+v and packed %#x", expected, st, s.sumCount.Load())
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var input strings.Builder
+	for i := 1000; i > 0; i-- {
+		fmt.Fprintf(&input, "a;%.1f\nb;%.1f\n", float64(i%100)/10, float64(-i%10))
+	}
+	for _, cfg := range []Config{
+		{Percentiles: true},
+		{Percentiles: true, Workers: 3, BlockSize: 1024},
+	} {
+		res, err := Process(strings.NewReader(input.String()), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range []struct {
+			name     string
+			p        float64
+			expected float64
+		}{
+			{"a", 50, 5.0},
+			{"a", 90, 9.0},
+			{"a", 99, 9.9},
+			{"b", 50, -4.5},
+		} {
+			if got, _ := res.Percentile(tc.name, tc.p); got < tc.expected-0.15 || got > tc.expected+0.15 {
+				t.Errorf("Wrong p%v of %s for %+v: expected about %.1f, got %.2f", tc.p, tc.name, cfg, tc.expected, got)
+			}
+		}
+	}
+}
+
+func TestFrequencies(t *testing.T) {
+	input := "a;1.0\na;-99.9\nb;2.0\na;1.0\na;99.9\na;3.0\n"
+	for _, cfg := range []Config{
+		{Frequencies: true},
+		{Frequencies: true, Workers: 3, BlockSize: 16},
+	} {
+		res, err := Process(strings.NewReader(input), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteFrequencies(&out)
+		expected := "station;temperature;count\n" +
+			"a;-99.9;1\na;1.0;2\na;3.0;1\na;99.9;1\n" +
+			"b;2.0;1\n"
+		if out.String() != expected {
+			t.Errorf("Wrong frequencies for %+v, expected:\n%s\ngot:\n%s", cfg, expected, out.String())
+		}
+		for _, tc := range []struct{ p, expected float64 }{{0, -99.9}, {40, 1.0}, {50, 1.0}, {70, 3.0}, {100, 99.9}} {
+			if got, _ := res.Percentile("a", tc.p); got != tc.expected {
+				t.Errorf("Wrong p%v for %+v: expected %.1f, got %.1f", tc.p, cfg, tc.expected, got)
+			}
+		}
+	}
+}
+
+func TestSamplePerStation(t *testing.T) {
+	var input strings.Builder
+	for i := range 10000 {
+		fmt.Fprintf(&input, "a;%d.0\nb;-1.0\n", i%2)
+	}
+	for _, cfg := range []Config{
+		{SamplePerStation: 100},
+		{SamplePerStation: 100, Workers: 3, BlockSize: 1024},
+	} {
+		res, err := Process(strings.NewReader(input.String()), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, _ := res.Samples("a")
+		if len(a) != 100 {
+			t.Fatalf("Wrong sample size %d", len(a))
+		}
+		// half the readings of a are 1.0, far outside 20..80 is unlikely
+		ones := 0
+		for _, v := range a {
+			if v == 1.0 {
+				ones++
+			}
+		}
+		if ones < 20 || ones > 80 {
+			t.Errorf("Sample of a for %+v not uniform: %d of 100 readings are 1.0", cfg, ones)
+		}
+		if b, _ := res.Samples("b"); len(b) != 100 || b[0] != -1.0 {
+			t.Errorf("Wrong sample of b for %+v: %v", cfg, b)
+		}
+	}
+
+	res, err := Process(strings.NewReader("a;1.0\na;2.0\n"), Config{SamplePerStation: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.WriteSamples(&out)
+	var decoded samplesJSON
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Stations) != 1 || decoded.Stations[0].Count != 2 || len(decoded.Stations[0].Samples) != 2 {
+		t.Errorf("Wrong samples JSON: %s", out.String())
+	}
+}
+
+func TestIterators(t *testing.T) {
+	res, err := Process(strings.NewReader("c;3.0\na;1.0\nb;-2.0\na;3.0\n"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []string
+	for name := range res.All() {
+		all = append(all, name)
+	}
+	if len(all) != 3 {
+		t.Errorf("Wrong stations from All: %v", all)
+	}
+
+	var sorted []string
+	for name, s := range res.Sorted() {
+		sorted = append(sorted, name+"="+s.String())
+	}
+	if s := strings.Join(sorted, " "); s != "a=1.0/2.0/3.0 b=-2.0/-2.0/-2.0 c=3.0/3.0/3.0" {
+		t.Errorf("Wrong stations from Sorted: %s", s)
+	}
+
+	var warm []string
+	for name := range res.Filter(func(_ string, s Stats) bool { return s.Max > 0 }) {
+		warm = append(warm, name)
+		break
+	}
+	if strings.Join(warm, " ") != "a" {
+		t.Errorf("Wrong stations from Filter: %v", warm)
+	}
+}
+
+func TestScan(t *testing.T) {
+	input := "a;1.0\nbad\nb;-2.5\n\nlong station name;99.9"
+	var got []string
+	err := Scan(iotest.OneByteReader(strings.NewReader(input)), func(station []byte, tenths int32) bool {
+		got = append(got, fmt.Sprintf("%s=%d", station, tenths))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.Join(got, " "); s != "a=10 b=-25 long station name=999" {
+		t.Errorf("Wrong records: %s", s)
+	}
+
+	n := 0
+	Scan(strings.NewReader(input), func([]byte, int32) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Scan went on after fn returned false: %d calls", n)
+	}
+
+	if err := Scan(iotest.ErrReader(io.ErrClosedPipe), func([]byte, int32) bool { return true }); err != io.ErrClosedPipe {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+// hotReadings counts readings above 30.0 as a custom Accumulator.
+type hotReadings struct{ n int }
+
+func (h *hotReadings) Observe(tenths int32) {
+	if tenths > 300 {
+		h.n++
+	}
+}
+
+func (h *hotReadings) Merge(other Accumulator) { h.n += other.(*hotReadings).n }
+
+func (h *hotReadings) Result() any { return h.n }
+
+func TestAccumulator(t *testing.T) {
+	input := "a;31.0\na;12.0\nb;45.0\na;30.1\nb;-45.0\n"
+	for _, cfg := range []Config{
+		{},
+		{Workers: 3, BlockSize: 16},
+		{Window: Window{Size: time.Hour}},
+	} {
+		cfg.NewAccumulator = func() Accumulator { return new(hotReadings) }
+		if cfg.Window.Size > 0 {
+			input = strings.ReplaceAll(input, ";", ";2024-03-01T10:00:00Z;")
+		}
+		res, err := Process(strings.NewReader(input), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for name := range res.Sorted() {
+			n, _ := res.Accumulated(name)
+			got = append(got, fmt.Sprintf("%s=%v", name, n))
+		}
+		expected := "a=2 b=1"
+		if cfg.Window.Size > 0 {
+			expected = "a;2024-03-01T10:00:00Z=2 b;2024-03-01T10:00:00Z=1"
+		}
+		if s := strings.Join(got, " "); s != expected {
+			t.Errorf("Wrong accumulated values for %+v: %s", cfg, s)
+		}
+	}
+}
+
+func TestWriteResultsJSON(t *testing.T) {
+	res, err := Process(strings.NewReader("b;-1.5\na;1.0\na;2.5\n"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := res.WriteResultsJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	var stations []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &stations); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]any{
+		{"name": "a", "min": 1.0, "mean": 1.8, "max": 2.5, "count": 2.0},
+		{"name": "b", "min": -1.5, "mean": -1.5, "max": -1.5, "count": 1.0},
+	}
+	if !reflect.DeepEqual(stations, expected) {
+		t.Errorf("Wrong results JSON %s", out.String())
+	}
+}
+
+func TestMerge(t *testing.T) {
+	days := []string{"a;1.0\nb;-2.5\n", "a;3.0\nc;0.5\n", "", "b;9.9\na;-1.0\n"}
+	merged, err := Process(strings.NewReader(""), Config{Distinct: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range days {
+		res, err := Process(strings.NewReader(day), Config{Distinct: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := merged.Merge(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	whole, err := Process(strings.NewReader(strings.Join(days, "")), Config{Distinct: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, expected bytes.Buffer
+	merged.WriteText(&got)
+	whole.WriteText(&expected)
+	if got.String() != expected.String() {
+		t.Errorf("Wrong merged results, expected %s, got %s", expected.String(), got.String())
+	}
+	got.Reset()
+	merged.WriteDistinct(&got)
+	if e := "station;count;distinct\na;3;3\nb;2;2\nc;1;1\n"; got.String() != e {
+		t.Errorf("Wrong merged distinct counts, expected %q, got %q", e, got.String())
+	}
+
+	// an empty side is taken as is, an overflow leaves the Result unchanged
+	s := Stats{}
+	if err := s.Merge(Stats{Min: -5, Max: 7, Sum: 2, Count: 2}); err != nil || s != (Stats{Min: -5, Max: 7, Sum: 2, Count: 2}) {
+		t.Errorf("Merge into empty Stats gave %+v, %v", s, err)
+	}
+	if err := s.Merge(Stats{}); err != nil || s.Count != 2 {
+		t.Errorf("Merge of empty Stats gave %+v, %v", s, err)
+	}
+	for _, c := range []struct{ s, o Stats }{
+		{Stats{Min: 1, Max: 1, Sum: 1, Count: 1}, Stats{Min: 1, Max: 1, Sum: math.MaxInt64, Count: 1}},
+		{Stats{Min: -1, Max: -1, Sum: -1, Count: 1}, Stats{Min: -1, Max: -1, Sum: math.MinInt64, Count: 1}},
+		{Stats{Min: 1, Max: 1, Sum: 1, Count: 1}, Stats{Min: 0, Max: 0, Sum: 0, Count: math.MaxInt64}},
+	} {
+		big := NewResult()
+		big.Add("a", c.s)
+		before, _ := big.Get("a")
+		other := NewResult()
+		other.Add("b", Stats{Min: 0, Max: 0, Sum: 0, Count: 1})
+		other.Add("a", c.o)
+		if err := big.Merge(other); !errors.Is(err, ErrOverflow) {
+			t.Errorf("Merge of %+v returned %v, expected ErrOverflow", c.o, err)
+		}
+		if after, _ := big.Get("a"); after != before || big.Len() != 1 {
+			t.Errorf("Failed Merge of %+v changed the Result to %+v", c.o, after)
+		}
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	cfg, err := NewConfig(WithWorkers(3), WithIOBackend(IOStream), WithBlockSize(16), WithDelimiter(','), WithStats(Extended))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Process(strings.NewReader("a,1.0\nb;2.0\na,3.0\n"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.WriteText(&out)
+	if expected := "{a=1.0/2.0/3.0}\n"; out.String() != expected {
+		t.Errorf("Wrong output with delimiter ',', expected %q, got %q", expected, out.String())
+	}
+	if n, _ := res.Distinct("a"); n != 2 {
+		t.Errorf("Wrong distinct count with Extended stats: %d", n)
+	}
+
+	for _, opts := range [][]Option{
+		{WithIOBackend("tape")},
+		{WithFormat("avro")},
+		{WithFormat(FormatParquet), WithSkipHeader(1)},
+		{WithWorkers(-1)},
+		{WithDelimiter('.')},
+		{WithGroupBy(GroupBy{Column: 1}), WithWindow(Window{Size: time.Hour})},
+	} {
+		if _, err := NewConfig(opts...); err == nil {
+			t.Errorf("Expected an error for %d options", len(opts))
+		}
+	}
+}
+
+func TestReports(t *testing.T) {
+	res, err := Process(strings.NewReader("b|c;-1.5\na;1.0\na;2.5\na;-0.1\n"), Config{Frequencies: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.WriteMarkdown(&out)
+	expected := "| Station | Min | Mean | Max | Count |\n|---|---:|---:|---:|---:|\n" +
+		"| a | -0.1 | 1.1 | 2.5 | 3 |\n" +
+		"| b\\|c | -1.5 | -1.5 | -1.5 | 1 |\n"
+	if out.String() != expected {
+		t.Errorf("Wrong markdown, expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := res.WriteHTML(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<p>2 stations, 4 readings, min -1.5, mean 0.5, max 2.5</p>",
+		`<tr><td>a</td><td class="n">-0.1</td><td class="n">1.1</td><td class="n">2.5</td><td class="n">3</td><td data-histogram="0,0,0,0,0,0,0,0,0,1,2,0,0,0,0,0,0,0,0,0">`,
+		"<td>b|c</td>",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("HTML report lacks %s:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	res, err := Process(strings.NewReader("b;-1.5\na;1.0\na;2.5\n"), Config{Distinct: true, Moments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := res.WriteXLSX(&out); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("xl/worksheets/sheet2.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sheet, _ := io.ReadAll(f)
+	for _, cell := range []string{
+		`<c r="F1" t="inlineStr"><is><t xml:space="preserve">Distinct</t></is></c><c r="G1" t="inlineStr"><is><t xml:space="preserve">StdDev</t></is></c>`,
+		`<c r="B2"><v>1</v></c><c r="C2"><v>1.8</v></c><c r="D2"><v>2.5</v></c><c r="E2"><v>2</v></c><c r="F2"><v>2</v></c><c r="G2"><v>0.75</v></c>`,
+	} {
+		if !strings.Contains(string(sheet), cell) {
+			t.Errorf("Stations sheet lacks %s:\n%s", cell, sheet)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package brc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// number and size of the content samples hashed into the cache key,
+	// spread evenly over the file including its first and last bytes
+	cacheSamples    = 16
+	cacheSampleSize = 4096
+)
+
+// cacheKey identifies the content of f by size, modification time and a hash
+// of sampled content without reading the whole file, together with the
+// settings of cfg that change the result.
+func cacheKey(f *os.File, cfg Config) (string, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, int64(partialVersion))
+	binary.Write(h, binary.LittleEndian, fi.Size())
+	binary.Write(h, binary.LittleEndian, fi.ModTime().UnixNano())
+	fmt.Fprintf(h, "%d:%d:%d:%d:%q:%d:%d:%d:%d:%d:%t", cfg.RangeStart, cfg.RangeEnd, cfg.LimitRows, cfg.SkipHeader, cfg.CommentPrefix, cfg.Normalize, cfg.GroupBy.Column, cfg.GroupBy.Prefix, cfg.Window.Size, cfg.Window.column(), cfg.Strict)
+	if cfg.KeyColumn > 0 {
+		fmt.Fprintf(h, ":key%d", cfg.KeyColumn)
+	}
+	if d := cfg.delimiter(); d != ';' {
+		fmt.Fprintf(h, ":delim%d", d)
+	}
+	if cfg.Format != "" && cfg.Format != FormatText {
+		// text keeps the keys it had before formats
+		fmt.Fprintf(h, ":%s", cfg.Format)
+	}
+
+	size := fi.Size()
+	step := max(size/(cacheSamples-1), cacheSampleSize)
+	buf := make([]byte, cacheSampleSize)
+	for offset := int64(0); offset < size; offset += step {
+		off := min(offset, max(size-cacheSampleSize, 0))
+		n, err := f.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		h.Write(buf[:n])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachePath returns the cache file in cfg.CacheDir for the input file at
+// path.
+func cachePath(path string, cfg Config) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	key, err := cacheKey(f, cfg)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cfg.CacheDir, key+".1brc"), nil
+}
+
+// processCached returns the cached aggregate of the file at path or processes
+// it and stores the aggregate in cfg.CacheDir.
+func processCached(ctx context.Context, path string, cfg Config) (*Result, error) {
+	cached, err := cachePath(path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	log := cfg.logger().With("cache", cached)
+	if res, ok := loadCached(cached); ok {
+		log.Info("cache hit")
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache_hit", true))
+		if cfg.Summary != nil {
+			cfg.Summary.Cached = true
+			cfg.Summary.fill(res, nil, 0, 0, 0)
+		}
+		return res, nil
+	}
+	log.Debug("cache miss")
+
+	res, err := processFile(ctx, path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// a failing cache must not fail the run, the next run simply misses again
+	if err := storeCached(cached, res); err != nil {
+		log.Warn("failed to store cache entry", "err", err)
+	}
+	return res, nil
+}
+
+// loadCached returns the cached aggregate at path, if there is a valid one.
+func loadCached(path string) (*Result, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	res := NewResult()
+	if err := res.Read(f); err != nil {
+		return nil, false
+	}
+	return res, true
+}
+
+// storeCached writes res to path atomically, so concurrent runs never see a
+// partially written cache entry.
+func storeCached(path string, res *Result) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := res.Write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
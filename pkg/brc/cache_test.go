@@ -0,0 +1,101 @@
+package brc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "measurements.txt")
+	if err := os.WriteFile(input, []byte("a;1.0\nb;2.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{CacheDir: filepath.Join(dir, "cache")}
+
+	if _, err := ProcessFile(input, cfg); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(cfg.CacheDir)
+	if len(entries) != 1 {
+		t.Fatalf("expected one cache entry, got %d", len(entries))
+	}
+
+	// a cache hit must not touch the input, so corrupt the entry to tell
+	// whether it was served from the cache
+	cached := NewResult()
+	cached.mergeStats("cached", Stats{Min: 1, Max: 1, Sum: 1, Count: 1})
+	if err := storeCached(filepath.Join(cfg.CacheDir, entries[0].Name()), cached); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ProcessFile(input, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := res.Get("cached"); !ok {
+		t.Errorf("expected result served from cache, got %v", res.Names())
+	}
+
+	if err := os.WriteFile(input, []byte("a;1.0\nc;3.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res, err = ProcessFile(input, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := res.Get("c"); !ok {
+		t.Errorf("expected changed file to miss the cache, got %v", res.Names())
+	}
+}
+
+func TestCacheSimulatedStorage(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "measurements.txt")
+	if err := os.WriteFile(input, []byte("a;1.0\nb;2.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []Config{
+		{SimulateReadLatency: time.Millisecond},
+		{SimulateBandwidth: 100 << 20},
+	} {
+		cfg.CacheDir = filepath.Join(dir, "cache")
+		if _, err := ProcessFile(input, cfg); err != nil {
+			t.Fatal(err)
+		}
+		if entries, _ := os.ReadDir(cfg.CacheDir); len(entries) != 0 {
+			t.Errorf("%v latency, %d bandwidth: cached %d entries", cfg.SimulateReadLatency, cfg.SimulateBandwidth, len(entries))
+		}
+	}
+}
+
+func TestCacheDelimiter(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "measurements.txt")
+	if err := os.WriteFile(input, []byte("a;1.0\nb,2.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	semicolon := Config{CacheDir: filepath.Join(dir, "cache")}
+	comma := semicolon
+	comma.Delimiter = ','
+	for _, tc := range []struct {
+		cfg      Config
+		expected string
+	}{
+		{semicolon, "a"},
+		{comma, "b"},
+		{semicolon, "a"},
+	} {
+		res, err := ProcessFile(input, tc.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := res.Names(); len(names) != 1 || names[0] != tc.expected {
+			t.Errorf("delimiter %q: expected %s, got %v", tc.cfg.delimiter(), tc.expected, names)
+		}
+	}
+	if entries, _ := os.ReadDir(semicolon.CacheDir); len(entries) != 2 {
+		t.Errorf("expected a cache entry per delimiter, got %d", len(entries))
+	}
+}
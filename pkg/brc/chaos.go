@@ -0,0 +1,51 @@
+package brc
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"time"
+)
+
+// chaosMaxDelay is the longest pause Config.Chaos injects.
+const chaosMaxDelay = 200 * time.Microsecond
+
+// chaos perturbs a goroutine of a run with Config.Chaos: it cuts chunks,
+// blocks and reads at random sizes, which land anywhere in a line or a UTF-8
+// sequence, and pauses or yields at random. Each goroutine draws from a
+// stream of its own, so the same seed makes the same cuts. A nil chaos does
+// nothing.
+type chaos struct {
+	rng *rand.Rand
+}
+
+// newChaos returns the chaos of the goroutine numbered stream, nil if
+// Config.Chaos is 0.
+func (c Config) newChaos(stream int) *chaos {
+	if c.Chaos == 0 {
+		return nil
+	}
+	return &chaos{rand.New(rand.NewPCG(c.Chaos, uint64(stream)))}
+}
+
+// size returns n, or with chaos a random size from 1 to n.
+func (c *chaos) size(n int) int {
+	if c == nil || n <= 1 {
+		return n
+	}
+	return 1 + c.rng.IntN(n)
+}
+
+// pause yields the processor half the time with chaos, and once in 64
+// sleeps up to chaosMaxDelay, so that the goroutines interleave in ways the
+// scheduler rarely picks. Sleeps are rare as timers round them up.
+func (c *chaos) pause() {
+	if c == nil {
+		return
+	}
+	switch n := c.rng.IntN(64); {
+	case n == 0:
+		time.Sleep(time.Duration(c.rng.Int64N(int64(chaosMaxDelay))))
+	case n <= 32:
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,97 @@
+package brc
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation selects the order of the names of Results.
+type Collation string
+
+const (
+	// CollateBytes orders names by their UTF-8 bytes, which is code point
+	// order. It is the default.
+	CollateBytes Collation = "bytes"
+	// CollateJava orders names by their UTF-16 code units like Java's
+	// String.compareTo, and so the TreeMap of the official baseline. It
+	// differs from CollateBytes where a name has a rune beyond U+FFFF, e.g.
+	// an emoji, in the place another has one of U+E000 to U+FFFF.
+	CollateJava Collation = "java"
+	// CollateUnicode orders names by the Unicode Collation Algorithm with
+	// the root locale, so e.g. "Île" sorts with the other names starting
+	// with I rather than after Z.
+	CollateUnicode Collation = "unicode"
+)
+
+// SetCollation sets the order of Names, and so of Sorted and the written
+// results, to c. Names still sort by station first and then key, and names
+// c considers equal by their bytes.
+func (r *Result) SetCollation(c Collation) error {
+	switch c {
+	case "", CollateBytes, CollateJava, CollateUnicode:
+	default:
+		return fmt.Errorf("unknown collation %q", c)
+	}
+	r.collation = c
+	return nil
+}
+
+// comparer returns the comparison of names in the order of c, of grouped
+// names by station and then key, which is not safe for concurrent use with
+// CollateUnicode.
+func (c Collation) comparer(grouped bool) func(a, b string) int {
+	var compare func(a, b string) int
+	switch c {
+	case CollateJava:
+		compare = compareUTF16
+	case CollateUnicode:
+		compare = collate.New(language.Und).CompareString
+	default:
+		compare = strings.Compare
+	}
+	return func(a, b string) int {
+		as, ak, bs, bk := a, "", b, ""
+		if grouped {
+			as, ak = SplitName(a)
+			bs, bk = SplitName(b)
+		}
+		if n := compare(as, bs); n != 0 {
+			return n
+		}
+		if n := strings.Compare(as, bs); n != 0 {
+			return n
+		}
+		if n := compare(ak, bk); n != 0 {
+			return n
+		}
+		return strings.Compare(ak, bk)
+	}
+}
+
+// compareUTF16 compares a and b by their UTF-16 code units.
+func compareUTF16(a, b string) int {
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			return cmp.Compare(utf16Key(ra), utf16Key(rb))
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// utf16Key returns a key of r that sorts like its UTF-16 code units: the
+// first, the high surrogate for runes beyond U+FFFF, shifted left by 10 bits
+// to make room for the 10 bits of the low surrogate.
+func utf16Key(r rune) rune {
+	if r < 0x10000 {
+		return r << 10
+	}
+	return (0xD800+(r-0x10000)>>10)<<10 | (r-0x10000)&0x3FF
+}
@@ -0,0 +1,68 @@
+package brc
+
+import "bytes"
+
+// parseQuotedLine is parseLine for FormatCSV: either field may be quoted as
+// in RFC 4180, so that quoted names can hold the delimiter, a quote being
+// written twice inside them, e.g. "St. John;s";12.3 or "The ""Rock""";9.1.
+// Quoted fields cannot span lines. buf holds names that had doubled quotes,
+// the name is only valid until the next call with it.
+func parseQuotedLine(line []byte, delim byte, buf *[]byte) (name []byte, tenths int32, ok bool) {
+	name, rest, ok := cutField(line, delim, buf)
+	if !ok || len(name) == 0 || rest == nil {
+		return nil, 0, false
+	}
+	// a quoted reading cannot have doubled quotes nor a delimiter
+	if len(rest) >= 2 && rest[0] == '"' && rest[len(rest)-1] == '"' {
+		rest = rest[1 : len(rest)-1]
+	}
+	tenths, ok = parseTenths(rest)
+	return name, tenths, ok
+}
+
+// cutField returns the first field of line, unquoted, and what follows the
+// delimiter after it, nil if none does.
+func cutField(line []byte, delim byte, buf *[]byte) (field, rest []byte, ok bool) {
+	if len(line) == 0 || line[0] != '"' {
+		field, rest, found := bytes.Cut(line, []byte{delim})
+		if !found {
+			rest = nil
+		}
+		return field, rest, true
+	}
+	// the common case of no doubled quotes needs no copy
+	end := bytes.IndexByte(line[1:], '"') + 1
+	if end == 0 {
+		return nil, nil, false
+	}
+	if end+1 == len(line) || line[end+1] != '"' {
+		return afterQuote(line[1:end], line[end+1:], delim)
+	}
+	*buf = (*buf)[:0]
+	s := line[1:]
+	for {
+		q := bytes.IndexByte(s, '"')
+		if q < 0 {
+			return nil, nil, false
+		}
+		*buf = append(*buf, s[:q]...)
+		if q+1 < len(s) && s[q+1] == '"' {
+			*buf = append(*buf, '"')
+			s = s[q+2:]
+			continue
+		}
+		return afterQuote(*buf, s[q+1:], delim)
+	}
+}
+
+// afterQuote returns the quoted field and what follows it, which must be
+// the delimiter or nothing.
+func afterQuote(field, after []byte, delim byte) ([]byte, []byte, bool) {
+	switch {
+	case len(after) == 0:
+		return field, nil, true
+	case after[0] == delim:
+		return field, after[1:], true
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,82 @@
+package brc
+
+import (
+	"fmt"
+	"sync"
+)
+
+// RecordDecoder decodes the records of an input format other than
+// FormatText, one per line, selected by Config.Format. The chunking,
+// options such as SkipHeader and Normalize, and the aggregation stay those
+// of text, so a format such as syslog lines only needs to be decoded, see
+// RegisterDecoder. Each worker has a decoder of its own, which needs no
+// locking.
+type RecordDecoder interface {
+	// Decode returns the station and the reading in tenths of a degree of
+	// record, a line without its newline, or ok false for a malformed
+	// record. The station must not be empty and is only valid until the
+	// next call.
+	Decode(record []byte) (station []byte, tenths int32, ok bool)
+}
+
+// decoders are the registered record decoders by format.
+var decoders = struct {
+	sync.RWMutex
+	m map[InputFormat]func(Config) RecordDecoder
+}{m: map[InputFormat]func(Config) RecordDecoder{
+	FormatCSV:   func(c Config) RecordDecoder { return &csvDecoder{delim: c.delimiter()} },
+	FormatJSONL: func(Config) RecordDecoder { return &jsonDecoder{} },
+}}
+
+// RegisterDecoder makes newDecoder create the record decoders of each
+// worker for input format, usually from an init function:
+//
+//	brc.RegisterDecoder("syslog", func(cfg brc.Config) brc.RecordDecoder { return new(syslogDecoder) })
+//
+// newDecoder receives the Config of the run for settings such as Delimiter.
+// RegisterDecoder panics if format is empty or already registered, text
+// and parquet included.
+func RegisterDecoder(format InputFormat, newDecoder func(Config) RecordDecoder) {
+	decoders.Lock()
+	defer decoders.Unlock()
+	if _, dup := decoders.m[format]; dup || format == "" || format == FormatText || format == FormatParquet || newDecoder == nil {
+		panic(fmt.Sprintf("brc: RegisterDecoder of format %q twice, empty or nil", format))
+	}
+	decoders.m[format] = newDecoder
+}
+
+// lookupDecoder returns the constructor of the record decoders of format.
+func lookupDecoder(format InputFormat) (func(Config) RecordDecoder, bool) {
+	decoders.RLock()
+	defer decoders.RUnlock()
+	newDecoder, ok := decoders.m[format]
+	return newDecoder, ok
+}
+
+// newDecoder returns a record decoder of c.Format, nil for the formats that
+// have none.
+func (c Config) newDecoder() RecordDecoder {
+	if newDecoder, ok := lookupDecoder(c.Format); ok {
+		return newDecoder(c)
+	}
+	return nil
+}
+
+// csvDecoder is the RecordDecoder of FormatCSV.
+type csvDecoder struct {
+	delim byte
+	buf   []byte
+}
+
+func (d *csvDecoder) Decode(record []byte) ([]byte, int32, bool) {
+	return parseQuotedLine(record, d.delim, &d.buf)
+}
+
+// jsonDecoder is the RecordDecoder of FormatJSONL.
+type jsonDecoder struct {
+	buf []byte
+}
+
+func (d *jsonDecoder) Decode(record []byte) ([]byte, int32, bool) {
+	return parseJSONLine(record, &d.buf)
+}
@@ -0,0 +1,244 @@
+package brc
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Dictionary assigns the station names of runs dense IDs, in the order they
+// are first seen. As Config.Dictionary, it replaces the dictionary the
+// per-worker tables of a run share, so that they start presized with the
+// stations of earlier runs in place and add the new ones after them. The IDs
+// stay the same from run to run, for joins across runs. It is safe for
+// concurrent use.
+//
+// Binary layout, integers varint encoded (encoding/binary):
+//
+//	magic   "1BRD"
+//	version uvarint
+//	count   uvarint, number of stations
+//	count times, by ID:
+//	  name  uvarint length + bytes
+//
+// The CSV form of WriteCSV, for the systems joining on the IDs, is
+// recognized by ReadDictionary as well.
+type Dictionary struct {
+	dict *dictionary
+}
+
+const (
+	dictionaryMagic   = "1BRD"
+	dictionaryVersion = 1
+)
+
+// NewDictionary returns an empty Dictionary.
+func NewDictionary() *Dictionary {
+	return &Dictionary{dict: newDictionary(0)}
+}
+
+// Len returns the number of stations of d.
+func (d *Dictionary) Len() int {
+	d.dict.mu.Lock()
+	defer d.dict.mu.Unlock()
+	return len(d.dict.names)
+}
+
+// ID returns the ID of station name, false if d has none for it.
+func (d *Dictionary) ID(name string) (int, bool) {
+	d.dict.mu.Lock()
+	defer d.dict.mu.Unlock()
+	id, ok := d.dict.ids[name]
+	return int(id), ok
+}
+
+// Names returns the stations of d by ID.
+func (d *Dictionary) Names() []string {
+	d.dict.mu.Lock()
+	defer d.dict.mu.Unlock()
+	return d.dict.names[:len(d.dict.names):len(d.dict.names)]
+}
+
+// Write encodes d in its binary layout.
+func (d *Dictionary) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+
+	names := d.Names()
+	bw.WriteString(dictionaryMagic)
+	putUvarint(dictionaryVersion)
+	putUvarint(uint64(len(names)))
+	for _, name := range names {
+		putUvarint(uint64(len(name)))
+		bw.WriteString(name)
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes d as "id,station" rows by ID after that header.
+func (d *Dictionary) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "station"})
+	for id, name := range d.Names() {
+		cw.Write([]string{strconv.Itoa(id), name})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadDictionary decodes a Dictionary that Write or WriteCSV encoded.
+func ReadDictionary(rd io.Reader) (*Dictionary, error) {
+	br := bufio.NewReader(rd)
+	if first, err := br.Peek(len(dictionaryMagic)); err == nil && string(first) != dictionaryMagic {
+		return readDictionaryCSV(br)
+	}
+	magic := make([]byte, len(dictionaryMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, fmt.Errorf("read dictionary: %w", err)
+	}
+	if string(magic) != dictionaryMagic {
+		return nil, errors.New("read dictionary: bad magic")
+	}
+	v, err := binary.ReadUvarint(br)
+	if err == nil && v != dictionaryVersion {
+		return nil, fmt.Errorf("read dictionary: unsupported version %d", v)
+	}
+	var n uint64
+	if err == nil {
+		n, err = binary.ReadUvarint(br)
+	}
+	d := NewDictionary()
+	for i := uint64(0); i < n && err == nil; i++ {
+		var nameLen uint64
+		if nameLen, err = binary.ReadUvarint(br); err != nil {
+			break
+		}
+		if nameLen > maxPartialNameLen {
+			return nil, fmt.Errorf("read dictionary: station name too long: %d", nameLen)
+		}
+		name := make([]byte, nameLen)
+		if _, err = io.ReadFull(br, name); err != nil {
+			break
+		}
+		if _, ok := d.dict.ids[string(name)]; ok {
+			return nil, fmt.Errorf("read dictionary: station %q listed twice", name)
+		}
+		d.dict.id(string(name), len(d.dict.names))
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("read dictionary: %w", err)
+	}
+	return d, nil
+}
+
+func readDictionaryCSV(r io.Reader) (*Dictionary, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read dictionary: %w", err)
+	}
+	if header[0] != "id" || header[1] != "station" {
+		return nil, errors.New("read dictionary: bad magic or CSV header")
+	}
+	d := NewDictionary()
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return d, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read dictionary: %w", err)
+		}
+		// IDs are dense, so a row's ID is its position
+		if record[0] != strconv.Itoa(len(d.dict.names)) {
+			return nil, fmt.Errorf("read dictionary: ID %s out of order, expected %d", record[0], len(d.dict.names))
+		}
+		if _, ok := d.dict.ids[record[1]]; ok {
+			return nil, fmt.Errorf("read dictionary: station %q listed twice", record[1])
+		}
+		d.dict.id(record[1], len(d.dict.names))
+	}
+}
+
+// idStation is a station of a Result by its Dictionary ID.
+type idStation struct {
+	id    int
+	stats Stats
+}
+
+// byID returns the stations of r by their IDs in d, all of which must have
+// one.
+func (r *Result) byID(d *Dictionary) ([]idStation, error) {
+	stations := make([]idStation, 0, r.stations.len())
+	for name, s := range r.All() {
+		id, ok := d.ID(name)
+		if !ok {
+			return nil, fmt.Errorf("station %q has no ID in the dictionary", name)
+		}
+		stations = append(stations, idStation{id, s})
+	}
+	slices.SortFunc(stations, func(a, b idStation) int { return cmp.Compare(a.id, b.id) })
+	return stations, nil
+}
+
+// WriteIDTable writes the results of r as "id;min;mean;max;count" rows by
+// the IDs of d instead of the names, see WriteTable, for joins on the IDs
+// of d written with it.
+func (r *Result) WriteIDTable(w io.Writer, d *Dictionary) error {
+	stations, err := r.byID(d)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("id;min;mean;max;count\n")
+	for _, st := range stations {
+		bw.WriteString(strconv.Itoa(st.id))
+		bw.WriteByte(';')
+		bw.WriteString(strings.ReplaceAll(st.stats.String(), "/", ";"))
+		bw.WriteByte(';')
+		bw.WriteString(strconv.FormatInt(st.stats.Count, 10))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// idJSON is a station of the results in JSON by its ID.
+type idJSON struct {
+	ID    int     `json:"id"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+// WriteIDJSON is WriteResultsJSON with the ID of each station in d instead
+// of its name, by ID.
+func (r *Result) WriteIDJSON(w io.Writer, d *Dictionary) error {
+	stations, err := r.byID(d)
+	if err != nil {
+		return err
+	}
+	rows := make([]idJSON, 0, len(stations))
+	for _, st := range stations {
+		s := st.stats
+		rows = append(rows, idJSON{st.id, float64(s.Min) / 10, s.Mean(), float64(s.Max) / 10, s.Count})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rows)
+}
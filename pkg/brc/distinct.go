@@ -0,0 +1,75 @@
+package brc
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+	"strconv"
+)
+
+// distinctSet is a bitmap of the readings of a station. Valid readings are
+// the 1999 tenths from -99.9 to 99.9, so 250 bytes cover them all.
+type distinctSet [(2*999 + 1 + 7) / 8]byte
+
+func (d *distinctSet) add(tenths int32) {
+	i := tenths + 999
+	d[i/8] |= 1 << (i % 8)
+}
+
+func (d *distinctSet) merge(o *distinctSet) {
+	for i := range d {
+		d[i] |= o[i]
+	}
+}
+
+func (d *distinctSet) len() int {
+	n := 0
+	for _, b := range d {
+		n += bits.OnesCount8(b)
+	}
+	return n
+}
+
+// Distinct returns the number of distinct readings of station name, e.g. to
+// spot stuck sensors repeating a value. It is only available for results of
+// a run with Config.Distinct.
+func (r *Result) Distinct(name string) (int, bool) {
+	d, ok := r.distinct[name]
+	if !ok {
+		return 0, false
+	}
+	return d.len(), true
+}
+
+// markDistinct records a reading of station name.
+func (r *Result) markDistinct(name []byte, tenths int32) {
+	d, ok := r.distinct[string(name)]
+	if !ok {
+		d = new(distinctSet)
+		r.distinct[string(name)] = d
+	}
+	d.add(tenths)
+}
+
+// WriteDistinct writes the number of readings and distinct readings of each
+// station as semicolon separated rows with a header:
+//
+//	station;count;distinct
+//	Abha;1204;873
+func (r *Result) WriteDistinct(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("station;count;distinct\n")
+	for _, name := range r.Names() {
+		d := r.distinct[name]
+		if d == nil {
+			continue
+		}
+		bw.WriteString(name)
+		bw.WriteByte(';')
+		bw.WriteString(strconv.FormatInt(r.stations.get(name).Count, 10))
+		bw.WriteByte(';')
+		bw.WriteString(strconv.Itoa(d.len()))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
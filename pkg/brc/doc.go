@@ -0,0 +1,8 @@
+// Package brc aggregates One Billion Row Challenge measurement files.
+//
+// Input lines have the form "<station>;<temperature>\n" where the temperature
+// has exactly one fractional digit. Readings are aggregated per station in
+// integer tenths by parallel workers and merged into a single Result, which
+// can be printed in the official format or exchanged between processes as a
+// partial aggregate.
+package brc
@@ -0,0 +1,55 @@
+package brc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// InputFormat selects how ProcessFile decodes the input.
+type InputFormat string
+
+const (
+	// FormatText reads "name;reading" lines.
+	FormatText InputFormat = "text"
+	// FormatCSV reads lines whose fields may be quoted, so that station
+	// names can hold the delimiter, see parseQuotedLine. Like every format
+	// with a RecordDecoder, it takes every line through the per-line
+	// options and is slower than FormatText.
+	FormatCSV InputFormat = "csv"
+	// FormatJSONL reads JSON Lines of objects with a station string and a
+	// temp or temperature number, e.g. {"station":"Oslo","temp":-3.2}, as
+	// log pipelines export them, see parseJSONLine.
+	FormatJSONL InputFormat = "jsonl"
+	// FormatParquet reads a Parquet file with a string column of station
+	// names and a numeric column of readings, named station and temperature
+	// or else the first of each type. Its row groups are decoded by the
+	// workers in parallel.
+	FormatParquet InputFormat = "parquet"
+)
+
+// validateFormat checks the settings of the input format of c.
+func (c Config) validateFormat() error {
+	switch c.Format {
+	case "", FormatText:
+		return nil
+	case FormatParquet:
+	default:
+		if _, ok := lookupDecoder(c.Format); !ok {
+			return fmt.Errorf("unknown input format %q", c.Format)
+		}
+		// records have no fields to group by, the names of other formats
+		// may have the delimiter that grouped names are joined with
+		if c.GroupBy.Column > 0 || c.Window.Size > 0 {
+			return fmt.Errorf("%s input cannot be combined with GroupBy or Window", c.Format)
+		}
+		return nil
+	}
+	// the settings of lines and byte ranges of text
+	if c.SkipHeader > 0 || c.RangeStart > 0 || c.RangeEnd > 0 || c.LimitRows > 0 || c.CommentPrefix != "" || c.delimiter() != ';' {
+		return errors.New("Parquet input cannot be combined with SkipHeader, RangeStart, RangeEnd, LimitRows, CommentPrefix or Delimiter")
+	}
+	if c.GroupBy.Column > 0 || c.Window.Size > 0 || c.Provenance || c.Audit != nil {
+		return errors.New("Parquet input cannot be combined with GroupBy, Window, Provenance or Audit")
+	}
+	return nil
+}
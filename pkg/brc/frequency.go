@@ -0,0 +1,80 @@
+package brc
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+)
+
+// frequencies counts the readings of a station per value, indexed by tenths
+// plus 999.
+type frequencies [2*999 + 1]uint32
+
+func (f *frequencies) merge(o *frequencies) {
+	for i, n := range o {
+		f[i] += n
+	}
+}
+
+// percentile returns the nearest rank p-th percentile in tenths of the count
+// readings in f.
+func (f *frequencies) percentile(p float64, count int64) int32 {
+	rank := int64(math.Ceil(p / 100 * float64(count)))
+	rank = min(max(rank, 1), count)
+	var seen int64
+	for i, n := range f {
+		if seen += int64(n); seen >= rank {
+			return int32(i) - 999
+		}
+	}
+	return 999
+}
+
+// countReading records a reading of station name.
+func (r *Result) countReading(name []byte, tenths int32) {
+	f, ok := r.freqs[string(name)]
+	if !ok {
+		f = new(frequencies)
+		r.freqs[string(name)] = f
+	}
+	f[tenths+999]++
+}
+
+// Frequency returns how often station name read tenths. It is only
+// available for results of a run with Config.Frequencies.
+func (r *Result) Frequency(name string, tenths int32) (uint32, bool) {
+	f, ok := r.freqs[name]
+	if !ok || tenths < -999 || tenths > 999 {
+		return 0, false
+	}
+	return f[tenths+999], true
+}
+
+// WriteFrequencies writes the frequency table of each station, one row per
+// value read, as semicolon separated rows with a header:
+//
+//	station;temperature;count
+//	Abha;-23.0;2
+func (r *Result) WriteFrequencies(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("station;temperature;count\n")
+	for _, name := range r.Names() {
+		f := r.freqs[name]
+		if f == nil {
+			continue
+		}
+		for i, n := range f {
+			if n == 0 {
+				continue
+			}
+			bw.WriteString(name)
+			bw.WriteByte(';')
+			bw.WriteString(strconv.FormatFloat(float64(i-999)/10, 'f', 1, 64))
+			bw.WriteByte(';')
+			bw.WriteString(strconv.FormatUint(uint64(n), 10))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
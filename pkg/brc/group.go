@@ -0,0 +1,100 @@
+package brc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GroupBy adds a second grouping key taken from a column between the station
+// and the temperature, for lines like "station;2024-03-01T12:00:00;12.3",
+// producing station×key stats. Results are keyed by "station;key", see
+// Result.Split; the station of a grouped name ends at its first semicolon.
+type GroupBy struct {
+	// Column is the field holding the key, 1 for the first field after the
+	// station. The temperature is always the last field. 0 disables
+	// grouping.
+	Column int
+	// Prefix, if positive, keeps only the first Prefix bytes of the field,
+	// e.g. 10 for the date of an ISO 8601 timestamp.
+	Prefix int
+}
+
+// parseGroupedLine splits a line "station;f1;...;fn;temperature", with delim
+// between the fields, into the station, the key field of g and the
+// temperature in tenths.
+func parseGroupedLine(line []byte, g GroupBy, delim byte) (name, key []byte, tenths int32, ok bool) {
+	semi := bytes.IndexByte(line, delim)
+	last := bytes.LastIndexByte(line, delim)
+	if semi <= 0 || last == semi {
+		return nil, nil, 0, false
+	}
+
+	fields := line[semi+1 : last]
+	for i := 1; ; i++ {
+		field, rest, more := bytes.Cut(fields, []byte{delim})
+		if i == g.Column {
+			key = field
+			break
+		}
+		if !more {
+			return nil, nil, 0, false
+		}
+		fields = rest
+	}
+	if g.Prefix > 0 && len(key) > g.Prefix {
+		key = key[:g.Prefix]
+	}
+
+	tenths, ok = parseTenths(line[last+1:])
+	return line[:semi], key, tenths, ok
+}
+
+// SplitName splits a name of a grouped Result into station and key at its
+// first semicolon. key is empty for names without one. The names of
+// ungrouped results may have semicolons of their own, e.g. quoted CSV
+// fields, so split those of a Result with Result.Split.
+func SplitName(name string) (station, key string) {
+	station, key, _ = strings.Cut(name, ";")
+	return station, key
+}
+
+// Grouped reports whether the names of r are "station;key", as with
+// Config.GroupBy and Config.Window.
+func (r *Result) Grouped() bool {
+	return r.grouped
+}
+
+// Split splits a name of r into station and key with SplitName if r is
+// Grouped. Otherwise the name is the station, semicolons included.
+func (r *Result) Split(name string) (station, key string) {
+	if !r.grouped {
+		return name, ""
+	}
+	return SplitName(name)
+}
+
+// WriteTable writes r as semicolon separated rows with a header, one row per
+// name, which suits grouped results better than the official format:
+//
+//	station;key;min;mean;max;count
+//	Abha;2024-03-01;-23.0;18.0;59.2;1204
+func (r *Result) WriteTable(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("station;key;min;mean;max;count\n")
+	for _, name := range r.Names() {
+		station, key := r.Split(name)
+		s := r.stations.get(name)
+		bw.WriteString(station)
+		bw.WriteByte(';')
+		bw.WriteString(key)
+		bw.WriteByte(';')
+		bw.WriteString(strings.ReplaceAll(s.String(), "/", ";"))
+		bw.WriteByte(';')
+		bw.WriteString(strconv.FormatInt(s.Count, 10))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,91 @@
+package brc
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestGroupBy(t *testing.T) {
+	input := "a;2024-03-01T10:00:00;x;1.0\n" +
+		"a b;2024-03-01T11:00:00;x;2.0\n" +
+		"a;2024-03-02T10:00:00;x;3.0\n" +
+		"a;2024-03-01T23:59:59;y;5.0\n" +
+		"a;2024-03-01\n" +
+		"b;1.0\n"
+	res, err := Process(strings.NewReader(input), Config{GroupBy: GroupBy{Column: 1, Prefix: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.WriteTable(&out)
+	expected := "station;key;min;mean;max;count\n" +
+		"a;2024-03-01;1.0;3.0;5.0;2\n" +
+		"a;2024-03-02;3.0;3.0;3.0;1\n" +
+		"a b;2024-03-01;2.0;2.0;2.0;1\n"
+	if out.String() != expected {
+		t.Errorf("Wrong output, expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	res, err = Process(strings.NewReader(input), Config{GroupBy: GroupBy{Column: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := strings.Join(res.Names(), ","); names != "a;x,a;y,a b;x" {
+		t.Errorf("Wrong names for column 2: %s", names)
+	}
+}
+
+func TestSemicolonNames(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		input string
+	}{
+		{Config{Format: FormatCSV}, "\"St. John;s\";12.3\n\"a;z\";1.0\n\"a b\";2.0\n"},
+		{Config{Format: FormatJSONL}, `{"station":"St. John;s","temp":12.3}` + "\n" + `{"station":"a;z","temp":1.0}` + "\n" + `{"station":"a b","temp":2.0}` + "\n"},
+	} {
+		res, err := Process(strings.NewReader(tc.input), tc.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if station, key := res.Split("St. John;s"); res.Grouped() || station != "St. John;s" || key != "" {
+			t.Errorf("%s: Split = %q, %q of a result grouped %v", tc.cfg.Format, station, key, res.Grouped())
+		}
+		// the names sort whole, ' ' before ';'
+		if names := strings.Join(res.Names(), ","); names != "St. John;s,a b,a;z" {
+			t.Errorf("%s: names %s", tc.cfg.Format, names)
+		}
+		var out bytes.Buffer
+		res.WriteMarkdown(&out)
+		if !strings.Contains(out.String(), "| St. John;s | 12.3 | 12.3 | 12.3 | 1 |\n") || strings.Contains(out.String(), "Key") {
+			t.Errorf("%s: markdown\n%s", tc.cfg.Format, out.String())
+		}
+		relabeled, _ := res.Relabel(map[string]string{"St. John;s": "St. John's"})
+		if _, ok := relabeled.Get("St. John's"); !ok || relabeled.Grouped() {
+			t.Errorf("%s: relabeled %v", tc.cfg.Format, relabeled.Names())
+		}
+	}
+
+	// grouped results stay grouped through partials
+	res, err := Process(strings.NewReader("a;x;1.0\n"), Config{GroupBy: GroupBy{Column: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, write := range []func(io.Writer) error{res.Write, res.WriteJSON} {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		read := NewResult()
+		if err := read.Read(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if station, key := read.Split("a;x"); !read.Grouped() || station != "a" || key != "x" {
+			t.Errorf("read partial: Split = %q, %q of a result grouped %v", station, key, read.Grouped())
+		}
+	}
+	if old := NewResult(); old.Read(strings.NewReader("1BRC\x01\x01\x03a;x\x02\x02\x02\x02")) != nil || old.Grouped() || old.Len() != 1 {
+		t.Errorf("read version 1 partial: %v grouped %v", old.Names(), old.Grouped())
+	}
+}
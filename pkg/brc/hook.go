@@ -0,0 +1,50 @@
+package brc
+
+// Hook preprocesses a record before it is aggregated, see Config.Hooks. It
+// returns the station and reading in tenths to aggregate instead, or keep
+// false or an empty station to drop the record, which then counts as
+// neither a row nor a malformed line. Workers run hooks concurrently, so
+// they must be safe for concurrent use. station is only valid during the
+// call, the station returned must stay valid until the next call.
+type Hook func(station []byte, tenths int32) (newStation []byte, newTenths int32, keep bool)
+
+// Filter returns a Hook that keeps the records keep reports true for.
+func Filter(keep func(station []byte, tenths int32) bool) Hook {
+	return func(station []byte, tenths int32) ([]byte, int32, bool) {
+		return station, tenths, keep(station, tenths)
+	}
+}
+
+// DropOutside returns a Hook that drops the readings below lo or above hi
+// tenths of a degree, e.g. DropOutside(-500, 500) for sensors that cannot
+// read beyond ±50.0.
+func DropOutside(lo, hi int32) Hook {
+	return Filter(func(_ []byte, tenths int32) bool { return tenths >= lo && tenths <= hi })
+}
+
+// Rename returns a Hook that renames the stations that are keys of names to
+// their values, leaving the others as they are. Renaming a station to ""
+// drops its records.
+func Rename(names map[string]string) Hook {
+	renamed := make(map[string][]byte, len(names))
+	for from, to := range names {
+		renamed[from] = []byte(to)
+	}
+	return func(station []byte, tenths int32) ([]byte, int32, bool) {
+		if to, ok := renamed[string(station)]; ok {
+			return to, tenths, true
+		}
+		return station, tenths, true
+	}
+}
+
+// hook applies the hooks of o to a record.
+func (o *parseOptions) hook(station []byte, tenths int32) ([]byte, int32, bool) {
+	for _, h := range o.hooks {
+		var keep bool
+		if station, tenths, keep = h(station, tenths); !keep {
+			return nil, 0, false
+		}
+	}
+	return station, tenths, len(station) > 0
+}
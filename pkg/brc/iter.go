@@ -0,0 +1,36 @@
+package brc
+
+import "iter"
+
+// All yields every station and its aggregate in unspecified order, without
+// copying the names.
+func (r *Result) All() iter.Seq2[string, Stats] {
+	return func(yield func(string, Stats) bool) {
+		for i, name := range r.stations.names {
+			if !yield(name, r.stations.stats(i)) {
+				return
+			}
+		}
+	}
+}
+
+// Sorted yields every station and its aggregate in the order of Names.
+func (r *Result) Sorted() iter.Seq2[string, Stats] {
+	return r.Filter(nil)
+}
+
+// Filter yields the stations for which keep returns true, and their
+// aggregates, in the order of Names. A nil keep keeps all stations.
+func (r *Result) Filter(keep func(name string, s Stats) bool) iter.Seq2[string, Stats] {
+	return func(yield func(string, Stats) bool) {
+		for _, name := range r.Names() {
+			s := r.stations.get(name)
+			if keep != nil && !keep(name, s) {
+				continue
+			}
+			if !yield(name, s) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package brc
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// parseJSONLine is parseLine for FormatJSONL, lines being objects such as
+// {"station":"Oslo","temp":-3.2}. It extracts the station string and the
+// temp or temperature number without encoding/json and skips the other
+// fields, whatever their values. A reading not of the form parseTenths reads
+// is rounded to tenths and must be from -99.9 to 99.9. buf holds names that
+// had escapes, the name is only valid until the next call with it.
+func parseJSONLine(line []byte, buf *[]byte) (name []byte, tenths int32, ok bool) {
+	d := jsonScanner{b: line}
+	if !d.consume('{') {
+		return nil, 0, false
+	}
+	var haveName, haveReading bool
+	for i := 0; !d.consume('}'); i++ {
+		if i > 0 && !d.consume(',') {
+			return nil, 0, false
+		}
+		key, escaped, ok := d.rawString()
+		if !ok || !d.consume(':') {
+			return nil, 0, false
+		}
+		switch {
+		case escaped:
+			// no key of interest has escapes
+			ok = d.skipValue(0)
+		case string(key) == "station":
+			if name, escaped, ok = d.rawString(); ok && escaped {
+				name, ok = unescape(name, buf)
+			}
+			haveName = ok
+		case string(key) == "temp" || string(key) == "temperature":
+			tenths, ok = d.number()
+			haveReading = ok
+		default:
+			ok = d.skipValue(0)
+		}
+		if !ok {
+			return nil, 0, false
+		}
+	}
+	d.space()
+	return name, tenths, d.pos == len(d.b) && haveName && len(name) > 0 && haveReading && bytes.IndexByte(name, '\n') < 0
+}
+
+// jsonScanner reads the JSON value in b.
+type jsonScanner struct {
+	b   []byte
+	pos int
+}
+
+func (d *jsonScanner) space() {
+	for d.pos < len(d.b) && (d.b[d.pos] == ' ' || d.b[d.pos] == '\t' || d.b[d.pos] == '\r') {
+		d.pos++
+	}
+}
+
+// consume skips white space and c, reporting whether c is next.
+func (d *jsonScanner) consume(c byte) bool {
+	d.space()
+	if d.pos < len(d.b) && d.b[d.pos] == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// rawString reads a string and returns its bytes between the quotes, still
+// escaped if escaped.
+func (d *jsonScanner) rawString() (s []byte, escaped, ok bool) {
+	if !d.consume('"') {
+		return nil, false, false
+	}
+	start := d.pos
+	for d.pos < len(d.b) {
+		switch c := d.b[d.pos]; {
+		case c == '"':
+			d.pos++
+			return d.b[start : d.pos-1], escaped, true
+		case c == '\\':
+			escaped = true
+			d.pos += 2
+		case c < ' ':
+			return nil, false, false
+		default:
+			d.pos++
+		}
+	}
+	return nil, false, false
+}
+
+// number reads a number as tenths.
+func (d *jsonScanner) number() (int32, bool) {
+	d.space()
+	start := d.pos
+	for d.pos < len(d.b) && isNumberByte(d.b[d.pos]) {
+		d.pos++
+	}
+	b := d.b[start:d.pos]
+	if v, ok := parseTenths(b); ok {
+		return v, true
+	}
+	// any other JSON number, e.g. 12 or -3.25, encoding/json's grammar
+	// being checked by ParseFloat but for leading zeros and a plus
+	if len(b) == 0 || b[0] == '+' || b[0] == '.' {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, false
+	}
+	if v := math.Round(f * 10); v >= -999 && v <= 999 {
+		return int32(v), true
+	}
+	return 0, false
+}
+
+func isNumberByte(c byte) bool {
+	return isDigit(c) || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+// skipValue skips a value of any type, depth being that of the enclosing
+// arrays and objects.
+func (d *jsonScanner) skipValue(depth int) bool {
+	if depth > maxJSONDepth {
+		return false
+	}
+	d.space()
+	if d.pos == len(d.b) {
+		return false
+	}
+	switch c := d.b[d.pos]; {
+	case c == '"':
+		_, _, ok := d.rawString()
+		return ok
+	case c == '{' || c == '[':
+		end := byte('}')
+		if c == '[' {
+			end = ']'
+		}
+		d.pos++
+		for i := 0; !d.consume(end); i++ {
+			if i > 0 && !d.consume(',') {
+				return false
+			}
+			if c == '{' {
+				if _, _, ok := d.rawString(); !ok || !d.consume(':') {
+					return false
+				}
+			}
+			if !d.skipValue(depth + 1) {
+				return false
+			}
+		}
+		return true
+	case c == '-' || isDigit(c):
+		start := d.pos
+		for d.pos < len(d.b) && isNumberByte(d.b[d.pos]) {
+			d.pos++
+		}
+		_, err := strconv.ParseFloat(string(d.b[start:d.pos]), 64)
+		return err == nil
+	}
+	for _, lit := range []string{"true", "false", "null"} {
+		if bytes.HasPrefix(d.b[d.pos:], []byte(lit)) {
+			d.pos += len(lit)
+			return true
+		}
+	}
+	return false
+}
+
+// maxJSONDepth bounds the nesting of skipped values.
+const maxJSONDepth = 64
+
+// unescape decodes the escapes of the JSON string s into buf.
+func unescape(s []byte, buf *[]byte) ([]byte, bool) {
+	out := (*buf)[:0]
+	for len(s) > 0 {
+		i := bytes.IndexByte(s, '\\')
+		if i < 0 {
+			out = append(out, s...)
+			break
+		}
+		out = append(out, s[:i]...)
+		if i+1 == len(s) {
+			return nil, false
+		}
+		c := s[i+1]
+		s = s[i+2:]
+		switch c {
+		case '"', '\\', '/':
+			out = append(out, c)
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, ok := hex4(s)
+			if !ok {
+				return nil, false
+			}
+			s = s[4:]
+			if utf16.IsSurrogate(r) {
+				r2, ok := rune(0), len(s) >= 6 && s[0] == '\\' && s[1] == 'u'
+				if ok {
+					r2, ok = hex4(s[2:])
+				}
+				if r = utf16.DecodeRune(r, r2); ok && r != utf8.RuneError {
+					s = s[6:]
+				}
+			}
+			out = utf8.AppendRune(out, r)
+		default:
+			return nil, false
+		}
+	}
+	*buf = out
+	return out, true
+}
+
+// hex4 decodes the 4 hex digits at the start of s.
+func hex4(s []byte) (rune, bool) {
+	if len(s) < 4 {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(string(s[:4]), 16, 16)
+	return rune(v), err == nil
+}
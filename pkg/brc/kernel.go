@@ -0,0 +1,38 @@
+package brc
+
+// mergeColumns folds the columns of o into those of t element-wise. The
+// slots of t must be those of o, followed by any more t has, as with the
+// tables of workers sharing a dictionary. With the brcfast build tag the
+// loops run in vector kernels where the architecture has them, so that
+// merging ten thousand stations per worker costs a few microseconds.
+func mergeColumns(t, o *table) {
+	n := len(o.names)
+	minInt32s(t.mins[:n], o.mins)
+	maxInt32s(t.maxs[:n], o.maxs)
+	addInt64s(t.sums[:n], o.sums)
+	addInt64s(t.counts[:n], o.counts)
+}
+
+// The portable kernels, also handling the tails the vector kernels leave.
+// dst and src have the same length.
+
+func minInt32sGo(dst, src []int32) {
+	dst = dst[:len(src)]
+	for i, v := range src {
+		dst[i] = min(dst[i], v)
+	}
+}
+
+func maxInt32sGo(dst, src []int32) {
+	dst = dst[:len(src)]
+	for i, v := range src {
+		dst[i] = max(dst[i], v)
+	}
+}
+
+func addInt64sGo(dst, src []int64) {
+	dst = dst[:len(src)]
+	for i, v := range src {
+		dst[i] += v
+	}
+}
@@ -0,0 +1,46 @@
+//go:build brcfast
+
+package brc
+
+import "golang.org/x/sys/cpu"
+
+var hasAVX2 = cpu.X86.HasAVX2
+
+// The AVX2 kernels process 32 bytes at a time and leave the rest of the
+// slices to the portable ones.
+
+func minInt32s(dst, src []int32) {
+	n := 0
+	if hasAVX2 {
+		n = len(src) &^ 7
+		minInt32sAVX2(dst[:n], src[:n])
+	}
+	minInt32sGo(dst[n:], src[n:])
+}
+
+func maxInt32s(dst, src []int32) {
+	n := 0
+	if hasAVX2 {
+		n = len(src) &^ 7
+		maxInt32sAVX2(dst[:n], src[:n])
+	}
+	maxInt32sGo(dst[n:], src[n:])
+}
+
+func addInt64s(dst, src []int64) {
+	n := 0
+	if hasAVX2 {
+		n = len(src) &^ 3
+		addInt64sAVX2(dst[:n], src[:n])
+	}
+	addInt64sGo(dst[n:], src[n:])
+}
+
+//go:noescape
+func minInt32sAVX2(dst, src []int32)
+
+//go:noescape
+func maxInt32sAVX2(dst, src []int32)
+
+//go:noescape
+func addInt64sAVX2(dst, src []int64)
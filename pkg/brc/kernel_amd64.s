@@ -0,0 +1,66 @@
+//go:build brcfast
+
+#include "textflag.h"
+
+// func minInt32sAVX2(dst, src []int32), len(src) a multiple of 8
+TEXT ·minInt32sAVX2(SB), NOSPLIT, $0-48
+	MOVQ dst_base+0(FP), DI
+	MOVQ src_base+24(FP), SI
+	MOVQ src_len+32(FP), CX
+	SHRQ $3, CX
+	JZ   mindone
+
+minloop:
+	VMOVDQU (DI), Y0
+	VPMINSD (SI), Y0, Y0
+	VMOVDQU Y0, (DI)
+	ADDQ    $32, DI
+	ADDQ    $32, SI
+	DECQ    CX
+	JNZ     minloop
+	VZEROUPPER
+
+mindone:
+	RET
+
+// func maxInt32sAVX2(dst, src []int32), len(src) a multiple of 8
+TEXT ·maxInt32sAVX2(SB), NOSPLIT, $0-48
+	MOVQ dst_base+0(FP), DI
+	MOVQ src_base+24(FP), SI
+	MOVQ src_len+32(FP), CX
+	SHRQ $3, CX
+	JZ   maxdone
+
+maxloop:
+	VMOVDQU (DI), Y0
+	VPMAXSD (SI), Y0, Y0
+	VMOVDQU Y0, (DI)
+	ADDQ    $32, DI
+	ADDQ    $32, SI
+	DECQ    CX
+	JNZ     maxloop
+	VZEROUPPER
+
+maxdone:
+	RET
+
+// func addInt64sAVX2(dst, src []int64), len(src) a multiple of 4
+TEXT ·addInt64sAVX2(SB), NOSPLIT, $0-48
+	MOVQ dst_base+0(FP), DI
+	MOVQ src_base+24(FP), SI
+	MOVQ src_len+32(FP), CX
+	SHRQ $2, CX
+	JZ   adddone
+
+addloop:
+	VMOVDQU (DI), Y0
+	VPADDQ  (SI), Y0, Y0
+	VMOVDQU Y0, (DI)
+	ADDQ    $32, DI
+	ADDQ    $32, SI
+	DECQ    CX
+	JNZ     addloop
+	VZEROUPPER
+
+adddone:
+	RET
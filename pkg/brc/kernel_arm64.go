@@ -0,0 +1,33 @@
+//go:build brcfast
+
+package brc
+
+// The NEON kernels, which every arm64 CPU has, process 16 bytes at a time and
+// leave the rest of the slices to the portable ones.
+
+func minInt32s(dst, src []int32) {
+	n := len(src) &^ 3
+	minInt32sNEON(dst[:n], src[:n])
+	minInt32sGo(dst[n:], src[n:])
+}
+
+func maxInt32s(dst, src []int32) {
+	n := len(src) &^ 3
+	maxInt32sNEON(dst[:n], src[:n])
+	maxInt32sGo(dst[n:], src[n:])
+}
+
+func addInt64s(dst, src []int64) {
+	n := len(src) &^ 1
+	addInt64sNEON(dst[:n], src[:n])
+	addInt64sGo(dst[n:], src[n:])
+}
+
+//go:noescape
+func minInt32sNEON(dst, src []int32)
+
+//go:noescape
+func maxInt32sNEON(dst, src []int32)
+
+//go:noescape
+func addInt64sNEON(dst, src []int64)
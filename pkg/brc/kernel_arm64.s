@@ -0,0 +1,60 @@
+//go:build brcfast
+
+#include "textflag.h"
+
+// func minInt32sNEON(dst, src []int32), len(src) a multiple of 4
+TEXT ·minInt32sNEON(SB), NOSPLIT, $0-48
+	MOVD dst_base+0(FP), R0
+	MOVD src_base+24(FP), R1
+	MOVD src_len+32(FP), R2
+	LSR  $2, R2
+	CBZ  R2, mindone
+
+minloop:
+	VLD1   (R0), [V0.S4]
+	VLD1.P 16(R1), [V1.S4]
+	VSMIN  V1.S4, V0.S4, V0.S4
+	VST1.P [V0.S4], 16(R0)
+	SUB    $1, R2
+	CBNZ   R2, minloop
+
+mindone:
+	RET
+
+// func maxInt32sNEON(dst, src []int32), len(src) a multiple of 4
+TEXT ·maxInt32sNEON(SB), NOSPLIT, $0-48
+	MOVD dst_base+0(FP), R0
+	MOVD src_base+24(FP), R1
+	MOVD src_len+32(FP), R2
+	LSR  $2, R2
+	CBZ  R2, maxdone
+
+maxloop:
+	VLD1   (R0), [V0.S4]
+	VLD1.P 16(R1), [V1.S4]
+	VSMAX  V1.S4, V0.S4, V0.S4
+	VST1.P [V0.S4], 16(R0)
+	SUB    $1, R2
+	CBNZ   R2, maxloop
+
+maxdone:
+	RET
+
+// func addInt64sNEON(dst, src []int64), len(src) a multiple of 2
+TEXT ·addInt64sNEON(SB), NOSPLIT, $0-48
+	MOVD dst_base+0(FP), R0
+	MOVD src_base+24(FP), R1
+	MOVD src_len+32(FP), R2
+	LSR  $1, R2
+	CBZ  R2, adddone
+
+addloop:
+	VLD1   (R0), [V0.D2]
+	VLD1.P 16(R1), [V1.D2]
+	VADD   V1.D2, V0.D2, V0.D2
+	VST1.P [V0.D2], 16(R0)
+	SUB    $1, R2
+	CBNZ   R2, addloop
+
+adddone:
+	RET
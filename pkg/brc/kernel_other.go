@@ -0,0 +1,7 @@
+//go:build !brcfast || (!amd64 && !arm64)
+
+package brc
+
+func minInt32s(dst, src []int32) { minInt32sGo(dst, src) }
+func maxInt32s(dst, src []int32) { maxInt32sGo(dst, src) }
+func addInt64s(dst, src []int64) { addInt64sGo(dst, src) }
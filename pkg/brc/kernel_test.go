@@ -0,0 +1,67 @@
+package brc
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestKernels(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	// lengths around the vector widths exercise the tails
+	for n := range 40 {
+		mins, maxs, srcMins := make([]int32, n), make([]int32, n), make([]int32, n)
+		sums, srcSums := make([]int64, n), make([]int64, n)
+		for i := range n {
+			mins[i], maxs[i], srcMins[i] = rng.Int32()-1<<30, rng.Int32()-1<<30, rng.Int32()-1<<30
+			sums[i], srcSums[i] = rng.Int64()>>2-1<<60, rng.Int64()>>2
+		}
+		expectedMins, expectedMaxs, expectedSums := slices.Clone(mins), slices.Clone(maxs), slices.Clone(sums)
+		minInt32sGo(expectedMins, srcMins)
+		maxInt32sGo(expectedMaxs, srcMins)
+		addInt64sGo(expectedSums, srcSums)
+
+		minInt32s(mins, srcMins)
+		maxInt32s(maxs, srcMins)
+		addInt64s(sums, srcSums)
+		if !slices.Equal(mins, expectedMins) || !slices.Equal(maxs, expectedMaxs) || !slices.Equal(sums, expectedSums) {
+			t.Errorf("Wrong kernel results for %d elements", n)
+		}
+	}
+}
+
+func TestDictionaryTables(t *testing.T) {
+	dict := newDictionary(0)
+	a, b := newTable(0), newTable(0)
+	a.dict, b.dict = dict, dict
+	a.add(a.slot([]byte("x")), 10)
+	b.add(b.slot([]byte("y")), -5)
+	b.add(b.slot([]byte("x")), 20)
+	a.add(a.slot([]byte("z")), 7)
+
+	if a.len() != 2 || b.len() != 2 {
+		t.Errorf("Wrong lengths %d and %d, expected 2", a.len(), b.len())
+	}
+	// b saw x after a had named it, a never saw y
+	if i, _ := b.lookup("x"); i != 0 {
+		t.Errorf("x has slot %d in b, expected 0", i)
+	}
+	if c := a.clone(); c.len() != 2 || c.get("y") != (Stats{}) {
+		t.Errorf("Clone kept the empty slot of y: %v", c.names)
+	}
+
+	a.merge(&b)
+	a.detach()
+	for name, expected := range map[string]Stats{
+		"x": {Min: 10, Max: 20, Sum: 30, Count: 2},
+		"y": {Min: -5, Max: -5, Sum: -5, Count: 1},
+		"z": {Min: 7, Max: 7, Sum: 7, Count: 1},
+	} {
+		if s := a.get(name); s != expected {
+			t.Errorf("Wrong stats of %s, expected %+v, got %+v", name, expected, s)
+		}
+	}
+	if a.dict != nil || a.len() != 3 {
+		t.Errorf("Merged table not detached or of wrong length %d", a.len())
+	}
+}
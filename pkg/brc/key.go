@@ -0,0 +1,76 @@
+package brc
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// parseKeyLine splits a line "f1;f2;...;fn;temperature", with delim between
+// the fields, into field column, counting from 1, and the temperature in
+// tenths, see Config.KeyColumn.
+func parseKeyLine(line []byte, column int, delim byte) (key []byte, tenths int32, ok bool) {
+	last := bytes.LastIndexByte(line, delim)
+	if last <= 0 {
+		return nil, 0, false
+	}
+	fields := line[:last]
+	for i := 1; i < column; i++ {
+		n := bytes.IndexByte(fields, delim)
+		if n < 0 {
+			return nil, 0, false
+		}
+		fields = fields[n+1:]
+	}
+	if n := bytes.IndexByte(fields, delim); n >= 0 {
+		fields = fields[:n]
+	}
+	if len(fields) == 0 {
+		return nil, 0, false
+	}
+	tenths, ok = parseTenths(line[last+1:])
+	return fields, tenths, ok
+}
+
+// Relabel returns r with its stations, keys such as the numeric IDs of
+// Config.KeyColumn, named by their labels in names, e.g. a station name for
+// an ID, for output after aggregating by the shorter keys. The keys of
+// grouped names are kept. Stations that share a label stay apart as
+// "label (key)". unlabeled are the stations names has no label for, which
+// keep their key, sorted. The extras of the stations, such as distinct
+// counts, are kept under their labels.
+func (r *Result) Relabel(names map[string]string) (relabeled *Result, unlabeled []string) {
+	// the stations of each label, to tell those sharing one apart
+	stations := map[string]map[string]bool{}
+	for name := range r.All() {
+		station, _ := r.Split(name)
+		if label, ok := names[station]; ok {
+			if stations[label] == nil {
+				stations[label] = map[string]bool{}
+			}
+			stations[label][station] = true
+		}
+	}
+	relabeled = r.emptyLike()
+	seen := map[string]bool{}
+	for name, s := range r.All() {
+		station, key := r.Split(name)
+		label, ok := names[station]
+		switch {
+		case !ok:
+			label = station
+			if !seen[station] {
+				seen[station] = true
+				unlabeled = append(unlabeled, station)
+			}
+		case len(stations[label]) > 1:
+			label = fmt.Sprintf("%s (%s)", label, station)
+		}
+		if key != "" {
+			label += ";" + key
+		}
+		relabeled.mergeStation(label, name, s, r)
+	}
+	slices.Sort(unlabeled)
+	return relabeled, unlabeled
+}
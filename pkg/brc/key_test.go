@@ -0,0 +1,64 @@
+package brc
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestParseKeyLine(t *testing.T) {
+	for _, tt := range []struct {
+		line   string
+		column int
+		key    string
+		tenths int32
+		ok     bool
+	}{
+		{"7;Hamburg;12.0", 1, "7", 120, true},
+		{"7;Hamburg;12.0", 2, "Hamburg", 120, true},
+		{"7;Hamburg;de;-3.4", 3, "de", -34, true},
+		{"7;Hamburg;12.0", 3, "", 0, false},
+		{"7;12.0", 1, "7", 120, true},
+		{"7;12.0", 2, "", 0, false},
+		{";Hamburg;12.0", 1, "", 0, false},
+		{"7;;12.0", 2, "", 0, false},
+		{"7;Hamburg;", 1, "", 0, false},
+		{"7;Hamburg;x", 1, "", 0, false},
+		{"12.0", 1, "", 0, false},
+	} {
+		key, tenths, ok := parseKeyLine([]byte(tt.line), tt.column, ';')
+		if ok != tt.ok || (ok && (string(key) != tt.key || tenths != tt.tenths)) {
+			t.Errorf("parseKeyLine(%q, %d) = %q, %d, %v", tt.line, tt.column, key, tenths, ok)
+		}
+	}
+}
+
+// BenchmarkKeyColumn compares the lines of names with those keyed by the
+// IDs of the stations in front of them, and with only the IDs.
+func BenchmarkKeyColumn(b *testing.B) {
+	var names, keyed, ids bytes.Buffer
+	for i := range 200_000 {
+		s := i * 7919 % 10_000
+		t := fmt.Sprintf("%d.%d", i%90-45, i%10)
+		fmt.Fprintf(&names, "Station number %d of the data set;%s\n", s, t)
+		fmt.Fprintf(&keyed, "%d;Station number %d of the data set;%s\n", s, s, t)
+		fmt.Fprintf(&ids, "%d;%s\n", s, t)
+	}
+	for _, bm := range []struct {
+		name string
+		data []byte
+		cfg  Config
+	}{
+		{"names", names.Bytes(), Config{}},
+		{"key-column", keyed.Bytes(), Config{KeyColumn: 1}},
+		{"ids", ids.Bytes(), Config{}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(int64(len(bm.data)))
+			for b.Loop() {
+				r := bm.cfg.newResult()
+				parseChunk(bm.data, r)
+			}
+		})
+	}
+}
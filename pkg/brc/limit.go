@@ -0,0 +1,169 @@
+package brc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// A byte range [RangeStart, RangeEnd) selects the lines starting in it, the
+// same way a chunk is owned by its worker: the line running into RangeStart
+// is skipped and the line running over RangeEnd is read to its end. Header
+// lines are only skipped for ranges starting at 0.
+
+func (c Config) validateRange() error {
+	if c.RangeStart < 0 || c.RangeEnd < 0 || c.RangeEnd > 0 && c.RangeEnd < c.RangeStart {
+		return fmt.Errorf("invalid byte range %d:%d", c.RangeStart, c.RangeEnd)
+	}
+	return nil
+}
+
+// restrictData applies the byte range, header and row limit of c to mapped
+// input and returns the offset of the remaining data.
+func (c Config) restrictData(data []byte) ([]byte, int64) {
+	start, end := min(c.RangeStart, int64(len(data))), int64(len(data))
+	if c.RangeEnd > 0 && c.RangeEnd < end {
+		end = c.RangeEnd
+	}
+	if end < int64(len(data)) && end > 0 {
+		if nl := bytes.IndexByte(data[end-1:], '\n'); nl >= 0 {
+			end += int64(nl)
+		} else {
+			end = int64(len(data))
+		}
+	}
+	if start > 0 {
+		// skip through the first newline at or after start-1
+		nl := bytes.IndexByte(data[start-1:end], '\n')
+		if nl < 0 {
+			return nil, end
+		}
+		start += int64(nl)
+	}
+	if start >= end {
+		return nil, end
+	}
+	data = data[start:end]
+
+	if c.RangeStart == 0 {
+		n := len(data)
+		data = skipLines(data, c.SkipHeader)
+		start += int64(n - len(data))
+	}
+	if c.LimitRows > 0 {
+		data = firstLines(data, c.LimitRows)
+	}
+	return data, start
+}
+
+// firstLines returns the first n lines of data.
+func firstLines(data []byte, n int64) []byte {
+	end := 0
+	for ; n > 0 && end < len(data); n-- {
+		nl := bytes.IndexByte(data[end:], '\n')
+		if nl < 0 {
+			return data
+		}
+		end += nl + 1
+	}
+	return data[:end]
+}
+
+// restrictReader applies the byte range, header and row limit of c to input
+// read from r, which is positioned at offset 0, and returns the offset the
+// restricted reader starts at. Seekable inputs skip to the range directly.
+func (c Config) restrictReader(r io.Reader) (io.Reader, int64, error) {
+	pos := int64(0)
+	skip := c.SkipHeader
+	if c.RangeStart > 0 {
+		// read from start-1 to see whether start begins a line
+		pos, skip = c.RangeStart-1, 1
+		if s, ok := r.(io.Seeker); ok {
+			if _, err := s.Seek(pos, io.SeekStart); err != nil {
+				return nil, 0, err
+			}
+		} else if _, err := io.CopyN(io.Discard, r, pos); err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+	}
+
+	if skip > 0 {
+		// bufio hands the block sized reads directly to r once the skipped
+		// lines are consumed from its buffer
+		br := bufio.NewReader(r)
+		for skip > 0 {
+			line, err := br.ReadSlice('\n')
+			pos += int64(len(line))
+			if err == bufio.ErrBufferFull {
+				continue // the line goes on
+			}
+			if err != nil {
+				break
+			}
+			skip--
+		}
+		r = br
+	}
+
+	if c.RangeEnd > 0 {
+		if pos >= c.RangeEnd {
+			// the skipped line covered the whole range
+			return bytes.NewReader(nil), pos, nil
+		}
+		r = &rangeEndReader{r: r, left: c.RangeEnd - 1 - pos}
+	}
+	if c.LimitRows > 0 {
+		r = &lineLimitReader{r: r, lines: c.LimitRows}
+	}
+	return r, pos, nil
+}
+
+// rangeEndReader ends its input at the first newline after left bytes.
+type rangeEndReader struct {
+	r    io.Reader
+	left int64
+	done bool
+}
+
+func (e *rangeEndReader) Read(p []byte) (int, error) {
+	if e.done {
+		return 0, io.EOF
+	}
+	n, err := e.r.Read(p)
+	if int64(n) <= e.left {
+		e.left -= int64(n)
+		return n, err
+	}
+	from := int(e.left)
+	e.left = 0
+	if nl := bytes.IndexByte(p[from:n], '\n'); nl >= 0 {
+		e.done = true
+		return from + nl + 1, nil
+	}
+	return n, err
+}
+
+// lineLimitReader ends its input after a number of lines.
+type lineLimitReader struct {
+	r     io.Reader
+	lines int64
+}
+
+func (l *lineLimitReader) Read(p []byte) (int, error) {
+	if l.lines <= 0 {
+		return 0, io.EOF
+	}
+	n, err := l.r.Read(p)
+	for i := 0; i < n; {
+		nl := bytes.IndexByte(p[i:n], '\n')
+		if nl < 0 {
+			break
+		}
+		i += nl + 1
+		if l.lines--; l.lines == 0 {
+			return i, nil
+		}
+	}
+	return n, err
+}
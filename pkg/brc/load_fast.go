@@ -0,0 +1,16 @@
+//go:build brcfast && (amd64 || arm64)
+
+package brc
+
+import "unsafe"
+
+// BuildMode is "fast" in builds with the brcfast tag on amd64 and arm64,
+// which load words through unsafe pointers and merge columns in assembly,
+// and "safe" in the default pure Go build.
+const BuildMode = "fast"
+
+// load64 is an unaligned load without bounds check, both architectures
+// being little endian. Callers check that b[i:] has 8 bytes.
+func load64(b []byte, i int) uint64 {
+	return *(*uint64)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(b)), i))
+}
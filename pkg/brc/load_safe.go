@@ -0,0 +1,15 @@
+//go:build !brcfast || (!amd64 && !arm64)
+
+package brc
+
+import "encoding/binary"
+
+// BuildMode is "fast" in builds with the brcfast tag on amd64 and arm64,
+// which load words through unsafe pointers and merge columns in assembly,
+// and "safe" in the default pure Go build.
+const BuildMode = "safe"
+
+// load64 returns the little endian word at b[i:], which must have 8 bytes.
+func load64(b []byte, i int) uint64 {
+	return binary.LittleEndian.Uint64(b[i:])
+}
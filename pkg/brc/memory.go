@@ -0,0 +1,258 @@
+package brc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/djheidihoe/1brc/internal/arch"
+	"github.com/djheidihoe/1brc/internal/parquet"
+)
+
+// probeBytes is how much of the input EstimateMemory parses to count its
+// stations.
+const probeBytes = 4 << 20
+
+// Per-station costs of the estimate in bytes on 64-bit platforms, with
+// room for the maps and columns growing by doubling.
+const (
+	slotBytes    = 96   // a slot of a table and its map entry
+	indexBytes   = 24   // an entry of the swiss index
+	internBytes  = 64   // a name in the dictionary the tables share
+	sortBytes    = 16   // a name sorted for output
+	extraBytes   = 48   // the map entry of a per-station extra
+	digestBytes  = 8192 // a t-digest of up to 100 centroids and 400 buffered points
+	extremeBytes = 64   // the Extremes of Provenance
+)
+
+// MemoryEstimate is the memory a run of ProcessFile is expected to need at
+// its peak, see EstimateMemory.
+type MemoryEstimate struct {
+	// Stations is the estimated number of distinct stations, or of keys
+	// with GroupBy and Window.
+	Stations int
+	// Exact reports whether the probe read the whole input, so that
+	// Stations is the actual number.
+	Exact bool
+	// Mapped is the size of the input IOMmap maps. Its pages belong to the
+	// page cache, which can evict and read them again, so it is not part
+	// of Heap.
+	Mapped int64
+	// Buffers are the blocks in flight with IOStream and IOPipeline, the
+	// batches of lines of AggregatePartitioned, or the row groups the
+	// workers decode with FormatParquet.
+	Buffers int64
+	// Tables are the per-worker tables with their per-station options, the
+	// single table of AggregateShared, or the partitions of
+	// AggregatePartitioned, which hold each station once.
+	Tables int64
+	// Interner is the dictionary of names the per-worker tables share.
+	Interner int64
+	// Merge is the merged result and its names sorted for output.
+	Merge int64
+}
+
+// Heap returns the estimated peak of the heap, all but Mapped.
+func (e MemoryEstimate) Heap() int64 {
+	return e.Buffers + e.Tables + e.Interner + e.Merge
+}
+
+// EstimateMemory estimates the peak memory of ProcessFile for the input at
+// path with cfg, from the input size, the settings of cfg and the stations
+// of the first 4MB, or of the first row group with FormatParquet. Unless
+// the probe read the whole input, the number of stations is extrapolated
+// from how many of them it saw once and twice (the Chao1 estimator), at
+// most one per line of the input, and CardinalityHint or the stations of
+// Dictionary are taken instead if set. Accumulators of NewAccumulator are
+// not counted.
+func EstimateMemory(path string, cfg Config) (MemoryEstimate, error) {
+	if err := cfg.Validate(); err != nil {
+		return MemoryEstimate{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return MemoryEstimate{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return MemoryEstimate{}, err
+	}
+	p, err := cfg.probeStations(f, fi.Size())
+	if err != nil {
+		return MemoryEstimate{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	e := MemoryEstimate{Stations: p.stations, Exact: p.exact}
+	if hint := cfg.cardinality(); hint > 0 && !p.exact {
+		e.Stations = hint
+	}
+	n, name, workers := int64(e.Stations), int64(p.nameBytes), int64(cfg.workers())
+	switch {
+	case cfg.Format == FormatParquet:
+		e.Buffers = workers * p.rowGroupBytes
+	case cfg.io() == IOMmap && fi.Size() <= arch.MaxMap:
+		e.Mapped = fi.Size()
+		if cfg.Aggregation == AggregatePartitioned {
+			// a batch per partition in each scanner, those queued and
+			// those the aggregators parse
+			e.Buffers = (workers + partitionDepth + 1) * workers * int64(partitionBatch(int(workers)))
+		}
+	case cfg.io() == IOPipeline:
+		rings := max(workers, int64(cfg.readers())) * int64(cfg.ringSize())
+		e.Buffers = (rings + workers + int64(cfg.readers())) * int64(cfg.blockSize())
+	default:
+		e.Buffers = (2*workers + 1) * int64(cfg.blockSize())
+	}
+	extras := cfg.extraBytes()
+	switch {
+	case cfg.Aggregation == AggregateShared:
+		e.Tables = n * (slotBytes + name)
+	case cfg.Aggregation == AggregatePartitioned && e.Mapped > 0:
+		slot := int64(slotBytes) + name
+		if cfg.Map == MapSwiss || cfg.Parse == ParseTwoStage {
+			slot += indexBytes
+		}
+		e.Tables = n * slot
+	default:
+		slot := int64(slotBytes) + extras
+		if cfg.Map == MapSwiss || cfg.Parse == ParseTwoStage {
+			slot += indexBytes
+		}
+		e.Tables = workers * n * slot
+		e.Interner = n * (internBytes + name)
+	}
+	e.Merge = n * (slotBytes + extras + sortBytes)
+	return e, nil
+}
+
+// extraBytes returns the per-station options of c a table holds for each
+// station.
+func (c Config) extraBytes() int64 {
+	var b int64
+	if c.Provenance {
+		b += extraBytes + extremeBytes
+	}
+	if c.Distinct {
+		b += extraBytes + int64(len(distinctSet{}))
+	}
+	if c.Moments {
+		b += extraBytes + 8
+	}
+	if c.Percentiles {
+		b += extraBytes + digestBytes
+	}
+	if c.Frequencies {
+		b += extraBytes + 4*int64(len(frequencies{}))
+	}
+	if c.SamplePerStation > 0 {
+		b += extraBytes + 4*int64(c.SamplePerStation)
+	}
+	return b
+}
+
+// stationProbe is what EstimateMemory learns from the start of the input.
+type stationProbe struct {
+	stations  int
+	exact     bool
+	nameBytes int // mean length of a name
+	// rowGroupBytes is the largest row group of Parquet, decoded
+	rowGroupBytes int64
+}
+
+// probeStations counts the stations at the start of the input f of the
+// given size.
+func (c Config) probeStations(f *os.File, size int64) (stationProbe, error) {
+	if c.Format == FormatParquet {
+		return probeParquet(f, size)
+	}
+	data := make([]byte, min(size, probeBytes))
+	if _, err := io.ReadFull(f, data); err != nil {
+		return stationProbe{}, err
+	}
+	exact := int64(len(data)) == size
+	if !exact {
+		data = data[:bytes.LastIndexByte(data, '\n')+1]
+	}
+	// the probe aggregates the keys of c alone, without its outputs
+	probe := Config{
+		Workers:       1,
+		Format:        c.Format,
+		SkipHeader:    c.SkipHeader,
+		CommentPrefix: c.CommentPrefix,
+		Delimiter:     c.Delimiter,
+		Normalize:     c.Normalize,
+		Hooks:         c.Hooks,
+		KeyColumn:     c.KeyColumn,
+		GroupBy:       c.GroupBy,
+		Window:        Window{Size: c.Window.Size, Column: c.Window.Column, Lateness: c.Window.Lateness},
+	}
+	res, err := Process(bytes.NewReader(data), probe)
+	if err != nil {
+		return stationProbe{}, err
+	}
+	counts := make(map[string]int64, res.Len())
+	for name, s := range res.All() {
+		counts[name] = s.Count
+	}
+	return estimateStations(counts, res.rows(), exact, float64(size)/float64(max(len(data), 1))), nil
+}
+
+// probeParquet counts the stations of the first row group of the Parquet
+// file f.
+func probeParquet(f *os.File, size int64) (stationProbe, error) {
+	pf, err := parquet.Open(f, size)
+	if err != nil {
+		return stationProbe{}, err
+	}
+	station, _, err := parquetColumns(pf)
+	if err != nil || pf.RowGroups() == 0 {
+		return stationProbe{exact: true}, err
+	}
+	var rows, largest int64
+	for rg := range pf.RowGroups() {
+		rows += pf.Rows(rg)
+		// a value is the bytes of the name, a float and a null flag
+		largest = max(largest, pf.Bytes(rg)+40*pf.Rows(rg))
+	}
+	names, err := pf.ReadColumn(0, station)
+	if err != nil {
+		return stationProbe{}, err
+	}
+	counts := map[string]int64{}
+	for i, name := range names.Bytes {
+		if names.Null == nil || !names.Null[i] {
+			counts[string(name)]++
+		}
+	}
+	p := estimateStations(counts, int64(names.Len()), pf.RowGroups() == 1, float64(rows)/float64(max(names.Len(), 1)))
+	p.rowGroupBytes = largest
+	return p, nil
+}
+
+// estimateStations extrapolates the stations of the input from the counts
+// of those a sample of it had, the input being scale times its rows.
+func estimateStations(counts map[string]int64, rows int64, exact bool, scale float64) stationProbe {
+	p := stationProbe{stations: len(counts), exact: exact}
+	var names, once, twice int
+	for name, n := range counts {
+		names += len(name)
+		switch n {
+		case 1:
+			once++
+		case 2:
+			twice++
+		}
+	}
+	if len(counts) > 0 {
+		p.nameBytes = names / len(counts)
+	}
+	if !exact {
+		// the bias-corrected Chao1 estimate, which stays finite without
+		// stations seen twice
+		chao1 := float64(len(counts)) + float64(once)*float64(once-1)/float64(2*(twice+1))
+		p.stations = int(min(chao1, float64(rows)*scale))
+	}
+	return p
+}
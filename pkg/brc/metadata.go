@@ -0,0 +1,182 @@
+package brc
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// StationInfo is the metadata of a station, such as a lookup file provides.
+type StationInfo struct {
+	Country   string
+	Latitude  float64
+	Elevation float64 // in meters
+}
+
+// Metadata maps station names to their StationInfo.
+type Metadata map[string]StationInfo
+
+// ReadMetadata reads station metadata as CSV with a header naming the
+// columns, in any order:
+//
+//	station,country,latitude,elevation
+//	Abha,SA,18.2164,2270
+//
+// Only station is required, empty fields are zero, other columns and lines
+// starting with # are skipped.
+func ReadMetadata(r io.Reader) (Metadata, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("read metadata: no header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read metadata: %w", err)
+	}
+	columns := map[string]int{"station": -1, "country": -1, "latitude": -1, "elevation": -1}
+	for i, name := range header {
+		if _, ok := columns[strings.ToLower(name)]; ok {
+			columns[strings.ToLower(name)] = i
+		}
+	}
+	if columns["station"] < 0 {
+		return nil, errors.New("read metadata: no station column")
+	}
+
+	m := Metadata{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return m, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read metadata: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(column string) string {
+			if i := columns[column]; i >= 0 && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		number := func(column string) (float64, error) {
+			s := field(column)
+			if s == "" {
+				return 0, nil
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return 0, fmt.Errorf("read metadata: line %d: invalid %s %q", line, column, s)
+			}
+			return v, nil
+		}
+		station := field("station")
+		if station == "" {
+			return nil, fmt.Errorf("read metadata: line %d: no station", line)
+		}
+		info := StationInfo{Country: field("country")}
+		if info.Latitude, err = number("latitude"); err != nil {
+			return nil, err
+		}
+		if info.Elevation, err = number("elevation"); err != nil {
+			return nil, err
+		}
+		m[station] = info
+	}
+}
+
+// Country returns the country of the station of name, with the key of a
+// grouped name ignored, or "" if m has none for it. Names of ungrouped
+// results with a semicolon are looked up whole, see Result.Split.
+func (m Metadata) Country(name string) string {
+	if info, ok := m[name]; ok {
+		return info.Country
+	}
+	station, _ := SplitName(name)
+	return m[station].Country
+}
+
+// Rollup aggregates the stations of r into groups, e.g. countries with
+// Metadata.Country, returning a Result keyed by group whose stats combine
+// those of the group's stations. Stations group maps to "" are left out, and
+// extras such as distinct counts are not rolled up. The groups of a grouped
+// r are grouped, for group to keep the keys.
+func (r *Result) Rollup(group func(name string) string) (*Result, error) {
+	groups := NewResult()
+	groups.grouped = r.grouped
+	for name, s := range r.All() {
+		g := group(name)
+		if g == "" {
+			continue
+		}
+		merged, _ := groups.Get(g)
+		if err := merged.Merge(s); err != nil {
+			return nil, fmt.Errorf("rollup %s: %w", g, err)
+		}
+		groups.Add(g, s)
+	}
+	return groups, nil
+}
+
+// WriteEnrichedTable writes r like WriteTable with the country, latitude and
+// elevation of each station from m after the key, empty for stations m does
+// not know.
+func (r *Result) WriteEnrichedTable(w io.Writer, m Metadata) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("station;key;country;latitude;elevation;min;mean;max;count\n")
+	for name, s := range r.Sorted() {
+		station, key := r.Split(name)
+		bw.WriteString(station)
+		bw.WriteByte(';')
+		bw.WriteString(key)
+		bw.WriteByte(';')
+		if info, ok := m[station]; ok {
+			bw.WriteString(info.Country)
+			bw.WriteByte(';')
+			bw.WriteString(strconv.FormatFloat(info.Latitude, 'f', -1, 64))
+			bw.WriteByte(';')
+			bw.WriteString(strconv.FormatFloat(info.Elevation, 'f', -1, 64))
+		} else {
+			bw.WriteString(";;")
+		}
+		bw.WriteByte(';')
+		bw.WriteString(strings.ReplaceAll(s.String(), "/", ";"))
+		bw.WriteByte(';')
+		bw.WriteString(strconv.FormatInt(s.Count, 10))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// enrichedJSON is a station of the results in JSON with its metadata.
+type enrichedJSON struct {
+	resultJSON
+	Country   string   `json:"country,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Elevation *float64 `json:"elevation,omitempty"`
+}
+
+// WriteEnrichedJSON writes r like WriteResultsJSON with the country,
+// latitude and elevation of each station that m knows.
+func (r *Result) WriteEnrichedJSON(w io.Writer, m Metadata) error {
+	stations := make([]enrichedJSON, 0, r.stations.len())
+	for name, s := range r.Sorted() {
+		e := enrichedJSON{resultJSON: resultJSON{name, float64(s.Min) / 10, s.Mean(), float64(s.Max) / 10, s.Count}}
+		station, _ := r.Split(name)
+		if info, ok := m[station]; ok {
+			e.Country, e.Latitude, e.Elevation = info.Country, &info.Latitude, &info.Elevation
+		}
+		stations = append(stations, e)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stations)
+}
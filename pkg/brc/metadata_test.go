@@ -0,0 +1,48 @@
+package brc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	meta, err := ReadMetadata(strings.NewReader("# stations\ncountry,station,elevation,latitude\nDE,Hamburg,6,53.55\nDE,Berlin,34,52.52\nNO,Oslo,,59.9\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := meta["Oslo"]; info != (StationInfo{Country: "NO", Latitude: 59.9}) {
+		t.Errorf("Wrong metadata of Oslo: %+v", info)
+	}
+
+	res, err := Process(strings.NewReader("Hamburg;1.0\nBerlin;3.0\nOslo;-2.0\nRome;20.1\nBerlin;-1.0\n"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.WriteEnrichedTable(&out, meta)
+	expected := "station;key;country;latitude;elevation;min;mean;max;count\n" +
+		"Berlin;;DE;52.52;34;-1.0;1.0;3.0;2\n" +
+		"Hamburg;;DE;53.55;6;1.0;1.0;1.0;1\n" +
+		"Oslo;;NO;59.9;0;-2.0;-2.0;-2.0;1\n" +
+		"Rome;;;;;20.1;20.1;20.1;1\n"
+	if out.String() != expected {
+		t.Errorf("Wrong enriched table, expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	countries, err := res.Rollup(meta.Country)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	countries.WriteText(&out)
+	if expected := "{DE=-1.0/1.0/3.0, NO=-2.0/-2.0/-2.0}\n"; out.String() != expected {
+		t.Errorf("Wrong rollup, expected %q, got %q", expected, out.String())
+	}
+
+	for _, input := range []string{"", "name,country\nOslo,NO\n", "station,latitude\nOslo,north\n"} {
+		if _, err := ReadMetadata(strings.NewReader(input)); err == nil {
+			t.Errorf("ReadMetadata(%q) succeeded", input)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix || aix || solaris
+
+package brc
+
+import (
+	"errors"
+	"runtime"
+)
+
+func mlock([]byte) error {
+	return errors.New("mlock is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,47 @@
+//go:build unix && !aix && !solaris
+
+package brc
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// mlock locks b into memory, first raising the soft RLIMIT_MEMLOCK up to the
+// hard limit if it is too low for b, and explains a limit that is still too
+// low in the error. The limit is restored once b is locked, so that the rest
+// of the process, and the children it starts, keep the limit they had.
+func mlock(b []byte) error {
+	var lim unix.Rlimit
+	limit := uint64(0)
+	if unix.Getrlimit(unix.RLIMIT_MEMLOCK, &lim) == nil {
+		saved := lim
+		limit = raiseLimit(&lim.Cur, lim.Max, uint64(len(b)))
+		if lim != saved && unix.Setrlimit(unix.RLIMIT_MEMLOCK, &lim) == nil {
+			// lowering the limit again keeps the pages locked already
+			defer unix.Setrlimit(unix.RLIMIT_MEMLOCK, &saved)
+		}
+	}
+	err := unix.Mlock(b)
+	if errors.Is(err, unix.ENOMEM) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EAGAIN) {
+		return fmt.Errorf("mlock %d bytes: %w, the locked memory limit (RLIMIT_MEMLOCK, ulimit -l) is %d bytes", len(b), err, limit)
+	}
+	if err != nil {
+		return fmt.Errorf("mlock: %w", err)
+	}
+	return nil
+}
+
+// raiseLimit raises the soft limit cur towards the hard limit max until it
+// allows need, and returns it. The limits are signed on some BSDs.
+func raiseLimit[T int64 | uint64](cur *T, max T, need uint64) uint64 {
+	if uint64(*cur) < need {
+		*cur = max
+		if uint64(max) > need {
+			*cur = T(need)
+		}
+	}
+	return uint64(*cur)
+}
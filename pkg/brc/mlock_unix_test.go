@@ -0,0 +1,39 @@
+//go:build unix && !aix && !solaris
+
+package brc
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestMlockRestoresLimit(t *testing.T) {
+	var saved unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &saved); err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { unix.Setrlimit(unix.RLIMIT_MEMLOCK, &saved) })
+	// a soft limit of nothing, which mlock raises for the page
+	low := saved
+	low.Cur = 0
+	if err := unix.Setrlimit(unix.RLIMIT_MEMLOCK, &low); err != nil {
+		t.Skip(err)
+	}
+	b, err := unix.Mmap(-1, 0, os.Getpagesize(), unix.PROT_READ, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Munmap(b)
+	if err := mlock(b); err != nil {
+		t.Logf("mlock with a hard limit of %d bytes: %v", saved.Max, err)
+	}
+	var lim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &lim); err != nil {
+		t.Fatal(err)
+	}
+	if lim != low {
+		t.Errorf("RLIMIT_MEMLOCK is %+v after mlock, was %+v", lim, low)
+	}
+}
@@ -0,0 +1,60 @@
+package brc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/arch"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// processMmap maps the file at path into memory and aggregates it in place.
+func processMmap(ctx context.Context, path string, cfg Config) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := fi.Size()
+	if size == 0 {
+		return NewResult(), nil
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("invalid file size: %d", size)
+	}
+	if size > arch.MaxMap {
+		cfg.logger().Info("input too large to map, streaming it", "bytes", size, "max", arch.MaxMap)
+		return processStream(ctx, f, size, cfg)
+	}
+
+	start := time.Now()
+	_, span := cfg.startSpan(ctx, "mmap", attribute.Int64("bytes", size))
+	data, err := mmap(f, int(size))
+	span.End()
+	if err != nil {
+		return nil, fmt.Errorf("mmap: %w", err)
+	}
+	defer munmap(data)
+	cfg.phase("mmap", start, "bytes", size)
+
+	if cfg.Mlock {
+		// unmapping unlocks the pages
+		start := time.Now()
+		if err := mlock(data); err != nil {
+			cfg.logger().Warn("input not locked in memory", "err", err)
+		} else {
+			cfg.phase("mlock", start, "bytes", size)
+			cfg.Summary.lock(size)
+		}
+	}
+
+	return processData(ctx, data, cfg)
+}
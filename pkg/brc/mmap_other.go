@@ -0,0 +1,21 @@
+//go:build !unix
+
+package brc
+
+import (
+	"errors"
+	"os"
+	"runtime"
+)
+
+const DefaultIO = IOStream
+
+var errMmapUnsupported = errors.New("not supported on " + runtime.GOOS + ", use IOStream")
+
+func mmap(f *os.File, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmap(b []byte) error {
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package brc
+
+import (
+	"os"
+	"syscall"
+)
+
+// DefaultIO is the read backend of ProcessFile if Config.IO is not set,
+// IOMmap where files can be mapped and IOStream elsewhere.
+const DefaultIO = IOMmap
+
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,247 @@
+package brc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/djheidihoe/1brc/internal/counter"
+	"github.com/djheidihoe/1brc/internal/cpu"
+)
+
+// monitorBlockSize is the granularity at which workers report progress.
+const monitorBlockSize = 1 << 20 // 1MB
+
+// Monitor exposes the live progress of a running ProcessFile or Process call,
+// e.g. for a dashboard. Pass it in Config.Monitor and poll it from another
+// goroutine; workers only touch it between blocks, so the parse loop itself
+// stays unchanged. Its counters are striped by worker and summed when
+// polled, see package counter; built with the brcnocounters tag they stay
+// zero.
+type Monitor struct {
+	mu        sync.Mutex
+	total     int64
+	workers   []workerMonitor
+	snapshots []*Result
+	shared    *sharedTable
+
+	bytes, rows, malformed *counter.Striped
+
+	// generation of the latest Snapshot request, workers publish a copy of
+	// their table whenever it changed since their last publication
+	snapshotGen atomic.Int64
+	// generation of the latest Progress request, workers count the rows of
+	// their table whenever it changed since they last did
+	progressGen atomic.Int64
+}
+
+// workerMonitor is the state of a worker, padded so that the workers
+// updating theirs do not write the cache line of their neighbors.
+type workerMonitor struct {
+	done  atomic.Bool
+	total int64
+	// only accessed by the worker itself
+	gen, rowsGen, rows int64
+	_                  cpu.CacheLinePad
+}
+
+// Progress is a point-in-time view of a Monitor.
+type Progress struct {
+	// TotalBytes is the input size, zero if unknown (e.g. reading stdin).
+	TotalBytes int64
+	// Rows is the number of rows aggregated, as of the previous call of
+	// Progress, as workers count them when polled.
+	Rows int64
+	// Malformed is the number of malformed lines skipped.
+	Malformed int64
+	Workers   []WorkerProgress
+}
+
+// WorkerProgress describes a single worker.
+type WorkerProgress struct {
+	// Bytes processed so far.
+	Bytes int64
+	// TotalBytes assigned to the worker, zero if work is handed out
+	// dynamically.
+	TotalBytes int64
+	Done       bool
+}
+
+// Bytes returns the sum of bytes processed by all workers.
+func (p Progress) Bytes() int64 {
+	var n int64
+	for _, w := range p.Workers {
+		n += w.Bytes
+	}
+	return n
+}
+
+// NewMonitor returns a Monitor for a single run.
+func NewMonitor() *Monitor {
+	return &Monitor{}
+}
+
+// Progress returns the current progress, it is empty until the run started.
+func (m *Monitor) Progress() Progress {
+	m.progressGen.Add(1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := Progress{TotalBytes: m.total, Workers: make([]WorkerProgress, len(m.workers))}
+	if m.bytes == nil {
+		return p
+	}
+	p.Rows, p.Malformed = m.rows.Load(), m.malformed.Load()
+	if m.shared != nil && counter.Enabled {
+		p.Rows = m.shared.rows()
+	}
+	for i := range m.workers {
+		w := &m.workers[i]
+		p.Workers[i] = WorkerProgress{Bytes: m.bytes.Stripe(i), TotalBytes: w.total, Done: w.done.Load()}
+	}
+	return p
+}
+
+// WriteMetrics writes the Progress of m in the Prometheus text exposition
+// format, for a /metrics endpoint.
+func (m *Monitor) WriteMetrics(w io.Writer) error {
+	p := m.Progress()
+	bw := bufio.NewWriter(w)
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	metric("onebrc_input_bytes", "gauge", "Size of the input, 0 if unknown.")
+	fmt.Fprintf(bw, "onebrc_input_bytes %d\n", p.TotalBytes)
+	metric("onebrc_processed_bytes_total", "counter", "Bytes of the input aggregated by each worker.")
+	for i, wp := range p.Workers {
+		fmt.Fprintf(bw, "onebrc_processed_bytes_total{worker=\"%d\"} %d\n", i, wp.Bytes)
+	}
+	metric("onebrc_rows_total", "counter", "Rows aggregated.")
+	fmt.Fprintf(bw, "onebrc_rows_total %d\n", p.Rows)
+	metric("onebrc_malformed_lines_total", "counter", "Malformed lines skipped.")
+	fmt.Fprintf(bw, "onebrc_malformed_lines_total %d\n", p.Malformed)
+	done := 0
+	for _, wp := range p.Workers {
+		if wp.Done {
+			done++
+		}
+	}
+	metric("onebrc_workers", "gauge", "Workers of the run.")
+	fmt.Fprintf(bw, "onebrc_workers %d\n", len(p.Workers))
+	metric("onebrc_workers_done", "gauge", "Workers done with their input.")
+	fmt.Fprintf(bw, "onebrc_workers_done %d\n", done)
+	return bw.Flush()
+}
+
+// Snapshot returns the merged tables as published by the workers in response
+// to the previous Snapshot call, so polling periodically yields results that
+// lag by one interval. Finished workers always contribute their final table.
+// With AggregateShared the snapshot is read from the shared table instead and
+// does not lag.
+func (m *Monitor) Snapshot() *Result {
+	m.snapshotGen.Add(1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.shared != nil {
+		return m.shared.result()
+	}
+	merged := NewResult()
+	for _, s := range m.snapshots {
+		if s != nil {
+			merged.merge(s)
+		}
+	}
+	return merged
+}
+
+// start is called by the backends once the work is distributed. sizes holds
+// the bytes assigned to each worker, or zeros if unknown, and shared is the
+// table of AggregateShared, if any.
+func (m *Monitor) start(total int64, sizes []int64, shared *sharedTable) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total = total
+	m.workers = make([]workerMonitor, len(sizes))
+	m.snapshots = make([]*Result, len(sizes))
+	m.shared = shared
+	m.bytes, m.rows, m.malformed = counter.New(len(sizes)), counter.New(len(sizes)), counter.New(len(sizes))
+	for i, size := range sizes {
+		m.workers[i].total = size
+	}
+}
+
+// advance records that worker aggregated n more bytes into r, skipping
+// malformed lines.
+func (m *Monitor) advance(worker int, n int, malformed int64, r *Result) {
+	if m == nil {
+		return
+	}
+	w := &m.workers[worker]
+	m.bytes.Add(worker, int64(n))
+	m.malformed.Add(worker, malformed)
+	if gen := m.progressGen.Load(); gen != w.rowsGen {
+		w.rowsGen = gen
+		m.countRows(worker, r)
+	}
+	if gen := m.snapshotGen.Load(); gen != w.gen {
+		w.gen = gen
+		m.publish(worker, r.clone())
+	}
+}
+
+// countRows adds the rows of r since it last counted them to those of
+// worker. Summing the counts of the stations of r costs more than a block
+// of a table of many of them, so it is left for when Progress asks.
+func (m *Monitor) countRows(worker int, r *Result) {
+	if !counter.Enabled {
+		return
+	}
+	w := &m.workers[worker]
+	rows := r.rows()
+	m.rows.Add(worker, rows-w.rows)
+	w.rows = rows
+}
+
+// finish publishes the final table of worker.
+func (m *Monitor) finish(worker int, r *Result) {
+	if m == nil {
+		return
+	}
+	m.countRows(worker, r)
+	m.publish(worker, r.clone())
+	m.workers[worker].done.Store(true)
+}
+
+func (m *Monitor) publish(worker int, r *Result) {
+	m.mu.Lock()
+	m.snapshots[worker] = r
+	m.mu.Unlock()
+}
+
+// parse aggregates chunk into r in blocks, waiting for pace and as long as
+// slow takes to read each before and reporting progress and the parse
+// position to ra after each, and returns the number of malformed lines
+// skipped. With chaos the blocks are of random sizes and followed by pauses.
+func (m *Monitor) parse(worker int, chunk []byte, r *Result, pace *throttle, slow *slowStorage, chaos *chaos, ra *readahead) (malformed int64) {
+	if m == nil && pace == nil && slow == nil && chaos == nil && ra == nil {
+		return parseChunk(chunk, r)
+	}
+	for len(chunk) > 0 {
+		block, rest := cutBlock(chunk, chaos.size(monitorBlockSize))
+		pace.wait(len(block))
+		slow.read(len(block))
+		n := parseChunk(block, r)
+		malformed += n
+		m.advance(worker, len(block), n, r)
+		ra.advance(len(block))
+		chaos.pause()
+		chunk = rest
+	}
+	return malformed
+}
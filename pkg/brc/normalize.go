@@ -0,0 +1,87 @@
+package brc
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize selects opt-in clean-ups of station names for dirty real-world
+// exports, where e.g. "Zürich", "Zürich " and "zürich" are one station.
+// Names are grouped, and reported, in their normalized form.
+type Normalize uint8
+
+const (
+	// NormalizeTrim removes white space around names and at the end of
+	// lines, which also accepts CRLF line endings.
+	NormalizeTrim Normalize = 1 << iota
+	// NormalizeNFC converts names to Unicode normalization form C, so
+	// precomposed and decomposed spellings of the same letters group
+	// together.
+	NormalizeNFC
+	// NormalizeFoldCase groups names case-insensitively under their lower
+	// case form.
+	NormalizeFoldCase
+)
+
+// normalizer applies a Normalize to the lines of one worker, reusing its
+// buffers so clean names cost no allocation.
+type normalizer struct {
+	flags    Normalize
+	nfc, low []byte
+}
+
+func newNormalizer(flags Normalize) *normalizer {
+	if flags == 0 {
+		return nil
+	}
+	return &normalizer{flags: flags}
+}
+
+// line prepares a line without its newline for parsing.
+func (n *normalizer) line(line []byte) []byte {
+	if n.flags&NormalizeTrim != 0 {
+		line = bytes.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return line
+}
+
+// name returns the normalized form of name. The result is only valid until
+// the next call.
+func (n *normalizer) name(name []byte) []byte {
+	if n.flags&NormalizeTrim != 0 {
+		name = bytes.TrimSpace(name)
+	}
+	if n.flags&NormalizeNFC != 0 && !norm.NFC.IsNormal(name) {
+		n.nfc = norm.NFC.Append(n.nfc[:0], name...)
+		name = n.nfc
+	}
+	if n.flags&NormalizeFoldCase != 0 && hasUpper(name) {
+		n.low = n.low[:0]
+		for len(name) > 0 {
+			r, size := utf8.DecodeRune(name)
+			if r == utf8.RuneError && size == 1 {
+				// keep invalid bytes as they are
+				n.low = append(n.low, name[0])
+			} else {
+				n.low = utf8.AppendRune(n.low, unicode.ToLower(r))
+			}
+			name = name[size:]
+		}
+		name = n.low
+	}
+	return name
+}
+
+// hasUpper reports whether name may change when lower cased, i.e. it holds
+// an upper case ASCII letter or any non-ASCII rune.
+func hasUpper(name []byte) bool {
+	for _, c := range name {
+		if c >= utf8.RuneSelf || 'A' <= c && c <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
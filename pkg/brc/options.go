@@ -0,0 +1,199 @@
+package brc
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option sets a field of a Config, see NewConfig.
+type Option func(*Config)
+
+// NewConfig returns the Config with opts applied to the zero value, or an
+// error if the combination is invalid, so mistakes surface before any input
+// is read:
+//
+//	cfg, err := brc.NewConfig(brc.WithWorkers(8), brc.WithDelimiter(','), brc.WithStats(brc.Extended))
+func NewConfig(opts ...Option) (Config, error) {
+	var c Config
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c, c.Validate()
+}
+
+// StatLevel selects which per-station statistics are computed beyond min,
+// mean and max.
+type StatLevel int
+
+const (
+	// Basic computes min, mean, max and count only.
+	Basic StatLevel = iota
+	// Extended adds estimated percentiles, distinct counts and standard
+	// deviations, see Config.Percentiles, Config.Distinct and
+	// Config.Moments.
+	Extended
+)
+
+// WithWorkers sets Config.Workers.
+func WithWorkers(n int) Option {
+	return func(c *Config) { c.Workers = n }
+}
+
+// WithIOBackend sets Config.IO.
+func WithIOBackend(io IOBackend) Option {
+	return func(c *Config) { c.IO = io }
+}
+
+// WithReaders sets Config.Readers.
+func WithReaders(n int) Option {
+	return func(c *Config) { c.Readers = n }
+}
+
+// WithRingSize sets Config.RingSize.
+func WithRingSize(n int) Option {
+	return func(c *Config) { c.RingSize = n }
+}
+
+// WithFormat sets Config.Format.
+func WithFormat(f InputFormat) Option {
+	return func(c *Config) { c.Format = f }
+}
+
+// WithAggregation sets Config.Aggregation.
+func WithAggregation(a Aggregation) Option {
+	return func(c *Config) { c.Aggregation = a }
+}
+
+// WithStationMap sets Config.Map.
+func WithStationMap(m StationMap) Option {
+	return func(c *Config) { c.Map = m }
+}
+
+// WithParseLoop sets Config.Parse.
+func WithParseLoop(p ParseLoop) Option {
+	return func(c *Config) { c.Parse = p }
+}
+
+// WithStrict sets Config.Strict.
+func WithStrict(strict bool) Option {
+	return func(c *Config) { c.Strict = strict }
+}
+
+// WithBlockSize sets Config.BlockSize.
+func WithBlockSize(n int) Option {
+	return func(c *Config) { c.BlockSize = n }
+}
+
+// WithDelimiter sets Config.Delimiter.
+func WithDelimiter(d byte) Option {
+	return func(c *Config) { c.Delimiter = d }
+}
+
+// WithStats enables the statistics of level.
+func WithStats(level StatLevel) Option {
+	return func(c *Config) {
+		extended := level >= Extended
+		c.Percentiles, c.Distinct, c.Moments = extended, extended, extended
+	}
+}
+
+// WithLogger sets Config.Logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Config) { c.Logger = l }
+}
+
+// WithCacheDir sets Config.CacheDir.
+func WithCacheDir(dir string) Option {
+	return func(c *Config) { c.CacheDir = dir }
+}
+
+// WithDictionary sets Config.Dictionary.
+func WithDictionary(d *Dictionary) Option {
+	return func(c *Config) { c.Dictionary = d }
+}
+
+// WithSkipHeader sets Config.SkipHeader.
+func WithSkipHeader(n int) Option {
+	return func(c *Config) { c.SkipHeader = n }
+}
+
+// WithCommentPrefix sets Config.CommentPrefix.
+func WithCommentPrefix(prefix string) Option {
+	return func(c *Config) { c.CommentPrefix = prefix }
+}
+
+// WithNormalize sets Config.Normalize.
+func WithNormalize(n Normalize) Option {
+	return func(c *Config) { c.Normalize = n }
+}
+
+// WithHooks appends hooks to Config.Hooks.
+func WithHooks(hooks ...Hook) Option {
+	return func(c *Config) { c.Hooks = append(c.Hooks, hooks...) }
+}
+
+// WithKeyColumn sets Config.KeyColumn.
+func WithKeyColumn(n int) Option {
+	return func(c *Config) { c.KeyColumn = n }
+}
+
+// WithGroupBy sets Config.GroupBy.
+func WithGroupBy(g GroupBy) Option {
+	return func(c *Config) { c.GroupBy = g }
+}
+
+// WithWindow sets Config.Window.
+func WithWindow(w Window) Option {
+	return func(c *Config) { c.Window = w }
+}
+
+// WithAffinity sets Config.Affinity.
+func WithAffinity(a Affinity) Option {
+	return func(c *Config) { c.Affinity = a }
+}
+
+// WithChaos sets Config.Chaos.
+func WithChaos(seed uint64) Option {
+	return func(c *Config) { c.Chaos = seed }
+}
+
+// WithMaxThroughput sets Config.MaxThroughput in bytes per second.
+func WithMaxThroughput(n int64) Option {
+	return func(c *Config) { c.MaxThroughput = n }
+}
+
+// WithHugePages sets Config.HugePages.
+func WithHugePages(huge bool) Option {
+	return func(c *Config) { c.HugePages = huge }
+}
+
+// WithSimulatedStorage sets Config.SimulateReadLatency and
+// Config.SimulateBandwidth in bytes per second.
+func WithSimulatedStorage(latency time.Duration, bandwidth int64) Option {
+	return func(c *Config) { c.SimulateReadLatency, c.SimulateBandwidth = latency, bandwidth }
+}
+
+// WithReadahead sets Config.Readahead in bytes.
+func WithReadahead(n int64) Option {
+	return func(c *Config) { c.Readahead = n }
+}
+
+// WithMlock sets Config.Mlock.
+func WithMlock(lock bool) Option {
+	return func(c *Config) { c.Mlock = lock }
+}
+
+// WithAudit sets Config.Audit.
+func WithAudit(a *Audit) Option {
+	return func(c *Config) { c.Audit = a }
+}
+
+// WithSummary sets Config.Summary.
+func WithSummary(s *Summary) Option {
+	return func(c *Config) { c.Summary = s }
+}
+
+// WithAccumulator sets Config.NewAccumulator.
+func WithAccumulator(newAccumulator func() Accumulator) Option {
+	return func(c *Config) { c.NewAccumulator = newAccumulator }
+}
@@ -0,0 +1,162 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/parquet"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// parquetColumns returns the columns of station names and readings of f.
+func parquetColumns(f *parquet.File) (station, temperature int, err error) {
+	station, temperature = -1, -1
+	for i, c := range f.Columns() {
+		switch {
+		case c.Name == "station" && c.Type == parquet.ByteArray:
+			station = i
+		case c.Name == "temperature" && c.Type.Numeric():
+			temperature = i
+		}
+	}
+	for i, c := range f.Columns() {
+		switch {
+		case station < 0 && c.Type == parquet.ByteArray:
+			station = i
+		case temperature < 0 && c.Type.Numeric():
+			temperature = i
+		}
+	}
+	if station < 0 || temperature < 0 {
+		return 0, 0, errors.New("parquet: no string column of stations and numeric column of readings")
+	}
+	return station, temperature, nil
+}
+
+// processParquet aggregates the Parquet file at path, each worker reading
+// the next row group until none is left.
+func processParquet(ctx context.Context, path string, cfg Config) (*Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	f, err := parquet.Open(cfg.newSlowStorage().readerAt(file), fi.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	station, temperature, err := parquetColumns(f)
+	if err != nil {
+		return nil, err
+	}
+
+	log := cfg.logger()
+	workers := max(min(cfg.workers(), f.RowGroups()), 1)
+	placement, err := cfg.placement(workers, nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	parseCtx, span := cfg.startSpan(ctx, "parse", attribute.Int("row_groups", f.RowGroups()))
+	groups := make(chan int, f.RowGroups())
+	for rg := range f.RowGroups() {
+		groups <- rg
+	}
+	close(groups)
+	shared, dict := cfg.newSharedTable(), cfg.newDictionary()
+	cfg.Monitor.start(fi.Size(), make([]int64, workers), shared)
+	pace := cfg.newThrottle()
+
+	var wg sync.WaitGroup
+	results := make([]*Result, workers)
+	malformed := make([]int64, workers)
+	errs := make([]error, workers)
+	for i := range workers {
+		wg.Go(func() {
+			cfg.pinWorker(placement, i)
+			log.Debug("worker started", "worker", i)
+			workerStart := time.Now()
+			_, workerSpan := cfg.startSpan(parseCtx, "parse row groups", attribute.Int("worker", i))
+			r := cfg.newResult()
+			r.shared, r.stations.dict = shared, dict
+			chaos := cfg.newChaos(i + 1)
+			for rg := range groups {
+				pace.wait(int(f.Bytes(rg)))
+				names, err := f.ReadColumn(rg, station)
+				if err != nil {
+					errs[i] = fmt.Errorf("%s: row group %d: %w", path, rg, err)
+					break
+				}
+				readings, err := f.ReadColumn(rg, temperature)
+				if err != nil {
+					errs[i] = fmt.Errorf("%s: row group %d: %w", path, rg, err)
+					break
+				}
+				bad := addRows(r, names, readings)
+				malformed[i] += bad
+				cfg.Monitor.advance(i, int(f.Bytes(rg)), bad, r)
+				chaos.pause()
+			}
+			cfg.Monitor.finish(i, r)
+			results[i] = r
+			finishWorker(log, workerSpan, i, workerStart, r, malformed[i])
+		})
+	}
+	wg.Wait()
+	span.End()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	cfg.phase("parse", start, "row_groups", f.RowGroups(), "workers", workers)
+
+	if err := cfg.checkMalformed(sum(malformed)); err != nil {
+		return nil, err
+	}
+	res := mergeResults(ctx, results, shared, cfg)
+	cfg.Summary.fill(res, placement, workers, fi.Size(), sum(malformed))
+	return res, nil
+}
+
+// addRows aggregates the rows of a row group into r and returns the number
+// of malformed rows: those with a null, an empty name or one with a
+// newline, or a reading that is not a number from -99.9 to 99.9.
+func addRows(r *Result, names, readings *parquet.Values) (malformed int64) {
+	for i, name := range names.Bytes {
+		if (names.Null != nil && names.Null[i]) || (readings.Null != nil && readings.Null[i]) {
+			malformed++
+			continue
+		}
+		// readings are rounded to tenths, as the text has them
+		v := math.Round(readings.Floats[i] * 10)
+		if !(v >= -999 && v <= 999) {
+			malformed++
+			continue
+		}
+		if r.opts != nil && r.opts.norm != nil {
+			name = r.opts.norm.name(name)
+		}
+		if len(name) == 0 || bytes.IndexByte(name, '\n') >= 0 {
+			malformed++
+			continue
+		}
+		tenths := int32(v)
+		if r.opts != nil && r.opts.hooks != nil {
+			var keep bool
+			if name, tenths, keep = r.opts.hook(name, tenths); !keep {
+				continue
+			}
+		}
+		r.addReading(name, tenths, position{})
+	}
+	return malformed
+}
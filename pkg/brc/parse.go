@@ -0,0 +1,326 @@
+package brc
+
+import (
+	"bytes"
+	"math/bits"
+
+	"github.com/djheidihoe/1brc/internal/arch"
+	"github.com/djheidihoe/1brc/internal/swiss"
+)
+
+// parseChunk aggregates every line of buf into r and returns the number of
+// malformed lines skipped. buf must start at a line boundary; a missing
+// trailing newline is tolerated.
+// Lines are "City;[-]d[d].d\n".
+func parseChunk(buf []byte, r *Result) (malformed int64) {
+	switch {
+	case r.opts != nil || r.shared != nil:
+	case r.keyColumn > 0:
+		return parseChunkKeyed(buf, r)
+	case r.twoStage:
+		return parseChunkTwoStage(buf, r)
+	case r.index != nil:
+		return parseChunkIndexed(buf, r)
+	case r.strict && arch.FastWords:
+		return parseChunkPairs(buf, r)
+	}
+	return parseLines(buf, r)
+}
+
+// parseLines is parseChunk with a line per iteration and every option.
+func parseLines(buf []byte, r *Result) (malformed int64) {
+	var prov *provenance
+	if r.opts != nil {
+		prov = r.opts.prov
+	}
+	for len(buf) > 0 {
+		nl := bytes.IndexByte(buf, '\n')
+		var line []byte
+		var at position
+		if prov != nil {
+			n := nl + 1
+			if nl < 0 {
+				n = len(buf)
+			}
+			at = prov.advance(n)
+		}
+		if nl < 0 {
+			line, buf = buf, nil
+		} else {
+			line, buf = buf[:nl], buf[nl+1:]
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		var name []byte
+		var tenths int32
+		var ok bool
+		if r.opts == nil {
+			name, tenths, ok = parseLine(line, ';')
+		} else {
+			var skip bool
+			if name, tenths, skip, ok = r.opts.parse(line); skip {
+				continue
+			}
+		}
+		if !ok {
+			malformed++
+			continue
+		}
+		r.addReading(name, tenths, at)
+	}
+	return malformed
+}
+
+// parseChunkKeyed is parseChunk with Config.KeyColumn, for results without
+// other per-line options, which cuts the key out of each line as parseLine
+// does the name.
+func parseChunkKeyed(buf []byte, r *Result) (malformed int64) {
+	for len(buf) > 0 {
+		line := buf
+		if nl := bytes.IndexByte(buf, '\n'); nl >= 0 {
+			line, buf = buf[:nl], buf[nl+1:]
+		} else {
+			buf = nil
+		}
+		if len(line) == 0 {
+			continue
+		}
+		key, tenths, ok := parseKeyLine(line, r.keyColumn, ';')
+		if !ok {
+			malformed++
+			continue
+		}
+		r.addReading(key, tenths, position{})
+	}
+	return malformed
+}
+
+// addReading aggregates a reading of station name into r, read at at with
+// Config.Provenance.
+func (r *Result) addReading(name []byte, tenths int32, at position) {
+	if r.shared != nil {
+		r.shared.add(name, tenths)
+		return
+	}
+	var i int
+	if r.index != nil {
+		p, found := r.index.Upsert(name)
+		if !found {
+			*p = int32(r.stations.slot(name))
+		}
+		i = int(*p)
+	} else {
+		i = r.stations.slot(name)
+	}
+	if r.opts != nil && r.opts.prov != nil {
+		r.observe(name, r.stations.stats(i), tenths, at)
+	}
+	if r.distinct != nil {
+		r.markDistinct(name, tenths)
+	}
+	if r.moments != nil {
+		r.addMoments(name, tenths)
+	}
+	if r.sketches != nil {
+		r.sketch(name, tenths)
+	}
+	if r.freqs != nil {
+		r.countReading(name, tenths)
+	}
+	if r.samples != nil {
+		r.sample(name, tenths, r.opts.sample)
+	}
+	if r.custom != nil {
+		r.observeCustom(name, tenths)
+	}
+	r.stations.add(i, tenths)
+}
+
+// parseChunkIndexed is parseChunk with MapSwiss, for results without per-line
+// options. Short names are looked up by the words splitShort loads.
+func parseChunkIndexed(buf []byte, r *Result) (malformed int64) {
+	for len(buf) > 0 {
+		n := bytes.IndexByte(buf, '\n')
+		if n < 0 {
+			n = len(buf)
+		}
+		line := buf[:n]
+		name, w0, w1, short := splitShort(buf, n)
+		buf = buf[min(n+1, len(buf)):]
+		if n == 0 {
+			continue
+		}
+
+		var p *int32
+		var found bool
+		tenths, ok := int32(0), false
+		if short {
+			tenths, ok = parseTenths(line[len(name)+1:])
+			if ok {
+				p, found = r.index.UpsertWords(name, w0, w1)
+			}
+		} else if name, tenths, ok = parseLine(line, ';'); ok {
+			p, found = r.index.Upsert(name)
+		}
+		if !ok {
+			malformed++
+			continue
+		}
+		if !found {
+			*p = int32(r.stations.slot(name))
+		}
+		r.stations.add(int(*p), tenths)
+	}
+	return malformed
+}
+
+// semicolons returns the high bit of each byte of w that is ';'. Bytes above
+// the lowest match may be reported falsely.
+func semicolons(w uint64) uint64 {
+	const lsb, msb = 0x0101010101010101, 0x8080808080808080
+	x := w ^ (lsb * ';')
+	return (x - lsb) &^ x & msb
+}
+
+// splitShort speculates that the line of n bytes at the start of buf has a
+// name of less than swiss.ShortKey bytes: it loads the first 16 bytes of buf
+// as two words, finds the semicolon in them and returns the name and its
+// swiss.Words, masked at the semicolon. ok is false if buf is shorter, the
+// name longer or empty, or the semicolon not in the line, which leaves the
+// line to parseLine. It is always false without arch.FastWords.
+func splitShort(buf []byte, n int) (name []byte, w0, w1 uint64, ok bool) {
+	if !arch.FastWords || len(buf) < swiss.ShortKey {
+		return nil, 0, 0, false
+	}
+	w0 = load64(buf, 0)
+	w1 = load64(buf, 8)
+	var i int
+	if m := semicolons(w0); m != 0 {
+		i = bits.TrailingZeros64(m) / 8
+		w0, w1 = w0&(1<<(8*i)-1), 0
+	} else if m := semicolons(w1); m != 0 {
+		i = 8 + bits.TrailingZeros64(m)/8
+		w1 &= 1<<(8*(i-8)) - 1
+	} else {
+		return nil, 0, 0, false
+	}
+	if i == 0 || i >= n {
+		return nil, 0, 0, false
+	}
+	return buf[:i], w0, w1, true
+}
+
+// parseOptions are the optional per-line settings of a worker.
+type parseOptions struct {
+	norm      *normalizer
+	comment   []byte
+	delim     byte
+	group     GroupBy
+	window    *windowParser
+	prov      *provenance
+	sample    int           // reservoir size, see Config.SamplePerStation
+	key       []byte        // scratch buffer for composite keys
+	decoder   RecordDecoder // of Config.Format, nil for text
+	hooks     []Hook
+	keyColumn int // see Config.KeyColumn
+}
+
+// parse is parseLine with the optional settings applied. skip reports
+// comment lines and records dropped by hooks, which are neither aggregated
+// nor malformed. The name is only valid until the next call.
+func (o *parseOptions) parse(line []byte) (name []byte, tenths int32, skip, ok bool) {
+	if o.comment != nil && bytes.HasPrefix(line, o.comment) {
+		return nil, 0, true, false
+	}
+	if o.norm != nil {
+		line = o.norm.line(line)
+	}
+
+	var key []byte
+	switch {
+	case o.group.Column > 0:
+		name, key, tenths, ok = parseGroupedLine(line, o.group, o.delim)
+	case o.window != nil:
+		name, key, tenths, ok = parseGroupedLine(line, GroupBy{Column: o.window.column}, o.delim)
+		if ok {
+			key, ok = o.window.key(key)
+		}
+	case o.keyColumn > 0:
+		name, tenths, ok = parseKeyLine(line, o.keyColumn, o.delim)
+	case o.decoder != nil:
+		name, tenths, ok = o.decoder.Decode(line)
+		ok = ok && len(name) > 0
+	default:
+		name, tenths, ok = parseLine(line, o.delim)
+	}
+	if ok && o.norm != nil {
+		name = o.norm.name(name)
+		ok = len(name) > 0
+	}
+	if ok && o.hooks != nil {
+		var keep bool
+		if name, tenths, keep = o.hook(name, tenths); !keep {
+			return nil, 0, true, false
+		}
+	}
+	if ok && key != nil {
+		o.key = append(append(append(o.key[:0], name...), ';'), key...)
+		name = o.key
+	}
+	return name, tenths, false, ok
+}
+
+// skipLines returns data without its first n lines.
+func skipLines(data []byte, n int) []byte {
+	for ; n > 0 && len(data) > 0; n-- {
+		nl := bytes.IndexByte(data, '\n')
+		if nl < 0 {
+			return nil
+		}
+		data = data[nl+1:]
+	}
+	return data
+}
+
+// parseLine splits a single line without its newline into station name and
+// temperature in tenths at delim, usually ';'.
+func parseLine(line []byte, delim byte) (name []byte, tenths int32, ok bool) {
+	semi := bytes.IndexByte(line, delim)
+	if semi <= 0 {
+		return nil, 0, false
+	}
+	tenths, ok = parseTenths(line[semi+1:])
+	return line[:semi], tenths, ok
+}
+
+// parseTenths reads a decimal number that matches "^-?[0-9]{1,2}[.][0-9]$",
+// e.g.: -12.3, -3.4, 5.6, 78.9 and returns the value*10, i.e. -123, -34, 56, 789.
+func parseTenths(b []byte) (int32, bool) {
+	negative := len(b) > 0 && b[0] == '-'
+	if negative {
+		b = b[1:]
+	}
+
+	var v int32
+	switch {
+	// 1.2
+	case len(b) == 3 && isDigit(b[0]) && b[1] == '.' && isDigit(b[2]):
+		v = int32(b[0]-'0')*10 + int32(b[2]-'0')
+	// 12.3
+	case len(b) == 4 && isDigit(b[0]) && isDigit(b[1]) && b[2] == '.' && isDigit(b[3]):
+		v = int32(b[0]-'0')*100 + int32(b[1]-'0')*10 + int32(b[3]-'0')
+	default:
+		return 0, false
+	}
+
+	if negative {
+		v = -v
+	}
+	return v, true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
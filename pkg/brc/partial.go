@@ -0,0 +1,194 @@
+package brc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Partial aggregates are the unit of exchange between runs: a worker, a file
+// or a whole machine writes its Result with Write and whoever combines them
+// merges any number of partials back with Read.
+//
+// Binary layout, all integers varint encoded (encoding/binary):
+//
+//	magic   "1BRC"
+//	version uvarint
+//	flags   uvarint, 1 for grouped names, see Result.Grouped; not in version 1
+//	count   uvarint, number of stations
+//	count times, sorted by name:
+//	  name  uvarint length + bytes
+//	  min   varint
+//	  max   varint
+//	  sum   varint
+//	  count uvarint
+//
+// The JSON form carries the same fields for debugging and is recognized by
+// Read as well.
+
+const (
+	partialMagic   = "1BRC"
+	partialVersion = 2
+
+	// partialGrouped is the flag of partials of grouped results
+	partialGrouped = 1
+
+	// sanity limit for a single station name, the spec allows 100 bytes
+	maxPartialNameLen = 1 << 16
+)
+
+// Write encodes r as a binary partial aggregate.
+func (r *Result) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var buf [binary.MaxVarintLen64]byte
+
+	putUvarint := func(v uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+	putVarint := func(v int64) {
+		bw.Write(buf[:binary.PutVarint(buf[:], v)])
+	}
+
+	bw.WriteString(partialMagic)
+	putUvarint(partialVersion)
+	var flags uint64
+	if r.grouped {
+		flags |= partialGrouped
+	}
+	putUvarint(flags)
+	putUvarint(uint64(r.stations.len()))
+	for _, name := range r.Names() {
+		s := r.stations.get(name)
+		putUvarint(uint64(len(name)))
+		bw.WriteString(name)
+		putVarint(int64(s.Min))
+		putVarint(int64(s.Max))
+		putVarint(s.Sum)
+		putUvarint(uint64(s.Count))
+	}
+	return bw.Flush()
+}
+
+type partialJSON struct {
+	Version  int              `json:"version"`
+	Grouped  bool             `json:"grouped,omitempty"`
+	Stations []partialStation `json:"stations"`
+}
+
+type partialStation struct {
+	Name  string `json:"name"`
+	Min   int32  `json:"min"`
+	Max   int32  `json:"max"`
+	Sum   int64  `json:"sum"`
+	Count int64  `json:"count"`
+}
+
+// WriteJSON encodes r as a JSON partial aggregate, values are in tenths.
+func (r *Result) WriteJSON(w io.Writer) error {
+	p := partialJSON{Version: partialVersion, Grouped: r.grouped, Stations: make([]partialStation, 0, r.stations.len())}
+	for _, name := range r.Names() {
+		s := r.stations.get(name)
+		p.Stations = append(p.Stations, partialStation{Name: name, Min: s.Min, Max: s.Max, Sum: s.Sum, Count: s.Count})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// Read decodes a binary or JSON partial aggregate from rd and merges it into
+// r, which is grouped if the partial is. Partials of version 1, which came
+// before the flags, are read as ungrouped.
+func (r *Result) Read(rd io.Reader) error {
+	br := bufio.NewReader(rd)
+	first, err := br.Peek(1)
+	if err != nil {
+		return fmt.Errorf("read partial: %w", err)
+	}
+	if first[0] == '{' {
+		return r.readJSON(br)
+	}
+	return r.readBinary(br)
+}
+
+func (r *Result) readBinary(br *bufio.Reader) error {
+	magic := make([]byte, len(partialMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("read partial: %w", err)
+	}
+	if string(magic) != partialMagic {
+		return errors.New("read partial: bad magic")
+	}
+
+	var err error
+	uvarint := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		var v uint64
+		v, err = binary.ReadUvarint(br)
+		return v
+	}
+	varint := func() int64 {
+		if err != nil {
+			return 0
+		}
+		var v int64
+		v, err = binary.ReadVarint(br)
+		return v
+	}
+
+	version := uvarint()
+	if err == nil && version != 1 && version != partialVersion {
+		return fmt.Errorf("read partial: unsupported version %d", version)
+	}
+	if version >= 2 && uvarint()&partialGrouped != 0 {
+		r.grouped = true
+	}
+	n := uvarint()
+	var name []byte
+	for i := uint64(0); i < n && err == nil; i++ {
+		nameLen := uvarint()
+		if err != nil {
+			break
+		}
+		if nameLen > maxPartialNameLen {
+			return fmt.Errorf("read partial: station name too long: %d", nameLen)
+		}
+		if uint64(cap(name)) < nameLen {
+			name = make([]byte, nameLen)
+		}
+		name = name[:nameLen]
+		if _, err = io.ReadFull(br, name); err != nil {
+			break
+		}
+		s := Stats{Min: int32(varint()), Max: int32(varint()), Sum: varint(), Count: int64(uvarint())}
+		if err == nil {
+			r.mergeStats(string(name), s)
+		}
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("read partial: %w", err)
+	}
+	return nil
+}
+
+func (r *Result) readJSON(br *bufio.Reader) error {
+	var p partialJSON
+	if err := json.NewDecoder(br).Decode(&p); err != nil {
+		return fmt.Errorf("read partial: %w", err)
+	}
+	if p.Version != 1 && p.Version != partialVersion {
+		return fmt.Errorf("read partial: unsupported version %d", p.Version)
+	}
+	r.grouped = r.grouped || p.Grouped
+	for _, s := range p.Stations {
+		r.mergeStats(s.Name, Stats{Min: s.Min, Max: s.Max, Sum: s.Sum, Count: s.Count})
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package brc
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartialRoundTrip(t *testing.T) {
+	res, err := ProcessFile(filepath.Join(samplesDir, "measurements-10000-unique-keys.txt"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected bytes.Buffer
+	res.WriteText(&expected)
+
+	for name, write := range map[string]func(io.Writer) error{
+		"binary": res.Write,
+		"json":   res.WriteJSON,
+	} {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		decoded := NewResult()
+		if err := decoded.Read(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var got bytes.Buffer
+		decoded.WriteText(&got)
+		if got.String() != expected.String() {
+			t.Errorf("%s: round trip changed the result", name)
+		}
+	}
+}
+
+func TestPartialMerge(t *testing.T) {
+	a, _ := Process(strings.NewReader("x;1.0\ny;-5.0\n"), Config{})
+	b, _ := Process(strings.NewReader("x;3.0\nz;7.5\n"), Config{})
+
+	var binaryPartial, jsonPartial bytes.Buffer
+	a.Write(&binaryPartial)
+	b.WriteJSON(&jsonPartial)
+
+	merged := NewResult()
+	if err := merged.Read(&binaryPartial); err != nil {
+		t.Fatal(err)
+	}
+	if err := merged.Read(&jsonPartial); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	merged.WriteText(&out)
+	if expected := "{x=1.0/2.0/3.0, y=-5.0/-5.0/-5.0, z=7.5/7.5/7.5}\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestPartialReadErrors(t *testing.T) {
+	var valid bytes.Buffer
+	res, _ := Process(strings.NewReader("station;12.3\n"), Config{})
+	res.Write(&valid)
+
+	for name, input := range map[string][]byte{
+		"empty":     nil,
+		"bad magic": []byte("2BRC\x01\x00"),
+		"version":   []byte("1BRC\x03\x00"),
+		"truncated": valid.Bytes()[:valid.Len()-2],
+		"json":      []byte(`{"version":1,"stations":[`),
+	} {
+		if err := NewResult().Read(bytes.NewReader(input)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
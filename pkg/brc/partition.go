@@ -0,0 +1,192 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/bufpool"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// partitionBuffer is the size of the batches of lines a scanner of
+	// AggregatePartitioned fills at a time, a batch for each partition, so
+	// that its memory does not grow with the number of partitions.
+	partitionBuffer = 256 << 10
+	// minPartitionBatch bounds the batches of many partitions from below,
+	// as their hand-offs would cost more than the lines
+	minPartitionBatch = 4 << 10
+	// partitionDepth is the number of batches queued for an aggregator
+	partitionDepth = 4
+)
+
+// partitionBatch returns the size of the batches of parts partitions.
+func partitionBatch(parts int) int {
+	return max(partitionBuffer/parts, minPartitionBatch)
+}
+
+// router hands the lines of the scanners of AggregatePartitioned to the
+// aggregators owning their stations: the hash of a station picks its
+// partition, so that each station has a single table and the tables of the
+// partitions never share a key.
+type router struct {
+	seed  maphash.Seed
+	delim byte
+	batch int
+	parts []chan block
+}
+
+func newRouter(parts int, delim byte) *router {
+	r := &router{seed: maphash.MakeSeed(), delim: delim, batch: partitionBatch(parts), parts: make([]chan block, parts)}
+	for i := range r.parts {
+		r.parts[i] = make(chan block, partitionDepth)
+	}
+	return r
+}
+
+// route copies each line of data, up to and including its newline, into
+// the batch of the partition of its station in batches, sending the batches
+// that fill up. A line without a delimiter is routed by all of it, so that
+// an aggregator counts it as malformed.
+func (r *router) route(data []byte, batches [][]byte) {
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		line := data[:end]
+		data = data[end:]
+		key := line
+		if sep := bytes.IndexByte(line, r.delim); sep >= 0 {
+			key = line[:sep]
+		}
+		p := int(maphash.Bytes(r.seed, key) % uint64(len(r.parts)))
+		b := batches[p]
+		if len(b)+len(line) > cap(b) {
+			r.send(p, b)
+			b = bufpool.Get(max(r.batch, len(line)))[:0]
+		}
+		batches[p] = append(b, line...)
+	}
+}
+
+// send hands the batch b to partition p, unless it is empty.
+func (r *router) send(p int, b []byte) {
+	if len(b) == 0 {
+		bufpool.Put(b)
+		return
+	}
+	r.parts[p] <- block{data: b, buf: b}
+}
+
+// close ends the batches of every partition, once the scanners are done.
+func (r *router) close() {
+	for _, ch := range r.parts {
+		close(ch)
+	}
+}
+
+// processPartitioned implements AggregatePartitioned for data, which starts
+// at offset of the input: a scanner per worker finds the lines of a chunk of
+// data and routes them to the aggregator of their partition, see router, and
+// an aggregator per worker parses those of its partition into a table of
+// its own. The tables are disjoint, so they are put together without a
+// merge, see table.concat.
+func processPartitioned(ctx context.Context, data []byte, offset int64, cfg Config) (*Result, error) {
+	log := cfg.logger()
+	first := offset
+	cfg.Audit.reset()
+	chunks := splitChunks(data, cfg.workers(), cfg.newChaos(0))
+	parts := cfg.workers()
+	placement, err := cfg.placement(parts, nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	parseCtx, span := cfg.startSpan(ctx, "parse", attribute.Int("bytes", len(data)), attribute.Int("partitions", parts))
+
+	cfg.Monitor.start(int64(len(data)), make([]int64, parts), nil)
+	pace, slow := cfg.newThrottle(), cfg.newSlowStorage()
+	route := newRouter(parts, cfg.delimiter())
+
+	// each partition holds its share of the stations
+	partCfg := cfg
+	partCfg.CardinalityHint = (cfg.cardinality() + parts - 1) / parts
+	results := make([]*Result, parts)
+	malformed := make([]int64, parts)
+	var aggregators sync.WaitGroup
+	aggregators.Add(parts)
+	for p := range results {
+		go func() {
+			defer aggregators.Done()
+			cfg.pinWorker(placement, p)
+			log.Debug("worker started", "worker", p, "partition", p)
+			workerStart := time.Now()
+			_, workerSpan := cfg.startSpan(parseCtx, "aggregate partition", attribute.Int("worker", p))
+			r := partCfg.newResult()
+			chaos := cfg.newChaos(len(chunks) + p + 1)
+			for b := range route.parts[p] {
+				bad := parseChunk(b.data, r)
+				malformed[p] += bad
+				cfg.Monitor.advance(p, len(b.data), bad, r)
+				bufpool.Put(b.buf)
+				chaos.pause()
+			}
+			cfg.Monitor.finish(p, r)
+			results[p] = r
+			finishWorker(log, workerSpan, p, workerStart, r, malformed[p])
+		}()
+	}
+
+	var scanners sync.WaitGroup
+	scanners.Add(len(chunks))
+	for i, chunk := range chunks {
+		chunkOffset := offset
+		offset += int64(len(chunk))
+		go func() {
+			defer scanners.Done()
+			cfg.Audit.add(i, chunkOffset, chunk)
+			chaos := cfg.newChaos(i + 1)
+			ra := cfg.startReadahead(chunk)
+			defer ra.stop()
+			batches := make([][]byte, parts)
+			for p := range batches {
+				batches[p] = bufpool.Get(route.batch)[:0]
+			}
+			for rest := chunk; len(rest) > 0; {
+				var b []byte
+				b, rest = cutBlock(rest, chaos.size(monitorBlockSize))
+				pace.wait(len(b))
+				slow.read(len(b))
+				route.route(b, batches)
+				ra.advance(len(b))
+				chaos.pause()
+			}
+			for p, b := range batches {
+				route.send(p, b)
+			}
+		}()
+	}
+	scanners.Wait()
+	route.close()
+	aggregators.Wait()
+	span.End()
+	cfg.phase("parse", start, "bytes", len(data), "workers", parts)
+	cfg.hugePages(results)
+
+	if err := cfg.checkMalformed(sum(malformed)); err != nil {
+		return nil, err
+	}
+	res := results[0]
+	for _, r := range results[1:] {
+		res.stations.concat(&r.stations)
+	}
+	if err := cfg.Audit.check(first, first+int64(len(data)), countLines(data), res.rows()+sum(malformed)); err != nil {
+		return nil, err
+	}
+	cfg.Summary.fill(res, placement, parts, int64(len(data)), sum(malformed))
+	return res, nil
+}
@@ -0,0 +1,65 @@
+package brc
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+
+	"github.com/djheidihoe/1brc/internal/tdigest"
+)
+
+// reportedPercentiles are the columns of WritePercentiles.
+var reportedPercentiles = []float64{50, 90, 99}
+
+// Percentile returns the p-th percentile, 0 to 100, of the readings of
+// station name in degrees. It is exact (nearest rank) for results of a run
+// with Config.Frequencies and estimated with Config.Percentiles, and not
+// available otherwise.
+func (r *Result) Percentile(name string, p float64) (float64, bool) {
+	if f, ok := r.freqs[name]; ok {
+		return float64(f.percentile(p, r.stations.get(name).Count)) / 10, true
+	}
+	d, ok := r.sketches[name]
+	if !ok {
+		return 0, false
+	}
+	return d.Quantile(p/100) / 10, true
+}
+
+// sketch records a reading of station name.
+func (r *Result) sketch(name []byte, tenths int32) {
+	d, ok := r.sketches[string(name)]
+	if !ok {
+		d = tdigest.New(tdigest.DefaultCompression)
+		r.sketches[string(name)] = d
+	}
+	d.Add(float64(tenths))
+}
+
+// WritePercentiles writes the median, 90th and 99th percentile of each
+// station, see Percentile, as semicolon separated rows with a header:
+//
+//	station;p50;p90;p99
+//	Abha;18.0;31.2;44.9
+func (r *Result) WritePercentiles(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("station")
+	for _, p := range reportedPercentiles {
+		bw.WriteString(";p")
+		bw.WriteString(strconv.FormatFloat(p, 'f', -1, 64))
+	}
+	bw.WriteByte('\n')
+	for _, name := range r.Names() {
+		if _, ok := r.Percentile(name, 50); !ok {
+			continue
+		}
+		bw.WriteString(name)
+		for _, p := range reportedPercentiles {
+			v, _ := r.Percentile(name, p)
+			bw.WriteByte(';')
+			bw.WriteString(strconv.FormatFloat(v, 'f', 1, 64))
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,300 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/bufpool"
+	"github.com/djheidihoe/1brc/internal/spsc"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultReaders is the number of IO goroutines of IOPipeline if
+// Config.Readers is not set.
+const defaultReaders = 4
+
+func (c Config) readers() int {
+	if c.Readers > 0 {
+		return c.Readers
+	}
+	return defaultReaders
+}
+
+// defaultRingSize is the capacity of a ring of IOPipeline in blocks if
+// Config.RingSize is not set.
+const defaultRingSize = 2
+
+// ringSize returns the capacity of a ring of IOPipeline, Config.RingSize
+// rounded up to a power of two as spsc.New does.
+func (c Config) ringSize() int {
+	if c.RingSize > 0 {
+		return 1 << bits.Len(uint(c.RingSize-1))
+	}
+	return defaultRingSize
+}
+
+// rings connects the readers and workers of IOPipeline by a lock-free
+// single-producer single-consumer ring each, as many as there are readers
+// or workers, whichever is more. Ring j is filled by reader j%readers and
+// drained by worker j%workers, so that each reader fills and each worker
+// drains at least one.
+type rings struct {
+	all       []*spsc.Ring[block]
+	producers [][]*spsc.Ring[block] // by reader
+	consumers [][]*spsc.Ring[block] // by worker
+}
+
+func newRings(readers, workers, size int) *rings {
+	r := &rings{producers: make([][]*spsc.Ring[block], readers), consumers: make([][]*spsc.Ring[block], workers)}
+	for j := range max(readers, workers) {
+		ring := spsc.New[block](size)
+		r.all = append(r.all, ring)
+		r.producers[j%readers] = append(r.producers[j%readers], ring)
+		r.consumers[j%workers] = append(r.consumers[j%workers], ring)
+	}
+	return r
+}
+
+// push hands b to the first ring of reader with room, from the one after
+// the last it pushed to, next, waiting while all are full.
+func (r *rings) push(reader int, next *int, b block) {
+	own := r.producers[reader]
+	for spins := 0; ; spins++ {
+		for range own {
+			ring := own[*next%len(own)]
+			*next++
+			if ring.TryPush(b) {
+				return
+			}
+		}
+		backoff(spins)
+	}
+}
+
+// pop takes a block from a ring of worker, waiting while all are empty, and
+// is false once all are closed and empty.
+func (r *rings) pop(worker int) (block, bool) {
+	own := r.consumers[worker]
+	for spins := 0; ; spins++ {
+		done := true
+		for _, ring := range own {
+			b, ok, closed := ring.TryPop()
+			if ok {
+				return b, true
+			}
+			done = done && closed
+		}
+		if done {
+			return block{}, false
+		}
+		backoff(spins)
+	}
+}
+
+// close ends the blocks of every ring, once the readers are done.
+func (r *rings) close() {
+	for _, ring := range r.all {
+		ring.Close()
+	}
+}
+
+// stats returns how often the readers found a ring full and the workers
+// found all of theirs empty, once both are done.
+func (r *rings) stats() (full, empty uint64) {
+	for _, ring := range r.all {
+		f, e := ring.Stats()
+		full, empty = full+f, empty+e
+	}
+	return full, empty
+}
+
+// backoff waits after a push or pop failed spins times in a row: yielding
+// first, as the other side is usually a block away, then sleeping up to a
+// millisecond while it waits for IO or parses.
+func backoff(spins int) {
+	if spins < 64 {
+		runtime.Gosched()
+		return
+	}
+	time.Sleep(min(time.Duration(spins-63)*10*time.Microsecond, time.Millisecond))
+}
+
+// fragment holds the ends of a block of IOPipeline that the lines cut by
+// its boundaries start and end in.
+type fragment struct {
+	// head is the end of the line the block starts in, up to and including
+	// its newline, empty for the first block
+	head []byte
+	// tail is the start of the line the next block ends, after the last
+	// newline
+	tail []byte
+	// open reports that the block holds no newline, all of it being in head
+	open bool
+	// lines counts the lines of the block for Audit, see lineCounter, with
+	// its first and last byte for those at its boundaries
+	lines       int64
+	first, last byte
+}
+
+// processPipeline implements IOPipeline for the file f of size bytes:
+// Config.Readers goroutines read its blocks at the offsets they claim in
+// turn with ReadAt, and push the whole lines of each on their rings, see
+// rings, which the workers drain. A reader waits while its rings are full,
+// so that at most a block per reader, the rings and a block per worker are
+// in memory, however far the readers get ahead of the parse. The lines cut
+// by the boundaries of the blocks are put together from the fragments at
+// both ends once every block is read, and parsed last.
+func processPipeline(ctx context.Context, f *os.File, size int64, cfg Config) (*Result, error) {
+	if size == 0 {
+		return NewResult(), nil
+	}
+	placement, err := cfg.placement(cfg.workers(), nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	blockSize := int64(cfg.blockSize())
+	parseCtx, span := cfg.startSpan(ctx, "parse", attribute.Int64("block_size", blockSize), attribute.Int("readers", cfg.readers()))
+	defer span.End()
+	ring := newRings(cfg.readers(), cfg.workers(), cfg.ringSize())
+	shared := cfg.newSharedTable()
+	results := make([]*Result, cfg.workers())
+	malformed := make([]int64, len(results))
+	cfg.Monitor.start(size, make([]int64, len(results)), shared)
+	cfg.Audit.reset()
+	wg := cfg.parseBlocks(parseCtx, placement, ring.pop, shared, results, malformed)
+
+	frags := make([]fragment, (size+blockSize-1)/blockSize)
+	pace := cfg.newThrottle()
+	src := cfg.newSlowStorage().readerAt(f)
+	var next atomic.Int64
+	var failed atomic.Bool
+	var errOnce sync.Once
+	var readErr error
+	var readers sync.WaitGroup
+	readers.Add(cfg.readers())
+	for reader := range cfg.readers() {
+		go func() {
+			defer readers.Done()
+			turn := 0
+			for !failed.Load() {
+				i := next.Add(1) - 1
+				if i >= int64(len(frags)) {
+					return
+				}
+				offset := i * blockSize
+				buf := bufpool.Get(int(min(blockSize, size-offset)))
+				if _, err := src.ReadAt(buf, offset); err != nil && err != io.EOF {
+					bufpool.Put(buf)
+					errOnce.Do(func() { readErr = fmt.Errorf("read block at %d: %w", offset, err) })
+					failed.Store(true)
+					return
+				}
+				pace.wait(len(buf))
+				body := frags[i].cut(i, buf, cfg.Audit != nil)
+				if len(body) == 0 {
+					bufpool.Put(buf)
+					continue
+				}
+				ring.push(reader, &turn, block{data: body, seq: int(i), position: position{offset: offset + int64(len(frags[i].head))}, buf: buf})
+			}
+		}()
+	}
+	readers.Wait()
+	var lines int64
+	if readErr == nil {
+		// the readers are done, this goroutine pushes for the first
+		turn := 0
+		lines = stitchFragments(frags, blockSize, size, func(b block) { ring.push(0, &turn, b) })
+	}
+	ring.close()
+	wg.Wait()
+	if readErr != nil {
+		return nil, readErr
+	}
+	full, empty := ring.stats()
+	cfg.logger().Debug("pipeline rings", "rings", len(ring.all), "size", cfg.ringSize(), "full", full, "empty", empty)
+	cfg.Summary.pipeline(len(ring.all), cfg.ringSize(), full, empty)
+	span.SetAttributes(attribute.Int64("bytes", size))
+	cfg.phase("parse", start, "bytes", size, "workers", len(results), "readers", cfg.readers())
+	cfg.hugePages(results)
+	if err := cfg.checkMalformed(sum(malformed)); err != nil {
+		return nil, err
+	}
+	res := mergeResults(ctx, results, shared, cfg)
+	if err := cfg.Audit.check(0, size, lines, res.rows()+sum(malformed)); err != nil {
+		return nil, err
+	}
+	cfg.Summary.fill(res, placement, len(results), size, sum(malformed))
+	return res, nil
+}
+
+// cut copies the fragments of block i of data into fr and returns the whole
+// lines between them, counting the lines with count.
+func (fr *fragment) cut(i int64, data []byte, count bool) []byte {
+	if count {
+		var c lineCounter
+		c.count(data)
+		fr.lines, fr.first, fr.last = c.n, data[0], data[len(data)-1]
+	}
+	first := bytes.IndexByte(data, '\n')
+	switch {
+	case first < 0 && i == 0:
+		fr.tail = bytes.Clone(data)
+		return nil
+	case first < 0:
+		fr.head, fr.open = bytes.Clone(data), true
+		return nil
+	}
+	last := bytes.LastIndexByte(data, '\n')
+	h := 0
+	if i > 0 {
+		h = first + 1
+	}
+	fr.head = bytes.Clone(data[:h])
+	fr.tail = bytes.Clone(data[last+1:])
+	return data[h : last+1]
+}
+
+// stitchFragments pushes the lines cut by the boundaries of the blocks, put
+// together from frags in order, each as a block of its own at its offset,
+// and returns the number of non-empty lines of the input of size bytes,
+// which it counts from frags for Audit.
+func stitchFragments(frags []fragment, blockSize, size int64, push func(block)) int64 {
+	var line []byte
+	var offset, lines int64
+	for i, fr := range frags {
+		line = append(line, fr.head...)
+		if i > 0 {
+			// a newline at the start of a block ends a line unless the
+			// byte before it is one too
+			if prev := frags[i-1].last; fr.first == '\n' && prev != '\n' {
+				lines++
+			}
+		}
+		lines += fr.lines
+		if fr.open {
+			continue
+		}
+		if len(line) > 0 {
+			push(block{data: line, position: position{offset: offset}})
+		}
+		line = bytes.Clone(fr.tail)
+		offset = min(int64(i+1)*blockSize, size) - int64(len(fr.tail))
+	}
+	if len(line) > 0 {
+		push(block{data: line, position: position{offset: offset}})
+	}
+	if last := frags[len(frags)-1].last; last != '\n' {
+		lines++
+	}
+	return lines
+}
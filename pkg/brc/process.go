@@ -0,0 +1,848 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/bufpool"
+	"github.com/djheidihoe/1brc/internal/cgroup"
+	"github.com/djheidihoe/1brc/internal/hugepage"
+	"github.com/djheidihoe/1brc/internal/swiss"
+	"github.com/djheidihoe/1brc/internal/tdigest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IOBackend selects how the input bytes are obtained.
+type IOBackend string
+
+const (
+	// IOMmap maps the whole file into memory and splits it between workers.
+	IOMmap IOBackend = "mmap"
+	// IOStream reads the input sequentially in blocks and hands the blocks
+	// to workers, so memory stays bounded and any io.Reader can be used.
+	IOStream IOBackend = "stream"
+	// IOPipeline reads the blocks of a file with Config.Readers goroutines
+	// of their own, in parallel and out of order, into a bounded ring the
+	// workers parse from, so that IO and parsing are balanced explicitly and
+	// the latency of a network filesystem overlaps between the reads. It
+	// needs a file, Process streams, and cannot be combined with the
+	// settings that need the lines in order: SkipHeader, RangeStart,
+	// RangeEnd, LimitRows, Window and Provenance.
+	IOPipeline IOBackend = "pipeline"
+)
+
+// StationMap selects the hash table workers look stations up in.
+type StationMap string
+
+const (
+	// MapBuiltin uses Go's map keyed by string.
+	MapBuiltin StationMap = "builtin"
+	// MapSwiss indexes the stations in a SwissTable keyed by the name bytes,
+	// whose hash is cheaper than that of Go's map but not meant to withstand
+	// inputs crafted to collide. Go's map is a SwissTable itself since Go
+	// 1.24 and matches groups with SIMD on amd64, so compare the two with
+	// onebrc bench before relying on either.
+	MapSwiss StationMap = "swiss"
+)
+
+const defaultBlockSize = 4 << 20 // 4MB
+
+// Config controls how measurements are processed. The zero value is ready to
+// use.
+type Config struct {
+	// Workers is the number of parallel parsers, defaults to CPUs().
+	Workers int
+	// IO selects the read backend for ProcessFile, defaults to DefaultIO.
+	// IOMmap fails where files cannot be mapped, e.g. on wasip1 and Windows.
+	IO IOBackend
+	// Readers is the number of IO goroutines of IOPipeline, defaults to 4.
+	Readers int
+	// RingSize is the number of blocks each ring between the readers and
+	// the workers of IOPipeline holds, rounded up to a power of two,
+	// defaults to 2.
+	RingSize int
+	// Format selects how the input is decoded, defaults to FormatText.
+	// FormatParquet reads with ReadAt whatever IO is, only in ProcessFile,
+	// and cannot be combined with the settings of lines and byte ranges of
+	// text, nor with GroupBy, Window, Provenance or Audit.
+	Format InputFormat
+	// Aggregation selects how workers combine their Stats, defaults to
+	// AggregatePerWorker.
+	Aggregation Aggregation
+	// Map selects the per-worker station table, defaults to MapBuiltin.
+	// AggregateShared has a table of its own and ignores it.
+	Map StationMap
+	// Parse selects the parse loop of the workers, defaults to ParseFused.
+	Parse ParseLoop
+	// Strict requires every line to be "name;[-]d[d].d", as in the original
+	// challenge. Processing fails with ErrMalformed instead of skipping
+	// malformed lines, and with MapBuiltin and the fused loop the workers
+	// decode two lines per iteration on 64-bit little endian CPUs, see
+	// parseChunkPairs.
+	Strict bool
+	// BlockSize is the read size of the IOStream backend, defaults to 4MB.
+	BlockSize int
+	// Monitor, if set, receives live progress of the run.
+	Monitor *Monitor
+	// Logger receives worker and phase diagnostics, defaults to discarding.
+	Logger *slog.Logger
+	// TracerProvider, if set, receives OpenTelemetry spans for the
+	// processing phases and each worker.
+	TracerProvider trace.TracerProvider
+	// CacheDir enables caching of ProcessFile results in the directory.
+	// Entries are keyed by file size, modification time and sampled content.
+	CacheDir string
+	// DisableGC turns the garbage collector off while parsing and runs a
+	// single collection before returning. The setting is process wide, so
+	// concurrent runs should agree on it. A soft memory limit set with
+	// debug.SetMemoryLimit still triggers collections when it is reached.
+	DisableGC bool
+	// CardinalityHint is the expected number of distinct stations, e.g. 10000
+	// for the 10K station dataset. Per-worker tables are presized for it
+	// instead of growing by rehashing.
+	CardinalityHint int
+	// HugePages places the columns of the per-worker tables, presized for
+	// CardinalityHint or Dictionary, in mappings advised for transparent
+	// huge pages on Linux, to spare the TLB misses of updating the slots of
+	// hundreds of thousands of stations. Without huge pages, or for tables
+	// too small to fill one, it falls back to the heap, and Summary reports
+	// how much of the tables the kernel did back with them.
+	HugePages bool
+	// Dictionary, if set, is the station dictionary the per-worker tables
+	// share, which the run adds its new stations to, so that a run can
+	// start with those of earlier ones, see Dictionary. It cannot be
+	// combined with AggregateShared, GroupBy or Window, and results are not
+	// cached with it set, as a cached run would add none.
+	Dictionary *Dictionary
+	// SkipHeader is the number of header lines at the start of the input,
+	// e.g. 1 for CSV exports starting with "station;temperature".
+	SkipHeader int
+	// RangeStart and RangeEnd restrict processing to the lines starting in
+	// the byte range [RangeStart, RangeEnd) of the input, RangeEnd 0 meaning
+	// its end.
+	RangeStart, RangeEnd int64
+	// LimitRows, if positive, stops after that many lines (after any
+	// header and range restriction).
+	LimitRows int64
+	// CommentPrefix, if set, skips lines starting with it, e.g. "#".
+	CommentPrefix string
+	// Delimiter separates the fields of a line, defaults to ';'.
+	Delimiter byte
+	// Normalize cleans station names before grouping, defaults to none.
+	Normalize Normalize
+	// Hooks, if set, preprocess every well-formed record in order, after
+	// Normalize, to drop or change it, see Hook. Without hooks the workers
+	// run as if there were none. Results are not cached with them set.
+	Hooks []Hook
+	// KeyColumn, if positive, aggregates lines of several fields
+	// "f1;f2;...;temperature" by field KeyColumn, counting from 1, e.g. 1
+	// for the numeric station IDs of "id;name;temperature" lines, see
+	// Result.Relabel. The IDs are shorter to hash than the names, which are
+	// still scanned past, so such lines parse about as fast as those of the
+	// names alone, see BenchmarkKeyColumn. It needs FormatText and cannot
+	// be combined with GroupBy or Window.
+	KeyColumn int
+	// GroupBy, if its Column is set, aggregates per station and second key.
+	GroupBy GroupBy
+	// Window, if its Size is set, aggregates per station and tumbling time
+	// window. It cannot be combined with GroupBy.
+	Window Window
+	// Provenance records where each station's minimum and maximum were
+	// read, see Result.Extremes. Results are not cached with it set.
+	Provenance bool
+	// Distinct counts the distinct readings of each station in a 250 byte
+	// bitmap, see Result.Distinct. Results are not cached with it set.
+	Distinct bool
+	// Moments sums the squares of each station's readings for
+	// Result.StdDev and Result.Anomalies. Results are not cached with it set.
+	Moments bool
+	// Percentiles keeps a mergeable t-digest of each station's readings for
+	// estimated percentiles, see Result.Percentile. It costs a few KB per
+	// station and worker. Results are not cached with it set.
+	Percentiles bool
+	// Frequencies keeps an exact frequency table of each station's readings,
+	// 8KB per station and worker, for exact percentiles and
+	// Result.WriteFrequencies. Results are not cached with it set.
+	Frequencies bool
+	// SamplePerStation, if positive, keeps a uniform random sample of that
+	// many readings per station, see Result.Samples. Results are not cached
+	// with it set.
+	SamplePerStation int
+	// NewAccumulator, if set, creates the custom Accumulator of a station
+	// in a worker, see Result.Accumulated. Results are not cached with it
+	// set.
+	NewAccumulator func() Accumulator
+	// Affinity pins each worker to a CPU on Linux, defaults to AffinityNone.
+	// AffinityNUMA also matches mapped chunks to the node holding them.
+	Affinity Affinity
+	// Chaos, if not 0, seeds random perturbations for concurrency testing:
+	// chunks, blocks and reads are cut at random sizes, splitting lines and
+	// UTF-8 sequences anywhere, and workers pause or yield between them and
+	// before the merge. The results are the same as without it, which
+	// go test -race and onebrc selftest -chaos check. A seed makes the same
+	// cuts when run again, the interleaving of the workers still varies.
+	Chaos uint64
+	// MaxThroughput, if positive, limits reading the input to that many
+	// bytes per second, e.g. to leave the disk or NFS server of a shared host
+	// to others. Mapped input is paced as the workers parse it.
+	MaxThroughput int64
+	// SimulateReadLatency and SimulateBandwidth, if positive, make the
+	// input behave as if on slower storage, e.g. 2ms and 200MB/s for a
+	// network filesystem, to see how each IO backend degrades on it without
+	// such storage at hand: each read waits the latency, reads in parallel
+	// overlapping as on a device with queued requests, and all of them share
+	// the bandwidth. The reads of IOMmap are the page faults of each 1MB
+	// block a worker parses. Readahead, whose prefetching is not simulated,
+	// cannot be combined with them.
+	SimulateReadLatency time.Duration
+	SimulateBandwidth   int64
+	// Readahead, if positive, has a goroutine per worker of IOMmap prefetch
+	// the pages of its chunk that many bytes ahead of where it parses, e.g.
+	// 8MB, so that the page faults of a cold page cache overlap parsing
+	// instead of stalling it. On Linux the window is also advised with
+	// madvise(MADV_WILLNEED), for the kernel to read it in large requests.
+	// A warm page cache gains nothing from it.
+	Readahead int64
+	// Mlock locks the mapped input of IOMmap into memory before parsing,
+	// which reads all of it in, so that neither swapping nor the reclaim of
+	// its pages disturb the timing of the parse. It needs the input to fit
+	// in the locked memory limit (RLIMIT_MEMLOCK), which is raised up to
+	// its hard limit; past that the run continues unlocked with a warning.
+	Mlock bool
+	// Audit, if set, is filled with the segments of the input each worker
+	// parsed, and the run fails with ErrAudit unless they cover every line
+	// exactly once. It cannot be combined with LimitRows, CommentPrefix,
+	// Window or Hooks, which skip lines on purpose, and results are not
+	// cached with it set.
+	Audit *Audit
+	// Summary, if set, is filled with the totals, phase durations and GC
+	// activity of the run.
+	Summary *Summary
+}
+
+func (c Config) workers() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return CPUs()
+}
+
+// CPUs returns the number of CPUs the process may use, runtime.NumCPU()
+// capped by the CPU quota of its cgroup on Linux, rounded up.
+func CPUs() int {
+	return cpus()
+}
+
+var cpus = sync.OnceValue(func() int {
+	return cgroup.Read().CPUCount(runtime.NumCPU())
+})
+
+// discardLogger is enabled for no level, so logging calls return early.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+
+func (c Config) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return discardLogger
+}
+
+// newResult returns a per-worker result presized for c.cardinality() that
+// applies the per-line settings of c.
+func (c Config) newResult() *Result {
+	hint := c.cardinality()
+	var arena *hugepage.Arena
+	if c.HugePages && hint*columnBytes >= hugepage.Size && c.Aggregation != AggregateShared {
+		arena = hugepage.New(hint * columnBytes)
+	}
+	r := &Result{stations: newArenaTable(hint, arena)}
+	if c.Map == MapSwiss || c.Parse == ParseTwoStage {
+		r.index = swiss.New[int32](max(hint, 0))
+	}
+	r.twoStage = c.Parse == ParseTwoStage
+	r.strict = c.Strict
+	r.grouped = c.grouped()
+	decoder := c.newDecoder()
+	r.keyColumn = c.KeyColumn
+	if c.Normalize != 0 || decoder != nil || len(c.Hooks) > 0 || c.CommentPrefix != "" || c.delimiter() != ';' || c.GroupBy.Column > 0 || c.Window.Size > 0 || c.Provenance || c.Distinct || c.Moments || c.Percentiles || c.Frequencies || c.SamplePerStation > 0 || c.NewAccumulator != nil {
+		r.opts = &parseOptions{norm: newNormalizer(c.Normalize), delim: c.delimiter(), group: c.GroupBy, window: newWindowParser(c.Window), decoder: decoder, hooks: c.Hooks, keyColumn: c.KeyColumn}
+		if c.CommentPrefix != "" {
+			r.opts.comment = []byte(c.CommentPrefix)
+		}
+		if c.Provenance {
+			r.opts.prov = &provenance{}
+			r.extremes = make(map[string]*Extremes, max(hint, 0))
+		}
+		if c.Distinct {
+			r.distinct = make(map[string]*distinctSet, max(hint, 0))
+		}
+		if c.Moments {
+			r.moments = make(map[string]*moments, max(hint, 0))
+		}
+		if c.Percentiles {
+			r.sketches = make(map[string]*tdigest.Digest, max(hint, 0))
+		}
+		if c.Frequencies {
+			r.freqs = make(map[string]*frequencies, max(hint, 0))
+		}
+		if c.SamplePerStation > 0 {
+			r.opts.sample = c.SamplePerStation
+			r.samples = make(map[string]*reservoir, max(hint, 0))
+		}
+		if c.NewAccumulator != nil {
+			r.custom = make(map[string]Accumulator, max(hint, 0))
+			r.newAccumulator = c.NewAccumulator
+		}
+	}
+	return r
+}
+
+// newDictionary returns the dictionary the per-worker tables of c share,
+// c.Dictionary if set, nil with AggregateShared.
+func (c Config) newDictionary() *dictionary {
+	if c.Aggregation == AggregateShared {
+		return nil
+	}
+	if c.Dictionary != nil {
+		return c.Dictionary.dict
+	}
+	return newDictionary(c.CardinalityHint)
+}
+
+// cardinality returns the number of stations the per-worker tables are
+// presized for, at least those of c.Dictionary.
+func (c Config) cardinality() int {
+	if c.Dictionary != nil {
+		return max(c.CardinalityHint, c.Dictionary.Len())
+	}
+	return c.CardinalityHint
+}
+
+// headerLines is the number of lines skipped before the input starts.
+func (c Config) headerLines() int64 {
+	if c.RangeStart > 0 {
+		return 0
+	}
+	return int64(max(c.SkipHeader, 0))
+}
+
+// cacheable reports whether results of c fit the cache, which stores only
+// the Stats and cannot replay emitted windows. Runs on simulated storage are
+// not cached, as a hit would read nothing of what they simulate.
+func (c Config) cacheable() bool {
+	return c.SimulateReadLatency <= 0 && c.SimulateBandwidth <= 0 && c.Window.Emit == nil && c.Audit == nil && !c.Provenance && !c.Distinct && !c.Moments && !c.Percentiles && !c.Frequencies && c.SamplePerStation <= 0 && c.NewAccumulator == nil && len(c.Hooks) == 0 && c.Dictionary == nil
+}
+
+// Validate checks the settings that processing cannot start with, which
+// Process and ProcessFile also do before reading any input.
+func (c Config) Validate() error {
+	if err := c.validateRange(); err != nil {
+		return err
+	}
+	if c.GroupBy.Column > 0 && c.Window.Size > 0 {
+		return errors.New("GroupBy and Window cannot be combined")
+	}
+	if c.KeyColumn < 0 {
+		return fmt.Errorf("negative key column %d", c.KeyColumn)
+	}
+	if c.KeyColumn > 0 && (c.GroupBy.Column > 0 || c.Window.Size > 0 || (c.Format != "" && c.Format != FormatText)) {
+		return errors.New("KeyColumn cannot be combined with GroupBy, Window or an input format other than text")
+	}
+	if c.Dictionary != nil && (c.Aggregation == AggregateShared || c.GroupBy.Column > 0 || c.Window.Size > 0) {
+		return errors.New("Dictionary cannot be combined with AggregateShared, GroupBy or Window")
+	}
+	if c.Audit != nil && (c.LimitRows > 0 || c.CommentPrefix != "" || c.Window.Size > 0 || len(c.Hooks) > 0) {
+		return errors.New("Audit cannot be combined with LimitRows, CommentPrefix, Window or Hooks")
+	}
+	if err := c.validateFormat(); err != nil {
+		return err
+	}
+	switch c.IO {
+	case "", IOMmap, IOStream:
+	case IOPipeline:
+		if c.SkipHeader > 0 || c.RangeStart > 0 || c.RangeEnd > 0 || c.LimitRows > 0 || c.Window.Size > 0 || c.Provenance {
+			return errors.New("IOPipeline cannot be combined with SkipHeader, RangeStart, RangeEnd, LimitRows, Window or Provenance, which need the lines in input order")
+		}
+	default:
+		return fmt.Errorf("unknown IO backend %q", c.IO)
+	}
+	switch c.Map {
+	case "", MapBuiltin, MapSwiss:
+	default:
+		return fmt.Errorf("unknown station map %q", c.Map)
+	}
+	switch c.Parse {
+	case "", ParseFused, ParseTwoStage:
+	default:
+		return fmt.Errorf("unknown parse loop %q", c.Parse)
+	}
+	if c.Workers < 0 || c.Readers < 0 || c.RingSize < 0 || c.BlockSize < 0 {
+		return fmt.Errorf("negative workers %d, readers %d, ring size %d or block size %d", c.Workers, c.Readers, c.RingSize, c.BlockSize)
+	}
+	if c.Readahead < 0 {
+		return fmt.Errorf("negative readahead %d", c.Readahead)
+	}
+	if c.SimulateReadLatency < 0 || c.SimulateBandwidth < 0 {
+		return fmt.Errorf("negative simulated read latency %v or bandwidth %d", c.SimulateReadLatency, c.SimulateBandwidth)
+	}
+	if c.Readahead > 0 && (c.SimulateReadLatency > 0 || c.SimulateBandwidth > 0) {
+		return errors.New("Readahead cannot be combined with simulated storage")
+	}
+	if d := c.delimiter(); d == '\n' || d == '-' || d == '.' || isDigit(d) {
+		return fmt.Errorf("invalid delimiter %q", d)
+	}
+	if err := c.Aggregation.validate(c); err != nil {
+		return err
+	}
+	return c.Window.validate()
+}
+
+// grouped reports whether the names of the results of c are "station;key".
+func (c Config) grouped() bool {
+	return c.GroupBy.Column > 0 || c.Window.Size > 0
+}
+
+func (c Config) delimiter() byte {
+	if c.Delimiter != 0 {
+		return c.Delimiter
+	}
+	return ';'
+}
+
+func (c Config) io() IOBackend {
+	if c.IO == "" {
+		return DefaultIO
+	}
+	return c.IO
+}
+
+func (c Config) blockSize() int {
+	if c.BlockSize > 0 {
+		return c.BlockSize
+	}
+	return defaultBlockSize
+}
+
+// ProcessFile aggregates the measurements file at path.
+func ProcessFile(path string, cfg Config) (*Result, error) {
+	return ProcessFileContext(context.Background(), path, cfg)
+}
+
+// ProcessFileContext is like ProcessFile, phase spans are children of the
+// span in ctx.
+func ProcessFileContext(ctx context.Context, path string, cfg Config) (*Result, error) {
+	ctx, span := cfg.startSpan(ctx, "ProcessFile", attribute.String("path", path), attribute.String("io", string(cfg.io())))
+	defer span.End()
+	defer cfg.startGC().finish()
+
+	var res *Result
+	err := cfg.Validate()
+	if err == nil && cfg.CacheDir != "" && cfg.cacheable() {
+		res, err = processCached(ctx, path, cfg)
+	} else if err == nil {
+		res, err = processFile(ctx, path, cfg)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return res, err
+}
+
+func processFile(ctx context.Context, path string, cfg Config) (*Result, error) {
+	if cfg.Format == FormatParquet {
+		return processParquet(ctx, path, cfg)
+	}
+	switch cfg.io() {
+	case IOMmap:
+		return processMmap(ctx, path, cfg)
+	case IOStream:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return processStream(ctx, f, fi.Size(), cfg)
+	case IOPipeline:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return processPipeline(ctx, f, fi.Size(), cfg)
+	default:
+		return nil, fmt.Errorf("unknown IO backend %q", cfg.IO)
+	}
+}
+
+// processData splits data into one chunk per worker at line boundaries,
+// aggregates the chunks concurrently and merges the per-worker results.
+func processData(ctx context.Context, data []byte, cfg Config) (*Result, error) {
+	log := cfg.logger()
+	// headers and range boundaries are resolved up front, so chunks never
+	// see them
+	data, offset := cfg.restrictData(data)
+	if cfg.Aggregation == AggregatePartitioned {
+		return processPartitioned(ctx, data, offset, cfg)
+	}
+	first := offset
+	cfg.Audit.reset()
+	chunks := splitChunks(data, cfg.workers(), cfg.newChaos(0))
+	placement, err := cfg.placement(len(chunks), chunks)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	parseCtx, span := cfg.startSpan(ctx, "parse", attribute.Int("bytes", len(data)))
+
+	sizes := make([]int64, len(chunks))
+	offsets := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		sizes[i] = int64(len(chunk))
+		offsets[i] = offset
+		offset += sizes[i]
+	}
+	shared, dict := cfg.newSharedTable(), cfg.newDictionary()
+	cfg.Monitor.start(int64(len(data)), sizes, shared)
+	pace, slow := cfg.newThrottle(), cfg.newSlowStorage()
+
+	var wg sync.WaitGroup
+	wg.Add(len(chunks))
+
+	results := make([]*Result, len(chunks))
+	malformed := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		go func() {
+			defer wg.Done()
+			cfg.pinWorker(placement, i)
+			log.Debug("worker started", "worker", i, "bytes", len(chunk))
+			workerStart := time.Now()
+			_, workerSpan := cfg.startSpan(parseCtx, "parse chunk", attribute.Int("worker", i), attribute.Int("bytes", len(chunk)))
+			r := cfg.newResult()
+			r.shared, r.stations.dict = shared, dict
+			if r.opts != nil && r.opts.prov != nil {
+				r.opts.prov.position = position{offset: offsets[i]}
+			}
+			chaos := cfg.newChaos(i + 1)
+			cfg.Audit.add(i, offsets[i], chunk)
+			ra := cfg.startReadahead(chunk)
+			malformed[i] = cfg.Monitor.parse(i, chunk, r, pace, slow, chaos, ra)
+			ra.stop()
+			chaos.pause()
+			cfg.Monitor.finish(i, r)
+			results[i] = r
+			finishWorker(log, workerSpan, i, workerStart, r, malformed[i])
+		}()
+	}
+	wg.Wait()
+	span.End()
+	cfg.phase("parse", start, "bytes", len(data), "workers", len(chunks))
+	cfg.hugePages(results)
+	if cfg.Provenance {
+		// chunks count their lines from 1, add the lines before them
+		lines := cfg.headerLines()
+		for _, r := range results {
+			r.shiftLines(lines)
+			lines += r.opts.prov.line
+		}
+	}
+
+	if err := cfg.checkMalformed(sum(malformed)); err != nil {
+		return nil, err
+	}
+	res := mergeResults(ctx, results, shared, cfg)
+	if err := cfg.Audit.check(first, first+int64(len(data)), countLines(data), res.rows()+sum(malformed)); err != nil {
+		return nil, err
+	}
+	cfg.Summary.fill(res, placement, len(chunks), int64(len(data)), sum(malformed))
+	if cfg.Window.Emit != nil {
+		return NewResult(), emitWindows(res, cfg.Window.Emit)
+	}
+	return res, nil
+}
+
+func sum(s []int64) int64 {
+	var n int64
+	for _, v := range s {
+		n += v
+	}
+	return n
+}
+
+// finishWorker reports the outcome of a worker in the log and its span.
+func finishWorker(log *slog.Logger, span trace.Span, worker int, start time.Time, r *Result, malformed int64) {
+	log.Debug("worker finished", "worker", worker, "duration", time.Since(start), "stations", r.Len())
+	if malformed > 0 {
+		log.Warn("skipped malformed lines", "worker", worker, "lines", malformed)
+	}
+	if span.IsRecording() {
+		span.SetAttributes(attribute.Int64("rows", r.rows()), attribute.Int64("malformed", malformed), attribute.Int("stations", r.Len()))
+	}
+	span.End()
+}
+
+// splitChunks cuts data into at most n chunks of similar size, each ending
+// right after a newline (or at the end of data). With chaos the sizes vary
+// from a byte to twice the even share.
+func splitChunks(data []byte, n int, chaos *chaos) [][]byte {
+	chunkSize := len(data) / n
+	if chunkSize == 0 {
+		chunkSize = len(data)
+	}
+
+	chunks := make([][]byte, 0, n)
+	for len(data) > 0 {
+		size := chunkSize
+		if chaos != nil {
+			size = chaos.size(2 * chunkSize)
+			if len(chunks) == n-1 {
+				size = len(data)
+			}
+		}
+		var chunk []byte
+		chunk, data = cutBlock(data, size)
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// cutBlock splits data right after the first newline at or after size bytes.
+func cutBlock(data []byte, size int) (block, rest []byte) {
+	if size >= len(data) {
+		return data, nil
+	}
+	nl := bytes.IndexByte(data[size:], '\n')
+	if nl < 0 {
+		return data, nil
+	}
+	end := size + nl + 1
+	return data[:end], data[end:]
+}
+
+// Process aggregates measurements read sequentially from r using the IOStream
+// backend.
+func Process(r io.Reader, cfg Config) (*Result, error) {
+	return ProcessContext(context.Background(), r, cfg)
+}
+
+// ProcessContext is like Process, phase spans are children of the span in
+// ctx.
+func ProcessContext(ctx context.Context, r io.Reader, cfg Config) (*Result, error) {
+	ctx, span := cfg.startSpan(ctx, "Process")
+	defer span.End()
+	defer cfg.startGC().finish()
+
+	var res *Result
+	err := cfg.Validate()
+	if err == nil && cfg.Format == FormatParquet {
+		err = errors.New("Parquet input needs a file, see ProcessFile")
+	}
+	if err == nil {
+		res, err = processStream(ctx, r, 0, cfg)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return res, err
+}
+
+// processStream implements Process, size is the input size if known.
+func processStream(ctx context.Context, r io.Reader, size int64, cfg Config) (*Result, error) {
+	r, offset, err := cfg.restrictReader(r)
+	if err != nil {
+		return nil, err
+	}
+	pos := position{offset: offset, line: cfg.headerLines()}
+	if cfg.Window.Emit != nil {
+		return processWindowStream(ctx, r, pos, cfg)
+	}
+	placement, err := cfg.placement(cfg.workers(), nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	parseCtx, span := cfg.startSpan(ctx, "parse", attribute.Int("block_size", cfg.blockSize()))
+	blocks := make(chan block, cfg.workers())
+	shared := cfg.newSharedTable()
+	results := make([]*Result, cfg.workers())
+	malformed := make([]int64, len(results))
+	cfg.Monitor.start(size, make([]int64, len(results)), shared)
+	wg := cfg.parseBlocks(parseCtx, placement, func(int) (block, bool) {
+		b, ok := <-blocks
+		return b, ok
+	}, shared, results, malformed)
+
+	cfg.Audit.reset()
+	counter := &countingReader{r: r}
+	if cfg.Audit != nil {
+		r = counter
+	}
+	n, err := readBlocks(cfg.newThrottle().reader(cfg.newSlowStorage().reader(r)), cfg.blockSize(), pos, cfg.Provenance, cfg.newChaos(0), blocks)
+	close(blocks)
+	wg.Wait()
+	span.SetAttributes(attribute.Int64("bytes", n))
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+	cfg.phase("parse", start, "bytes", n, "workers", len(results))
+	cfg.hugePages(results)
+	if err := cfg.checkMalformed(sum(malformed)); err != nil {
+		return nil, err
+	}
+	res := mergeResults(ctx, results, shared, cfg)
+	if err := cfg.Audit.check(pos.offset, pos.offset+n, counter.lines(), res.rows()+sum(malformed)); err != nil {
+		return nil, err
+	}
+	cfg.Summary.fill(res, placement, len(results), n, sum(malformed))
+	return res, nil
+}
+
+// parseBlocks starts a worker per entry of results that aggregates the
+// blocks next returns for it into it until there are no more, returning
+// their WaitGroup.
+func (c Config) parseBlocks(ctx context.Context, placement []int, next func(worker int) (block, bool), shared *sharedTable, results []*Result, malformed []int64) *sync.WaitGroup {
+	log, dict := c.logger(), c.newDictionary()
+	var wg sync.WaitGroup
+	wg.Add(len(results))
+	for i := range results {
+		go func() {
+			defer wg.Done()
+			c.pinWorker(placement, i)
+			log.Debug("worker started", "worker", i)
+			workerStart := time.Now()
+			_, workerSpan := c.startSpan(ctx, "parse blocks", attribute.Int("worker", i))
+			res := c.newResult()
+			res.shared, res.stations.dict = shared, dict
+			chaos := c.newChaos(i + 1)
+			var n int64
+			for b, ok := next(i); ok; b, ok = next(i) {
+				if res.opts != nil && res.opts.prov != nil {
+					res.opts.prov.position = b.position
+				}
+				c.Audit.add(i, b.offset, b.data)
+				bad := parseChunk(b.data, res)
+				malformed[i] += bad
+				n += int64(len(b.data))
+				c.Monitor.advance(i, len(b.data), bad, res)
+				bufpool.Put(b.buf)
+				chaos.pause()
+			}
+			c.Monitor.finish(i, res)
+			results[i] = res
+			workerSpan.SetAttributes(attribute.Int64("bytes", n))
+			finishWorker(log, workerSpan, i, workerStart, res, malformed[i])
+		}()
+	}
+	return &wg
+}
+
+// block is a run of whole lines read from a stream, numbered in input
+// order.
+type block struct {
+	data []byte
+	seq  int
+	position
+	// buf is the bufpool buffer of data, which the worker returns once it
+	// parsed data, nil if there is none
+	buf []byte
+}
+
+// readBlocks reads r, which starts at pos, in blocks of about size bytes and
+// sends each block, trimmed to its last newline, on blocks. The trailing
+// partial line is carried over to the next block. Blocks come from bufpool
+// and the receiver returns them once parsed, so a warm pool serves the whole
+// run. Block line numbers are only counted with countLines. With chaos the
+// reads stop at random sizes up to the free space of the block. It returns
+// the number of bytes read.
+func readBlocks(r io.Reader, size int, pos position, countLines bool, chaos *chaos, blocks chan<- block) (int64, error) {
+	seq := 0
+	send := func(data []byte) {
+		blocks <- block{data, seq, pos, data}
+		seq++
+		pos.offset += int64(len(data))
+		if countLines {
+			pos.line += int64(bytes.Count(data, []byte{'\n'}))
+		}
+	}
+	var total int64
+	buf := bufpool.Get(size)
+	carry := 0
+	for {
+		if carry == len(buf) {
+			// no line end in the whole block, make room to keep reading
+			buf = bufpool.Grow(buf)
+		}
+		n, err := io.ReadFull(r, buf[carry:carry+chaos.size(len(buf)-carry)])
+		data := buf[:carry+n]
+		total += int64(n)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if len(data) > 0 {
+				send(data)
+			} else {
+				bufpool.Put(buf)
+			}
+			return total, nil
+		}
+		if err != nil {
+			bufpool.Put(buf)
+			return total, err
+		}
+
+		nl := bytes.LastIndexByte(data, '\n')
+		if nl < 0 {
+			carry = len(data)
+			continue
+		}
+		rest := data[nl+1:]
+		next := bufpool.Get(max(size, len(rest)))
+		carry = copy(next, rest)
+		send(data[:nl+1])
+		buf = next
+	}
+}
+
+// mergeResults merges the per-worker results, or collects the shared table
+// they added to if there is one.
+func mergeResults(ctx context.Context, results []*Result, shared *sharedTable, cfg Config) *Result {
+	if len(results) == 0 {
+		return NewResult()
+	}
+	start := time.Now()
+	_, span := cfg.startSpan(ctx, "merge", attribute.Int("results", len(results)))
+	defer span.End()
+
+	var merged *Result
+	if shared != nil {
+		merged = shared.result()
+	} else {
+		merged = results[0]
+		for _, r := range results[1:] {
+			merged.merge(r)
+		}
+		merged.stations.detach()
+	}
+	span.SetAttributes(attribute.Int("stations", merged.Len()))
+	cfg.phase("merge", start, "stations", merged.Len())
+	return merged
+}
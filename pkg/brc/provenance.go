@@ -0,0 +1,131 @@
+package brc
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
+
+// Extremes locates the readings of a station's minimum and maximum in the
+// input, see Config.Provenance. For repeated extremes the first occurrence
+// is kept.
+type Extremes struct {
+	// MinOffset and MaxOffset are the byte offsets of the lines in the
+	// input file or stream, ranges included.
+	MinOffset, MaxOffset int64
+	// MinLine and MaxLine are the 1-based line numbers, counting header
+	// lines. With a byte range, lines are counted from its start.
+	MinLine, MaxLine int64
+}
+
+// Extremes returns where the minimum and maximum of station name were read.
+// It is only available for results of a run with Config.Provenance.
+func (r *Result) Extremes(name string) (Extremes, bool) {
+	e, ok := r.extremes[name]
+	if !ok {
+		return Extremes{}, false
+	}
+	return *e, true
+}
+
+// position is where a block of lines starts in the input.
+type position struct {
+	offset int64
+	line   int64 // lines before the block
+}
+
+// provenance is the input cursor of a worker recording Extremes. parseChunk
+// moves it over every line, so it must be set to the start of each chunk or
+// block before parsing it.
+type provenance struct {
+	position
+}
+
+// advance moves the cursor over a line of n bytes, its newline included, and
+// returns the position of the line. The line number is 1-based.
+func (p *provenance) advance(n int) position {
+	at := p.position
+	p.offset += int64(n)
+	p.line++
+	at.line++
+	return at
+}
+
+// observe records at as the position of tenths if it is a new extreme of s,
+// which has not yet been updated for the reading.
+func (r *Result) observe(name []byte, s Stats, tenths int32, at position) {
+	if s.Count > 0 && tenths >= s.Min && tenths <= s.Max {
+		return
+	}
+	e, ok := r.extremes[string(name)]
+	if !ok {
+		e = &Extremes{}
+		r.extremes[string(name)] = e
+	}
+	if s.Count == 0 || tenths < s.Min {
+		e.MinOffset, e.MinLine = at.offset, at.line
+	}
+	if s.Count == 0 || tenths > s.Max {
+		e.MaxOffset, e.MaxLine = at.offset, at.line
+	}
+}
+
+// shiftLines adds n to the line numbers of r's extremes, which were counted
+// from the start of a chunk.
+func (r *Result) shiftLines(n int64) {
+	for _, e := range r.extremes {
+		e.MinLine += n
+		e.MaxLine += n
+	}
+}
+
+// mergeExtremes folds the extremes o, belonging to the aggregate s, into the
+// extremes for name. It must run before s is merged into r.
+func (r *Result) mergeExtremes(name string, s Stats, o *Extremes) {
+	if r.extremes == nil || o == nil {
+		return
+	}
+	e, ok := r.extremes[name]
+	m := r.stations.get(name)
+	if !ok || m.Count == 0 {
+		c := *o
+		r.extremes[name] = &c
+		return
+	}
+	if s.Min < m.Min || s.Min == m.Min && o.MinOffset < e.MinOffset {
+		e.MinOffset, e.MinLine = o.MinOffset, o.MinLine
+	}
+	if s.Max > m.Max || s.Max == m.Max && o.MaxOffset < e.MaxOffset {
+		e.MaxOffset, e.MaxLine = o.MaxOffset, o.MaxLine
+	}
+}
+
+// WriteExtremes writes where each station's minimum and maximum were read as
+// semicolon separated rows with a header:
+//
+//	station;min;min_line;min_offset;max;max_line;max_offset
+//	Abha;-23.0;1204;16384;59.2;77;1050
+func (r *Result) WriteExtremes(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("station;min;min_line;min_offset;max;max_line;max_offset\n")
+	for _, name := range r.Names() {
+		s, e := r.stations.get(name), r.extremes[name]
+		if e == nil {
+			continue
+		}
+		bw.WriteString(name)
+		writeExtreme(bw, s.Min, e.MinLine, e.MinOffset)
+		writeExtreme(bw, s.Max, e.MaxLine, e.MaxOffset)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+func writeExtreme(bw *bufio.Writer, tenths int32, line, offset int64) {
+	bw.WriteByte(';')
+	bw.WriteString(strconv.FormatFloat(float64(tenths)/10, 'f', 1, 64))
+	bw.WriteByte(';')
+	bw.WriteString(strconv.FormatInt(line, 10))
+	bw.WriteByte(';')
+	bw.WriteString(strconv.FormatInt(offset, 10))
+}
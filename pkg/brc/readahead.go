@@ -0,0 +1,96 @@
+package brc
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// readahead prefetches the pages of a worker's mapped chunk Config.Readahead
+// bytes ahead of where it parses, so that on a cold page cache the page
+// faults are taken, and the reads behind them wait, in its goroutine instead
+// of the worker's. It advises the kernel of each window (madvise WILLNEED on
+// Linux) before touching a byte of each page of it. A nil readahead does
+// nothing.
+type readahead struct {
+	chunk  []byte
+	window int
+	parsed atomic.Int64
+	wake   chan struct{}
+	done   chan struct{}
+	// stopped is closed once run returned and touches no more of the chunk
+	stopped chan struct{}
+}
+
+// pageSize is the step readahead touches pages in.
+var pageSize = os.Getpagesize()
+
+// touched keeps the compiler from dropping the loads of readahead.
+var touched atomic.Uint32
+
+// startReadahead starts prefetching chunk, unless Config.Readahead is unset
+// or chunk fits in the first window.
+func (c Config) startReadahead(chunk []byte) *readahead {
+	if c.Readahead <= 0 || int64(len(chunk)) <= c.Readahead/2 {
+		return nil
+	}
+	ra := &readahead{chunk: chunk, window: int(min(c.Readahead, int64(len(chunk)))), wake: make(chan struct{}, 1), done: make(chan struct{}), stopped: make(chan struct{})}
+	go ra.run()
+	return ra
+}
+
+// advance reports that n more bytes of the chunk were parsed.
+func (ra *readahead) advance(n int) {
+	if ra == nil {
+		return
+	}
+	ra.parsed.Add(int64(n))
+	select {
+	case ra.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop ends the prefetching, e.g. when the worker is done before it, and
+// waits for it to touch no more of the chunk, which may be unmapped next.
+func (ra *readahead) stop() {
+	if ra != nil {
+		close(ra.done)
+		<-ra.stopped
+	}
+}
+
+func (ra *readahead) run() {
+	defer close(ra.stopped)
+	var sum byte
+	// prefetched is how far the chunk was, the windows are advised in
+	// halves so that the next one is on its way while the worker parses
+	prefetched := 0
+	step := max(ra.window/2, pageSize)
+	for prefetched < len(ra.chunk) {
+		if prefetched >= int(ra.parsed.Load())+ra.window {
+			select {
+			case <-ra.wake:
+				continue
+			case <-ra.done:
+				touched.Add(uint32(sum))
+				return
+			}
+		}
+		end := min(prefetched+step, len(ra.chunk))
+		next := ra.chunk[prefetched:end]
+		willNeed(next)
+		// a byte of each page, the last one of a window may be that of the
+		// next, until stop, after which the chunk may be unmapped
+		for i := 0; i < len(next); i += pageSize {
+			select {
+			case <-ra.done:
+				touched.Add(uint32(sum))
+				return
+			default:
+			}
+			sum += next[i]
+		}
+		prefetched = end
+	}
+	touched.Add(uint32(sum))
+}
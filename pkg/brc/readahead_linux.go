@@ -0,0 +1,18 @@
+package brc
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// willNeed advises the kernel to read the pages of b, which is part of a
+// mapping, ahead. It is advice, errors are ignored.
+func willNeed(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	// madvise takes page aligned addresses
+	p := unsafe.Pointer(unsafe.SliceData(b))
+	off := int(uintptr(p) % uintptr(pageSize))
+	syscall.Madvise(unsafe.Slice((*byte)(unsafe.Add(p, -off)), len(b)+off), syscall.MADV_WILLNEED)
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package brc
+
+// willNeed does nothing where there is no madvise, readahead only touches
+// the pages.
+func willNeed(b []byte) {}
@@ -0,0 +1,96 @@
+// Package reference is a naive implementation of package brc, kept as a
+// correctness oracle for its fast paths. It scans lines one at a time like
+// the go_copilot variant, parses readings with strconv.ParseFloat and shares
+// no parsing or aggregation code with brc.
+//
+// Process and ProcessFile take the same arguments as their brc counterparts
+// but honor only Config.Delimiter and Config.Strict.
+package reference
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// maxLine is the longest line the scanner accepts.
+const maxLine = 1 << 20
+
+// reading is the form of the readings of the challenge; strconv.ParseFloat
+// alone accepts many more, such as 1e1 and NaN.
+var reading = regexp.MustCompile(`^-?[0-9]{1,2}\.[0-9]$`)
+
+// ProcessFile aggregates the measurements file at path.
+func ProcessFile(path string, cfg brc.Config) (*brc.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Process(f, cfg)
+}
+
+// Process aggregates the measurements read from r. Lines without a
+// delimiter or with a reading other than an optional '-', one or two digits,
+// a '.' and a digit are skipped, or with cfg.Strict fail the run with
+// brc.ErrMalformed.
+func Process(r io.Reader, cfg brc.Config) (*brc.Result, error) {
+	delim := cfg.Delimiter
+	if delim == 0 {
+		delim = ';'
+	}
+	stats := make(map[string]*brc.Stats)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLine)
+	var malformed int64
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		sep := bytes.IndexByte(line, delim)
+		if sep <= 0 {
+			malformed++
+			continue
+		}
+		if !reading.Match(line[sep+1:]) {
+			malformed++
+			continue
+		}
+		val, err := strconv.ParseFloat(string(line[sep+1:]), 64)
+		if err != nil {
+			malformed++
+			continue
+		}
+		tenths := math.Round(val * 10)
+		city := string(line[:sep])
+		s, ok := stats[city]
+		if !ok {
+			s = &brc.Stats{Min: int32(tenths), Max: int32(tenths)}
+			stats[city] = s
+		}
+		s.Min = min(s.Min, int32(tenths))
+		s.Max = max(s.Max, int32(tenths))
+		s.Sum += int64(tenths)
+		s.Count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cfg.Strict && malformed > 0 {
+		return nil, fmt.Errorf("%d %w", malformed, brc.ErrMalformed)
+	}
+
+	res := brc.NewResult()
+	for city, s := range stats {
+		res.Add(city, *s)
+	}
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package reference
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/djheidihoe/1brc/internal/testdata"
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, err := range testdata.Check(func(path string) (string, error) {
+		res, err := ProcessFile(path, brc.Config{})
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		return out.String(), nil
+	}) {
+		t.Error(err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	input := "a,1.0\nno delimiter\na,x\nb,-2.5\n"
+	res, err := Process(strings.NewReader(input), brc.Config{Delimiter: ','})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.WriteText(&out)
+	if expected := "{a=1.0/1.0/1.0, b=-2.5/-2.5/-2.5}\n"; out.String() != expected {
+		t.Errorf("Wrong output, expected %q, got %q", expected, out.String())
+	}
+	if _, err := Process(strings.NewReader(input), brc.Config{Delimiter: ',', Strict: true}); !errors.Is(err, brc.ErrMalformed) {
+		t.Errorf("Expected ErrMalformed with Strict, got %v", err)
+	}
+}
+
+func TestReadings(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected string
+	}{
+		{value: "-99.9", expected: "{a=-99.9/-99.9/-99.9}"},
+		{value: "5.0", expected: "{a=5.0/5.0/5.0}"},
+		{value: "-0.0", expected: "{a=0.0/0.0/0.0}"},
+		{value: "1"},
+		{value: "+1.0"},
+		{value: "1.25"},
+		{value: "1e1"},
+		{value: ".5"},
+		{value: "1."},
+		{value: "NaN"},
+		{value: "Inf"},
+		{value: "100.0"},
+		{value: " 1.0"},
+	} {
+		res, err := Process(strings.NewReader("a;"+tc.value+"\n"), brc.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		res.WriteText(&out)
+		if expected := cmp.Or(tc.expected, "{}") + "\n"; out.String() != expected {
+			t.Errorf("Wrong output for %q, expected %q, got %q", tc.value, expected, out.String())
+		}
+		// the fast paths agree
+		fast, err := brc.Process(strings.NewReader("a;"+tc.value+"\n"), brc.Config{})
+		if err != nil || fast.Len() != res.Len() {
+			t.Errorf("brc.Process of %q has %d stations, %v, expected %d", tc.value, fast.Len(), err, res.Len())
+		}
+	}
+}
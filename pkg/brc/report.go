@@ -0,0 +1,163 @@
+package brc
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// histogramBins is the number of bins of the histograms of WriteHTML, 10
+// degrees each.
+const histogramBins = 20
+
+// WriteMarkdown writes r as a Markdown table, one row per name in the order
+// of Names, to paste into wikis. Grouped results get a key column.
+//
+//	| Station | Min | Mean | Max | Count |
+//	|---|---:|---:|---:|---:|
+//	| Abha | -23.0 | 18.0 | 59.2 | 1204 |
+func (r *Result) WriteMarkdown(w io.Writer) error {
+	grouped := r.grouped
+	bw := bufio.NewWriter(w)
+	if grouped {
+		bw.WriteString("| Station | Key | Min | Mean | Max | Count |\n|---|---|---:|---:|---:|---:|\n")
+	} else {
+		bw.WriteString("| Station | Min | Mean | Max | Count |\n|---|---:|---:|---:|---:|\n")
+	}
+	cell := strings.NewReplacer("|", `\|`)
+	for name, s := range r.Sorted() {
+		station, key := r.Split(name)
+		bw.WriteString("| ")
+		bw.WriteString(cell.Replace(station))
+		if grouped {
+			bw.WriteString(" | ")
+			bw.WriteString(cell.Replace(key))
+		}
+		bw.WriteString(" | ")
+		bw.WriteString(strings.ReplaceAll(s.String(), "/", " | "))
+		bw.WriteString(" | ")
+		bw.WriteString(strconv.FormatInt(s.Count, 10))
+		bw.WriteString(" |\n")
+	}
+	return bw.Flush()
+}
+
+// htmlRow is a row of the table of WriteHTML.
+type htmlRow struct {
+	Station, Key   string
+	Min, Mean, Max string
+	Count          int64
+	Histogram      string // the counts per bin, comma separated
+	Sparkline      template.HTML
+}
+
+// WriteHTML writes r as a static HTML page to open in a browser: a summary
+// header and a table that sorts by the column whose header is clicked.
+// Results of a run with Config.Frequencies also get a histogram sparkline
+// per row, whose counts are in the data-histogram attribute.
+func (r *Result) WriteHTML(w io.Writer) error {
+	page := struct {
+		Grouped, Histograms bool
+		Rows                []htmlRow
+		Stations            int
+		Readings            int64
+		Min, Mean, Max      string
+	}{Grouped: r.grouped, Histograms: r.freqs != nil, Stations: r.Len()}
+
+	var all Stats
+	for name, s := range r.Sorted() {
+		station, key := r.Split(name)
+		row := htmlRow{Station: station, Key: key, Count: s.Count}
+		row.Min, row.Mean, row.Max = degrees(s)
+		if f := r.freqs[name]; f != nil {
+			row.Histogram, row.Sparkline = histogram(f)
+		}
+		page.Rows = append(page.Rows, row)
+		all.Merge(s)
+	}
+	page.Readings = all.Count
+	if all.Count > 0 {
+		page.Min, page.Mean, page.Max = degrees(all)
+	}
+	return htmlReport.Execute(w, page)
+}
+
+// degrees returns the min, mean and max of s formatted like String.
+func degrees(s Stats) (min, mean, max string) {
+	parts := strings.SplitN(s.String(), "/", 3)
+	return parts[0], parts[1], parts[2]
+}
+
+// histogram returns the counts of f in histogramBins bins, from -100 up to
+// -90 degrees to 90 up to 100, and an inline SVG sparkline of them.
+func histogram(f *frequencies) (string, template.HTML) {
+	var bins [histogramBins]uint64
+	var top uint64
+	for i, n := range f {
+		b := (i + 1) / 100 // i is tenths+999
+		bins[b] += uint64(n)
+		top = max(top, bins[b])
+	}
+	counts := make([]string, len(bins))
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg width="%d" height="16" viewBox="0 0 %d 16">`, 3*histogramBins, 3*histogramBins)
+	for i, n := range bins {
+		counts[i] = strconv.FormatUint(n, 10)
+		if n > 0 {
+			h := max(1, int(n*16/top))
+			fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="2" height="%d"/>`, 3*i, 16-h, h)
+		}
+	}
+	svg.WriteString("</svg>")
+	// the SVG consists of numbers only, so it needs no escaping
+	return strings.Join(counts, ","), template.HTML(svg.String())
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Measurements</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.2em 0.8em; border-bottom: 1px solid #ddd; }
+th { cursor: pointer; text-align: left; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+svg { fill: #4a7ebb; }
+</style>
+</head>
+<body>
+<h1>Measurements</h1>
+<p>{{.Stations}} stations, {{.Readings}} readings{{if .Readings}}, min {{.Min}}, mean {{.Mean}}, max {{.Max}}{{end}}</p>
+<table>
+<thead><tr><th>Station</th>{{if .Grouped}}<th>Key</th>{{end}}<th data-numeric>Min</th><th data-numeric>Mean</th><th data-numeric>Max</th><th data-numeric>Count</th>{{if .Histograms}}<th>Histogram</th>{{end}}</tr></thead>
+<tbody>
+{{- range .Rows}}
+<tr><td>{{.Station}}</td>{{if $.Grouped}}<td>{{.Key}}</td>{{end}}<td class="n">{{.Min}}</td><td class="n">{{.Mean}}</td><td class="n">{{.Max}}</td><td class="n">{{.Count}}</td>{{if $.Histograms}}<td data-histogram="{{.Histogram}}">{{.Sparkline}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("th").forEach((th, col) => {
+  let asc = true;
+  th.addEventListener("click", () => {
+    const numeric = th.hasAttribute("data-numeric");
+    const body = th.closest("table").tBodies[0];
+    const rows = Array.from(body.rows);
+    rows.sort((a, b) => {
+      const x = a.cells[col].textContent, y = b.cells[col].textContent;
+      const c = numeric ? parseFloat(x) - parseFloat(y) : x.localeCompare(y);
+      return asc ? c : -c;
+    });
+    asc = !asc;
+    rows.forEach(row => body.appendChild(row));
+  });
+});
+</script>
+</body>
+</html>
+`))
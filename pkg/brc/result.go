@@ -0,0 +1,249 @@
+package brc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/djheidihoe/1brc/internal/swiss"
+	"github.com/djheidihoe/1brc/internal/tdigest"
+)
+
+// Result maps station names to their aggregated Stats.
+type Result struct {
+	stations table
+	// extremes are the Extremes of every station with Config.Provenance
+	extremes map[string]*Extremes
+	// distinct are the readings of every station with Config.Distinct
+	distinct map[string]*distinctSet
+	// moments are the sums of squares of every station with Config.Moments
+	moments map[string]*moments
+	// sketches are the t-digests of every station with Config.Percentiles
+	sketches map[string]*tdigest.Digest
+	// freqs are the frequency tables of every station with
+	// Config.Frequencies
+	freqs map[string]*frequencies
+	// samples are the reservoirs of every station with
+	// Config.SamplePerStation
+	samples map[string]*reservoir
+	// custom are the Accumulators of every station with
+	// Config.NewAccumulator, which newAccumulator creates
+	custom         map[string]Accumulator
+	newAccumulator func() Accumulator
+	// opts are the parse settings when r is a per-worker result
+	opts *parseOptions
+	// shared is the table a per-worker result adds its readings to instead
+	// of stations with AggregateShared
+	shared *sharedTable
+	// index, with MapSwiss, finds the slots of stations in a per-worker
+	// result, each new station being added to both
+	index *swiss.Table[int32]
+	// twoStage selects parseChunkTwoStage where it applies
+	twoStage bool
+	// strict selects parseChunkPairs where it applies
+	strict bool
+	// keyColumn, with Config.KeyColumn and no parse settings besides it,
+	// selects parseChunkKeyed
+	keyColumn int
+	// collation is the order of Names, set by SetCollation
+	collation Collation
+	// grouped is set for names "station;key", see Split
+	grouped bool
+}
+
+// NewResult returns an empty Result.
+func NewResult() *Result {
+	return &Result{stations: newTable(0)}
+}
+
+// Len returns the number of distinct stations.
+func (r *Result) Len() int {
+	return r.stations.len()
+}
+
+// Get returns the aggregate for station name.
+func (r *Result) Get(name string) (Stats, bool) {
+	i, ok := r.stations.lookup(name)
+	if !ok {
+		return Stats{}, false
+	}
+	return r.stations.stats(i), true
+}
+
+// Add folds s into the aggregate of station name, for Results built outside
+// of processing such as those of package reference.
+func (r *Result) Add(name string, s Stats) {
+	r.stations.mergeStats(name, s)
+}
+
+// Merge folds o into r, as if r had also processed the input of o, e.g. to
+// combine the Results of per-day files processed by different jobs. The
+// extras of o that r records as well, such as distinct counts with
+// Config.Distinct, are merged too. It leaves r unchanged and returns
+// ErrOverflow, wrapped with the station, if a sum or count would overflow.
+func (r *Result) Merge(o *Result) error {
+	for i, name := range o.stations.names {
+		s, _ := r.Get(name)
+		if err := s.Merge(o.stations.stats(i)); err != nil {
+			return fmt.Errorf("merge %s: %w", name, err)
+		}
+	}
+	r.merge(o)
+	return nil
+}
+
+// Names returns the station names in sorted order, grouped names by
+// station, then key, in the order of SetCollation.
+func (r *Result) Names() []string {
+	names := slices.Clone(r.stations.names)
+	slices.SortFunc(names, r.collation.comparer(r.grouped))
+	return names
+}
+
+// clone returns a deep copy of the Stats of r, without the extras of
+// per-station options like Config.Provenance. It snapshots live progress.
+func (r *Result) clone() *Result {
+	return &Result{stations: r.stations.clone(), grouped: r.grouped}
+}
+
+// mergeStats folds s into the aggregate for name.
+func (r *Result) mergeStats(name string, s Stats) {
+	r.stations.mergeStats(name, s)
+}
+
+// merge folds all aggregates of o into r. Without extras it merges the
+// tables column by column.
+func (r *Result) merge(o *Result) {
+	r.grouped = r.grouped || o.grouped
+	if !o.hasExtras() {
+		r.stations.merge(&o.stations)
+		return
+	}
+	for i, name := range o.stations.names {
+		if o.stations.dict != nil && o.stations.counts[i] == 0 {
+			continue // a station only other workers have seen
+		}
+		r.mergeStation(name, name, o.stations.stats(i), o)
+	}
+}
+
+// hasExtras reports whether r records more than Stats for its stations.
+func (r *Result) hasExtras() bool {
+	return r.extremes != nil || r.distinct != nil || r.moments != nil || r.sketches != nil || r.freqs != nil || r.samples != nil || r.custom != nil
+}
+
+// mergeStation folds the aggregate s of station from in o, and what else o
+// recorded for it, into station name of r, usually the same.
+func (r *Result) mergeStation(name, from string, s Stats, o *Result) {
+	r.mergeExtremes(name, s, o.extremes[from])
+	if d := o.distinct[from]; d != nil && r.distinct != nil {
+		if rd, ok := r.distinct[name]; ok {
+			rd.merge(d)
+		} else {
+			cd := *d
+			r.distinct[name] = &cd
+		}
+	}
+	if m := o.moments[from]; m != nil && r.moments != nil {
+		if rm, ok := r.moments[name]; ok {
+			rm.sumSquares += m.sumSquares
+		} else {
+			cm := *m
+			r.moments[name] = &cm
+		}
+	}
+	if d := o.sketches[from]; d != nil && r.sketches != nil {
+		if rd, ok := r.sketches[name]; ok {
+			rd.Merge(d)
+		} else {
+			r.sketches[name] = d.Clone()
+		}
+	}
+	if f := o.freqs[from]; f != nil && r.freqs != nil {
+		if rf, ok := r.freqs[name]; ok {
+			rf.merge(f)
+		} else {
+			cf := *f
+			r.freqs[name] = &cf
+		}
+	}
+	if rs := o.samples[from]; rs != nil && r.samples != nil {
+		if m, ok := r.samples[name]; ok {
+			m.merge(rs)
+		} else {
+			r.samples[name] = rs.clone()
+		}
+	}
+	r.mergeCustom(name, o.custom[from])
+	r.mergeStats(name, s)
+}
+
+// emptyLike returns an empty Result recording the same extras as r.
+func (r *Result) emptyLike() *Result {
+	e := NewResult()
+	e.collation, e.grouped = r.collation, r.grouped
+	if r.extremes != nil {
+		e.extremes = make(map[string]*Extremes)
+	}
+	if r.distinct != nil {
+		e.distinct = make(map[string]*distinctSet)
+	}
+	if r.moments != nil {
+		e.moments = make(map[string]*moments)
+	}
+	if r.sketches != nil {
+		e.sketches = make(map[string]*tdigest.Digest)
+	}
+	if r.freqs != nil {
+		e.freqs = make(map[string]*frequencies)
+	}
+	if r.samples != nil {
+		e.samples = make(map[string]*reservoir)
+	}
+	if r.custom != nil {
+		e.custom = make(map[string]Accumulator)
+		e.newAccumulator = r.newAccumulator
+	}
+	return e
+}
+
+// WriteText writes r in the official challenge format:
+// {Abha=-23.0/18.0/59.2, Abidjan=-16.2/26.0/67.3, ...}
+func (r *Result) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('{')
+	for i, name := range r.Names() {
+		if i > 0 {
+			bw.WriteString(", ")
+		}
+		bw.WriteString(name)
+		bw.WriteByte('=')
+		bw.WriteString(r.stations.get(name).String())
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// resultJSON is a station of the results in JSON, in degrees.
+type resultJSON struct {
+	Name  string  `json:"name"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+// WriteResultsJSON writes the results of r as a JSON array of stations in
+// the order of Names, with readings in degrees rounded like WriteText. Unlike
+// WriteJSON it is not meant to be merged.
+func (r *Result) WriteResultsJSON(w io.Writer) error {
+	stations := make([]resultJSON, 0, r.stations.len())
+	for name, s := range r.Sorted() {
+		stations = append(stations, resultJSON{name, float64(s.Min) / 10, s.Mean(), float64(s.Max) / 10, s.Count})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stations)
+}
@@ -0,0 +1,39 @@
+package brc
+
+// Rusage is the resource usage of the process from getrusage(2), zero where
+// it is unavailable, e.g. on Windows. As the kernel counts the process
+// rather than the run, concurrent runs see the faults and switches of each
+// other.
+type Rusage struct {
+	// MaxRSS is the peak resident set size in bytes, mapped input included.
+	MaxRSS int64
+	// MajorFaults are the page faults that read from storage, those of
+	// mapped input on a cold page cache.
+	MajorFaults int64
+	// MinorFaults are the page faults served without I/O, e.g. from the
+	// page cache.
+	MinorFaults int64
+	// VoluntarySwitches are the context switches of threads that blocked,
+	// e.g. on I/O.
+	VoluntarySwitches int64
+	// InvoluntarySwitches are the context switches of threads that were
+	// preempted, a sign of more workers than CPUs.
+	InvoluntarySwitches int64
+}
+
+// Sub returns the faults and switches of u since before, with the MaxRSS of
+// u, which is a peak.
+func (u Rusage) Sub(before Rusage) Rusage {
+	return Rusage{
+		MaxRSS:              u.MaxRSS,
+		MajorFaults:         u.MajorFaults - before.MajorFaults,
+		MinorFaults:         u.MinorFaults - before.MinorFaults,
+		VoluntarySwitches:   u.VoluntarySwitches - before.VoluntarySwitches,
+		InvoluntarySwitches: u.InvoluntarySwitches - before.InvoluntarySwitches,
+	}
+}
+
+// ReadRusage returns the resource usage of the process so far.
+func ReadRusage() Rusage {
+	return readRusage()
+}
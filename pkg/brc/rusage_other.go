@@ -0,0 +1,14 @@
+//go:build !unix || aix
+
+package brc
+
+import "os"
+
+func readRusage() Rusage {
+	return Rusage{}
+}
+
+// RusageOf returns the resource usage of the exited child process of state.
+func RusageOf(state *os.ProcessState) Rusage {
+	return Rusage{}
+}
@@ -0,0 +1,40 @@
+//go:build unix && !aix
+
+package brc
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+func readRusage() Rusage {
+	var ru syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &ru) != nil {
+		return Rusage{}
+	}
+	return convertRusage(&ru)
+}
+
+// RusageOf returns the resource usage of the exited child process of state.
+func RusageOf(state *os.ProcessState) Rusage {
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return convertRusage(ru)
+	}
+	return Rusage{}
+}
+
+func convertRusage(ru *syscall.Rusage) Rusage {
+	// macOS reports the peak in bytes, the others in kilobytes
+	rss := int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		rss <<= 10
+	}
+	return Rusage{
+		MaxRSS:              rss,
+		MajorFaults:         int64(ru.Majflt),
+		MinorFaults:         int64(ru.Minflt),
+		VoluntarySwitches:   int64(ru.Nvcsw),
+		InvoluntarySwitches: int64(ru.Nivcsw),
+	}
+}
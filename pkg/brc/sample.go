@@ -0,0 +1,108 @@
+package brc
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+)
+
+// reservoir is a uniform random sample of at most size readings of a
+// station, of seen readings in total.
+type reservoir struct {
+	size  int
+	seen  int64
+	items []int32
+}
+
+// add offers a reading to r, keeping each of the seen readings with the same
+// probability (Vitter's algorithm R).
+func (r *reservoir) add(tenths int32) {
+	r.seen++
+	if len(r.items) < r.size {
+		r.items = append(r.items, tenths)
+	} else if j := rand.Int64N(r.seen); j < int64(r.size) {
+		r.items[j] = tenths
+	}
+}
+
+// merge replaces r by a sample of both inputs. The number of items taken
+// from each side follows the readings they stand for, as if the merged
+// sample was drawn from all readings at once.
+func (r *reservoir) merge(o *reservoir) {
+	a, b := append([]int32(nil), r.items...), append([]int32(nil), o.items...)
+	na, nb := r.seen, o.seen
+	r.items = r.items[:0]
+	for len(r.items) < r.size && len(a)+len(b) > 0 {
+		// drawing a reading from either side moves one out of its pool
+		src := &b
+		if rand.Int64N(na+nb) < na {
+			src, na = &a, na-1
+		} else {
+			nb--
+		}
+		s := *src
+		i := rand.IntN(len(s))
+		r.items = append(r.items, s[i])
+		s[i] = s[len(s)-1]
+		*src = s[:len(s)-1]
+	}
+	r.seen += o.seen
+}
+
+// clone returns a copy of r.
+func (r *reservoir) clone() *reservoir {
+	c := *r
+	c.items = append([]int32(nil), r.items...)
+	return &c
+}
+
+// sample offers a reading of station name to its reservoir.
+func (r *Result) sample(name []byte, tenths int32, size int) {
+	s, ok := r.samples[string(name)]
+	if !ok {
+		s = &reservoir{size: size, items: make([]int32, 0, size)}
+		r.samples[string(name)] = s
+	}
+	s.add(tenths)
+}
+
+// Samples returns a uniform random sample of the readings of station name in
+// degrees, in no particular order. It is only available for results of a run
+// with Config.SamplePerStation.
+func (r *Result) Samples(name string) ([]float64, bool) {
+	s, ok := r.samples[name]
+	if !ok {
+		return nil, false
+	}
+	v := make([]float64, len(s.items))
+	for i, tenths := range s.items {
+		v[i] = float64(tenths) / 10
+	}
+	return v, true
+}
+
+type samplesJSON struct {
+	Stations []stationSamples `json:"stations"`
+}
+
+type stationSamples struct {
+	Name    string    `json:"name"`
+	Count   int64     `json:"count"`
+	Samples []float64 `json:"samples"`
+}
+
+// WriteSamples writes the samples of each station as JSON, e.g. for plotting
+// distributions:
+//
+//	{"stations": [{"name": "Abha", "count": 1204, "samples": [18.2, -3.1, ...]}]}
+func (r *Result) WriteSamples(w io.Writer) error {
+	p := samplesJSON{Stations: make([]stationSamples, 0, len(r.samples))}
+	for _, name := range r.Names() {
+		if v, ok := r.Samples(name); ok {
+			p.Stations = append(p.Stations, stationSamples{Name: name, Count: r.stations.get(name).Count, Samples: v})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
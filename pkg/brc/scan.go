@@ -0,0 +1,63 @@
+package brc
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/djheidihoe/1brc/internal/bufpool"
+)
+
+// scanBlockSize is the read size of Scan, smaller than the default block
+// size so slow streams reach fn early.
+const scanBlockSize = 64 << 10
+
+// Scan calls fn with the station and temperature in tenths of every line read
+// from r, in input order, until fn returns false or the input ends. It runs
+// the parser of Process on a single goroutine without aggregating, for
+// custom processing such as alerting on readings above a threshold.
+// Malformed lines are skipped. station is only valid during the call.
+func Scan(r io.Reader, fn func(station []byte, tenths int32) bool) error {
+	buf := bufpool.Get(scanBlockSize)
+	defer func() { bufpool.Put(buf) }()
+	carry := 0
+	for {
+		if carry == len(buf) {
+			// no line end in the whole buffer, make room to keep reading
+			buf = bufpool.Grow(buf)
+		}
+		n, err := r.Read(buf[carry:])
+		data := buf[:carry+n]
+		end := len(data)
+		if err != io.EOF {
+			end = bytes.LastIndexByte(data, '\n') + 1
+		}
+		if !scanLines(data[:end], fn) {
+			return nil
+		}
+		carry = copy(buf, data[end:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// scanLines calls fn for every well-formed line of data and reports whether
+// it asked for more.
+func scanLines(data []byte, fn func(station []byte, tenths int32) bool) bool {
+	for len(data) > 0 {
+		nl := bytes.IndexByte(data, '\n')
+		var line []byte
+		if nl < 0 {
+			line, data = data, nil
+		} else {
+			line, data = data[:nl], data[nl+1:]
+		}
+		if name, tenths, ok := parseLine(line, ';'); ok && !fn(name, tenths) {
+			return false
+		}
+	}
+	return true
+}
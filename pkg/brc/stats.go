@@ -0,0 +1,170 @@
+package brc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync/atomic"
+)
+
+// Stats holds the aggregate of a single station's readings. All values are
+// kept in integer tenths of a degree, e.g. -12.3 is stored as -123.
+type Stats struct {
+	Min   int32
+	Max   int32
+	Sum   int64
+	Count int64
+}
+
+// add records a single reading.
+func (s *Stats) add(tenths int32) {
+	if s.Count == 0 {
+		s.Min = tenths
+		s.Max = tenths
+	} else {
+		s.Min = min(s.Min, tenths)
+		s.Max = max(s.Max, tenths)
+	}
+	s.Sum += int64(tenths)
+	s.Count++
+}
+
+// ErrOverflow is returned by the Merge methods when a sum or count would
+// overflow int64.
+var ErrOverflow = errors.New("aggregate overflows int64")
+
+// Merge folds o into s, as if s had also seen the readings of o. It leaves
+// s unchanged and returns ErrOverflow if the sum or count would overflow.
+func (s *Stats) Merge(o Stats) error {
+	if o.Count == 0 {
+		return nil
+	}
+	if s.Count == 0 {
+		*s = o
+		return nil
+	}
+	if addOverflows(s.Sum, o.Sum) || addOverflows(s.Count, o.Count) {
+		return ErrOverflow
+	}
+	s.Min = min(s.Min, o.Min)
+	s.Max = max(s.Max, o.Max)
+	s.Sum += o.Sum
+	s.Count += o.Count
+	return nil
+}
+
+// addOverflows reports whether a+b overflows int64.
+func addOverflows(a, b int64) bool {
+	return b > 0 && a > math.MaxInt64-b || b < 0 && a < math.MinInt64-b
+}
+
+// atomicStats is a Stats that goroutines update and read concurrently
+// without locks. The zero value is empty.
+//
+// minMax holds the minimum, inverted, in its high and the maximum, offset, in
+// its low 32 bits, so that zero is an empty range and a CAS widens it.
+// sumCount holds the sum in its high 40 and the count in its low 24 bits, so
+// that a single Add records a reading. Before the count can carry into the
+// sum, a goroutine that sees it reach spillCount moves the word into the
+// wide sum and count. spills is odd while it does so.
+type atomicStats struct {
+	minMax     atomic.Uint64
+	sumCount   atomic.Uint64
+	spills     atomic.Uint64
+	sum, count atomic.Int64
+}
+
+const (
+	countBits  = 24
+	countMask  = 1<<countBits - 1
+	spillCount = 1 << (countBits - 1)
+)
+
+func packMinMax(lo, hi int32) uint64 {
+	return uint64(uint32(math.MaxInt32)-uint32(lo))<<32 | uint64(uint32(hi)^1<<31)
+}
+
+func unpackMinMax(v uint64) (lo, hi int32) {
+	return int32(uint32(math.MaxInt32) - uint32(v>>32)), int32(uint32(v) ^ 1<<31)
+}
+
+// add records a single reading. The range is widened before the reading is
+// counted, so that load never sees a mean outside of it.
+func (s *atomicStats) add(tenths int32) {
+	for {
+		old := s.minMax.Load()
+		lo, hi := unpackMinMax(old)
+		if tenths >= lo && tenths <= hi {
+			break
+		}
+		if s.minMax.CompareAndSwap(old, packMinMax(min(lo, tenths), max(hi, tenths))) {
+			break
+		}
+	}
+	if v := s.sumCount.Add(uint64(int64(tenths))<<countBits + 1); v&countMask >= spillCount {
+		s.spill()
+	}
+}
+
+// spill moves sumCount into the wide sum and count, unless another goroutine
+// is already doing so.
+func (s *atomicStats) spill() {
+	gen := s.spills.Load()
+	if gen%2 == 1 || !s.spills.CompareAndSwap(gen, gen+1) {
+		return
+	}
+	v := s.sumCount.Load()
+	s.sumCount.Add(-v)
+	s.sum.Add(int64(v) >> countBits)
+	s.count.Add(int64(v & countMask))
+	s.spills.Add(1)
+}
+
+// load returns the readings recorded so far. It never blocks writers and
+// only retries while a spill, once per few million readings, is underway.
+func (s *atomicStats) load() Stats {
+	for {
+		gen := s.spills.Load()
+		if gen%2 == 1 {
+			runtime.Gosched()
+			continue
+		}
+		// sumCount before minMax, which already covers every counted reading
+		v := s.sumCount.Load()
+		sum, count := s.sum.Load(), s.count.Load()
+		lo, hi := unpackMinMax(s.minMax.Load())
+		if s.spills.Load() != gen {
+			continue
+		}
+		st := Stats{Min: lo, Max: hi, Sum: sum + int64(v)>>countBits, Count: count + int64(v&countMask)}
+		if st.Count == 0 {
+			return Stats{}
+		}
+		return st
+	}
+}
+
+// Mean returns the mean reading in degrees, rounded to one fractional digit
+// the way the Java baseline does.
+func (s Stats) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return roundJava(float64(s.Sum)/float64(s.Count)) / 10
+}
+
+// String formats s as "min/mean/max" in degrees, matching the official output.
+func (s Stats) String() string {
+	return fmt.Sprintf("%.1f/%.1f/%.1f", float64(s.Min)/10, s.Mean(), float64(s.Max)/10)
+}
+
+// roundJava returns the closest integer to the argument, with ties
+// rounding to positive infinity, see java's Math.round
+func roundJava(x float64) float64 {
+	t := math.Floor(x + 0.5)
+	if t == 0 { // check -0
+		return 0
+	}
+	return t
+}
@@ -0,0 +1,68 @@
+package brc
+
+import (
+	"io"
+	"time"
+)
+
+// slowStorage makes the reads of a run behave as those of slower storage
+// for Config.SimulateReadLatency and Config.SimulateBandwidth: each read
+// waits the latency, reads in parallel overlapping as on a device with
+// queued requests, and takes its bytes from a throttle of the bandwidth
+// all reads share. A nil slowStorage reads at full speed.
+type slowStorage struct {
+	latency   time.Duration
+	bandwidth *throttle
+}
+
+func (c Config) newSlowStorage() *slowStorage {
+	if c.SimulateReadLatency <= 0 && c.SimulateBandwidth <= 0 {
+		return nil
+	}
+	return &slowStorage{latency: c.SimulateReadLatency, bandwidth: newRateThrottle(c.SimulateBandwidth)}
+}
+
+// read waits as long as reading n bytes takes.
+func (s *slowStorage) read(n int) {
+	if s == nil {
+		return
+	}
+	if s.latency > 0 {
+		time.Sleep(s.latency)
+	}
+	s.bandwidth.wait(n)
+}
+
+// reader returns r slowed down by s.
+func (s *slowStorage) reader(r io.Reader) io.Reader {
+	if s == nil {
+		return r
+	}
+	return &slowReader{r: r, s: s}
+}
+
+// readerAt returns r slowed down by s.
+func (s *slowStorage) readerAt(r io.ReaderAt) io.ReaderAt {
+	if s == nil {
+		return r
+	}
+	return &slowReader{ra: r, s: s}
+}
+
+type slowReader struct {
+	r  io.Reader
+	ra io.ReaderAt
+	s  *slowStorage
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.s.read(n)
+	return n, err
+}
+
+func (r *slowReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ra.ReadAt(p, off)
+	r.s.read(n)
+	return n, err
+}
@@ -0,0 +1,77 @@
+package brc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// ErrMalformed is returned, wrapped with the number of lines, when the input
+// of a run with Config.Strict has malformed lines.
+var ErrMalformed = errors.New("malformed lines")
+
+// checkMalformed returns ErrMalformed if c is strict and n is not zero.
+func (c Config) checkMalformed(n int64) error {
+	if c.Strict && n > 0 {
+		return fmt.Errorf("%d %w", n, ErrMalformed)
+	}
+	return nil
+}
+
+// parseChunkPairs is parseChunk with Config.Strict, for results without
+// per-line options. It finds the next two newlines up front and decodes both
+// lines with independent instructions, so the CPU overlaps the two. A pair of
+// which either line does not decode is left to parseLines, and so are the
+// last lines, for which fewer than 8 bytes follow the second newline.
+func parseChunkPairs(buf []byte, r *Result) (malformed int64) {
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		j := i + 1 + bytes.IndexByte(buf[i+1:], '\n')
+		if i < 0 || j <= i || len(buf) < j+8 {
+			break
+		}
+		a, b := buf[:i], buf[i+1:j]
+		sa, sb := bytes.IndexByte(a, ';'), bytes.IndexByte(b, ';')
+		if sa > 0 && sb > 0 {
+			ta, na, okA := decodeTenths(load64(buf, sa+1))
+			tb, nb, okB := decodeTenths(load64(buf, i+1+sb+1))
+			if okA && okB && na == len(a)-sa-1 && nb == len(b)-sb-1 {
+				r.stations.add(r.stations.slot(a[:sa]), ta)
+				r.stations.add(r.stations.slot(b[:sb]), tb)
+				buf = buf[j+1:]
+				continue
+			}
+		}
+		malformed += parseLines(buf[:j+1], r)
+		buf = buf[j+1:]
+	}
+	return malformed + parseLines(buf, r)
+}
+
+// decodeTenths decodes the reading at the start of w, the little endian word
+// of the 8 bytes after a semicolon, with a single multiply instead of a
+// branch per byte. The '.' is the first of bytes 1 to 3 with bit 4 clear,
+// which is set in digits; shifting the word by its position aligns the
+// digits for the multiply, which adds them up with their weights. A leading
+// '-' selects the negation; any other leading byte is checked as a digit.
+//
+// n is the length of the reading, ok reports whether its bytes are an
+// optional '-', one or two digits, a '.' and a digit.
+func decodeTenths(w uint64) (tenths int32, n int, ok bool) {
+	const lsb = 0x0101010101010101
+	// without a '.', the bit forced at byte 3 is taken for one and fails below
+	dot := bits.TrailingZeros64(^w&0x10101000 | 1<<28)
+	signed := int64(uint64(byte(w)^'-')-1) >> 63 // -1 with a leading '-', 0 otherwise
+	digits := (w &^ uint64(signed&0xff)) << (28 - dot) & 0x0f000f0f00
+	abs := int64((digits*0x640a0001)>>32) & 0x3ff
+
+	at := dot / 8 // the byte of the '.'
+	n = at + 2
+	mask := (uint64(1)<<(8*n) - 1) &^ (0xff << (8 * at)) &^ uint64(signed&0xff)
+	x := (w ^ lsb*'0') & mask
+	notDigit := ((x&(lsb*0x7f) + lsb*0x76) | x) & mask & (lsb * 0x80)
+	before := at + int(signed) // digits before the '.'
+	ok = w>>(8*at)&0xff == '.' && notDigit == 0 && before >= 1 && before <= 2
+	return int32((abs ^ signed) - signed), n, ok
+}
@@ -0,0 +1,258 @@
+package brc
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Summary describes a finished run. Set Config.Summary to have it filled by
+// ProcessFile or Process.
+type Summary struct {
+	// Workers is the number of parallel parsers used.
+	Workers int
+	// Bytes is the size of the input that was parsed.
+	Bytes int64
+	// Rows is the number of aggregated readings.
+	Rows int64
+	// Malformed is the number of skipped input lines.
+	Malformed int64
+	// Stations is the number of distinct stations.
+	Stations int
+	// CPUs is the CPU each worker was pinned to by Config.Affinity, -1 for
+	// workers that could not be pinned. It is nil if workers were not pinned.
+	CPUs []int
+	// Locked is how many bytes of the input Config.Mlock locked in memory.
+	Locked int64
+	// HugePages is how many bytes of the per-worker tables the kernel
+	// backed with huge pages with Config.HugePages.
+	HugePages int64
+	// Pipeline describes the rings of IOPipeline.
+	Pipeline PipelineStats
+	// Cached reports whether the result was served from Config.CacheDir.
+	Cached bool
+	// Phases lists the processing phases in the order they finished.
+	Phases []Phase
+	// GC describes the garbage collector during the run.
+	GC GCStats
+	// Usage is the resource usage of the process during the run, with its
+	// peak resident set size, see Rusage.
+	Usage Rusage
+
+	// usage is the resource usage at the end of the last phase.
+	usage Rusage
+}
+
+// Phase is the duration and resource usage of a processing phase, the
+// page faults of mapping the input being those of "parse".
+type Phase struct {
+	Name     string
+	Duration time.Duration
+	// Usage is the resource usage during the phase, with the peak resident
+	// set size at its end.
+	Usage Rusage
+}
+
+// PipelineStats describes the rings between the readers and the workers of
+// IOPipeline: how many there were of how many blocks, how often a reader
+// found a ring full, held back by the workers, and how often a worker found
+// all of its rings empty, starved by the readers.
+type PipelineStats struct {
+	Rings, RingSize int
+	Full, Empty     uint64
+}
+
+// GCStats describes the garbage collector settings and activity of a run.
+type GCStats struct {
+	// Percent is the GOGC value in effect, -1 if it is off.
+	Percent int
+	// MemoryLimit is the soft memory limit, math.MaxInt64 if there is none.
+	MemoryLimit int64
+	// DisabledDuringParse reports whether Config.DisableGC was set.
+	DisabledDuringParse bool
+	// Cycles is the number of completed collections during the run.
+	Cycles uint32
+	// Pause is the total stop-the-world pause time during the run.
+	Pause time.Duration
+	// Collection is the duration of the single collection that runs at the
+	// end when the collector was disabled during parsing.
+	Collection time.Duration
+	// HeapAlloc is the size of the live heap at the end of the run.
+	HeapAlloc uint64
+}
+
+// phase logs the end of a processing phase that began at start and records
+// it in cfg.Summary.
+func (c Config) phase(name string, start time.Time, args ...any) {
+	d := time.Since(start)
+	c.logger().Info("phase finished", append([]any{"phase", name, "duration", d}, args...)...)
+	if c.Summary != nil {
+		u := readRusage()
+		c.Summary.Phases = append(c.Summary.Phases, Phase{name, d, u.Sub(c.Summary.usage)})
+		c.Summary.usage = u
+	}
+}
+
+// lock records the bytes of the input Config.Mlock locked.
+func (s *Summary) lock(bytes int64) {
+	if s != nil {
+		s.Locked = bytes
+	}
+}
+
+// pipeline records the rings of IOPipeline.
+func (s *Summary) pipeline(rings, size int, full, empty uint64) {
+	if s != nil {
+		s.Pipeline = PipelineStats{rings, size, full, empty}
+	}
+}
+
+// hugePages logs whether the tables of the workers of a run got the huge
+// pages of Config.HugePages and records it in c.Summary.
+func (c Config) hugePages(results []*Result) {
+	if !c.HugePages {
+		return
+	}
+	var n int64
+	for _, r := range results {
+		if r != nil {
+			n += r.stations.arena.HugeBytes()
+		}
+	}
+	if n == 0 {
+		c.logger().Warn("huge pages not in effect, the tables are too small, are not presized by CardinalityHint or Dictionary, or the kernel declined")
+	} else {
+		c.logger().Info("tables on huge pages", "bytes", n)
+	}
+	if c.Summary != nil {
+		c.Summary.HugePages = n
+	}
+}
+
+// gcRun applies the GC policy of a Config for the duration of one run.
+type gcRun struct {
+	summary *Summary
+	disable bool
+	percent int
+	before  runtime.MemStats
+	usage   Rusage
+}
+
+// startGC disables the collector if cfg.DisableGC is set and takes the
+// baseline for the GC and resource statistics of cfg.Summary.
+func (c Config) startGC() *gcRun {
+	g := &gcRun{summary: c.Summary, disable: c.DisableGC}
+	if g.summary != nil {
+		runtime.ReadMemStats(&g.before)
+		g.summary.GC.Percent = gcPercent()
+		g.summary.GC.MemoryLimit = debug.SetMemoryLimit(-1)
+		g.summary.GC.DisabledDuringParse = g.disable
+		g.usage = readRusage()
+		g.summary.usage = g.usage
+	}
+	if g.disable {
+		g.percent = debug.SetGCPercent(-1)
+	}
+	return g
+}
+
+// finish restores the collector, running the single deferred collection, and
+// fills in the GC and resource statistics.
+func (g *gcRun) finish() {
+	if g.disable {
+		start := time.Now()
+		debug.SetGCPercent(g.percent)
+		runtime.GC()
+		if g.summary != nil {
+			g.summary.GC.Collection = time.Since(start)
+		}
+	}
+	if g.summary == nil {
+		return
+	}
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	g.summary.GC.Cycles = after.NumGC - g.before.NumGC
+	g.summary.GC.Pause = time.Duration(after.PauseTotalNs - g.before.PauseTotalNs)
+	g.summary.GC.HeapAlloc = after.HeapAlloc
+	g.summary.Usage = readRusage().Sub(g.usage)
+}
+
+// gcPercent returns the current GOGC value without changing it.
+func gcPercent() int {
+	p := debug.SetGCPercent(100)
+	debug.SetGCPercent(p)
+	return p
+}
+
+// fill records the totals of a finished run.
+func (s *Summary) fill(res *Result, placement []int, workers int, bytes, malformed int64) {
+	if s == nil {
+		return
+	}
+	s.CPUs = placement
+	s.Workers = workers
+	s.Bytes = bytes
+	s.Malformed = malformed
+	s.Rows = res.rows()
+	s.Stations = res.Len()
+}
+
+// WriteText writes s in a human readable form, one fact per line.
+func (s *Summary) WriteText(w io.Writer) error {
+	var b strings.Builder
+	if s.Cached {
+		fmt.Fprintf(&b, "result served from cache\n")
+	}
+	fmt.Fprintf(&b, "input     %d bytes, %d rows, %d malformed lines, %d stations, %d workers\n",
+		s.Bytes, s.Rows, s.Malformed, s.Stations, s.Workers)
+	if s.CPUs != nil {
+		fmt.Fprintf(&b, "cpus      %s\n", strings.Trim(fmt.Sprint(s.CPUs), "[]"))
+	}
+	if p := s.Pipeline; p.Rings > 0 {
+		fmt.Fprintf(&b, "rings     %d of %d blocks, full %d times, empty %d times\n", p.Rings, p.RingSize, p.Full, p.Empty)
+	}
+	if s.Locked > 0 {
+		fmt.Fprintf(&b, "locked    %d bytes of the input in memory\n", s.Locked)
+	}
+	if s.HugePages > 0 {
+		fmt.Fprintf(&b, "tables    %d bytes on huge pages\n", s.HugePages)
+	}
+	var total time.Duration
+	for _, p := range s.Phases {
+		fmt.Fprintf(&b, "%-9s %v", p.Name, p.Duration.Round(time.Microsecond))
+		if u := p.Usage; u.MajorFaults > 0 || u.MinorFaults > 0 {
+			fmt.Fprintf(&b, ", %d major and %d minor page faults", u.MajorFaults, u.MinorFaults)
+		}
+		b.WriteByte('\n')
+		total += p.Duration
+	}
+	if total > 0 && s.Bytes > 0 {
+		fmt.Fprintf(&b, "rate      %.1f MB/s\n", float64(s.Bytes)/total.Seconds()/1e6)
+	}
+
+	gc := s.GC
+	percent := "off"
+	if gc.Percent >= 0 {
+		percent = fmt.Sprint(gc.Percent)
+	}
+	limit := "none"
+	if gc.MemoryLimit != math.MaxInt64 {
+		limit = fmt.Sprintf("%d bytes", gc.MemoryLimit)
+	}
+	fmt.Fprintf(&b, "gc        GOGC=%s, memory limit %s, %d cycles, %v paused, heap %d bytes\n",
+		percent, limit, gc.Cycles, gc.Pause.Round(time.Microsecond), gc.HeapAlloc)
+	if gc.DisabledDuringParse {
+		fmt.Fprintf(&b, "gc        off during parse, final collection %v\n", gc.Collection.Round(time.Microsecond))
+	}
+	if u := s.Usage; u.MaxRSS > 0 {
+		fmt.Fprintf(&b, "rusage    max RSS %d bytes, %d major and %d minor page faults, %d voluntary and %d involuntary context switches\n",
+			u.MaxRSS, u.MajorFaults, u.MinorFaults, u.VoluntarySwitches, u.InvoluntarySwitches)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,244 @@
+package brc
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/djheidihoe/1brc/internal/hugepage"
+)
+
+// table holds the Stats of a Result as parallel columns indexed by slot, so
+// that the parse loop updates a few dense arrays and merging two tables walks
+// them in order instead of chasing a pointer per station. Slots are assigned
+// in insertion order and never removed.
+//
+// A new slot starts with the minimum at math.MaxInt32 and the maximum at
+// math.MinInt32, so adding a reading or merging a slot needs no check for an
+// empty one.
+//
+// The tables of the workers of a run share a dictionary, which makes their
+// slots the same station in every table and leaves empty slots for the
+// stations only other workers have seen. Merging them is then element-wise
+// over the columns, see mergeColumns.
+type table struct {
+	dict   *dictionary
+	slots  map[string]int32
+	names  []string
+	mins   []int32
+	maxs   []int32
+	sums   []int64
+	counts []int64
+	// arena holds the columns of hint stations with Config.HugePages,
+	// until t and its copies are unreachable.
+	arena *hugepage.Arena
+}
+
+// columnBytes is the size of a slot of the columns of a table.
+const columnBytes = 4 + 4 + 8 + 8
+
+func newTable(hint int) table {
+	return newArenaTable(hint, nil)
+}
+
+// newArenaTable returns a table whose columns are presized for hint
+// stations in arena, or on the heap if it is nil.
+func newArenaTable(hint int, arena *hugepage.Arena) table {
+	hint = max(hint, 0)
+	return table{
+		slots:  make(map[string]int32, hint),
+		names:  make([]string, 0, hint),
+		mins:   hugepage.Make[int32](arena, 0, hint),
+		maxs:   hugepage.Make[int32](arena, 0, hint),
+		sums:   hugepage.Make[int64](arena, 0, hint),
+		counts: hugepage.Make[int64](arena, 0, hint),
+		arena:  arena,
+	}
+}
+
+func (t *table) len() int {
+	if t.dict == nil {
+		return len(t.names)
+	}
+	n := 0
+	for _, c := range t.counts {
+		if c > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// lookup returns the slot of name.
+func (t *table) lookup(name string) (int, bool) {
+	i, ok := t.slots[name]
+	return int(i), ok
+}
+
+// slot returns the slot of name, adding an empty one if there is none.
+func (t *table) slot(name []byte) int {
+	// the string(name) conversion in a map index does not allocate
+	if i, ok := t.slots[string(name)]; ok {
+		return int(i)
+	}
+	return t.insert(string(name))
+}
+
+// insert adds an empty slot for name, which must not have one, and with a
+// dictionary those of the stations before it that t has not seen.
+func (t *table) insert(name string) int {
+	if t.dict == nil {
+		return t.appendSlot(name)
+	}
+	id, names := t.dict.id(name, len(t.names))
+	for _, name := range names {
+		t.appendSlot(name)
+	}
+	return id
+}
+
+func (t *table) appendSlot(name string) int {
+	i := len(t.names)
+	t.slots[name] = int32(i)
+	t.names = append(t.names, name)
+	t.mins = append(t.mins, math.MaxInt32)
+	t.maxs = append(t.maxs, math.MinInt32)
+	t.sums = append(t.sums, 0)
+	t.counts = append(t.counts, 0)
+	return i
+}
+
+// add records a single reading in slot i.
+func (t *table) add(i int, tenths int32) {
+	t.mins[i] = min(t.mins[i], tenths)
+	t.maxs[i] = max(t.maxs[i], tenths)
+	t.sums[i] += int64(tenths)
+	t.counts[i]++
+}
+
+// stats returns the aggregate of slot i.
+func (t *table) stats(i int) Stats {
+	if t.counts[i] == 0 {
+		return Stats{}
+	}
+	return Stats{Min: t.mins[i], Max: t.maxs[i], Sum: t.sums[i], Count: t.counts[i]}
+}
+
+// get returns the aggregate of name, the zero Stats if it has none.
+func (t *table) get(name string) Stats {
+	i, ok := t.lookup(name)
+	if !ok {
+		return Stats{}
+	}
+	return t.stats(i)
+}
+
+// mergeStats folds s into the aggregate of name.
+func (t *table) mergeStats(name string, s Stats) {
+	i, ok := t.lookup(name)
+	if !ok {
+		i = t.insert(name)
+	}
+	if s.Count == 0 {
+		return
+	}
+	t.mins[i] = min(t.mins[i], s.Min)
+	t.maxs[i] = max(t.maxs[i], s.Max)
+	t.sums[i] += s.Sum
+	t.counts[i] += s.Count
+}
+
+// merge folds every slot of o into t.
+func (t *table) merge(o *table) {
+	if t.dict != nil && t.dict == o.dict {
+		for len(t.names) < len(o.names) {
+			t.appendSlot(o.names[len(t.names)])
+		}
+		mergeColumns(t, o)
+		return
+	}
+	for j, name := range o.names {
+		i, ok := t.lookup(name)
+		if !ok {
+			i = t.insert(name)
+		}
+		t.mins[i] = min(t.mins[i], o.mins[j])
+		t.maxs[i] = max(t.maxs[i], o.maxs[j])
+		t.sums[i] += o.sums[j]
+		t.counts[i] += o.counts[j]
+	}
+}
+
+// concat appends the slots of o, none of whose stations t has, without
+// looking them up in t or combining any, as the partitions of
+// AggregatePartitioned are disjoint.
+func (t *table) concat(o *table) {
+	for _, name := range o.names {
+		t.slots[name] = int32(len(t.names))
+		t.names = append(t.names, name)
+	}
+	t.mins = append(t.mins, o.mins...)
+	t.maxs = append(t.maxs, o.maxs...)
+	t.sums = append(t.sums, o.sums...)
+	t.counts = append(t.counts, o.counts...)
+}
+
+// clone returns a deep copy of t, without the empty slots and dictionary of
+// a worker's table.
+func (t *table) clone() table {
+	if t.dict != nil {
+		c := newTable(t.len())
+		for i, name := range t.names {
+			if t.counts[i] > 0 {
+				c.mergeStats(name, t.stats(i))
+			}
+		}
+		return c
+	}
+	return table{
+		slots:  maps.Clone(t.slots),
+		names:  slices.Clone(t.names),
+		mins:   slices.Clone(t.mins),
+		maxs:   slices.Clone(t.maxs),
+		sums:   slices.Clone(t.sums),
+		counts: slices.Clone(t.counts),
+	}
+}
+
+// detach turns the merged table of a run into a standalone one.
+func (t *table) detach() {
+	if t.dict != nil && slices.Contains(t.counts, 0) {
+		*t = t.clone()
+	}
+	t.dict = nil
+}
+
+// dictionary assigns dense IDs to the station names of a run.
+type dictionary struct {
+	mu    sync.Mutex
+	ids   map[string]int32
+	names []string
+}
+
+func newDictionary(hint int) *dictionary {
+	return &dictionary{ids: make(map[string]int32, max(hint, 0))}
+}
+
+// id returns the ID of name, assigning the next one if it has none, and the
+// names of the IDs from from up to and including it.
+func (d *dictionary) id(name string, from int) (int, []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	id, ok := d.ids[name]
+	if !ok {
+		id = int32(len(d.names))
+		d.ids[name] = id
+		d.names = append(d.names, name)
+	}
+	if int(id) < from {
+		return int(id), nil
+	}
+	// names are never overwritten, so the slice stays valid after appends
+	return int(id), d.names[from : id+1]
+}
@@ -0,0 +1,73 @@
+package brc
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleBurst is how far ahead of the rate a run may read after idling.
+const throttleBurst = 100 * time.Millisecond
+
+// throttle paces the reads of a run to Config.MaxThroughput with a token
+// bucket shared by its workers. A read larger than the tokens left takes the
+// bucket into debt, which later reads wait for, so blocks of any size keep
+// the average rate. A nil throttle does not limit.
+type throttle struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (c Config) newThrottle() *throttle {
+	return newRateThrottle(c.MaxThroughput)
+}
+
+// newRateThrottle returns a throttle of bytesPerSecond, nil if it is not
+// positive.
+func newRateThrottle(bytesPerSecond int64) *throttle {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	burst := rate * throttleBurst.Seconds()
+	return &throttle{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait blocks until n more bytes may be read.
+func (t *throttle) wait(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	now := time.Now()
+	t.tokens = min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate) - float64(n)
+	t.last = now
+	var d time.Duration
+	if t.tokens < 0 {
+		d = time.Duration(-t.tokens / t.rate * float64(time.Second))
+	}
+	t.mu.Unlock()
+	time.Sleep(d)
+}
+
+// reader returns r paced by t.
+func (t *throttle) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &throttledReader{r, t}
+}
+
+type throttledReader struct {
+	r io.Reader
+	t *throttle
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.t.wait(n)
+	return n, err
+}
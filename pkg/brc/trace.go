@@ -0,0 +1,32 @@
+package brc
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/djheidihoe/1brc/pkg/brc"
+
+func (c Config) tracer() trace.Tracer {
+	if c.TracerProvider != nil {
+		return c.TracerProvider.Tracer(tracerName)
+	}
+	return noop.NewTracerProvider().Tracer(tracerName)
+}
+
+// startSpan starts a span for a processing phase, attrs describe its input.
+func (c Config) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return c.tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// rows returns the number of readings aggregated in r.
+func (r *Result) rows() int64 {
+	var n int64
+	for _, c := range r.stations.counts {
+		n += c
+	}
+	return n
+}
@@ -0,0 +1,83 @@
+package brc
+
+import (
+	"bytes"
+	"runtime"
+)
+
+// ParseLoop selects how workers turn their lines into aggregates.
+type ParseLoop string
+
+const (
+	// ParseFused parses and aggregates each line before reading the next.
+	ParseFused ParseLoop = "fused"
+	// ParseTwoStage scans a batch of lines into records of station, hash and
+	// reading first and aggregates the batch in a second loop, which touches
+	// the table group of the record a few places ahead so that its hash
+	// probe rarely waits for memory. It looks stations up in the SwissTable
+	// of MapSwiss whatever Map says, and falls back to the fused loop with
+	// per-line options or AggregateShared.
+	ParseTwoStage ParseLoop = "two-stage"
+)
+
+// twoStageBatch is the number of lines scanned before they are aggregated,
+// few enough for the records to stay in the L1 cache.
+const twoStageBatch = 256
+
+// prefetchDistance is how many records ahead of the lookup the aggregation
+// touches the table, enough to cover a cache miss.
+const prefetchDistance = 8
+
+// record is a line scanned by the first stage. The name is batch[start:end].
+type record struct {
+	hash       uint64
+	start, end int32
+	tenths     int32
+}
+
+// parseChunkTwoStage is parseChunk with ParseTwoStage, for results without
+// per-line options.
+func parseChunkTwoStage(buf []byte, r *Result) (malformed int64) {
+	records := make([]record, 0, twoStageBatch)
+	var touched uint64
+	for len(buf) > 0 {
+		// stage 1: scan lines into records, batch is where their names point
+		batch := buf
+		records = records[:0]
+		for len(records) < twoStageBatch && len(buf) > 0 {
+			start := int32(len(batch) - len(buf))
+			nl := bytes.IndexByte(buf, '\n')
+			var line []byte
+			if nl < 0 {
+				line, buf = buf, nil
+			} else {
+				line, buf = buf[:nl], buf[nl+1:]
+			}
+			if len(line) == 0 {
+				continue
+			}
+			name, tenths, ok := parseLine(line, ';')
+			if !ok {
+				malformed++
+				continue
+			}
+			records = append(records, record{r.index.Hash(name), start, start + int32(len(name)), tenths})
+		}
+
+		// stage 2: aggregate them
+		for i, rec := range records {
+			if i+prefetchDistance < len(records) {
+				touched ^= r.index.Touch(records[i+prefetchDistance].hash)
+			}
+			name := batch[rec.start:rec.end]
+			p, found := r.index.UpsertHash(name, rec.hash)
+			if !found {
+				*p = int32(r.stations.slot(name))
+			}
+			r.stations.add(int(*p), rec.tenths)
+		}
+	}
+	// the touched control words must be computed, so the loads are issued
+	runtime.KeepAlive(touched)
+	return malformed
+}
@@ -0,0 +1,374 @@
+package brc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/djheidihoe/1brc/internal/bufpool"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Window configures tumbling time window aggregation for lines like
+// "station;2024-03-01T12:34:56Z;12.3". Readings are grouped per station and
+// window, and results are keyed "station;<window start>" with the start in
+// RFC 3339 UTC, like the keys of GroupBy.
+type Window struct {
+	// Size is the window length, a whole number of seconds. 0 disables
+	// windows.
+	Size time.Duration
+	// Column is the timestamp field, defaults to 1, the first field after
+	// the station. Timestamps are RFC 3339 or Unix seconds.
+	Column int
+	// Lateness is how far past the end of a window readings may still
+	// arrive, defaults to Size.
+	Lateness time.Duration
+	// Emit, if set, receives every window, in order of their start, instead
+	// of the returned Result. Process (and ProcessFile with IOStream) emits
+	// a window as soon as the input has moved Lateness past its end, so
+	// memory stays bounded for time ordered streams. Readings arriving for
+	// an emitted window are dropped and counted as malformed. With IOMmap
+	// all windows are emitted at the end.
+	Emit func(start time.Time, r *Result) error
+}
+
+func (w Window) column() int {
+	if w.Column > 0 {
+		return w.Column
+	}
+	return 1
+}
+
+func (w Window) lateness() time.Duration {
+	if w.Lateness > 0 {
+		return w.Lateness
+	}
+	return w.Size
+}
+
+func (w Window) validate() error {
+	if w.Size != 0 && w.Size < time.Second {
+		return fmt.Errorf("window size %v is below a second", w.Size)
+	}
+	if w.Size%time.Second != 0 {
+		// the windows are of whole seconds, as are the timestamps
+		return fmt.Errorf("window size %v is not a whole number of seconds", w.Size)
+	}
+	if w.Size == 0 && w.Emit != nil {
+		return errors.New("window Emit set without a Size")
+	}
+	return nil
+}
+
+// windowParser maps the timestamps of a worker's lines to window keys.
+type windowParser struct {
+	size    int64 // seconds
+	column  int
+	maxTime int64 // latest timestamp seen, Unix seconds
+
+	// the key of the last window, consecutive lines mostly share it
+	last    int64
+	lastKey []byte
+}
+
+func newWindowParser(w Window) *windowParser {
+	if w.Size == 0 {
+		return nil
+	}
+	return &windowParser{size: int64(w.Size / time.Second), column: w.column(), maxTime: math.MinInt64, last: math.MinInt64}
+}
+
+// key returns the window key for a timestamp field.
+func (p *windowParser) key(field []byte) ([]byte, bool) {
+	t, ok := parseTimestamp(field)
+	if !ok {
+		return nil, false
+	}
+	p.maxTime = max(p.maxTime, t)
+	start := t - mod(t, p.size)
+	if start != p.last {
+		p.last = start
+		p.lastKey = time.Unix(start, 0).UTC().AppendFormat(p.lastKey[:0], time.RFC3339)
+	}
+	return p.lastKey, true
+}
+
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+// parseTimestamp parses Unix seconds or an RFC 3339 timestamp, which may use
+// a space instead of the T and omit the zone (meaning UTC), into Unix
+// seconds. Fractional seconds are dropped, fields out of their range, such
+// as a month 13 or a day 45, are invalid.
+func parseTimestamp(b []byte) (int64, bool) {
+	if len(b) > 0 && len(b) <= 18 && allDigits(b) {
+		var v int64
+		for _, c := range b {
+			v = v*10 + int64(c-'0')
+		}
+		return v, true
+	}
+
+	// 2006-01-02T15:04:05
+	if len(b) < 19 || b[4] != '-' || b[7] != '-' || (b[10] != 'T' && b[10] != ' ') || b[13] != ':' || b[16] != ':' {
+		return 0, false
+	}
+	var f [6]int
+	for i, pos := range [6]int{0, 5, 8, 11, 14, 17} {
+		n := 2
+		if i == 0 {
+			n = 4
+		}
+		if !allDigits(b[pos : pos+n]) {
+			return 0, false
+		}
+		for _, c := range b[pos : pos+n] {
+			f[i] = f[i]*10 + int(c-'0')
+		}
+	}
+	// time.Date would normalize a day 45 into the next month
+	date := time.Date(f[0], time.Month(f[1]), f[2], f[3], f[4], f[5], 0, time.UTC)
+	if int(date.Month()) != f[1] || date.Day() != f[2] || date.Hour() != f[3] || date.Minute() != f[4] || date.Second() != f[5] {
+		return 0, false
+	}
+	t := date.Unix()
+
+	rest := b[19:]
+	if len(rest) > 0 && rest[0] == '.' {
+		i := 1
+		for i < len(rest) && isDigit(rest[i]) {
+			i++
+		}
+		rest = rest[i:]
+	}
+	switch {
+	case len(rest) == 0, len(rest) == 1 && rest[0] == 'Z':
+	case len(rest) == 6 && (rest[0] == '+' || rest[0] == '-') && rest[3] == ':' && allDigits(rest[1:3]) && allDigits(rest[4:6]):
+		hours, minutes := int64((rest[1]-'0')*10+rest[2]-'0'), int64((rest[4]-'0')*10+rest[5]-'0')
+		if hours > 23 || minutes > 59 {
+			return 0, false
+		}
+		offset := hours*3600 + minutes*60
+		if rest[0] == '+' {
+			offset = -offset
+		}
+		t += offset
+	default:
+		return 0, false
+	}
+	return t, true
+}
+
+func allDigits(b []byte) bool {
+	for _, c := range b {
+		if !isDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// windowStart returns the start of the window of a key written by
+// windowParser.
+func windowStart(key string) (time.Time, error) {
+	return time.Parse(time.RFC3339, key)
+}
+
+// splitWindows splits a windowed result into one result per window start.
+func splitWindows(res *Result) (map[int64]*Result, error) {
+	windows := map[int64]*Result{}
+	starts := map[string]int64{}
+	for i, name := range res.stations.names {
+		_, key := SplitName(name)
+		start, ok := starts[key]
+		if !ok {
+			t, err := windowStart(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid window key %q: %w", key, err)
+			}
+			start = t.Unix()
+			starts[key] = start
+		}
+		w := windows[start]
+		if w == nil {
+			w = res.emptyLike()
+			windows[start] = w
+		}
+		w.mergeStation(name, name, res.stations.stats(i), res)
+	}
+	return windows, nil
+}
+
+// emitWindows hands the windows of res to emit in order.
+func emitWindows(res *Result, emit func(time.Time, *Result) error) error {
+	windows, err := splitWindows(res)
+	if err != nil {
+		return err
+	}
+	return emitClosed(windows, math.MaxInt64, emit)
+}
+
+// emitClosed emits and removes the windows starting before end, in order.
+func emitClosed(windows map[int64]*Result, end int64, emit func(time.Time, *Result) error) error {
+	var starts []int64
+	for start := range windows {
+		if start < end {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts {
+		w := windows[start]
+		delete(windows, start)
+		if err := emit(time.Unix(start, 0).UTC(), w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processWindowStream aggregates r like processStream but hands complete
+// windows to cfg.Window.Emit as the input progresses. Blocks are parsed in
+// parallel and merged back in input order, so a window is only emitted once
+// every earlier block is merged.
+func processWindowStream(ctx context.Context, r io.Reader, pos position, cfg Config) (*Result, error) {
+	log := cfg.logger()
+	start := time.Now()
+	_, span := cfg.startSpan(ctx, "parse windows", attribute.Int("block_size", cfg.blockSize()))
+	defer span.End()
+
+	type parsed struct {
+		seq       int
+		res       *Result
+		maxTime   int64
+		malformed int64
+	}
+
+	raw := make(chan block, cfg.workers())
+	blocks := make(chan block, cfg.workers())
+	results := make(chan parsed, cfg.workers())
+	// a slow block holds back the merge, tokens bound the blocks parsed
+	// ahead of it
+	tokens := make(chan struct{}, 2*cfg.workers())
+	go func() {
+		for b := range raw {
+			tokens <- struct{}{}
+			blocks <- b
+		}
+		close(blocks)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(cfg.workers())
+	for range cfg.workers() {
+		go func() {
+			defer wg.Done()
+			for b := range blocks {
+				res := cfg.newResult()
+				if res.opts.prov != nil {
+					res.opts.prov.position = b.position
+				}
+				malformed := parseChunk(b.data, res)
+				bufpool.Put(b.buf)
+				results <- parsed{b.seq, res, res.opts.window.maxTime, malformed}
+			}
+		}()
+	}
+
+	var n int64
+	var readErr error
+	go func() {
+		n, readErr = readBlocks(cfg.newThrottle().reader(cfg.newSlowStorage().reader(r)), cfg.blockSize(), pos, cfg.Provenance, cfg.newChaos(0), raw)
+		close(raw)
+		wg.Wait()
+		close(results)
+	}()
+
+	size := int64(cfg.Window.Size / time.Second)
+	lateness := int64(cfg.Window.lateness() / time.Second)
+	windows := map[int64]*Result{}
+	pending := map[int]parsed{}
+	next := 0
+	watermark := int64(math.MinInt64)
+	closed := int64(math.MinInt64) // windows starting before closed were emitted
+	var malformed, rows int64
+	var emitErr error
+	for p := range results {
+		pending[p.seq] = p
+		for {
+			q, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-tokens
+			malformed += q.malformed
+			if emitErr != nil {
+				continue // drain the workers
+			}
+
+			split, err := splitWindows(q.res)
+			if err != nil {
+				emitErr = err
+				continue
+			}
+			for start, w := range split {
+				if start < closed {
+					late := w.rows()
+					malformed += late
+					log.Warn("dropped late readings", "window", time.Unix(start, 0).UTC(), "rows", late)
+					continue
+				}
+				rows += w.rows()
+				if o := windows[start]; o != nil {
+					o.merge(w)
+				} else {
+					windows[start] = w
+				}
+			}
+
+			watermark = max(watermark, q.maxTime)
+			if watermark != math.MinInt64 {
+				// windows ending Lateness before the latest reading are complete
+				end := watermark - lateness - size + 1
+				if end > closed {
+					closed = end
+					emitErr = emitClosed(windows, closed, cfg.Window.Emit)
+				}
+			}
+		}
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if emitErr == nil {
+		emitErr = emitClosed(windows, math.MaxInt64, cfg.Window.Emit)
+	}
+	if emitErr != nil {
+		return nil, fmt.Errorf("emit window: %w", emitErr)
+	}
+
+	span.SetAttributes(attribute.Int64("bytes", n))
+	cfg.phase("parse", start, "bytes", n, "workers", cfg.workers())
+	if malformed > 0 {
+		log.Warn("skipped malformed lines", "lines", malformed)
+	}
+	if cfg.Summary != nil {
+		cfg.Summary.Workers = cfg.workers()
+		cfg.Summary.Bytes = n
+		cfg.Summary.Rows = rows
+		cfg.Summary.Malformed = malformed
+	}
+	return NewResult(), cfg.checkMalformed(malformed)
+}
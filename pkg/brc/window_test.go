@@ -0,0 +1,103 @@
+package brc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+		ok  bool
+	}{
+		{"1709287200", 1709287200, true},
+		{"2024-03-01T10:00:00Z", 1709287200, true},
+		{"2024-03-01T10:00:00", 1709287200, true},
+		{"2024-03-01 10:00:00.123456Z", 1709287200, true},
+		{"2024-03-01T12:30:00+02:30", 1709287200, true},
+		{"2024-03-01T08:00:00-02:00", 1709287200, true},
+		{"2024-03-01", 0, false},
+		{"2024-03-01T10:00:00CET", 0, false},
+		{"2024-02-29T10:00:00Z", 1709200800, true},
+		{"2023-02-29T10:00:00Z", 0, false},
+		{"2024-13-01T10:00:00Z", 0, false},
+		{"2024-00-01T10:00:00Z", 0, false},
+		{"2024-03-45T10:00:00Z", 0, false},
+		{"2024-03-00T10:00:00Z", 0, false},
+		{"2024-03-01T24:00:00Z", 0, false},
+		{"2024-03-01T10:60:00Z", 0, false},
+		{"2024-03-01T10:00:60Z", 0, false},
+		{"2024-03-01T10:00:00+24:00", 0, false},
+		{"2024-03-01T10:00:00+02:60", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		out, ok := parseTimestamp([]byte(test.in))
+		if out != test.out || ok != test.ok {
+			t.Errorf("Wrong timestamp for %q: expected %d %v, got %d %v", test.in, test.out, test.ok, out, ok)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	input := "a;2024-03-01T10:05:00Z;1.0\n" +
+		"b;2024-03-01T10:59:59Z;2.0\n" +
+		"a;2024-03-01T10:30:00Z;3.0\n" +
+		"a;2024-03-01T11:00:00Z;4.0\n" +
+		"a;2024-03-01T13:10:00Z;5.0\n" +
+		"a;2024-03-01T10:10:00Z;6.0\n" + // late, its window closed at 12:00
+		"a;yesterday;7.0\n"
+	cfg := Config{Window: Window{Size: time.Hour}}
+	res, err := Process(strings.NewReader(input), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.WriteTable(&out)
+	expected := "station;key;min;mean;max;count\n" +
+		"a;2024-03-01T10:00:00Z;1.0;3.3;6.0;3\n" +
+		"a;2024-03-01T11:00:00Z;4.0;4.0;4.0;1\n" +
+		"a;2024-03-01T13:00:00Z;5.0;5.0;5.0;1\n" +
+		"b;2024-03-01T10:00:00Z;2.0;2.0;2.0;1\n"
+	if out.String() != expected {
+		t.Errorf("Wrong output, expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	// one line per block, so windows close while reading
+	var emitted []string
+	var summary Summary
+	cfg.BlockSize = 16
+	cfg.Summary = &summary
+	cfg.Window.Emit = func(start time.Time, r *Result) error {
+		emitted = append(emitted, start.Format("15:04")+"="+strings.Join(r.Names(), ","))
+		return nil
+	}
+	res, err = Process(strings.NewReader(input), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Len() != 0 {
+		t.Errorf("Wrong result size with Emit: %d", res.Len())
+	}
+	if s := strings.Join(emitted, " "); s != "10:00=a;2024-03-01T10:00:00Z,b;2024-03-01T10:00:00Z 11:00=a;2024-03-01T11:00:00Z 13:00=a;2024-03-01T13:00:00Z" {
+		t.Errorf("Wrong emitted windows: %s", s)
+	}
+	if summary.Rows != 5 || summary.Malformed != 2 {
+		t.Errorf("Wrong rows %d and malformed %d, expected 5 and 2", summary.Rows, summary.Malformed)
+	}
+
+	if _, err := Process(strings.NewReader(input), Config{Window: Window{Size: time.Hour}, GroupBy: GroupBy{Column: 1}}); err == nil {
+		t.Errorf("Expected an error for GroupBy with Window")
+	}
+	for _, size := range []time.Duration{500 * time.Millisecond, 1500 * time.Millisecond, time.Minute + time.Nanosecond} {
+		if err := (Config{Window: Window{Size: size}}).Validate(); err == nil {
+			t.Errorf("Expected an error for windows of %v", size)
+		}
+	}
+	if err := (Config{Window: Window{Size: 90 * time.Second}}).Validate(); err != nil {
+		t.Errorf("Windows of 90s: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package brc
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/djheidihoe/1brc/internal/xlsx"
+)
+
+// WriteXLSX writes r as an Excel workbook with a Summary sheet of totals and
+// a Stations sheet of a row per name in the order of Names. The Stations
+// sheet has the extended statistics r has as extra columns: distinct counts
+// with Config.Distinct, standard deviations with Config.Moments and the
+// percentiles of WritePercentiles with Config.Percentiles or
+// Config.Frequencies. Rows are streamed, so memory does not grow with them.
+func (r *Result) WriteXLSX(w io.Writer) error {
+	var all Stats
+	hottest, coldest := "", ""
+	for name, s := range r.Sorted() {
+		if hottest == "" || s.Mean() > r.stations.get(hottest).Mean() {
+			hottest = name
+		}
+		if coldest == "" || s.Mean() < r.stations.get(coldest).Mean() {
+			coldest = name
+		}
+		if err := all.Merge(s); err != nil {
+			return err
+		}
+	}
+
+	x := xlsx.NewWriter(w)
+	x.Sheet("Summary")
+	x.Row("Stations", r.Len())
+	x.Row("Readings", all.Count)
+	if all.Count > 0 {
+		x.Row("Min", float64(all.Min)/10)
+		x.Row("Mean", all.Mean())
+		x.Row("Max", float64(all.Max)/10)
+		x.Row("Hottest", hottest, r.stations.get(hottest).Mean())
+		x.Row("Coldest", coldest, r.stations.get(coldest).Mean())
+	}
+
+	grouped := r.grouped
+	percentiles := r.sketches != nil || r.freqs != nil
+	header := []any{"Station"}
+	if grouped {
+		header = append(header, "Key")
+	}
+	header = append(header, "Min", "Mean", "Max", "Count")
+	if r.distinct != nil {
+		header = append(header, "Distinct")
+	}
+	if r.moments != nil {
+		header = append(header, "StdDev")
+	}
+	if percentiles {
+		for _, p := range reportedPercentiles {
+			header = append(header, "P"+strconv.FormatFloat(p, 'f', -1, 64))
+		}
+	}
+	x.Sheet("Stations")
+	x.Row(header...)
+	row := make([]any, 0, len(header))
+	for name, s := range r.Sorted() {
+		station, key := r.Split(name)
+		row = append(row[:0], station)
+		if grouped {
+			row = append(row, key)
+		}
+		row = append(row, float64(s.Min)/10, s.Mean(), float64(s.Max)/10, s.Count)
+		if r.distinct != nil {
+			if n, ok := r.Distinct(name); ok {
+				row = append(row, n)
+			} else {
+				row = append(row, nil)
+			}
+		}
+		if r.moments != nil {
+			if sd, ok := r.StdDev(name); ok {
+				row = append(row, sd)
+			} else {
+				row = append(row, nil)
+			}
+		}
+		if percentiles {
+			for _, p := range reportedPercentiles {
+				if v, ok := r.Percentile(name, p); ok {
+					row = append(row, v)
+				} else {
+					row = append(row, nil)
+				}
+			}
+		}
+		if err := x.Row(row...); err != nil {
+			return err
+		}
+	}
+	return x.Close()
+}
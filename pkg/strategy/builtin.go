@@ -0,0 +1,41 @@
+package strategy
+
+import "github.com/djheidihoe/1brc/pkg/brc"
+
+// ChunkedBlockSize is the read size of the chunked and pipeline strategies,
+// large enough for network filesystems to see long sequential reads.
+const ChunkedBlockSize = 16 << 20
+
+func init() {
+	for name, factory := range map[string]Factory{
+		"mmap": Configured("maps the input and splits it into a chunk per worker", func(c *brc.Config) {
+			c.IO = brc.IOMmap
+		}),
+		"stream": Configured("reads the input in order in blocks the workers take in turn", func(c *brc.Config) {
+			c.IO = brc.IOStream
+		}),
+		"chunked": Configured("stream in blocks of 16MB, long sequential reads for network filesystems", func(c *brc.Config) {
+			c.IO, c.BlockSize = brc.IOStream, ChunkedBlockSize
+		}),
+		"pipeline": Configured("reads blocks of 16MB with parallel reads at their offsets, overlapping the latency of slow storage", func(c *brc.Config) {
+			c.IO, c.BlockSize = brc.IOPipeline, ChunkedBlockSize
+		}),
+		"shared": Configured("mmap with a single table the workers share instead of one each to merge", func(c *brc.Config) {
+			c.IO, c.Aggregation = brc.IOMmap, brc.AggregateShared
+		}),
+		"partitioned": Configured("mmap routing each line to the worker owning its station, whose tables need no merge", func(c *brc.Config) {
+			c.IO, c.Aggregation = brc.IOMmap, brc.AggregatePartitioned
+		}),
+		"swiss": Configured("mmap with swiss tables instead of Go maps", func(c *brc.Config) {
+			c.IO, c.Map = brc.IOMmap, brc.MapSwiss
+		}),
+		"two-stage": Configured("mmap finding the lines of a block before parsing them", func(c *brc.Config) {
+			c.IO, c.Parse = brc.IOMmap, brc.ParseTwoStage
+		}),
+		"strict": Configured("mmap trusting the input to be well formed, failing on malformed lines", func(c *brc.Config) {
+			c.IO, c.Strict = brc.IOMmap, true
+		}),
+	} {
+		Register(name, factory)
+	}
+}
@@ -0,0 +1,151 @@
+// Package strategy is the registry of the strategies of onebrc: the ways of
+// processing a measurements file that run -strategy, bench and selftest pick
+// by name. A package registering a strategy in its init function adds it to
+// all three, and to onebrc strategies, once it is linked into the binary or
+// loaded as a plugin, see cmd/onebrc.
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// Strategy processes measurements files. Input from stdin is streamed by
+// brc.Process with the Config the strategy adjusted, whatever its
+// ProcessFile does.
+type Strategy interface {
+	// Configure adjusts the Config of a run to the strategy. Flags set on
+	// the command line of run override it.
+	Configure(cfg *brc.Config)
+	// ProcessFile aggregates the measurements file at path with cfg, as
+	// brc.ProcessFileContext does.
+	ProcessFile(ctx context.Context, path string, cfg brc.Config) (*brc.Result, error)
+}
+
+// Factory returns a new Strategy, once for each Lookup.
+type Factory func() Strategy
+
+// Describer is implemented by a Strategy that describes itself in a line
+// for onebrc strategies.
+type Describer interface {
+	Describe() string
+}
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register makes the strategy of factory available by name. It panics if
+// factory is nil, name is empty or auto, which picks one of the others, or a
+// strategy of that name is registered already.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	switch {
+	case factory == nil:
+		panic("strategy: Register factory is nil")
+	case name == "" || name == "auto":
+		panic(fmt.Sprintf("strategy: Register of reserved name %q", name))
+	}
+	if _, dup := factories[name]; dup {
+		panic("strategy: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// Lookup returns a new Strategy of the name, or false if none is registered.
+func Lookup(name string) (Strategy, bool) {
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
+
+// Names returns the names of the registered strategies, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Configured returns the Factory of a Strategy that adjusts the Config with
+// configure and leaves the processing to brc.ProcessFileContext, as the
+// strategies of onebrc do, described by doc.
+func Configured(doc string, configure func(cfg *brc.Config)) Factory {
+	return func() Strategy { return configured{doc, configure} }
+}
+
+type configured struct {
+	doc       string
+	configure func(*brc.Config)
+}
+
+func (s configured) Configure(cfg *brc.Config) { s.configure(cfg) }
+
+func (s configured) ProcessFile(ctx context.Context, path string, cfg brc.Config) (*brc.Result, error) {
+	return brc.ProcessFileContext(ctx, path, cfg)
+}
+
+func (s configured) Describe() string { return s.doc }
+
+// Capabilities are what a strategy supports.
+type Capabilities struct {
+	// Mmap reports whether the input is mapped into memory.
+	Mmap bool `json:"mmap"`
+	// Streaming reports whether the input is read in order, so that a pipe
+	// is processed as the file would be. The others fall back to streaming
+	// stdin.
+	Streaming bool `json:"streaming"`
+	// Windows reports whether the strategy runs on Windows, where files
+	// cannot be mapped.
+	Windows bool `json:"windows"`
+	// Compressed reports whether compressed input decompressed into a pipe,
+	// e.g. zcat measurements.txt.gz | onebrc run -strategy stream -, runs as
+	// the strategy does on a file. onebrc decompresses no text itself.
+	Compressed bool `json:"compressed"`
+	// BoundedMemory reports whether the memory for the input is a few
+	// blocks per worker, whatever its size, instead of the pages of all of
+	// it mapped.
+	BoundedMemory bool `json:"bounded_memory"`
+}
+
+// Capable is implemented by a Strategy that reports its Capabilities itself,
+// e.g. as its ProcessFile does not use the IO of the Config.
+type Capable interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns the Capabilities of s, those it reports if it is
+// Capable or else those of the IO of the Config it makes, so that they
+// cannot fall out of date with it.
+func CapabilitiesOf(s Strategy) Capabilities {
+	if c, ok := s.(Capable); ok {
+		return c.Capabilities()
+	}
+	var cfg brc.Config
+	s.Configure(&cfg)
+	io := cfg.IO
+	if io == "" {
+		io = brc.DefaultIO
+	}
+	return Capabilities{
+		Mmap:          io == brc.IOMmap,
+		Streaming:     io == brc.IOStream,
+		Windows:       io != brc.IOMmap,
+		Compressed:    io == brc.IOStream,
+		BoundedMemory: io != brc.IOMmap,
+	}
+}
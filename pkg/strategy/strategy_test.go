@@ -0,0 +1,77 @@
+package strategy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/djheidihoe/1brc/pkg/brc"
+)
+
+// counting processes the files with the stream backend and counts them.
+type counting struct{ files *int }
+
+func (s counting) Configure(cfg *brc.Config) { cfg.IO = brc.IOStream }
+
+func (s counting) ProcessFile(ctx context.Context, path string, cfg brc.Config) (*brc.Result, error) {
+	*s.files++
+	return brc.ProcessFileContext(ctx, path, cfg)
+}
+
+func TestRegister(t *testing.T) {
+	var files int
+	Register("test-counting", func() Strategy { return counting{&files} })
+	if !slices.Contains(Names(), "test-counting") || !slices.IsSorted(Names()) {
+		t.Fatalf("Names = %v", Names())
+	}
+	s, ok := Lookup("test-counting")
+	if !ok {
+		t.Fatal("Lookup found no test-counting")
+	}
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(path, []byte("a;1.0\nb;-2.5\na;3.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var cfg brc.Config
+	s.Configure(&cfg)
+	res, err := s.ProcessFile(context.Background(), path, cfg)
+	if err != nil || res.Len() != 2 || files != 1 {
+		t.Errorf("ProcessFile = %v, %v after %d files", res, err, files)
+	}
+	if c := CapabilitiesOf(s); !c.Streaming || c.Mmap {
+		t.Errorf("CapabilitiesOf = %+v", c)
+	}
+	if _, ok := Lookup("test-missing"); ok {
+		t.Error("Lookup found test-missing")
+	}
+
+	for _, name := range []string{"test-counting", "mmap", "auto", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%q) did not panic", name)
+				}
+			}()
+			Register(name, Configured("", func(*brc.Config) {}))
+		}()
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	for _, name := range []string{"mmap", "stream", "chunked", "pipeline", "shared", "partitioned", "swiss", "two-stage", "strict"} {
+		s, ok := Lookup(name)
+		if !ok {
+			t.Errorf("%s is not registered", name)
+			continue
+		}
+		if d, ok := s.(Describer); !ok || d.Describe() == "" {
+			t.Errorf("%s has no description", name)
+		}
+		c := CapabilitiesOf(s)
+		if c.Mmap == c.BoundedMemory {
+			t.Errorf("%s: %+v", name, c)
+		}
+	}
+}